@@ -0,0 +1,55 @@
+// Package main contains the entrypoint of the audit log verifier
+//
+// Module main.go verifies the hash chain of an audit log written by the
+// server, exiting with a non-zero status if it was tampered with
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsaudit"
+)
+
+// main program entrypoint
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s AUDIT_LOG\n       %s -files FILE...\n\n", os.Args[0], os.Args[0])
+		fmt.Fprintln(os.Stderr, "Verifies the hash chain of an audit log. Given the path of the current audit log,")
+		fmt.Fprintln(os.Stderr, "its rotated files are found and verified with it. With -files, exactly the given")
+		fmt.Fprintln(os.Stderr, "files are verified, which must be listed oldest first.")
+		flag.PrintDefaults()
+	}
+	explicitFiles := flag.Bool("files", false, "verify exactly the given files, oldest first")
+	flag.Parse()
+
+	var files []string
+	switch {
+	case *explicitFiles && flag.NArg() > 0:
+		files = flag.Args()
+	case !*explicitFiles && flag.NArg() == 1:
+		files = htsaudit.LogFiles(flag.Arg(0))
+		if len(files) == 0 {
+			fmt.Fprintf(os.Stderr, "no audit log found at %s\n", flag.Arg(0))
+			os.Exit(2)
+		}
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	verification, err := htsaudit.Verify(files)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAILED: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("OK: %d records verified across %d files\n", verification.Records, len(files))
+	if verification.Records > 0 {
+		fmt.Printf("records %d to %d, last hash %s\n", verification.FirstSequence, verification.LastSequence, verification.LastHash)
+	}
+	if verification.Anchor != "" {
+		fmt.Printf("earlier records were rotated out, so the chain is verified from hash %s\n", verification.Anchor)
+	}
+}
@@ -0,0 +1,129 @@
+// Package main contains the entrypoint of the local passport issuer
+//
+// Module main.go runs a passport broker and visa issuer for test deployments,
+// which signs passports carrying visas for the datasets it is given, and
+// prints the configuration a server needs to trust it
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport/passporttest"
+	"github.com/ga4gh/htsget-refserver/internal/htsutils"
+	"golang.org/x/crypto/ed25519"
+)
+
+// loadKey reads the signing key from the file holding its base64 encoded seed,
+// generating and writing a new key if the file does not exist
+func loadKey(path string) (ed25519.PrivateKey, error) {
+	encoded, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		seed := make([]byte, ed25519.SeedSize)
+		if _, err := rand.Read(seed); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, []byte(base64.StdEncoding.EncodeToString(seed)+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(encoded)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s does not hold a base64 encoded ed25519 seed", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// main program entrypoint
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s -datasets DATASET[,DATASET...] [flags]\n\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Runs a passport broker and visa issuer for test deployments. Passports are signed at")
+		fmt.Fprintln(os.Stderr, "/passport?sub=SUBJECT, carrying a visa for each dataset, or only for the datasets")
+		fmt.Fprintln(os.Stderr, "named by dataset parameters. The configuration the server needs to trust the issuer")
+		fmt.Fprintln(os.Stderr, "is printed on startup. Never run it alongside a production deployment.")
+		flag.PrintDefaults()
+	}
+	addr := flag.String("addr", "127.0.0.1:8090", "host and port to listen on")
+	keyFile := flag.String("key", "local-issuer.key", "file holding the signing key, generated if it does not exist")
+	audience := flag.String("audience", "htsget", "audience of the passports")
+	datasets := flag.String("datasets", "", "comma separated datasets the issuer grants")
+	lifetime := flag.Duration("lifetime", time.Hour, "time passports and visas are valid for")
+	flag.Parse()
+
+	if *datasets == "" || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	granted := strings.Split(*datasets, ",")
+
+	key, err := loadKey(*keyFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not load the signing key: %v\n", err)
+		os.Exit(1)
+	}
+	issuer, err := passporttest.NewLocalIssuerAt(*addr, key)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "could not start the issuer: %v\n", err)
+		os.Exit(1)
+	}
+	defer issuer.Close()
+
+	issuer.Handle("/passport", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		subject := request.URL.Query().Get("sub")
+		if subject == "" {
+			http.Error(writer, "a sub parameter is required", http.StatusBadRequest)
+			return
+		}
+		requested := request.URL.Query()["dataset"]
+		if len(requested) == 0 {
+			requested = granted
+		}
+
+		expiresAt := time.Now().Add(*lifetime)
+		visas := make([]map[string]interface{}, 0)
+		for _, dataset := range requested {
+			if !htsutils.IsItemInArray(dataset, granted) {
+				http.Error(writer, "the issuer does not grant dataset "+dataset, http.StatusForbidden)
+				return
+			}
+			visas = append(visas, issuer.CompactVisa(fmt.Sprintf("c:%s e:%d u:%s", dataset, expiresAt.Unix(), subject)))
+		}
+		passport, err := issuer.Passport(subject, *audience, expiresAt, visas...)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writer.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintln(writer, passport)
+	}))
+
+	config := map[string]interface{}{
+		"htsgetConfig": map[string]interface{}{
+			"passport":       map[string]interface{}{"brokers": []*htsconfig.PassportBroker{issuer.Broker(*audience)}},
+			"trustedIssuers": []*htsconfig.TrustedIssuer{issuer.TrustedIssuer(granted...)},
+		},
+	}
+	encoded, _ := json.MarshalIndent(config, "", "    ")
+	fmt.Printf("Local issuer %s granting %s\n\n", issuer.URL(), strings.Join(granted, ", "))
+	fmt.Printf("Trust it by adding to the server configuration:\n%s\n\n", encoded)
+	fmt.Printf("Get a passport with:\ncurl '%s/passport?sub=alice'\n", issuer.URL())
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	<-interrupt
+}
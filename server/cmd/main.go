@@ -4,8 +4,10 @@
 package main
 
 import (
+	"github.com/ga4gh/htsget-refserver/internal/htsaudit"
 	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
 	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+	"github.com/ga4gh/htsget-refserver/internal/htsquota"
 	"github.com/ga4gh/htsget-refserver/internal/htsserver"
 	"net/http"
 )
@@ -24,6 +26,16 @@ func main() {
 	// set up our global logging instance
 	log.Setup(htsconfig.GetLogFile(), htsconfig.GetLogLevel())
 
+	// a configured audit log must be writable before any ticket is decided
+	if _, err := htsaudit.GetAuditor(); err != nil {
+		panic(err.Error())
+	}
+
+	// nor may controlled tickets be issued while configured quotas cannot be enforced
+	if _, err := htsquota.GetQuotas(); err != nil {
+		panic(err.Error())
+	}
+
 	// load server routes
 	router, err := htsserver.SetRouter()
 	if err != nil {
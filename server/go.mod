@@ -13,12 +13,11 @@ require (
 	github.com/go-chi/jwtauth/v5 v5.0.1
 	github.com/google/go-intervals v0.0.2 // indirect
 	github.com/google/uuid v1.3.0
-	github.com/jwangsadinata/go-multimap v0.0.0-20190620162914-c29f3d7f33b6 // indirect
-	github.com/s12v/go-jwks v0.2.1
+	github.com/jwangsadinata/go-multimap v0.0.0-20190620162914-c29f3d7f33b6
 	github.com/sirupsen/logrus v1.8.1
-	github.com/square/go-jose v2.5.1+incompatible
 	github.com/stretchr/testify v1.7.0
-	github.com/xenitab/go-oidc-middleware v0.0.18 // indirect
+	go.etcd.io/bbolt v1.3.6
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+	gopkg.in/square/go-jose.v2 v2.3.1
 )
@@ -0,0 +1,131 @@
+// Package bai implements the BAI index of coordinate sorted BAM files.
+//
+// A BAI index only numbers the references of a BAM file, so the names of the
+// references, as given by the @SQ lines of the BAM header, are set on the
+// index once the header has been read.
+package bai
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ga4gh/htsget-refserver/internal/bgzf"
+	"github.com/ga4gh/htsget-refserver/internal/bgzf/index"
+	"github.com/ga4gh/htsget-refserver/internal/internal"
+)
+
+// Index is a BAI index.
+type Index struct {
+	refNames []string
+	nameMap  map[string]int
+
+	idx internal.Index
+}
+
+// NumRefs returns the number of references in the index.
+func (i *Index) NumRefs() int {
+	return len(i.idx.Refs)
+}
+
+// SetNames names the references of the index, in the order of the @SQ lines
+// of the BAM header.
+func (i *Index) SetNames(names []string) error {
+	if len(names) != len(i.idx.Refs) {
+		return fmt.Errorf("bai: name count mismatch: %d != %d", len(names), len(i.idx.Refs))
+	}
+	i.refNames = names
+	i.nameMap = make(map[string]int)
+	for id, name := range names {
+		i.nameMap[name] = id
+	}
+	return nil
+}
+
+// Names returns the reference names set on the index. The returned
+// slice should not be altered.
+func (i *Index) Names() []string {
+	return i.refNames
+}
+
+// ReferenceStats returns the index statistics for the given reference and true
+// if the statistics are valid.
+func (i *Index) ReferenceStats(id int) (stats index.ReferenceStats, ok bool) {
+	s := i.idx.Refs[id].Stats
+	if s == nil {
+		return index.ReferenceStats{}, false
+	}
+	return index.ReferenceStats(*s), true
+}
+
+// Unmapped returns the number of unplaced unmapped reads and true if the count
+// is valid.
+func (i *Index) Unmapped() (n uint64, ok bool) {
+	if i.idx.Unmapped == nil {
+		return 0, false
+	}
+	return *i.idx.Unmapped, true
+}
+
+// Chunks returns a []bgzf.Chunk that corresponds to the given genomic interval.
+func (i *Index) Chunks(ref string, beg, end int) ([]bgzf.Chunk, error) {
+	id, ok := i.nameMap[ref]
+	if !ok {
+		return nil, index.ErrNoReference
+	}
+	chunks, err := i.idx.Chunks(id, beg, end)
+	if err != nil {
+		return nil, err
+	}
+	return index.Adjacent(chunks), nil
+}
+
+// UnplacedOffset returns the offset of the block the unplaced unmapped reads
+// start in, which follow the reads placed on every reference, and true if any
+// reads are placed.
+func (i *Index) UnplacedOffset() (int64, bool) {
+	var last int64
+	placed := false
+	for _, ref := range i.idx.Refs {
+		for _, bin := range ref.Bins {
+			for _, c := range bin.Chunks {
+				if !placed || c.End.File > last {
+					last = c.End.File
+					placed = true
+				}
+			}
+		}
+	}
+	return last, placed
+}
+
+var baiMagic = [4]byte{'B', 'A', 'I', 0x1}
+
+// ReadFrom reads the BAI index from the given io.Reader. Unlike tabix, a BAI
+// index is not compressed.
+func ReadFrom(r io.Reader) (*Index, error) {
+	var (
+		idx   Index
+		magic [4]byte
+		err   error
+	)
+	err = binary.Read(r, binary.LittleEndian, &magic)
+	if err != nil {
+		return nil, err
+	}
+	if magic != baiMagic {
+		return nil, errors.New("bai: magic number mismatch")
+	}
+
+	var n int32
+	err = binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return nil, err
+	}
+	idx.idx, err = internal.ReadIndex(r, n, "bai")
+	if err != nil {
+		return nil, err
+	}
+	return &idx, nil
+}
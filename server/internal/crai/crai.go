@@ -0,0 +1,230 @@
+// Package crai implements the CRAI index of coordinate sorted CRAM files.
+//
+// A CRAI index is a gzip compressed text file with a line for each slice of a
+// CRAM file, giving the reference the slice is placed on, the span of its
+// alignments and the offset of the container holding it. As the slices of a
+// container are only decoded with its compression header, the blocks of a
+// CRAM file are its containers: each chunk of the index begins and ends at
+// the offset of a container, with no offset within it.
+//
+// Like BAI, a CRAI index only numbers the references of a CRAM file, so the
+// names of the references, as given by the @SQ lines of the CRAM header, are
+// set on the index once the header has been read.
+package crai
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ga4gh/htsget-refserver/internal/bgzf"
+	"github.com/ga4gh/htsget-refserver/internal/bgzf/index"
+)
+
+// Unplaced is the reference id of slices holding unplaced unmapped reads.
+const Unplaced = -1
+
+// Entry is a line of a CRAI index, i.e. a slice of a CRAM file.
+type Entry struct {
+	// RefID is the reference the slice is placed on, or Unplaced.
+	RefID int
+
+	// Start is the 1-based position of the first alignment of the slice,
+	// and Span the number of bases its alignments span from there.
+	Start int
+	Span  int
+
+	// ContainerOffset is the offset of the container holding the slice
+	// from the start of the file, SliceOffset the offset of the slice from
+	// the end of the container header, and SliceSize the size of the slice.
+	ContainerOffset int64
+	SliceOffset     int64
+	SliceSize       int64
+}
+
+// overlaps returns whether the alignments of the slice overlap the given
+// zero-based, half-open interval.
+func (e Entry) overlaps(beg, end int) bool {
+	return e.Start-1 < end && e.Start-1+e.Span > beg
+}
+
+// Index is a CRAI index.
+type Index struct {
+	refNames []string
+	nameMap  map[string]int
+
+	entries    []Entry
+	containers []int64
+}
+
+// NumRefs returns the number of references that slices of the index are
+// placed on, i.e. one past the highest reference id.
+func (i *Index) NumRefs() int {
+	n := 0
+	for _, e := range i.entries {
+		if e.RefID >= n {
+			n = e.RefID + 1
+		}
+	}
+	return n
+}
+
+// Entries returns the lines of the index, in the order of the file. The
+// returned slice should not be altered.
+func (i *Index) Entries() []Entry {
+	return i.entries
+}
+
+// SetNames names the references of the index, in the order of the @SQ lines
+// of the CRAM header. A header may name references that no slice is placed
+// on, but not fewer references than the index numbers.
+func (i *Index) SetNames(names []string) error {
+	if n := i.NumRefs(); len(names) < n {
+		return fmt.Errorf("crai: name count mismatch: %d < %d", len(names), n)
+	}
+	i.refNames = names
+	i.nameMap = make(map[string]int)
+	for id, name := range names {
+		i.nameMap[name] = id
+	}
+	return nil
+}
+
+// Names returns the reference names set on the index. The returned
+// slice should not be altered.
+func (i *Index) Names() []string {
+	return i.refNames
+}
+
+// Chunks returns a []bgzf.Chunk for each container holding a slice that
+// overlaps the given genomic interval, in the order of the file.
+func (i *Index) Chunks(ref string, beg, end int) ([]bgzf.Chunk, error) {
+	id, ok := i.nameMap[ref]
+	if !ok {
+		return nil, index.ErrNoReference
+	}
+	if beg < 0 || end <= beg {
+		return nil, index.ErrInvalid
+	}
+
+	var chunks []bgzf.Chunk
+	seen := make(map[int64]bool)
+	for _, e := range i.entries {
+		if e.RefID != id || !e.overlaps(beg, end) || seen[e.ContainerOffset] {
+			continue
+		}
+		seen[e.ContainerOffset] = true
+		offset := bgzf.Offset{File: e.ContainerOffset}
+		chunks = append(chunks, bgzf.Chunk{Begin: offset, End: offset})
+	}
+	sort.Slice(chunks, func(a, b int) bool {
+		return chunks[a].Begin.File < chunks[b].Begin.File
+	})
+	return chunks, nil
+}
+
+// ChunksWithNext returns a []bgzf.Chunk for each container holding a slice
+// that overlaps the given genomic interval, along with the offset of the
+// container that follows the last of them, or zero if there is none.
+func (i *Index) ChunksWithNext(ref string, beg, end int) ([]bgzf.Chunk, int64, error) {
+	chunks, err := i.Chunks(ref, beg, end)
+	if err != nil || len(chunks) == 0 {
+		return chunks, 0, err
+	}
+	return chunks, i.nextContainer(chunks[len(chunks)-1].Begin.File), nil
+}
+
+// nextContainer returns the offset of the container that follows the
+// container at the given offset, or zero if there is none.
+func (i *Index) nextContainer(offset int64) int64 {
+	n := sort.Search(len(i.containers), func(c int) bool {
+		return i.containers[c] > offset
+	})
+	if n == len(i.containers) {
+		return 0
+	}
+	return i.containers[n]
+}
+
+// UnplacedOffset returns the offset of the first container holding unplaced
+// unmapped reads, which follow the reads placed on every reference, and true
+// if there is one.
+func (i *Index) UnplacedOffset() (int64, bool) {
+	var first int64
+	found := false
+	for _, e := range i.entries {
+		if e.RefID == Unplaced && (!found || e.ContainerOffset < first) {
+			first = e.ContainerOffset
+			found = true
+		}
+	}
+	return first, found
+}
+
+// ReadFrom reads the CRAI index from the given io.Reader. As for tabix, the
+// reader must decompress the index.
+func ReadFrom(r io.Reader) (*Index, error) {
+	var idx Index
+	seen := make(map[int64]bool)
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		e, err := parseEntry(text)
+		if err != nil {
+			return nil, fmt.Errorf("crai: line %d: %v", line, err)
+		}
+		idx.entries = append(idx.entries, e)
+		if !seen[e.ContainerOffset] {
+			seen[e.ContainerOffset] = true
+			idx.containers = append(idx.containers, e.ContainerOffset)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(idx.entries) == 0 {
+		return nil, errors.New("crai: index holds no slices")
+	}
+	sort.Slice(idx.containers, func(a, b int) bool {
+		return idx.containers[a] < idx.containers[b]
+	})
+	return &idx, nil
+}
+
+// parseEntry parses a line of a CRAI index, made up of six tab separated
+// integers.
+func parseEntry(text string) (Entry, error) {
+	fields := strings.Split(text, "\t")
+	if len(fields) != 6 {
+		return Entry{}, fmt.Errorf("%d fields, not 6", len(fields))
+	}
+	var values [6]int64
+	for f, field := range fields {
+		v, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return Entry{}, err
+		}
+		values[f] = v
+	}
+	if values[3] < 0 {
+		return Entry{}, errors.New("negative container offset")
+	}
+	return Entry{
+		RefID:           int(values[0]),
+		Start:           int(values[1]),
+		Span:            int(values[2]),
+		ContainerOffset: values[3],
+		SliceOffset:     values[4],
+		SliceSize:       values[5],
+	}, nil
+}
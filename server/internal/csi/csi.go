@@ -0,0 +1,448 @@
+// Package csi implements the coordinate sorted index (CSI) of BGZF compressed
+// files, e.g. as written by bcftools index or samtools index -c.
+//
+// Unlike tabix and BAI, the binning of a CSI index is configured by its
+// min_shift and depth, so it can index references longer than 512 Mbp. An
+// index of a VCF holds a tabix-like header naming its references in its
+// auxiliary data. An index of a BAM or BCF file does not, so the names of its
+// references are set on the index once the header of the file has been read.
+package csi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ga4gh/htsget-refserver/internal/bgzf"
+	"github.com/ga4gh/htsget-refserver/internal/bgzf/index"
+)
+
+// Index is a CSI index.
+type Index struct {
+	minShift int
+	depth    int
+
+	aux       []byte
+	hasConfig bool
+
+	format      int32
+	zeroBased   bool
+	nameColumn  int32
+	beginColumn int32
+	endColumn   int32
+	metaChar    rune
+	skip        int32
+
+	refNames []string
+	nameMap  map[string]int
+
+	refs     []refIndex
+	unmapped *uint64
+}
+
+// refIndex is the index of a single reference.
+type refIndex struct {
+	bins  []bin
+	stats *index.ReferenceStats
+}
+
+// bin is an index bin, along with the offset of the first record in or after
+// it, which CSI uses in place of the linear index of tabix and BAI.
+type bin struct {
+	bin    uint32
+	left   bgzf.Offset
+	chunks []bgzf.Chunk
+}
+
+// MinShift returns the number of bits the smallest bins of the index span.
+func (i *Index) MinShift() int {
+	return i.minShift
+}
+
+// Depth returns the number of levels of bins of the index below the root.
+func (i *Index) Depth() int {
+	return i.depth
+}
+
+// Auxilliary returns the auxiliary data of the index. The returned slice
+// should not be altered.
+func (i *Index) Auxilliary() []byte {
+	return i.aux
+}
+
+// NumRefs returns the number of references in the index.
+func (i *Index) NumRefs() int {
+	return len(i.refs)
+}
+
+// Format returns the tabix format of the indexed file given in the auxiliary
+// data, 0 for generic, 1 for SAM and 2 for VCF.
+func (i *Index) Format() byte {
+	return byte(i.format)
+}
+
+// ZeroBased returns whether the coordinates of the indexed file are zero based.
+func (i *Index) ZeroBased() bool {
+	return i.zeroBased
+}
+
+// NameColumn returns the column of the indexed file holding reference names.
+func (i *Index) NameColumn() int {
+	return int(i.nameColumn)
+}
+
+// BeginColumn returns the column of the indexed file holding start positions.
+func (i *Index) BeginColumn() int {
+	return int(i.beginColumn)
+}
+
+// EndColumn returns the column of the indexed file holding end positions.
+func (i *Index) EndColumn() int {
+	return int(i.endColumn)
+}
+
+// MetaChar returns the character header lines of the indexed file start with.
+func (i *Index) MetaChar() rune {
+	return i.metaChar
+}
+
+// Skip returns the number of lines skipped at the start of the indexed file.
+func (i *Index) Skip() int {
+	return int(i.skip)
+}
+
+// Names returns the reference names in the index. The returned
+// slice should not be altered.
+func (i *Index) Names() []string {
+	return i.refNames
+}
+
+// HasNames returns whether the references of the index are named, either by
+// its auxiliary data or by SetNames.
+func (i *Index) HasNames() bool {
+	return i.nameMap != nil
+}
+
+// SetNames names the references of the index, in the order of the header of
+// the indexed file.
+func (i *Index) SetNames(names []string) error {
+	if len(names) != len(i.refs) {
+		return fmt.Errorf("csi: name count mismatch: %d != %d", len(names), len(i.refs))
+	}
+	i.refNames = names
+	i.nameMap = make(map[string]int)
+	for id, name := range names {
+		i.nameMap[name] = id
+	}
+	return nil
+}
+
+// ReferenceStats returns the index statistics for the given reference and true
+// if the statistics are valid.
+func (i *Index) ReferenceStats(id int) (stats index.ReferenceStats, ok bool) {
+	s := i.refs[id].stats
+	if s == nil {
+		return index.ReferenceStats{}, false
+	}
+	return *s, true
+}
+
+// Unmapped returns the number of unplaced unmapped records and true if the
+// count is valid.
+func (i *Index) Unmapped() (n uint64, ok bool) {
+	if i.unmapped == nil {
+		return 0, false
+	}
+	return *i.unmapped, true
+}
+
+// maxPos returns the first position beyond those the index can hold.
+func (i *Index) maxPos() int {
+	return 1 << uint(i.minShift+3*i.depth)
+}
+
+// binFirst returns the number of the first bin of a level.
+func binFirst(level int) uint32 {
+	return uint32(((1 << uint(3*level)) - 1) / 7)
+}
+
+// statsBin returns the number of the pseudo-bin holding reference statistics.
+func (i *Index) statsBin() uint32 {
+	return binFirst(i.depth+1) + 1
+}
+
+// overlappingBins returns the bins that may hold records overlapping the
+// zero based half open interval [beg, end).
+func (i *Index) overlappingBins(beg, end int) []uint32 {
+	end--
+	if end < beg {
+		end = beg
+	}
+	var bins []uint32
+	shift := uint(i.minShift + 3*i.depth)
+	for level := 0; level <= i.depth; level++ {
+		first := binFirst(level)
+		for b := first + uint32(beg>>shift); b <= first+uint32(end>>shift); b++ {
+			bins = append(bins, b)
+		}
+		shift -= 3
+	}
+	return bins
+}
+
+// findBin returns the bin of a reference with the given number, or nil.
+func (r *refIndex) findBin(b uint32) *bin {
+	n := sort.Search(len(r.bins), func(i int) bool { return r.bins[i].bin >= b })
+	if n < len(r.bins) && r.bins[n].bin == b {
+		return &r.bins[n]
+	}
+	return nil
+}
+
+// Chunks returns a []bgzf.Chunk that corresponds to the given genomic interval.
+func (i *Index) Chunks(ref string, beg, end int) ([]bgzf.Chunk, error) {
+	id, ok := i.nameMap[ref]
+	if !ok {
+		return nil, index.ErrNoReference
+	}
+	if beg < 0 {
+		beg = 0
+	}
+	if beg >= i.maxPos() {
+		return nil, index.ErrInvalid
+	}
+	if end > i.maxPos() {
+		end = i.maxPos()
+	}
+	r := &i.refs[id]
+
+	// the records overlapping the interval start no earlier than the left offset of
+	// the smallest bin holding its start that is in the index
+	var minOffset bgzf.Offset
+	for b := binFirst(i.depth) + uint32(beg>>uint(i.minShift)); ; b = (b - 1) >> 3 {
+		if found := r.findBin(b); found != nil {
+			minOffset = found.left
+			break
+		}
+		if b == 0 {
+			break
+		}
+	}
+
+	var chunks []bgzf.Chunk
+	for _, b := range i.overlappingBins(beg, end) {
+		found := r.findBin(b)
+		if found == nil {
+			continue
+		}
+		for _, c := range found.chunks {
+			if vOffset(c.End) > vOffset(minOffset) {
+				chunks = append(chunks, c)
+			}
+		}
+	}
+	sort.Slice(chunks, func(a, b int) bool { return vOffset(chunks[a].Begin) < vOffset(chunks[b].Begin) })
+	return index.Adjacent(chunks), nil
+}
+
+// UnplacedOffset returns the offset of the block the unplaced unmapped records
+// start in, which follow the records placed on every reference, and true if
+// any records are placed.
+func (i *Index) UnplacedOffset() (int64, bool) {
+	var last int64
+	placed := false
+	for _, ref := range i.refs {
+		for _, b := range ref.bins {
+			for _, c := range b.chunks {
+				if !placed || c.End.File > last {
+					last = c.End.File
+					placed = true
+				}
+			}
+		}
+	}
+	return last, placed
+}
+
+func makeOffset(vOff uint64) bgzf.Offset {
+	return bgzf.Offset{
+		File:  int64(vOff >> 16),
+		Block: uint16(vOff),
+	}
+}
+
+func vOffset(o bgzf.Offset) int64 {
+	return o.File<<16 | int64(o.Block)
+}
+
+var csiMagic = [4]byte{'C', 'S', 'I', 0x1}
+
+// ReadFrom reads the CSI index from the given io.Reader. Note that the CSI
+// specification states that the index is stored as BGZF, but ReadFrom does
+// not perform decompression.
+func ReadFrom(r io.Reader) (*Index, error) {
+	var (
+		idx   Index
+		magic [4]byte
+		err   error
+	)
+	err = binary.Read(r, binary.LittleEndian, &magic)
+	if err != nil {
+		return nil, err
+	}
+	if magic != csiMagic {
+		return nil, errors.New("csi: magic number mismatch")
+	}
+
+	var minShift, depth, nAux int32
+	err = binary.Read(r, binary.LittleEndian, &minShift)
+	if err != nil {
+		return nil, fmt.Errorf("csi: failed to read min_shift: %v", err)
+	}
+	err = binary.Read(r, binary.LittleEndian, &depth)
+	if err != nil {
+		return nil, fmt.Errorf("csi: failed to read depth: %v", err)
+	}
+	if minShift < 0 || depth < 0 || minShift+3*depth > 62 {
+		return nil, fmt.Errorf("csi: invalid min_shift %d and depth %d", minShift, depth)
+	}
+	idx.minShift, idx.depth = int(minShift), int(depth)
+
+	err = binary.Read(r, binary.LittleEndian, &nAux)
+	if err != nil {
+		return nil, fmt.Errorf("csi: failed to read auxiliary data length: %v", err)
+	}
+	if nAux < 0 {
+		return nil, fmt.Errorf("csi: invalid auxiliary data length %d", nAux)
+	}
+	idx.aux = make([]byte, nAux)
+	_, err = io.ReadFull(r, idx.aux)
+	if err != nil {
+		return nil, fmt.Errorf("csi: failed to read auxiliary data: %v", err)
+	}
+	err = idx.readConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	var n int32
+	err = binary.Read(r, binary.LittleEndian, &n)
+	if err != nil {
+		return nil, fmt.Errorf("csi: failed to read reference count: %v", err)
+	}
+	idx.refs = make([]refIndex, n)
+	for id := range idx.refs {
+		err = idx.readRef(r, &idx.refs[id])
+		if err != nil {
+			return nil, err
+		}
+	}
+	if idx.hasConfig && len(idx.refNames) != int(n) {
+		return nil, fmt.Errorf("csi: name count mismatch: %d != %d", len(idx.refNames), n)
+	}
+
+	var nUnmapped uint64
+	err = binary.Read(r, binary.LittleEndian, &nUnmapped)
+	if err == nil {
+		idx.unmapped = &nUnmapped
+	} else if err != io.EOF {
+		return nil, err
+	}
+	return &idx, nil
+}
+
+// readConfig reads the tabix-like header held in the auxiliary data of the
+// index of a VCF or other text file, if there is one.
+func (i *Index) readConfig() error {
+	const configSize = 7 * 4
+	if len(i.aux) < configSize {
+		return nil
+	}
+	var config [7]int32
+	for n := range config {
+		config[n] = int32(binary.LittleEndian.Uint32(i.aux[n*4:]))
+	}
+	if int(config[6]) != len(i.aux)-configSize {
+		return nil
+	}
+	i.hasConfig = true
+	i.format = config[0]
+	i.zeroBased = config[0]&0x10000 != 0
+	i.nameColumn, i.beginColumn, i.endColumn = config[1], config[2], config[3]
+	i.metaChar = rune(config[4])
+	i.skip = config[5]
+
+	names := string(i.aux[configSize:])
+	if names == "" {
+		return nil
+	}
+	if names[len(names)-1] != 0 {
+		return errors.New("csi: last name not zero-terminated")
+	}
+	i.refNames = strings.Split(names[:len(names)-1], string(rune(0)))
+	i.nameMap = make(map[string]int)
+	for id, name := range i.refNames {
+		i.nameMap[name] = id
+	}
+	return nil
+}
+
+// readRef reads the bins of a single reference.
+func (i *Index) readRef(r io.Reader, ref *refIndex) error {
+	var nBins int32
+	err := binary.Read(r, binary.LittleEndian, &nBins)
+	if err != nil {
+		return fmt.Errorf("csi: failed to read bin count: %v", err)
+	}
+	for n := int32(0); n < nBins; n++ {
+		var (
+			b      uint32
+			left   uint64
+			nChunk int32
+		)
+		err = binary.Read(r, binary.LittleEndian, &b)
+		if err != nil {
+			return fmt.Errorf("csi: failed to read bin number: %v", err)
+		}
+		err = binary.Read(r, binary.LittleEndian, &left)
+		if err != nil {
+			return fmt.Errorf("csi: failed to read bin left offset: %v", err)
+		}
+		err = binary.Read(r, binary.LittleEndian, &nChunk)
+		if err != nil {
+			return fmt.Errorf("csi: failed to read bin chunk count: %v", err)
+		}
+		if nChunk < 0 {
+			return fmt.Errorf("csi: invalid bin chunk count %d", nChunk)
+		}
+		offsets := make([]uint64, 2*nChunk)
+		err = binary.Read(r, binary.LittleEndian, offsets)
+		if err != nil {
+			return fmt.Errorf("csi: failed to read chunk virtual offsets: %v", err)
+		}
+
+		// the pseudo-bin holds the span of the reference and its mapped and unmapped counts
+		if b == i.statsBin() {
+			if nChunk != 2 {
+				return fmt.Errorf("csi: invalid statistics chunk count %d", nChunk)
+			}
+			ref.stats = &index.ReferenceStats{
+				Chunk:    bgzf.Chunk{Begin: makeOffset(offsets[0]), End: makeOffset(offsets[1])},
+				Mapped:   offsets[2],
+				Unmapped: offsets[3],
+			}
+			continue
+		}
+
+		chunks := make([]bgzf.Chunk, nChunk)
+		for c := range chunks {
+			chunks[c] = bgzf.Chunk{Begin: makeOffset(offsets[2*c]), End: makeOffset(offsets[2*c+1])}
+		}
+		ref.bins = append(ref.bins, bin{bin: b, left: makeOffset(left), chunks: chunks})
+	}
+	sort.Slice(ref.bins, func(a, b int) bool { return ref.bins[a].bin < ref.bins[b].bin })
+	return nil
+}
@@ -0,0 +1,160 @@
+// Package htsaudit keeps a tamper-evident audit log of ticket access decisions
+//
+// Module auditor chains audit records together and writes them to a sink,
+// and holds the process-wide auditor configured for the server
+package htsaudit
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+)
+
+// Auditor numbers and hash chains audit records, writing them to a sink in
+// the order they are logged
+type Auditor struct {
+	sink     Sink
+	now      func() time.Time
+	mutex    sync.Mutex
+	sequence uint64
+	prevHash string
+}
+
+// NewAuditor instantiates an auditor continuing the hash chain from the most
+// recent record already written to the sink
+//
+// Arguments
+//	sink (Sink): sink records are written to
+//	last (*Record): most recent record written to the sink, nil if there is none
+// Returns
+//	(*Auditor): auditor
+func NewAuditor(sink Sink, last *Record) *Auditor {
+	auditor := new(Auditor)
+	auditor.sink = sink
+	auditor.now = time.Now
+	if last != nil {
+		auditor.sequence = last.Sequence
+		auditor.prevHash = last.Hash
+	}
+	return auditor
+}
+
+// Log numbers the record, chains it to the record before it and writes it to
+// the sink. if the record cannot be written, the chain is left as it was
+//
+//	Type: Auditor
+// Arguments
+//	record (*Record): access decision to log
+// Returns
+//	(error): the record could not be written
+func (auditor *Auditor) Log(record *Record) error {
+	auditor.mutex.Lock()
+	defer auditor.mutex.Unlock()
+
+	record.Sequence = auditor.sequence + 1
+	record.Time = auditor.now().UTC()
+	record.PrevHash = auditor.prevHash
+	hash, err := record.computeHash()
+	if err != nil {
+		return err
+	}
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := auditor.sink.Write(line); err != nil {
+		return err
+	}
+	auditor.sequence = record.Sequence
+	auditor.prevHash = record.Hash
+	return nil
+}
+
+// auditor process-wide auditor, created from the configuration on first use.
+// nil if no audit log is configured
+var auditor *Auditor
+
+// auditorLoaded if true, auditor has been created from the configuration
+var auditorLoaded bool
+
+// auditorMutex guards auditor
+var auditorMutex sync.Mutex
+
+// newConfiguredAuditor creates an auditor writing to the audit log file named
+// in the configuration, continuing the hash chain already in the file
+func newConfiguredAuditor() (*Auditor, error) {
+	path := htsconfig.GetAuditFile()
+	if path == "" {
+		return nil, nil
+	}
+	last, err := lastRecord(LogFiles(path))
+	if err != nil {
+		return nil, fmt.Errorf("could not read the audit log %s: %v", path, err)
+	}
+	sink, err := NewFileSink(path, htsconfig.GetAuditMaxSize(), htsconfig.GetAuditMaxFiles())
+	if err != nil {
+		return nil, fmt.Errorf("could not open the audit log %s: %v", path, err)
+	}
+	return NewAuditor(sink, last), nil
+}
+
+// GetAuditor gets the process-wide auditor, creating it from the
+// configuration on first use. if the configured audit log cannot be opened,
+// it is tried again on the next call
+//
+// Returns
+//	(*Auditor): process-wide auditor, nil if no audit log is configured
+//	(error): the configured audit log could not be opened
+func GetAuditor() (*Auditor, error) {
+	auditorMutex.Lock()
+	defer auditorMutex.Unlock()
+
+	if !auditorLoaded {
+		configured, err := newConfiguredAuditor()
+		if err != nil {
+			return nil, err
+		}
+		auditor = configured
+		auditorLoaded = true
+	}
+	return auditor, nil
+}
+
+// SetAuditor replaces the process-wide auditor. if nil, the next call to
+// GetAuditor creates it again from the configuration
+func SetAuditor(newAuditor *Auditor) {
+	auditorMutex.Lock()
+	defer auditorMutex.Unlock()
+
+	auditor = newAuditor
+	auditorLoaded = newAuditor != nil
+}
+
+// Log writes an access decision to the process-wide audit log, if one is
+// configured. a decision that cannot be recorded must not be acted on
+//
+// Arguments
+//	record (*Record): access decision to log
+// Returns
+//	(error): the audit log is configured, but the record could not be written
+func Log(record *Record) error {
+	auditor, err := GetAuditor()
+	if err != nil {
+		log.Error("Could not write the audit record of %s %s: %v", record.Dataset, record.ObjectID, err)
+		return err
+	}
+	if auditor == nil {
+		return nil
+	}
+	if err := auditor.Log(record); err != nil {
+		log.Error("Could not write the audit record of %s %s: %v", record.Dataset, record.ObjectID, err)
+		return err
+	}
+	return nil
+}
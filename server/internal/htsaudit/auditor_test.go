@@ -0,0 +1,78 @@
+// Package htsaudit keeps a tamper-evident audit log of ticket access decisions
+//
+// Module auditor_test tests module auditor
+package htsaudit
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memorySink keeps written records in memory, failing writes while broken
+type memorySink struct {
+	lines  [][]byte
+	broken bool
+}
+
+func (sink *memorySink) Write(line []byte) error {
+	if sink.broken {
+		return errors.New("sink is broken")
+	}
+	sink.lines = append(sink.lines, line)
+	return nil
+}
+
+// newTestRecord creates a record of a decision on an object of dataset 10g
+func newTestRecord(outcome string) *Record {
+	record := NewRecord()
+	record.Subject = "alice"
+	record.Dataset = "10g"
+	record.ObjectID = "10g.NA12878"
+	record.Outcome = outcome
+	return record
+}
+
+// TestAuditorLog tests Auditor Log function
+func TestAuditorLog(t *testing.T) {
+	sink := &memorySink{}
+	auditor := NewAuditor(sink, nil)
+	auditor.now = func() time.Time { return time.Unix(1635724800, 0) }
+
+	assert.Nil(t, auditor.Log(newTestRecord(OutcomeGranted)))
+	assert.Nil(t, auditor.Log(newTestRecord(OutcomeDenied)))
+
+	// a failed write leaves the chain as it was
+	sink.broken = true
+	assert.NotNil(t, auditor.Log(newTestRecord(OutcomeDenied)))
+	sink.broken = false
+	assert.Nil(t, auditor.Log(newTestRecord(OutcomeFailed)))
+
+	records := make([]*Record, 0)
+	for _, line := range sink.lines {
+		record := new(Record)
+		assert.Nil(t, json.Unmarshal(line, record))
+		records = append(records, record)
+	}
+	assert.Equal(t, 3, len(records))
+	assert.Equal(t, "", records[0].PrevHash)
+	for i, record := range records {
+		assert.Equal(t, uint64(i+1), record.Sequence)
+		assert.Equal(t, time.Unix(1635724800, 0).UTC(), record.Time)
+		if i > 0 {
+			assert.Equal(t, records[i-1].Hash, record.PrevHash)
+		}
+	}
+	assert.Equal(t, OutcomeFailed, records[2].Outcome)
+
+	// a new auditor continues the chain from the last record
+	resumed := NewAuditor(sink, records[2])
+	assert.Nil(t, resumed.Log(newTestRecord(OutcomeGranted)))
+	record := new(Record)
+	json.Unmarshal(sink.lines[3], record)
+	assert.Equal(t, uint64(4), record.Sequence)
+	assert.Equal(t, records[2].Hash, record.PrevHash)
+}
@@ -0,0 +1,152 @@
+// Package htsaudit keeps a tamper-evident audit log of ticket access decisions
+//
+// Module filesink writes audit records to a file, rotating it once it reaches
+// its maximum size
+package htsaudit
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Sink receives the encoded audit records, one line per record
+type Sink interface {
+	// Write writes a single encoded record, without a trailing newline
+	Write(line []byte) error
+}
+
+// FileSink appends audit records to a file. once the file reaches its maximum
+// size it is renamed to {path}.1, shifting earlier rotations to {path}.2 and
+// so on, and the oldest rotation beyond the number kept is removed
+type FileSink struct {
+	path     string
+	maxSize  int64
+	maxFiles int
+	mutex    sync.Mutex
+	file     *os.File
+	size     int64
+}
+
+// NewFileSink opens the audit log for appending, creating it if needed
+//
+// Arguments
+//	path (string): path of the audit log
+//	maxSize (int64): size in bytes the audit log grows to before it is rotated
+//	maxFiles (int): number of rotated audit logs kept
+// Returns
+//	(*FileSink): file sink
+//	(error): the audit log could not be opened
+func NewFileSink(path string, maxSize int64, maxFiles int) (*FileSink, error) {
+	sink := new(FileSink)
+	sink.path = path
+	sink.maxSize = maxSize
+	sink.maxFiles = maxFiles
+	if err := sink.open(); err != nil {
+		return nil, err
+	}
+	return sink, nil
+}
+
+// open opens the current audit log for appending
+//
+//	Type: FileSink
+// Returns
+//	(error): the audit log could not be opened
+func (sink *FileSink) open() error {
+	file, err := os.OpenFile(sink.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	sink.file = file
+	sink.size = info.Size()
+	return nil
+}
+
+// Write appends a record to the audit log, rotating the log first if the
+// record would take it over its maximum size. the record is synced to disk
+// before returning
+//
+//	Type: FileSink
+// Arguments
+//	line ([]byte): encoded record
+// Returns
+//	(error): the record could not be written
+func (sink *FileSink) Write(line []byte) error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+
+	entry := append(append(make([]byte, 0, len(line)+1), line...), '\n')
+	if sink.size > 0 && sink.size+int64(len(entry)) > sink.maxSize {
+		if err := sink.rotate(); err != nil {
+			return err
+		}
+	}
+	written, err := sink.file.Write(entry)
+	sink.size += int64(written)
+	if err != nil {
+		return err
+	}
+	return sink.file.Sync()
+}
+
+// rotate moves the current audit log aside and opens a new one
+//
+//	Type: FileSink
+// Returns
+//	(error): the audit log could not be rotated
+func (sink *FileSink) rotate() error {
+	if err := sink.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(rotatedPath(sink.path, sink.maxFiles))
+	for i := sink.maxFiles - 1; i >= 1; i-- {
+		os.Rename(rotatedPath(sink.path, i), rotatedPath(sink.path, i+1))
+	}
+	if err := os.Rename(sink.path, rotatedPath(sink.path, 1)); err != nil {
+		return err
+	}
+	return sink.open()
+}
+
+// Close closes the current audit log
+//
+//	Type: FileSink
+// Returns
+//	(error): the audit log could not be closed
+func (sink *FileSink) Close() error {
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	return sink.file.Close()
+}
+
+// rotatedPath gets the path of the nth rotation of an audit log
+func rotatedPath(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// LogFiles gets the existing files of an audit log, oldest first: the rotated
+// logs from the highest numbered down, then the current log
+//
+// Arguments
+//	path (string): path of the current audit log
+// Returns
+//	([]string): paths of the existing audit log files
+func LogFiles(path string) []string {
+	files := make([]string, 0)
+	for n := 1; ; n++ {
+		if _, err := os.Stat(rotatedPath(path, n)); err != nil {
+			break
+		}
+		files = append([]string{rotatedPath(path, n)}, files...)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files
+}
@@ -0,0 +1,51 @@
+// Package htsaudit keeps a tamper-evident audit log of ticket access decisions
+//
+// Module filesink_test tests module filesink
+package htsaudit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFileSinkRotation tests that FileSink rotates the audit log and keeps
+// only the configured number of rotations
+func TestFileSinkRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.log")
+
+	// each line is 10 bytes with its newline, so two fit in a file
+	sink, err := NewFileSink(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"record-01", "record-02", "record-03", "record-04", "record-05", "record-06", "record-07"} {
+		assert.Nil(t, sink.Write([]byte(line)))
+	}
+	sink.Close()
+
+	files := LogFiles(path)
+	assert.Equal(t, []string{path + ".2", path + ".1", path}, files)
+	expContents := []string{"record-03\nrecord-04\n", "record-05\nrecord-06\n", "record-07\n"}
+	for i, file := range files {
+		content, _ := ioutil.ReadFile(file)
+		assert.Equal(t, expContents[i], string(content))
+	}
+
+	// reopening appends to the current audit log
+	sink, _ = NewFileSink(path, 20, 2)
+	sink.Write([]byte("record-08"))
+	sink.Close()
+	content, _ := ioutil.ReadFile(path)
+	assert.Equal(t, "record-07\nrecord-08\n", string(content))
+
+	assert.Equal(t, []string{}, LogFiles(filepath.Join(dir, "missing.log")))
+}
@@ -0,0 +1,118 @@
+// Package htsaudit keeps a tamper-evident audit log of ticket access decisions
+//
+// Module record contains the audit record written for each ticket access
+// decision, and the hash chaining records together
+package htsaudit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// OutcomeGranted a ticket was issued
+const OutcomeGranted = "granted"
+
+// OutcomeDenied a ticket was refused because the client may not access the
+// requested data
+const OutcomeDenied = "denied"
+
+// OutcomeFailed a ticket could not be issued because of a failure of the
+// server or of a service it depends on
+const OutcomeFailed = "failed"
+
+// Region a genomic region requested or granted. a nil Start or End leaves the
+// region open at that side
+type Region struct {
+	ReferenceName string `json:"referenceName"`
+	Start         *int   `json:"start,omitempty"`
+	End           *int   `json:"end,omitempty"`
+}
+
+// VisaUse a visa the access decision was based on
+//
+// Attributes
+//	Issuer (string): issuer of the visa
+//	Datasets ([]string): datasets the visa grants
+//	Hash (string): hex encoded SHA-256 hash of the visa
+//	Revocation (string): revocation state of the visa, empty if not known
+//	RevocationListAt (*time.Time): time the revocation list the visa was checked against was
+//	loaded, nil if it was not checked
+type VisaUse struct {
+	Issuer           string     `json:"issuer"`
+	Datasets         []string   `json:"datasets"`
+	Hash             string     `json:"hash,omitempty"`
+	Revocation       string     `json:"revocation,omitempty"`
+	RevocationListAt *time.Time `json:"revocationListAt,omitempty"`
+}
+
+// Record a single ticket access decision. records are chained together, each
+// holding the hash of the record before it, so that altering, removing or
+// reordering records is detected on verification
+//
+// Attributes
+//	Sequence (uint64): position of the record in the audit log, starting at 1
+//	Time (time.Time): time the decision was made
+//	Subject (string): subject of the passport, empty if there was none
+//	Visas ([]VisaUse): visas granting the dataset that the decision was based on
+//	RevokedVisas ([]VisaUse): visas the passport carried that their issuers have revoked
+//	Endpoint (string): endpoint the ticket was requested from, i.e. reads or variants
+//	Dataset (string): requested dataset
+//	Purpose (string): purpose declared for accessing the dataset, empty if none was
+//	ObjectID (string): requested object id
+//	Class (string): requested class, empty if the whole object was requested
+//	RequestedRegions ([]Region): requested regions, empty if all regions were requested
+//	GrantedRegions ([]Region): regions the ticket was issued for, empty if all regions
+//	were granted or none were
+//	WithheldRegions ([]Region): requested regions left out of the ticket
+//	Outcome (string): one of granted, denied or failed
+//	Reason (string): why the decision was made
+//	PrevHash (string): hash of the record before, empty for the first record
+//	Hash (string): hash of this record
+type Record struct {
+	Sequence         uint64    `json:"seq"`
+	Time             time.Time `json:"time"`
+	Subject          string    `json:"subject"`
+	Visas            []VisaUse `json:"visas"`
+	RevokedVisas     []VisaUse `json:"revokedVisas,omitempty"`
+	Endpoint         string    `json:"endpoint"`
+	Dataset          string    `json:"dataset"`
+	Purpose          string    `json:"purpose,omitempty"`
+	ObjectID         string    `json:"objectId"`
+	Class            string    `json:"class,omitempty"`
+	RequestedRegions []Region  `json:"requestedRegions"`
+	GrantedRegions   []Region  `json:"grantedRegions"`
+	WithheldRegions  []Region  `json:"withheldRegions,omitempty"`
+	Outcome          string    `json:"outcome"`
+	Reason           string    `json:"reason"`
+	PrevHash         string    `json:"prevHash"`
+	Hash             string    `json:"hash"`
+}
+
+// NewRecord instantiates an empty audit record
+func NewRecord() *Record {
+	record := new(Record)
+	record.Visas = make([]VisaUse, 0)
+	record.RequestedRegions = make([]Region, 0)
+	record.GrantedRegions = make([]Region, 0)
+	return record
+}
+
+// computeHash hashes the JSON encoding of the record without its own hash.
+// the encoding includes the hash of the previous record, chaining the two
+//
+//	Type: Record
+// Returns
+//	(string): hex encoded SHA-256 hash of the record
+//	(error): the record could not be encoded
+func (record *Record) computeHash() (string, error) {
+	unhashed := *record
+	unhashed.Hash = ""
+	body, err := json.Marshal(&unhashed)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
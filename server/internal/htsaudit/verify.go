@@ -0,0 +1,159 @@
+// Package htsaudit keeps a tamper-evident audit log of ticket access decisions
+//
+// Module verify checks the hash chain of an audit log, detecting records that
+// were altered, removed, inserted or reordered
+package htsaudit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// maxRecordSize the largest encoded record read back from an audit log
+const maxRecordSize = 1024 * 1024
+
+// Verification summarises an audit log whose hash chain is intact
+//
+// Attributes
+//	Records (int): number of records verified
+//	FirstSequence (uint64): sequence of the first record
+//	LastSequence (uint64): sequence of the last record
+//	Anchor (string): previous hash of the first record. if not empty, the
+//	records before it were rotated out of the audit log, so the chain could
+//	only be verified from this point on
+//	LastHash (string): hash of the last record
+type Verification struct {
+	Records       int
+	FirstSequence uint64
+	LastSequence  uint64
+	Anchor        string
+	LastHash      string
+}
+
+// Verify checks the hash chain across the files of an audit log. the chain
+// continues from one file to the next, so the files must be given oldest
+// first, as returned by LogFiles
+//
+// Arguments
+//	files ([]string): paths of the audit log files, oldest first
+// Returns
+//	(*Verification): summary of the verified audit log
+//	(error): the first break in the hash chain, or a file that could not be read
+func Verify(files []string) (*Verification, error) {
+	verification := new(Verification)
+	for _, path := range files {
+		if err := verification.verifyFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return verification, nil
+}
+
+// verifyFile continues verifying the hash chain through the records of a file
+//
+//	Type: Verification
+// Arguments
+//	path (string): path of the audit log file
+// Returns
+//	(error): the first break in the hash chain, or the file could not be read
+func (verification *Verification) verifyFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+	for line := 1; scanner.Scan(); line++ {
+		record := new(Record)
+		if err := json.Unmarshal(scanner.Bytes(), record); err != nil {
+			return fmt.Errorf("%s line %d: malformed record: %v", path, line, err)
+		}
+		if err := verification.verifyRecord(record); err != nil {
+			return fmt.Errorf("%s line %d: %v", path, line, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// verifyRecord checks a record follows on from the records verified so far,
+// and that its hash matches its content
+//
+//	Type: Verification
+// Arguments
+//	record (*Record): next record of the audit log
+// Returns
+//	(error): the record breaks the hash chain
+func (verification *Verification) verifyRecord(record *Record) error {
+	if verification.Records == 0 {
+		// the first record of a log that was never rotated out starts the chain
+		if record.Sequence == 1 && record.PrevHash != "" {
+			return fmt.Errorf("record %d starts the audit log but follows hash %s", record.Sequence, record.PrevHash)
+		}
+		verification.FirstSequence = record.Sequence
+		verification.Anchor = record.PrevHash
+	} else {
+		if record.Sequence != verification.LastSequence+1 {
+			return fmt.Errorf("record %d follows record %d", record.Sequence, verification.LastSequence)
+		}
+		if record.PrevHash != verification.LastHash {
+			return fmt.Errorf("record %d does not follow the hash of record %d", record.Sequence, verification.LastSequence)
+		}
+	}
+
+	hash, err := record.computeHash()
+	if err != nil {
+		return err
+	}
+	if hash != record.Hash {
+		return fmt.Errorf("record %d was altered, its hash does not match its content", record.Sequence)
+	}
+
+	verification.Records++
+	verification.LastSequence = record.Sequence
+	verification.LastHash = record.Hash
+	return nil
+}
+
+// lastRecord reads the most recent record of an audit log, so that a new
+// auditor continues its hash chain
+//
+// Arguments
+//	files ([]string): paths of the audit log files, oldest first
+// Returns
+//	(*Record): most recent record, nil if the audit log is empty
+//	(error): the most recent record could not be read
+func lastRecord(files []string) (*Record, error) {
+	for i := len(files) - 1; i >= 0; i-- {
+		file, err := os.Open(files[i])
+		if err != nil {
+			return nil, err
+		}
+		var last []byte
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxRecordSize)
+		for scanner.Scan() {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", files[i], err)
+		}
+		if last == nil {
+			continue
+		}
+		record := new(Record)
+		if err := json.Unmarshal(last, record); err != nil {
+			return nil, fmt.Errorf("%s: malformed last record: %v", files[i], err)
+		}
+		return record, nil
+	}
+	return nil, nil
+}
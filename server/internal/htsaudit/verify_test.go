@@ -0,0 +1,98 @@
+// Package htsaudit keeps a tamper-evident audit log of ticket access decisions
+//
+// Module verify_test tests module verify
+package htsaudit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeTestLog writes records to an audit log rotated every two records,
+// returning its files oldest first
+func writeTestLog(t *testing.T, dir string, records int, maxFiles int) []string {
+	path := filepath.Join(dir, "audit.log")
+	sink, err := NewFileSink(path, 1, maxFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	auditor := NewAuditor(&pairedSink{sink: sink}, nil)
+	for i := 0; i < records; i++ {
+		if err := auditor.Log(newTestRecord(OutcomeGranted)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return LogFiles(path)
+}
+
+// pairedSink writes two records per audit log file, by joining every second
+// record onto the one before
+type pairedSink struct {
+	sink    *FileSink
+	pending []byte
+}
+
+func (paired *pairedSink) Write(line []byte) error {
+	if paired.pending == nil {
+		paired.pending = append([]byte{}, line...)
+		return nil
+	}
+	joined := append(append(paired.pending, '\n'), line...)
+	paired.pending = nil
+	return paired.sink.Write(joined)
+}
+
+// TestVerify tests Verify function
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// an intact chain spanning rotated files
+	files := writeTestLog(t, dir, 6, 5)
+	assert.Equal(t, 3, len(files))
+	verification, err := Verify(files)
+	assert.Nil(t, err)
+	assert.Equal(t, 6, verification.Records)
+	assert.Equal(t, uint64(1), verification.FirstSequence)
+	assert.Equal(t, uint64(6), verification.LastSequence)
+	assert.Equal(t, "", verification.Anchor)
+
+	// the chain resumes from the last record
+	last, err := lastRecord(files)
+	assert.Nil(t, err)
+	assert.Equal(t, verification.LastHash, last.Hash)
+
+	// files verified out of order break the chain
+	_, err = Verify([]string{files[1], files[0], files[2]})
+	assert.NotNil(t, err)
+
+	// a removed file breaks the chain
+	_, err = Verify([]string{files[0], files[2]})
+	assert.Contains(t, err.Error(), "record 5 follows record 2")
+
+	// a verified chain starting after the oldest records were rotated out is anchored
+	verification, err = Verify(files[1:])
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(3), verification.FirstSequence)
+	assert.NotEqual(t, "", verification.Anchor)
+
+	// an altered record is detected
+	content, _ := ioutil.ReadFile(files[1])
+	ioutil.WriteFile(files[1], []byte(strings.Replace(string(content), `"outcome":"granted"`, `"outcome":"denied"`, 1)), 0600)
+	_, err = Verify(files)
+	assert.Contains(t, err.Error(), "record 3 was altered")
+
+	// a malformed record is detected
+	ioutil.WriteFile(files[1], []byte("{\"seq\":\n"), 0600)
+	_, err = Verify(files)
+	assert.Contains(t, err.Error(), "malformed record")
+}
@@ -5,6 +5,7 @@
 package htscli
 
 import (
+	"os"
 	"os/exec"
 )
 
@@ -12,6 +13,7 @@ import (
 type Command struct {
 	baseCommand string
 	args        []string
+	env         []string
 	cmd         *exec.Cmd
 }
 
@@ -44,6 +46,17 @@ func (command *Command) GetArgs() []string {
 	return command.args
 }
 
+// AddEnv adds a single environment variable, set for the command on top of
+// the environment of the server
+func (command *Command) AddEnv(key string, value string) {
+	command.env = append(command.env, key+"="+value)
+}
+
+// GetEnv gets the environment variables set for the command, as "key=value"
+func (command *Command) GetEnv() []string {
+	return command.env
+}
+
 // GetLastArg gets the final argument in the array
 func (command *Command) GetLastArg() string {
 	return command.args[len(command.args)-1]
@@ -53,9 +66,17 @@ func (command *Command) GetLastArg() string {
 // object, setting it to the command's cmd property
 func (command *Command) SetupCmd() {
 	cmd := exec.Command(command.baseCommand, command.args...)
+	if len(command.env) > 0 {
+		cmd.Env = append(os.Environ(), command.env...)
+	}
 	command.cmd = cmd
 }
 
+// GetCmd gets the exec.Cmd the command has been set up as
+func (command *Command) GetCmd() *exec.Cmd {
+	return command.cmd
+}
+
 // ExecuteCmd starts the command that has been set up
 func (command *Command) ExecuteCmd() {
 	command.cmd.Start()
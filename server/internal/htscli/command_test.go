@@ -35,12 +35,23 @@ var commandAddArgTC = []struct {
 	{[]string{"-h"}},
 }
 
+// commandAddEnvTC test cases for AddEnv
+var commandAddEnvTC = []struct {
+	key, value string
+	exp        string
+}{
+	{"REF_PATH", "https://www.ebi.ac.uk/ena/cram/md5/%s", "REF_PATH=https://www.ebi.ac.uk/ena/cram/md5/%s"},
+	{"REF_CACHE", "/tmp/ref/%2s/%2s/%s", "REF_CACHE=/tmp/ref/%2s/%2s/%s"},
+}
+
 // commandSetupCmdTC test cases for SetupCmd
 var commandSetupCmdTC = []struct {
 	baseCommand string
 	args        []string
+	env         [][2]string
 }{
-	{"echo", []string{"Hello", "World"}},
+	{"echo", []string{"Hello", "World"}, nil},
+	{"echo", []string{"Hello", "World"}, [][2]string{{"REF_PATH", "/tmp/ref/%s"}}},
 }
 
 // TestCommandSetBaseCommand tests SetBaseCommand function
@@ -78,14 +89,33 @@ func TestCommandAddArg(t *testing.T) {
 	}
 }
 
+// TestCommandAddEnv tests AddEnv function
+func TestCommandAddEnv(t *testing.T) {
+	for _, tc := range commandAddEnvTC {
+		command := NewCommand()
+		command.AddEnv(tc.key, tc.value)
+		assert.Equal(t, []string{tc.exp}, command.GetEnv())
+	}
+}
+
 // TestCommandSetupCmd tests SetupCmd function
 func TestCommandSetupCmd(t *testing.T) {
 	for _, tc := range commandSetupCmdTC {
 		command := NewCommand()
 		command.SetBaseCommand(tc.baseCommand)
 		command.SetArgs(tc.args)
+		for _, env := range tc.env {
+			command.AddEnv(env[0], env[1])
+		}
 		command.SetupCmd()
 
+		// the environment of the server is only replaced if variables are added
+		if len(tc.env) == 0 {
+			assert.Nil(t, command.cmd.Env)
+		} else {
+			assert.Contains(t, command.cmd.Env, tc.env[0][0]+"="+tc.env[0][1])
+		}
+
 		expArgs := []string{tc.baseCommand}
 		expArgs = append(expArgs, tc.args...)
 		actualArgs := command.cmd.Args
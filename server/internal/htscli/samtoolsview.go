@@ -2,10 +2,12 @@
 // jobs
 //
 // Module samtoolsview defines the job submission for the 'samtools view'
-// command, which streams SAM or BAM to stdout
+// command, which streams SAM, BAM or CRAM to stdout
 package htscli
 
 import (
+	"strings"
+
 	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
 )
 
@@ -52,6 +54,30 @@ func (samtoolsViewCommand *SamtoolsViewCommand) OutputBAM() *SamtoolsViewCommand
 	return samtoolsViewCommand
 }
 
+// OutputCRAM adds an option to the cli, which will lead to the output being
+// printed in CRAM format instead of SAM
+func (samtoolsViewCommand *SamtoolsViewCommand) OutputCRAM() *SamtoolsViewCommand {
+	samtoolsViewCommand.command.AddArg("-C")
+	return samtoolsViewCommand
+}
+
+// SetReference sets the reference CRAM is encoded and decoded against. a
+// local FASTA file is added as a cli option, while a refget url template
+// (containing %s, in place of the MD5 of each sequence) is passed to htslib
+// through the REF_PATH environment variable. if empty, nothing is set
+func (samtoolsViewCommand *SamtoolsViewCommand) SetReference(reference string) *SamtoolsViewCommand {
+	if reference == "" {
+		return samtoolsViewCommand
+	}
+	if strings.Contains(reference, "%s") {
+		samtoolsViewCommand.command.AddEnv("REF_PATH", reference)
+		return samtoolsViewCommand
+	}
+	samtoolsViewCommand.command.AddArg("-T")
+	samtoolsViewCommand.command.AddArg(reference)
+	return samtoolsViewCommand
+}
+
 // AddRegion adds a specific region request to the command line
 func (samtoolsViewCommand *SamtoolsViewCommand) AddRegion(region *htsrequest.Region) *SamtoolsViewCommand {
 	samtoolsViewCommand.command.AddArg(region.ExportSamtools())
@@ -98,6 +98,17 @@ var samtoolsViewGetCommandTC = []struct {
 	},
 }
 
+// samtoolsViewSetReferenceTC test cases for SetReference
+var samtoolsViewSetReferenceTC = []struct {
+	reference string
+	expArgs   []string
+	expEnv    []string
+}{
+	{"", []string{"view"}, nil},
+	{"/data/ref/GRCh38.fa", []string{"view", "-T", "/data/ref/GRCh38.fa"}, nil},
+	{"https://www.ebi.ac.uk/ena/cram/md5/%s", []string{"view"}, []string{"REF_PATH=https://www.ebi.ac.uk/ena/cram/md5/%s"}},
+}
+
 // intPtr convenience method to get pointer of an int
 func intPtr(i int) *int {
 	return &i
@@ -133,6 +144,23 @@ func TestSamtoolsViewOutputBAM(t *testing.T) {
 	assert.Equal(t, samtoolsView.command.GetLastArg(), "-b")
 }
 
+// TestSamtoolsViewOutputCRAM tests OutputCRAM function
+func TestSamtoolsViewOutputCRAM(t *testing.T) {
+	samtoolsView := SamtoolsView()
+	samtoolsView.OutputCRAM()
+	assert.Equal(t, samtoolsView.command.GetLastArg(), "-C")
+}
+
+// TestSamtoolsViewSetReference tests SetReference function
+func TestSamtoolsViewSetReference(t *testing.T) {
+	for _, tc := range samtoolsViewSetReferenceTC {
+		samtoolsView := SamtoolsView()
+		samtoolsView.SetReference(tc.reference)
+		assert.Equal(t, tc.expArgs, samtoolsView.command.GetArgs())
+		assert.Equal(t, tc.expEnv, samtoolsView.command.GetEnv())
+	}
+}
+
 // TestSamtoolsViewAddRegion tests AddRegion function
 func TestSamtoolsViewAddRegion(t *testing.T) {
 	for _, tc := range samtoolsViewAddRegionTC {
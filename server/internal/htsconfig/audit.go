@@ -0,0 +1,47 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module audit.go allows the program to be configured with where the audit log
+// of ticket access decisions is written, and how it is rotated
+package htsconfig
+
+import (
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+)
+
+// configurationAudit contains properties for the audit log
+type configurationAudit struct {
+	File      string `json:"file"`
+	MaxSizeMB int    `json:"maxSizeMB"`
+	MaxFiles  int    `json:"maxFiles"`
+}
+
+func getAudit() *configurationAudit {
+	return getContainer().Audit
+}
+
+// GetAuditFile gets the path of the audit log. if empty, no audit log is
+// written
+func GetAuditFile() string {
+	return getAudit().File
+}
+
+// GetAuditMaxSize gets the size in bytes the audit log may grow to before it
+// is rotated
+func GetAuditMaxSize() int64 {
+	maxSizeMB := getAudit().MaxSizeMB
+	if maxSizeMB <= 0 {
+		maxSizeMB = htsconstants.DfltAuditMaxSizeMB
+	}
+	return int64(maxSizeMB) * 1024 * 1024
+}
+
+// GetAuditMaxFiles gets the number of rotated audit logs kept alongside the
+// current audit log
+func GetAuditMaxFiles() int {
+	maxFiles := getAudit().MaxFiles
+	if maxFiles <= 0 {
+		return htsconstants.DfltAuditMaxFiles
+	}
+	return maxFiles
+}
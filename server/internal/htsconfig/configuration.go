@@ -6,16 +6,20 @@
 package htsconfig
 
 import (
+	"crypto/rand"
 	"errors"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
+	"time"
 
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
 
 	"github.com/ga4gh/htsget-refserver/internal/htsutils"
 
 	"github.com/getlantern/deepcopy"
+	log "github.com/sirupsen/logrus"
 )
 
 // Configuration contains properties loaded from the JSON config file
@@ -30,6 +34,11 @@ type configurationContainer struct {
 	ServerProps    *configurationServerProps `json:"props"`
 	ReadsConfig    *configurationEndpoint    `json:"reads"`
 	VariantsConfig *configurationEndpoint    `json:"variants"`
+	TrustedIssuers []*TrustedIssuer          `json:"trustedIssuers"`
+	Passport       *configurationPassport    `json:"passport"`
+	Manifests      *configurationManifests   `json:"manifests"`
+	Audit          *configurationAudit       `json:"audit"`
+	Quotas         *configurationQuotas      `json:"quotas"`
 }
 
 type configurationServerProps struct {
@@ -45,12 +54,18 @@ type configurationServerProps struct {
 	CorsAllowCredentials *bool  `json:"corsAllowCredentials"`
 	CorsMaxAge           int    `json:"corsMaxAge"`
 	AwsAssumeRole        *bool  `json:"awsAssumeRole"`
+	IndexCacheTTL        string `json:"indexCacheTTL"`
+	URLSigningKey        string `json:"urlSigningKey"`
+	URLLifetime          string `json:"urlLifetime"`
 }
 
 type configurationEndpoint struct {
 	Enabled            *bool               `json:"enabled,true" default:"true"`
 	DataSourceRegistry *DataSourceRegistry `json:"dataSourceRegistry"`
+	Datasets           []*Dataset          `json:"datasets"`
+	LegacyDataset      string              `json:"legacyDataset"`
 	ServiceInfo        *ServiceInfo        `json:"serviceInfo"`
+	Cram               *configurationCram  `json:"cram"`
 }
 
 var configurationSingleton *Configuration
@@ -72,6 +87,9 @@ func patchConfiguration(defR reflect.Value, patchR reflect.Value) {
 			"int",
 			"*bool",
 			"*htsconfig.DataSourceRegistry",
+			"[]*htsconfig.TrustedIssuer",
+			"[]*htsconfig.PassportBroker",
+			"[]*htsconfig.Dataset",
 		}
 
 		if !htsutils.IsItemInArray(defRType, typesToPatch) && !htsutils.IsItemInArray(patchRType, typesToPatch) {
@@ -99,6 +117,18 @@ func patchConfiguration(defR reflect.Value, patchR reflect.Value) {
 				if !patchR.Field(i).IsNil() {
 					defR.Field(i).Set(patchR.Field(i))
 				}
+			} else if defRType == "[]*htsconfig.TrustedIssuer" {
+				if !patchR.Field(i).IsNil() {
+					defR.Field(i).Set(patchR.Field(i))
+				}
+			} else if defRType == "[]*htsconfig.PassportBroker" {
+				if !patchR.Field(i).IsNil() {
+					defR.Field(i).Set(patchR.Field(i))
+				}
+			} else if defRType == "[]*htsconfig.Dataset" {
+				if !patchR.Field(i).IsNil() {
+					defR.Field(i).Set(patchR.Field(i))
+				}
 			}
 		}
 	}
@@ -120,6 +150,9 @@ func LoadConfig() {
 			reflect.ValueOf(configFileConfiguration).Elem(),
 		)
 	}
+	if err := checkPassportBrokers(newConfiguration.Container.Passport.Brokers); err != nil && configurationSingletonLoadedError == nil {
+		configurationSingletonLoadedError = err
+	}
 	SetConfig(newConfiguration)
 	configurationSingletonLoaded = true
 }
@@ -206,6 +239,45 @@ func GetCorsMaxAge() int {
 	return getServerProps().CorsMaxAge
 }
 
+// GetIndexCacheTTL gets how long an index fetched over http is used before it
+// is fetched again
+func GetIndexCacheTTL() time.Duration {
+	return parseDuration("props indexCacheTTL", getServerProps().IndexCacheTTL, htsconstants.DfltIndexCacheTTL)
+}
+
+// GetURLLifetime gets how long the data urls of a ticket are accepted for
+// after the ticket is issued
+func GetURLLifetime() time.Duration {
+	lifetime := parseDuration("props urlLifetime", getServerProps().URLLifetime, htsconstants.DfltURLLifetime)
+	if lifetime <= 0 {
+		lifetime, _ = time.ParseDuration(htsconstants.DfltURLLifetime)
+	}
+	return lifetime
+}
+
+// generatedURLSigningKey key data urls are signed with when none is configured
+var generatedURLSigningKey []byte
+
+// generatedURLSigningKeyOnce generates generatedURLSigningKey once per process
+var generatedURLSigningKeyOnce sync.Once
+
+// GetURLSigningKey gets the key the data urls of tickets are signed with. if
+// none is configured, a random key is generated for the process, so urls are
+// only accepted by the server instance that issued them
+func GetURLSigningKey() []byte {
+	if key := getServerProps().URLSigningKey; key != "" {
+		return []byte(key)
+	}
+	generatedURLSigningKeyOnce.Do(func() {
+		generatedURLSigningKey = make([]byte, 32)
+		if _, err := rand.Read(generatedURLSigningKey); err != nil {
+			panic("Could not generate a url signing key: " + err.Error())
+		}
+		log.Warn("No props urlSigningKey is configured, so data urls are only accepted by this server instance")
+	})
+	return generatedURLSigningKey
+}
+
 func getEndpointConfig(ep htsconstants.APIEndpoint) *configurationEndpoint {
 	reads := getContainer().ReadsConfig
 	variants := getContainer().VariantsConfig
@@ -213,9 +285,13 @@ func getEndpointConfig(ep htsconstants.APIEndpoint) *configurationEndpoint {
 		htsconstants.APIEndpointReadsTicket:         reads,
 		htsconstants.APIEndpointReadsData:           reads,
 		htsconstants.APIEndpointReadsServiceInfo:    reads,
+		htsconstants.APIEndpointReadsDatasets:       reads,
+		htsconstants.APIEndpointReadsBytes:          reads,
 		htsconstants.APIEndpointVariantsTicket:      variants,
 		htsconstants.APIEndpointVariantsData:        variants,
 		htsconstants.APIEndpointVariantsServiceInfo: variants,
+		htsconstants.APIEndpointVariantsDatasets:    variants,
+		htsconstants.APIEndpointVariantsBytes:       variants,
 	}
 	return configs[ep]
 }
@@ -232,6 +308,23 @@ func GetObjectPath(ep htsconstants.APIEndpoint, id string) (string, error) {
 	return GetDataSourceRegistry(ep).GetMatchingPath(id)
 }
 
+// GetObjectFormat gets the format of the object an id resolves to through the
+// data source registry of an endpoint, or an empty string if its path does not
+// tell
+func GetObjectFormat(ep htsconstants.APIEndpoint, id string) string {
+	path, err := GetObjectPath(ep, id)
+	if err != nil {
+		return ""
+	}
+	return FormatOfPath(path)
+}
+
+// GetObjectID gets the object id that resolves to a path through the data
+// source registry of an endpoint
+func GetObjectID(ep htsconstants.APIEndpoint, path string) (string, error) {
+	return GetDataSourceRegistry(ep).GetMatchingID(path)
+}
+
 func GetServiceInfo(ep htsconstants.APIEndpoint) *ServiceInfo {
 	return getEndpointConfig(ep).ServiceInfo
 }
@@ -244,3 +337,26 @@ func GetConfigLoadError() error {
 func IsAwsAssumeRole() bool {
 	return *getServerProps().AwsAssumeRole
 }
+
+// GetTrustedIssuers gets all visa issuers the server has been configured to trust
+func GetTrustedIssuers() []*TrustedIssuer {
+	return getContainer().TrustedIssuers
+}
+
+// AddTrustedIssuer trusts an additional visa issuer, e.g. a local issuer
+// started by integration tests
+func AddTrustedIssuer(trustedIssuer *TrustedIssuer) {
+	container := getContainer()
+	container.TrustedIssuers = append(container.TrustedIssuers, trustedIssuer)
+}
+
+// GetTrustedIssuer gets the trusted issuer configuration matching an issuer
+// url, or nil if the issuer is not trusted
+func GetTrustedIssuer(issuer string) *TrustedIssuer {
+	for _, trustedIssuer := range GetTrustedIssuers() {
+		if trustedIssuer.Issuer == issuer {
+			return trustedIssuer
+		}
+	}
+	return nil
+}
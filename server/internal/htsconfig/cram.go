@@ -0,0 +1,53 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module cram.go allows the program to be configured with whether CRAM is
+// served from the reads endpoints, and the reference its sequences are
+// encoded against
+package htsconfig
+
+import (
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+)
+
+// configurationCram contains properties for serving CRAM
+type configurationCram struct {
+	Enabled   *bool  `json:"enabled"`
+	Reference string `json:"reference"`
+}
+
+func getCram() *configurationCram {
+	return getContainer().ReadsConfig.Cram
+}
+
+// IsCramEnabled gets whether CRAM is served from the reads endpoints, and
+// advertised in their service info
+func IsCramEnabled() bool {
+	cram := getCram()
+	return cram != nil && cram.Enabled != nil && *cram.Enabled
+}
+
+// GetCramReference gets the reference CRAM is encoded and decoded against when
+// it is transformed on the data path. either the path of a local FASTA file,
+// or a refget url template such as https://www.ebi.ac.uk/ena/cram/md5/%s. if
+// empty, the reference is located through the M5 and UR fields of the header
+func GetCramReference() string {
+	cram := getCram()
+	if cram == nil {
+		return ""
+	}
+	return cram.Reference
+}
+
+// EnabledFormats filters formats down to those that are enabled, leaving CRAM
+// out unless it is enabled
+func EnabledFormats(formats []string) []string {
+	enabled := make([]string, 0, len(formats))
+	for _, format := range formats {
+		if format == htsconstants.FormatCram && !IsCramEnabled() {
+			continue
+		}
+		enabled = append(enabled, format)
+	}
+	return enabled
+}
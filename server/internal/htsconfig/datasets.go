@@ -0,0 +1,83 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module datasets.go allows the program to be configured with the access mode
+// of each dataset served by an endpoint, so that open datasets can be served
+// alongside controlled ones
+package htsconfig
+
+import (
+	"strings"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+)
+
+// DatasetAccessPublic is the access mode of datasets served without a passport
+const DatasetAccessPublic = "public"
+
+// DatasetAccessControlled is the access mode of datasets only served to the
+// holder of a passport carrying a visa for the dataset
+const DatasetAccessControlled = "controlled"
+
+// Dataset describes a single dataset served by an endpoint
+//
+// Attributes
+//	ID (string): dataset id, matched against the dataset segment of the ticket path
+//	Access (string): access mode of the dataset, either public or controlled
+//	DataUse ([]string): Data Use Ontology codes the dataset is labelled with,
+//	which the purpose declared by a client must be compatible with
+type Dataset struct {
+	ID      string   `json:"id"`
+	Access  string   `json:"access"`
+	DataUse []string `json:"dataUse,omitempty"`
+}
+
+// IsPublic checks if the dataset is served without a passport. any access mode
+// other than public is treated as controlled
+//
+//	Type: Dataset
+// Returns
+//	(bool): if true, tickets for the dataset are issued without a passport
+func (dataset *Dataset) IsPublic() bool {
+	return strings.EqualFold(dataset.Access, DatasetAccessPublic)
+}
+
+// GetDatasets gets all datasets configured for an endpoint
+func GetDatasets(ep htsconstants.APIEndpoint) []*Dataset {
+	return getEndpointConfig(ep).Datasets
+}
+
+// GetDataset gets the dataset configuration matching a dataset id, or nil if
+// the dataset has not been configured for the endpoint
+func GetDataset(ep htsconstants.APIEndpoint, id string) *Dataset {
+	for _, dataset := range GetDatasets(ep) {
+		if dataset.ID == id {
+			return dataset
+		}
+	}
+	return nil
+}
+
+// IsDatasetPublic checks if a dataset is served without a passport. datasets
+// that have not been configured are controlled
+func IsDatasetPublic(ep htsconstants.APIEndpoint, id string) bool {
+	dataset := GetDataset(ep, id)
+	return dataset != nil && dataset.IsPublic()
+}
+
+// GetDatasetDataUse gets the Data Use Ontology codes a dataset is labelled with
+// in the configuration, empty if the dataset has not been configured
+func GetDatasetDataUse(ep htsconstants.APIEndpoint, id string) []string {
+	dataset := GetDataset(ep, id)
+	if dataset == nil {
+		return []string{}
+	}
+	return dataset.DataUse
+}
+
+// GetLegacyDataset gets the dataset that tickets requested from the path of an
+// endpoint without a dataset (i.e. /reads/{id}) are requested from, empty if
+// that path is not served
+func GetLegacyDataset(ep htsconstants.APIEndpoint) string {
+	return getEndpointConfig(ep).LegacyDataset
+}
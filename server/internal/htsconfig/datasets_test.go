@@ -0,0 +1,69 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module datasets_test tests module datasets
+package htsconfig
+
+import (
+	"testing"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/stretchr/testify/assert"
+)
+
+// datasetIsPublicTC test cases for IsPublic
+var datasetIsPublicTC = []struct {
+	dataset *Dataset
+	exp     bool
+}{
+	{&Dataset{ID: "1kg", Access: DatasetAccessPublic}, true},
+	{&Dataset{ID: "1kg", Access: "PUBLIC"}, true},
+	{&Dataset{ID: "10g", Access: DatasetAccessControlled}, false},
+	{&Dataset{ID: "10g", Access: "open"}, false},
+	{&Dataset{ID: "10g"}, false},
+}
+
+// isDatasetPublicTC test cases for IsDatasetPublic
+var isDatasetPublicTC = []struct {
+	ep  htsconstants.APIEndpoint
+	id  string
+	exp bool
+}{
+	{htsconstants.APIEndpointVariantsTicket, "1kg", true},
+	{htsconstants.APIEndpointVariantsServiceInfo, "1kg", true},
+	{htsconstants.APIEndpointVariantsTicket, "10g", false},
+	{htsconstants.APIEndpointVariantsTicket, "giab", false},
+	{htsconstants.APIEndpointReadsTicket, "1kg", false},
+}
+
+// TestDatasetIsPublic tests IsPublic function
+func TestDatasetIsPublic(t *testing.T) {
+	for _, tc := range datasetIsPublicTC {
+		assert.Equal(t, tc.exp, tc.dataset.IsPublic())
+	}
+}
+
+// TestIsDatasetPublic tests lookup of dataset access modes from the
+// configuration
+func TestIsDatasetPublic(t *testing.T) {
+	config := new(Configuration)
+	config.Container = &configurationContainer{
+		ReadsConfig: &configurationEndpoint{},
+		VariantsConfig: &configurationEndpoint{
+			Datasets: []*Dataset{
+				{ID: "1kg", Access: DatasetAccessPublic},
+				{ID: "10g", Access: DatasetAccessControlled},
+			},
+		},
+	}
+	SetConfig(config)
+	configurationSingletonLoaded = true
+
+	for _, tc := range isDatasetPublicTC {
+		assert.Equal(t, tc.exp, IsDatasetPublic(tc.ep, tc.id))
+	}
+	assert.Equal(t, "10g", GetDataset(htsconstants.APIEndpointVariantsTicket, "10g").ID)
+	assert.Nil(t, GetDataset(htsconstants.APIEndpointVariantsTicket, "giab"))
+
+	SetConfig(DefaultConfiguration)
+}
@@ -12,6 +12,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
 	"github.com/ga4gh/htsget-refserver/internal/htsutils"
 )
 
@@ -150,6 +151,127 @@ func (registry *DataSourceRegistry) GetMatchingPath(id string) (string, error) {
 	return path, err
 }
 
+// FormatOfPath gets the format of an object from the extension of its path
+//
+// Arguments
+//	path (string): local path or url of the object
+// Returns
+//	(string): format of the object, or an empty string if the extension is not known
+func FormatOfPath(path string) string {
+	path = strings.ToLower(path)
+	switch {
+	case strings.HasSuffix(path, ".bam"):
+		return htsconstants.FormatBam
+	case strings.HasSuffix(path, ".cram"):
+		return htsconstants.FormatCram
+	case strings.HasSuffix(path, ".vcf"), strings.HasSuffix(path, ".vcf.gz"):
+		return htsconstants.FormatVcf
+	case strings.HasSuffix(path, ".bcf"):
+		return htsconstants.FormatBcf
+	}
+	return ""
+}
+
+// pathTemplateRegex converts a path template to a regex matching the paths it
+// produces, capturing each template parameter in a named group
+func pathTemplateRegex(path string) string {
+	var builder strings.Builder
+	builder.WriteString("^")
+	for {
+		open := strings.Index(path, "{")
+		close := strings.Index(path, "}")
+		if open < 0 || close < open {
+			break
+		}
+		builder.WriteString(regexp.QuoteMeta(path[:open]))
+		builder.WriteString("(?P<" + path[open+1:close] + ">.+?)")
+		path = path[close+1:]
+	}
+	builder.WriteString(regexp.QuoteMeta(path) + "$")
+	return builder.String()
+}
+
+// fillPattern replaces each named group of a regex pattern with the parameter
+// value of the same name, and removes anchors and escapes, producing the id
+// the pattern would match. the id is only a candidate, as patterns may use
+// constructs that cannot be filled in
+func fillPattern(pattern string, parameters map[string][]string) string {
+	var builder strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch {
+		case strings.HasPrefix(pattern[i:], "(?P<"):
+			nameEnd := strings.Index(pattern[i:], ">")
+			if nameEnd < 0 {
+				return ""
+			}
+			name := pattern[i+4 : i+nameEnd]
+			if values := parameters[name]; len(values) > 0 {
+				builder.WriteString(values[0])
+			}
+			// skip to the parenthesis closing the group
+			depth := 0
+			for ; i < len(pattern); i++ {
+				if pattern[i] == '\\' {
+					i++
+				} else if pattern[i] == '(' {
+					depth++
+				} else if pattern[i] == ')' {
+					depth--
+					if depth == 0 {
+						break
+					}
+				}
+			}
+		case pattern[i] == '\\' && i+1 < len(pattern):
+			i++
+			builder.WriteByte(pattern[i])
+		case (pattern[i] == '^' && i == 0) || (pattern[i] == '$' && i == len(pattern)-1):
+		default:
+			builder.WriteByte(pattern[i])
+		}
+	}
+	return builder.String()
+}
+
+// evaluateID gets the object id resolving to a path, the reverse of
+// evaluatePath
+//
+//	Type: DataSource
+// Arguments
+//	path (string): resource location
+// Returns
+//	(string): object id the path template populates to the location with, empty if none does
+func (dataSource *DataSource) evaluateID(path string) string {
+	pathParameterMap, err := htsutils.CreateRegexNamedParameterMap(pathTemplateRegex(dataSource.Path), path)
+	if err != nil {
+		return ""
+	}
+	return fillPattern(dataSource.Pattern, pathParameterMap)
+}
+
+// GetMatchingID gets the object id that resolves to a path, so that objects
+// known only by their location can be requested. each candidate id is checked
+// by resolving it back to the path through the registry
+//
+//	Type: DataSourceRegistry
+// Arguments
+//	path (string): resource location
+// Returns
+//	(string): object id resolving to the location
+//	(error): if not nil, no id resolving to the location could be constructed
+func (registry *DataSourceRegistry) GetMatchingID(path string) (string, error) {
+	for _, dataSource := range registry.Sources {
+		id := dataSource.evaluateID(path)
+		if id == "" {
+			continue
+		}
+		if resolved, err := registry.GetMatchingPath(id); err == nil && resolved == path {
+			return id, nil
+		}
+	}
+	return "", errors.New("path: " + path + " is not resolved to by any registered data source")
+}
+
 // String gets the registry representation as a string
 //
 //	Type: DataSourceRegistry
@@ -0,0 +1,112 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module datasources_test tests module datasources
+package htsconfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestDataSourceRegistry creates a registry from pattern and path pairs
+func newTestDataSourceRegistry(sources ...string) *DataSourceRegistry {
+	registry := newDataSourceRegistry()
+	for i := 0; i+1 < len(sources); i += 2 {
+		registry.addDataSource(newDataSource(sources[i], sources[i+1]))
+	}
+	return registry
+}
+
+// dataSourceRegistryGetMatchingIDTC test cases for GetMatchingID
+var dataSourceRegistryGetMatchingIDTC = []struct {
+	registry *DataSourceRegistry
+	path     string
+	expID    string
+	expError bool
+}{
+	{
+		newTestDataSourceRegistry("^tabulamuris\\.(?P<accession>.*)$", "../../data/test/sources/tabulamuris/{accession}.mus.Aligned.out.sorted.bam"),
+		"../../data/test/sources/tabulamuris/A1-B000168-3_57_F-1-1_R2.mus.Aligned.out.sorted.bam",
+		"tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		false,
+	},
+	{
+		newTestDataSourceRegistry("^(?P<accession>.*)_GIAB$", "./data/test/sources/giab/{accession}_GIAB.filtered.vcf.gz"),
+		"./data/test/sources/giab/NA12878_GIAB.filtered.vcf.gz",
+		"NA12878_GIAB",
+		false,
+	},
+	{
+		newTestDataSourceRegistry(
+			"^10g/vcf/(?P<sample>.*)$", "s3://umccr-10g-data-dev/{sample}/{sample}.hard-filtered.vcf.gz",
+			"^10g/sv/(?P<sample>.*)$", "s3://umccr-10g-data-dev/{sample}/{sample}.sv.vcf.gz",
+		),
+		"s3://umccr-10g-data-dev/SBJ00001/SBJ00001.sv.vcf.gz",
+		"10g/sv/SBJ00001",
+		false,
+	},
+	{
+		// the same path parameter must take the same value throughout the path
+		newTestDataSourceRegistry("^10g/vcf/(?P<sample>.*)$", "s3://umccr-10g-data-dev/{sample}/{sample}.hard-filtered.vcf.gz"),
+		"s3://umccr-10g-data-dev/SBJ00001/SBJ00002.hard-filtered.vcf.gz",
+		"",
+		true,
+	},
+	{
+		// an earlier data source matching the id resolves it to another path
+		newTestDataSourceRegistry(
+			"^tabulamuris\\.(?P<accession>10X.*)$", "https://example.org/10x/{accession}.bam",
+			"^tabulamuris\\.(?P<accession>.*)$", "https://example.org/facs/{accession}.bam",
+		),
+		"https://example.org/facs/10X_P4_0.bam",
+		"",
+		true,
+	},
+	{
+		newTestDataSourceRegistry("^tabulamuris\\.(?P<accession>.*)$", "../../data/test/sources/tabulamuris/{accession}.bam"),
+		"s3://bucket/A1.bam",
+		"",
+		true,
+	},
+	{
+		newTestDataSourceRegistry(),
+		"s3://bucket/A1.bam",
+		"",
+		true,
+	},
+}
+
+// TestDataSourceRegistryGetMatchingID tests GetMatchingID function
+func TestDataSourceRegistryGetMatchingID(t *testing.T) {
+	for _, tc := range dataSourceRegistryGetMatchingIDTC {
+		id, err := tc.registry.GetMatchingID(tc.path)
+		if tc.expError {
+			assert.NotNil(t, err, tc.path)
+		} else {
+			assert.Nil(t, err, tc.path)
+			assert.Equal(t, tc.expID, id)
+		}
+	}
+}
+
+// formatOfPathTC test cases for FormatOfPath
+var formatOfPathTC = []struct {
+	path      string
+	expFormat string
+}{
+	{"../../data/test/sources/tabulamuris/A1-B000168-3_57_F-1-1_R2.mus.Aligned.out.sorted.bam", "BAM"},
+	{"s3://bucket/NA12878/NA12878.CRAM", "CRAM"},
+	{"https://example.org/cram/NA12878.cram", "CRAM"},
+	{"./data/test/sources/giab/NA12878_GIAB.filtered.vcf.gz", "VCF"},
+	{"s3://bucket/SBJ00001.bcf", "BCF"},
+	{"s3://bucket/SBJ00001.cram.crai", ""},
+}
+
+// TestFormatOfPath tests FormatOfPath function
+func TestFormatOfPath(t *testing.T) {
+	for _, tc := range formatOfPathTC {
+		assert.Equal(t, tc.expFormat, FormatOfPath(tc.path), tc.path)
+	}
+}
@@ -19,6 +19,7 @@ var defaultServiceType = &ServiceType{
 var defaultEnabledReads = true
 var defaultFieldsParameterEffectiveReads = true
 var defaultTagsParametersEffectiveReads = true
+var defaultCramEnabledReads = true
 
 var defaultEnabledVariants = true
 var defaultFieldsParameterEffectiveVariants = false
@@ -41,6 +42,8 @@ var DefaultConfiguration = &Configuration{
 			CorsAllowCredentials: &htsconstants.DfltCorsAllowCredentials,
 			CorsMaxAge:           htsconstants.DfltCorsMaxAge,
 			AwsAssumeRole:        &htsconstants.DfltAwsAssumeRole,
+			IndexCacheTTL:        htsconstants.DfltIndexCacheTTL,
+			URLLifetime:          htsconstants.DfltURLLifetime,
 		},
 		ReadsConfig: &configurationEndpoint{
 			Enabled: &defaultEnabledReads,
@@ -56,6 +59,7 @@ var DefaultConfiguration = &Configuration{
 					},
 				},
 			},
+			Datasets: []*Dataset{},
 			ServiceInfo: &ServiceInfo{
 				ID:          htsconstants.DfltServiceInfoReadsID,
 				Name:        htsconstants.DfltServiceInfoReadsName,
@@ -78,6 +82,9 @@ var DefaultConfiguration = &Configuration{
 					TagsParametersEffective:  &defaultTagsParametersEffectiveReads,
 				},
 			},
+			Cram: &configurationCram{
+				Enabled: &defaultCramEnabledReads,
+			},
 		},
 		VariantsConfig: &configurationEndpoint{
 			Enabled: &defaultEnabledVariants,
@@ -93,6 +100,7 @@ var DefaultConfiguration = &Configuration{
 					},
 				},
 			},
+			Datasets: []*Dataset{},
 			ServiceInfo: &ServiceInfo{
 				ID:          htsconstants.DfltServiceInfoVariantsID,
 				Name:        htsconstants.DfltServiceInfoVariantsName,
@@ -116,5 +124,27 @@ var DefaultConfiguration = &Configuration{
 				},
 			},
 		},
+		TrustedIssuers: []*TrustedIssuer{},
+		Passport: &configurationPassport{
+			Brokers:   []*PassportBroker{},
+			ClockSkew: htsconstants.DfltPassportClockSkew,
+			CacheTTL:  htsconstants.DfltPassportCacheTTL,
+			CacheSize: htsconstants.DfltPassportCacheSize,
+		},
+		Manifests: &configurationManifests{
+			Provider:         htsconstants.DfltManifestProvider,
+			CacheTTL:         htsconstants.DfltManifestCacheTTL,
+			Timeout:          htsconstants.DfltManifestTimeout,
+			BreakerThreshold: htsconstants.DfltManifestBreakerThreshold,
+			BreakerCooldown:  htsconstants.DfltManifestBreakerCooldown,
+			ClipRegions:      &htsconstants.DfltManifestClipRegions,
+		},
+		Audit: &configurationAudit{
+			MaxSizeMB: htsconstants.DfltAuditMaxSizeMB,
+			MaxFiles:  htsconstants.DfltAuditMaxFiles,
+		},
+		Quotas: &configurationQuotas{
+			Window: htsconstants.DfltQuotaWindow,
+		},
 	},
 }
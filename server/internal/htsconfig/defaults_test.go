@@ -27,9 +27,13 @@ func TestDefaults(t *testing.T) {
 	assert.Equal(t, props.CorsAllowedHeaders, htsconstants.DfltCorsAllowedHeaders)
 	assert.Equal(t, props.CorsAllowCredentials, &htsconstants.DfltCorsAllowCredentials)
 	assert.Equal(t, props.CorsMaxAge, htsconstants.DfltCorsMaxAge)
+	assert.Equal(t, props.IndexCacheTTL, htsconstants.DfltIndexCacheTTL)
 
 	// READS DATA SOURCE REGISTRY
 	assert.Equal(t, *reads.Enabled, true)
+	assert.Equal(t, *reads.Cram.Enabled, true)
+	assert.Equal(t, reads.Cram.Reference, "")
+	assert.Equal(t, reads.ServiceInfo.HtsgetExtension.Formats, []string{htsconstants.FormatBam, htsconstants.FormatCram})
 
 	// VARIANTS DATA SOURCE REGISTRY
 	assert.Equal(t, *variants.Enabled, true)
@@ -0,0 +1,89 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module manifests.go allows the program to be configured with where the
+// manifests of controlled datasets are loaded from, and how fetched manifests
+// are cached
+package htsconfig
+
+import (
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	log "github.com/sirupsen/logrus"
+)
+
+// ManifestProviderHTTP provider fetching manifests from the issuer of each visa
+const ManifestProviderHTTP = "http"
+
+// ManifestProviderFile provider reading manifests from a local directory
+const ManifestProviderFile = "file"
+
+// configurationManifests contains properties for loading dataset manifests
+type configurationManifests struct {
+	Provider         string `json:"provider"`
+	Dir              string `json:"dir"`
+	CacheTTL         string `json:"cacheTTL"`
+	Timeout          string `json:"timeout"`
+	BreakerThreshold int    `json:"breakerThreshold"`
+	BreakerCooldown  string `json:"breakerCooldown"`
+	ClipRegions      *bool  `json:"clipRegions"`
+}
+
+func getManifests() *configurationManifests {
+	return getContainer().Manifests
+}
+
+// parseDuration parses a configured duration, falling back to the default
+// duration if it is not valid
+func parseDuration(name string, value string, dflt string) time.Duration {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Errorf("Invalid %s %s, so using %s", name, value, dflt)
+		duration, _ = time.ParseDuration(dflt)
+	}
+	return duration
+}
+
+// GetManifestProvider gets the name of the provider manifests are loaded with
+func GetManifestProvider() string {
+	return getManifests().Provider
+}
+
+// GetManifestDir gets the directory the file provider reads manifests from
+func GetManifestDir() string {
+	return getManifests().Dir
+}
+
+// GetManifestCacheTTL gets how long a fetched manifest is used before it is
+// revalidated with the issuer
+func GetManifestCacheTTL() time.Duration {
+	return parseDuration("manifests cacheTTL", getManifests().CacheTTL, htsconstants.DfltManifestCacheTTL)
+}
+
+// GetManifestTimeout gets the timeout for manifest http requests
+func GetManifestTimeout() time.Duration {
+	return parseDuration("manifests timeout", getManifests().Timeout, htsconstants.DfltManifestTimeout)
+}
+
+// GetManifestBreakerThreshold gets the number of consecutive failed fetches
+// from an issuer after which its manifests are no longer requested
+func GetManifestBreakerThreshold() int {
+	threshold := getManifests().BreakerThreshold
+	if threshold <= 0 {
+		return htsconstants.DfltManifestBreakerThreshold
+	}
+	return threshold
+}
+
+// GetManifestBreakerCooldown gets how long manifests are no longer requested
+// from an issuer after its fetches have repeatedly failed
+func GetManifestBreakerCooldown() time.Duration {
+	return parseDuration("manifests breakerCooldown", getManifests().BreakerCooldown, htsconstants.DfltManifestBreakerCooldown)
+}
+
+// IsManifestClipRegions checks if requested regions reaching outside the
+// manifest regions are clipped to the permitted parts, rather than rejected
+func IsManifestClipRegions() bool {
+	return *getManifests().ClipRegions
+}
@@ -0,0 +1,167 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module passportbrokers.go allows the program to be configured with the set of
+// passport brokers whose passports will be accepted on controlled endpoints,
+// along with the audiences, algorithms and clock skew permitted when verifying
+// them
+package htsconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htsutils"
+)
+
+// configurationPassport contains properties for verifying passports
+type configurationPassport struct {
+	Brokers   []*PassportBroker `json:"brokers"`
+	ClockSkew string            `json:"clockSkew"`
+	CacheTTL  string            `json:"cacheTTL"`
+	CacheSize int               `json:"cacheSize"`
+}
+
+// PassportBroker describes a single passport broker whose signed passports the
+// server will accept
+//
+// Attributes
+//	Issuer (string): broker issuer url, compared against the issuer of each passport
+//	JwksUri (string): location of the JSON web key set holding the broker's signing keys. if
+//	empty, the location is resolved through the broker's OIDC discovery document
+//	Jwks (json.RawMessage): the broker's JSON web key set, configured inline so that its
+//	keys are never fetched
+//	JwksFile (string): path of a file holding the broker's JSON web key set, reloaded when
+//	it changes. takes precedence over Jwks
+//	Audiences ([]string): passports must be intended for at least one of these audiences.
+//	every broker must be configured with one, as a passport issued for another service
+//	must not be accepted here
+//	Algorithms ([]string): JOSE algorithm names the broker is permitted to sign passports with
+//	IntrospectionEndpoint (string): RFC 7662 endpoint opaque access tokens from the broker
+//	are introspected at
+//	UserinfoEndpoint (string): OIDC userinfo endpoint the passport claims of opaque access
+//	tokens from the broker are read from
+//	ClientID (string): client id the server authenticates to the introspection endpoint with
+//	ClientSecret (string): client secret the server authenticates to the introspection endpoint with
+type PassportBroker struct {
+	Issuer                string          `json:"issuer"`
+	JwksUri               string          `json:"jwksUri"`
+	Jwks                  json.RawMessage `json:"jwks,omitempty"`
+	JwksFile              string          `json:"jwksFile,omitempty"`
+	Audiences             []string        `json:"audiences"`
+	Algorithms            []string        `json:"algorithms"`
+	IntrospectionEndpoint string          `json:"introspectionEndpoint,omitempty"`
+	UserinfoEndpoint      string          `json:"userinfoEndpoint,omitempty"`
+	ClientID              string          `json:"clientId,omitempty"`
+	ClientSecret          string          `json:"clientSecret,omitempty"`
+}
+
+// AllowsAlgorithm checks if the broker is permitted to sign passports with the
+// given JOSE algorithm
+//
+//	Type: PassportBroker
+// Arguments
+//	alg (string): JOSE algorithm name (e.g. RS256)
+// Returns
+//	(bool): if true, passports signed with the algorithm may be accepted
+func (broker *PassportBroker) AllowsAlgorithm(alg string) bool {
+	for _, allowed := range broker.Algorithms {
+		if strings.EqualFold(allowed, alg) {
+			return true
+		}
+	}
+	return false
+}
+
+// AcceptsAudience checks if a passport intended for the given audiences may be
+// accepted from the broker. a broker configured without audiences accepts no
+// passports
+//
+//	Type: PassportBroker
+// Arguments
+//	audiences ([]string): audiences of the passport (aud claim)
+// Returns
+//	(bool): if true, the passport is intended for this server
+func (broker *PassportBroker) AcceptsAudience(audiences []string) bool {
+	for _, audience := range audiences {
+		if htsutils.IsItemInArray(audience, broker.Audiences) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPassportBrokers checks that every configured passport broker names the
+// audiences its passports must be intended for
+func checkPassportBrokers(brokers []*PassportBroker) error {
+	for _, broker := range brokers {
+		if len(broker.Audiences) == 0 {
+			return fmt.Errorf("Passport broker %s must be configured with at least one audience", broker.Issuer)
+		}
+	}
+	return nil
+}
+
+// AcceptsOpaqueTokens checks if opaque access tokens may be exchanged with the
+// broker for passport claims, which the broker opts into by configuring an
+// introspection or userinfo endpoint
+//
+//	Type: PassportBroker
+// Returns
+//	(bool): if true, opaque tokens may be sent to the broker
+func (broker *PassportBroker) AcceptsOpaqueTokens() bool {
+	return broker.IntrospectionEndpoint != "" || broker.UserinfoEndpoint != ""
+}
+
+func getPassport() *configurationPassport {
+	return getContainer().Passport
+}
+
+// GetPassportBrokers gets all passport brokers the server has been configured
+// to trust
+func GetPassportBrokers() []*PassportBroker {
+	return getPassport().Brokers
+}
+
+// GetPassportBroker gets the passport broker configuration matching an issuer
+// url, or nil if the broker is not trusted
+func GetPassportBroker(issuer string) *PassportBroker {
+	for _, broker := range GetPassportBrokers() {
+		if broker.Issuer == issuer {
+			return broker
+		}
+	}
+	return nil
+}
+
+// AddPassportBroker trusts an additional passport broker, e.g. a local issuer
+// started by integration tests
+func AddPassportBroker(broker *PassportBroker) {
+	passport := getPassport()
+	passport.Brokers = append(passport.Brokers, broker)
+}
+
+// GetClockSkew gets the clock skew tolerated when checking the times of
+// passports and visas
+func GetClockSkew() time.Duration {
+	return parseDuration("passport clockSkew", getPassport().ClockSkew, htsconstants.DfltPassportClockSkew)
+}
+
+// GetPassportCacheTTL gets how long the visas of a verified passport are reused
+// for before the passport is verified again. zero disables the cache
+func GetPassportCacheTTL() time.Duration {
+	return parseDuration("passport cacheTTL", getPassport().CacheTTL, htsconstants.DfltPassportCacheTTL)
+}
+
+// GetPassportCacheSize gets the number of verified passports whose visas are
+// kept at once
+func GetPassportCacheSize() int {
+	size := getPassport().CacheSize
+	if size <= 0 {
+		return htsconstants.DfltPassportCacheSize
+	}
+	return size
+}
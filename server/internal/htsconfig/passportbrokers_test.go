@@ -0,0 +1,121 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module passportbrokers_test tests module passportbrokers
+package htsconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// passportBrokerTC sample passport broker used across test cases
+var passportBrokerTC = &PassportBroker{
+	Issuer:     "https://broker.example.org",
+	Audiences:  []string{"htsget", "htsget-staging"},
+	Algorithms: []string{"RS256", "ES256"},
+}
+
+// passportBrokerAllowsAlgorithmTC test cases for AllowsAlgorithm
+var passportBrokerAllowsAlgorithmTC = []struct {
+	alg string
+	exp bool
+}{
+	{"RS256", true},
+	{"es256", true},
+	{"HS256", false},
+	{"none", false},
+	{"", false},
+}
+
+// passportBrokerAcceptsAudienceTC test cases for AcceptsAudience
+var passportBrokerAcceptsAudienceTC = []struct {
+	broker    *PassportBroker
+	audiences []string
+	exp       bool
+}{
+	{passportBrokerTC, []string{"htsget"}, true},
+	{passportBrokerTC, []string{"portal", "htsget-staging"}, true},
+	{passportBrokerTC, []string{"portal"}, false},
+	{passportBrokerTC, []string{}, false},
+	{&PassportBroker{}, []string{"portal"}, false},
+	{&PassportBroker{}, []string{}, false},
+}
+
+// TestPassportBrokerAllowsAlgorithm tests AllowsAlgorithm function
+func TestPassportBrokerAllowsAlgorithm(t *testing.T) {
+	for _, tc := range passportBrokerAllowsAlgorithmTC {
+		assert.Equal(t, tc.exp, passportBrokerTC.AllowsAlgorithm(tc.alg))
+	}
+}
+
+// TestPassportBrokerAcceptsAudience tests AcceptsAudience function
+func TestPassportBrokerAcceptsAudience(t *testing.T) {
+	for _, tc := range passportBrokerAcceptsAudienceTC {
+		assert.Equal(t, tc.exp, tc.broker.AcceptsAudience(tc.audiences))
+	}
+}
+
+// TestPassportBrokerAcceptsOpaqueTokens tests AcceptsOpaqueTokens function
+func TestPassportBrokerAcceptsOpaqueTokens(t *testing.T) {
+	var tc = []struct {
+		broker *PassportBroker
+		exp    bool
+	}{
+		{passportBrokerTC, false},
+		{&PassportBroker{IntrospectionEndpoint: "https://broker.example.org/introspect"}, true},
+		{&PassportBroker{UserinfoEndpoint: "https://broker.example.org/userinfo"}, true},
+	}
+
+	for _, c := range tc {
+		assert.Equal(t, c.exp, c.broker.AcceptsOpaqueTokens())
+	}
+}
+
+// TestCheckPassportBrokers tests that every broker must be configured with an
+// audience
+func TestCheckPassportBrokers(t *testing.T) {
+	assert.Nil(t, checkPassportBrokers([]*PassportBroker{}))
+	assert.Nil(t, checkPassportBrokers([]*PassportBroker{passportBrokerTC}))
+	err := checkPassportBrokers([]*PassportBroker{passportBrokerTC, {Issuer: "https://local.example.org"}})
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), "https://local.example.org")
+	}
+}
+
+// TestGetPassportBroker tests lookup and addition of passport brokers from the
+// configuration
+func TestGetPassportBroker(t *testing.T) {
+	config := new(Configuration)
+	config.Container = &configurationContainer{
+		Passport: &configurationPassport{
+			Brokers:   []*PassportBroker{passportBrokerTC},
+			ClockSkew: "2m",
+		},
+	}
+	SetConfig(config)
+	configurationSingletonLoaded = true
+
+	assert.Equal(t, passportBrokerTC, GetPassportBroker("https://broker.example.org"))
+	assert.Nil(t, GetPassportBroker("https://local.example.org"))
+
+	local := &PassportBroker{Issuer: "https://local.example.org"}
+	AddPassportBroker(local)
+	assert.Equal(t, local, GetPassportBroker("https://local.example.org"))
+	assert.Equal(t, 2, len(GetPassportBrokers()))
+
+	assert.Equal(t, 2*time.Minute, GetClockSkew())
+	config.Container.Passport.ClockSkew = "soon"
+	assert.Equal(t, time.Minute, GetClockSkew())
+
+	assert.Equal(t, time.Minute, GetPassportCacheTTL())
+	assert.Equal(t, 1000, GetPassportCacheSize())
+	config.Container.Passport.CacheTTL = "0s"
+	config.Container.Passport.CacheSize = 50
+	assert.Equal(t, time.Duration(0), GetPassportCacheTTL())
+	assert.Equal(t, 50, GetPassportCacheSize())
+
+	SetConfig(DefaultConfiguration)
+}
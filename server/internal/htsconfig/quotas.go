@@ -0,0 +1,61 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module quotas.go allows the program to be configured with the number of
+// tickets and the volume of data each passport holder may be granted for a
+// controlled dataset within a window of time
+package htsconfig
+
+import (
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+)
+
+// configurationQuotas contains properties for per-subject quotas
+type configurationQuotas struct {
+	File        string `json:"file"`
+	Window      string `json:"window"`
+	MaxRequests int    `json:"maxRequests"`
+	MaxEgressMB int    `json:"maxEgressMB"`
+}
+
+func getQuotas() *configurationQuotas {
+	return getContainer().Quotas
+}
+
+// GetQuotaFile gets the path of the store quota usage is kept in. if empty,
+// quotas are not enforced
+func GetQuotaFile() string {
+	return getQuotas().File
+}
+
+// GetQuotaWindow gets the length of the window that quota usage is counted
+// over before it is reset
+func GetQuotaWindow() time.Duration {
+	window := parseDuration("quota window", getQuotas().Window, htsconstants.DfltQuotaWindow)
+	if window <= 0 {
+		window, _ = time.ParseDuration(htsconstants.DfltQuotaWindow)
+	}
+	return window
+}
+
+// GetQuotaMaxRequests gets the number of tickets a subject may be issued for a
+// dataset within a window, 0 if unlimited
+func GetQuotaMaxRequests() int {
+	maxRequests := getQuotas().MaxRequests
+	if maxRequests <= 0 {
+		return 0
+	}
+	return maxRequests
+}
+
+// GetQuotaMaxEgress gets the number of bytes a subject may be granted tickets
+// for from a dataset within a window, 0 if unlimited
+func GetQuotaMaxEgress() int64 {
+	maxEgressMB := getQuotas().MaxEgressMB
+	if maxEgressMB <= 0 {
+		return 0
+	}
+	return int64(maxEgressMB) * 1024 * 1024
+}
@@ -27,8 +27,9 @@ type Organization struct {
 }
 
 type HtsgetExtension struct {
-	Datatype                 string   `json:"datatype"`
-	Formats                  []string `json:"formats"`
-	FieldsParameterEffective *bool    `json:"fieldsParameterEffective"`
-	TagsParametersEffective  *bool    `json:"tagsParametersEffective"`
+	Datatype                 string     `json:"datatype"`
+	Formats                  []string   `json:"formats"`
+	FieldsParameterEffective *bool      `json:"fieldsParameterEffective"`
+	TagsParametersEffective  *bool      `json:"tagsParametersEffective"`
+	Datasets                 []*Dataset `json:"datasets,omitempty"`
 }
@@ -0,0 +1,127 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module trustedissuers.go allows the program to be configured with the set of
+// visa issuers (Data Access Committees) whose visas will be evaluated when
+// granting controlled access to datasets
+package htsconfig
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+)
+
+// TrustedIssuerAnyDataset is the datasets entry allowing an issuer to grant
+// access to any dataset served by this instance
+const TrustedIssuerAnyDataset = "*"
+
+// TrustedIssuer describes a single visa issuer whose signed visas the server
+// is willing to evaluate
+//
+// Attributes
+//	Issuer (string): issuer url, compared against the issuer of each visa
+//	JwksUri (string): location of the JSON web key set holding the issuer's signing keys. if
+//	empty, the location is resolved through the issuer's OIDC discovery document
+//	Jwks (json.RawMessage): the issuer's JSON web key set, configured inline so that its
+//	keys are never fetched
+//	JwksFile (string): path of a file holding the issuer's JSON web key set, reloaded when
+//	it changes. takes precedence over Jwks
+//	Algorithms ([]string): JOSE algorithm names the issuer is permitted to sign visas with,
+//	any of EdDSA, RS256, PS256, ES256 or ES384
+//	Datasets ([]string): dataset ids the issuer is permitted to grant access to
+//	Revocation (*IssuerRevocation): where the issuer publishes the visas it has revoked, nil
+//	if revocation is not checked
+type TrustedIssuer struct {
+	Issuer     string            `json:"issuer"`
+	JwksUri    string            `json:"jwksUri"`
+	Jwks       json.RawMessage   `json:"jwks,omitempty"`
+	JwksFile   string            `json:"jwksFile,omitempty"`
+	Algorithms []string          `json:"algorithms"`
+	Datasets   []string          `json:"datasets"`
+	Revocation *IssuerRevocation `json:"revocation,omitempty"`
+}
+
+// IssuerRevocation describes the revocation list of a trusted issuer, listing
+// visas withdrawn before their expiry
+//
+// Attributes
+//	Uri (string): location the issuer publishes its revocation list at
+//	File (string): path of a local copy of the revocation list, read when the list cannot be
+//	fetched from Uri, or if no Uri is configured
+//	Refresh (string): how often the revocation list is reloaded, as a duration
+//	MaxStaleness (string): how long after it was loaded the revocation list may be used
+//	while it cannot be reloaded, as a duration
+type IssuerRevocation struct {
+	Uri          string `json:"uri,omitempty"`
+	File         string `json:"file,omitempty"`
+	Refresh      string `json:"refresh,omitempty"`
+	MaxStaleness string `json:"maxStaleness,omitempty"`
+}
+
+// GetRefresh gets how often the revocation list is reloaded
+//
+//	Type: IssuerRevocation
+// Returns
+//	(time.Duration): time a loaded revocation list is used before it is reloaded
+func (revocation *IssuerRevocation) GetRefresh() time.Duration {
+	refresh := revocation.Refresh
+	if refresh == "" {
+		refresh = htsconstants.DfltRevocationRefresh
+	}
+	return parseDuration("revocation refresh", refresh, htsconstants.DfltRevocationRefresh)
+}
+
+// GetMaxStaleness gets how long after it was loaded the revocation list may be
+// used while it cannot be reloaded. it is never less than the refresh
+// interval, as the list is not reloaded before then
+//
+//	Type: IssuerRevocation
+// Returns
+//	(time.Duration): time after loading that the revocation list is no longer trusted
+func (revocation *IssuerRevocation) GetMaxStaleness() time.Duration {
+	maxStaleness := revocation.MaxStaleness
+	if maxStaleness == "" {
+		maxStaleness = htsconstants.DfltRevocationMaxStaleness
+	}
+	staleness := parseDuration("revocation maxStaleness", maxStaleness, htsconstants.DfltRevocationMaxStaleness)
+	if refresh := revocation.GetRefresh(); staleness < refresh {
+		return refresh
+	}
+	return staleness
+}
+
+// AllowsAlgorithm checks if the issuer is permitted to sign visas with the
+// given JOSE algorithm
+//
+//	Type: TrustedIssuer
+// Arguments
+//	alg (string): JOSE algorithm name (e.g. EdDSA)
+// Returns
+//	(bool): if true, visas signed with the algorithm may be accepted
+func (trustedIssuer *TrustedIssuer) AllowsAlgorithm(alg string) bool {
+	for _, allowed := range trustedIssuer.Algorithms {
+		if strings.EqualFold(allowed, alg) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanGrant checks if the issuer is permitted to grant access to a dataset
+//
+//	Type: TrustedIssuer
+// Arguments
+//	datasetID (string): requested dataset id
+// Returns
+//	(bool): if true, a visa from this issuer may grant access to the dataset
+func (trustedIssuer *TrustedIssuer) CanGrant(datasetID string) bool {
+	for _, dataset := range trustedIssuer.Datasets {
+		if dataset == TrustedIssuerAnyDataset || dataset == datasetID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,107 @@
+// Package htsconfig allows the program to be configured with modifiable
+// properties, affecting runtime properties. also contains program constants
+//
+// Module trustedissuers_test tests module trustedissuers
+package htsconfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// trustedIssuerTC sample trusted issuer used across test cases
+var trustedIssuerTC = &TrustedIssuer{
+	Issuer:     "https://dac.example.org/",
+	Algorithms: []string{"EdDSA"},
+	Datasets:   []string{"10g", "giab"},
+}
+
+// trustedIssuerAllowsAlgorithmTC test cases for AllowsAlgorithm
+var trustedIssuerAllowsAlgorithmTC = []struct {
+	alg string
+	exp bool
+}{
+	{"EdDSA", true},
+	{"eddsa", true},
+	{"RS256", false},
+	{"", false},
+}
+
+// trustedIssuerCanGrantTC test cases for CanGrant
+var trustedIssuerCanGrantTC = []struct {
+	trustedIssuer *TrustedIssuer
+	datasetID     string
+	exp           bool
+}{
+	{trustedIssuerTC, "10g", true},
+	{trustedIssuerTC, "giab", true},
+	{trustedIssuerTC, "1000genomes", false},
+	{&TrustedIssuer{Datasets: []string{TrustedIssuerAnyDataset}}, "1000genomes", true},
+	{&TrustedIssuer{}, "10g", false},
+}
+
+// TestTrustedIssuerAllowsAlgorithm tests AllowsAlgorithm function
+func TestTrustedIssuerAllowsAlgorithm(t *testing.T) {
+	for _, tc := range trustedIssuerAllowsAlgorithmTC {
+		assert.Equal(t, tc.exp, trustedIssuerTC.AllowsAlgorithm(tc.alg))
+	}
+}
+
+// TestTrustedIssuerCanGrant tests CanGrant function
+func TestTrustedIssuerCanGrant(t *testing.T) {
+	for _, tc := range trustedIssuerCanGrantTC {
+		assert.Equal(t, tc.exp, tc.trustedIssuer.CanGrant(tc.datasetID))
+	}
+}
+
+// TestIssuerRevocationGetRefresh tests GetRefresh function
+func TestIssuerRevocationGetRefresh(t *testing.T) {
+	var tc = []struct {
+		refresh string
+		exp     time.Duration
+	}{
+		{"", 5 * time.Minute},
+		{"30s", 30 * time.Second},
+		{"hourly", 5 * time.Minute},
+	}
+
+	for _, c := range tc {
+		assert.Equal(t, c.exp, (&IssuerRevocation{Refresh: c.refresh}).GetRefresh())
+	}
+}
+
+// TestIssuerRevocationGetMaxStaleness tests GetMaxStaleness function
+func TestIssuerRevocationGetMaxStaleness(t *testing.T) {
+	var tc = []struct {
+		refresh      string
+		maxStaleness string
+		exp          time.Duration
+	}{
+		{"", "", time.Hour},
+		{"", "24h", 24 * time.Hour},
+		{"", "daily", time.Hour},
+		{"2h", "", 2 * time.Hour},
+		{"5m", "1m", 5 * time.Minute},
+	}
+
+	for _, c := range tc {
+		assert.Equal(t, c.exp, (&IssuerRevocation{Refresh: c.refresh, MaxStaleness: c.maxStaleness}).GetMaxStaleness())
+	}
+}
+
+// TestGetTrustedIssuer tests lookup of trusted issuers from the configuration
+func TestGetTrustedIssuer(t *testing.T) {
+	config := new(Configuration)
+	config.Container = &configurationContainer{
+		TrustedIssuers: []*TrustedIssuer{trustedIssuerTC},
+	}
+	SetConfig(config)
+	configurationSingletonLoaded = true
+
+	assert.Equal(t, trustedIssuerTC, GetTrustedIssuer("https://dac.example.org/"))
+	assert.Nil(t, GetTrustedIssuer("https://untrusted.example.org/"))
+
+	SetConfig(DefaultConfiguration)
+}
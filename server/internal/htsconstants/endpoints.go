@@ -14,18 +14,28 @@ const (
 	APIEndpointVariantsTicket      APIEndpoint = 3
 	APIEndpointVariantsData        APIEndpoint = 4
 	APIEndpointVariantsServiceInfo APIEndpoint = 5
-	APIEndpointFileBytes           APIEndpoint = 6
+	APIEndpointReadsBytes          APIEndpoint = 6
+	APIEndpointReadsDatasets       APIEndpoint = 7
+	APIEndpointVariantsDatasets    APIEndpoint = 8
+	APIEndpointVariantsBytes       APIEndpoint = 9
 )
 
+// LegacyReadsTicketPath path reads tickets were requested from before they
+// were scoped by dataset. it is served for a single configured dataset
+const LegacyReadsTicketPath = "/reads/{id}"
+
 // maps enum int values to string representation
 var htsEndpointStringMap = map[APIEndpoint]string{
-	APIEndpointReadsTicket:         "/reads/{id}*",
+	APIEndpointReadsTicket:         "/reads/{dataset}/*",
 	APIEndpointReadsData:           "/reads/data/{id}*",
 	APIEndpointReadsServiceInfo:    "/reads/service-info",
 	APIEndpointVariantsTicket:      "/variants/{dataset}/*",
 	APIEndpointVariantsData:        "/variants/data/{id}*",
 	APIEndpointVariantsServiceInfo: "/variants/service-info",
-	APIEndpointFileBytes:           "/file-bytes",
+	APIEndpointReadsBytes:          "/reads/bytes/{id}*",
+	APIEndpointReadsDatasets:       "/reads/datasets",
+	APIEndpointVariantsDatasets:    "/variants/datasets",
+	APIEndpointVariantsBytes:       "/variants/bytes/{id}*",
 }
 
 // maps ticket endpoints to their corresponding data endpoint prefixes
@@ -34,10 +44,17 @@ var ticketEndpointToDataEndpointPathMap = map[APIEndpoint]string{
 	APIEndpointVariantsTicket: "/variants/data/",
 }
 
+// maps ticket endpoints to the prefixes of the endpoints serving byte ranges
+// of their local objects
+var ticketEndpointToBytesEndpointPathMap = map[APIEndpoint]string{
+	APIEndpointReadsTicket:    "/reads/bytes/",
+	APIEndpointVariantsTicket: "/variants/bytes/",
+}
+
 // maps endpoints to allowed format values
 var endpointToEnabledFormatsMap = map[APIEndpoint][]string{
-	APIEndpointReadsTicket:    []string{FormatBam /*, FormatCram */},
-	APIEndpointReadsData:      []string{FormatBam /*, FormatCram */},
+	APIEndpointReadsTicket:    []string{FormatBam, FormatCram},
+	APIEndpointReadsData:      []string{FormatBam, FormatCram},
 	APIEndpointVariantsTicket: []string{FormatVcf /*, FormatBcf */},
 	APIEndpointVariantsData:   []string{FormatVcf /*, FormatBcf */},
 }
@@ -53,6 +70,12 @@ func (e APIEndpoint) DataEndpointPath() string {
 	return ticketEndpointToDataEndpointPathMap[e]
 }
 
+// BytesEndpointPath gets the prefix of the endpoint serving byte ranges of the
+// local objects of a given ticket APIEndpoint
+func (e APIEndpoint) BytesEndpointPath() string {
+	return ticketEndpointToBytesEndpointPathMap[e]
+}
+
 // AllowedFormats gets the acceptable requested formats based on the API Endpoint
 func (e APIEndpoint) AllowedFormats() []string {
 	return endpointToEnabledFormatsMap[e]
@@ -14,10 +14,11 @@ var endpointsStringTC = []struct {
 	e   APIEndpoint
 	exp string
 }{
-	{APIEndpointReadsTicket, "/reads/{id}*"},
+	{APIEndpointReadsTicket, "/reads/{dataset}/*"},
 	{APIEndpointReadsData, "/reads/data/{id}*"},
 	{APIEndpointVariantsServiceInfo, "/variants/service-info"},
-	{APIEndpointFileBytes, "/file-bytes"},
+	{APIEndpointReadsBytes, "/reads/bytes/{id}*"},
+	{APIEndpointVariantsDatasets, "/variants/datasets"},
 }
 
 // endpointsDataEndpointPathTC test cases for DataEndpointPath
@@ -29,13 +30,23 @@ var endpointsDataEndpointPathTC = []struct {
 	{APIEndpointVariantsTicket, "/variants/data/"},
 }
 
+// endpointsBytesEndpointPathTC test cases for BytesEndpointPath
+var endpointsBytesEndpointPathTC = []struct {
+	e   APIEndpoint
+	exp string
+}{
+	{APIEndpointReadsTicket, "/reads/bytes/"},
+	{APIEndpointVariantsTicket, "/variants/bytes/"},
+	{APIEndpointReadsData, ""},
+}
+
 // endpointsAllowedFormatsTC test cases for AllowedFormats
 var endpointsAllowedFormatsTC = []struct {
 	e   APIEndpoint
 	exp []string
 }{
-	{APIEndpointReadsTicket, []string{"BAM"}},
-	{APIEndpointReadsData, []string{"BAM"}},
+	{APIEndpointReadsTicket, []string{"BAM", "CRAM"}},
+	{APIEndpointReadsData, []string{"BAM", "CRAM"}},
 	{APIEndpointVariantsTicket, []string{"VCF"}},
 	{APIEndpointVariantsData, []string{"VCF"}},
 }
@@ -54,6 +65,13 @@ func TestEndpointsDataEndpointPath(t *testing.T) {
 	}
 }
 
+// TestEndpointsBytesEndpointPath tests BytesEndpointPath function
+func TestEndpointsBytesEndpointPath(t *testing.T) {
+	for _, tc := range endpointsBytesEndpointPathTC {
+		assert.Equal(t, tc.exp, tc.e.BytesEndpointPath())
+	}
+}
+
 // TestEndpointsAllowedFormats tests AllowedFormats function
 func TestEndpointsAllowedFormats(t *testing.T) {
 	for _, tc := range endpointsAllowedFormatsTC {
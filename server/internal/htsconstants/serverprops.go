@@ -37,6 +37,67 @@ var DfltCorsMaxAge = 300
 
 var DfltAwsAssumeRole = false
 
+// DfltIndexCacheTTL default time an index fetched over http is used before it is fetched again
+var DfltIndexCacheTTL = "10m"
+
+// DfltURLLifetime default time the data urls of a ticket are accepted for
+var DfltURLLifetime = "1h"
+
+// DfltPassportClockSkew default clock skew tolerated when checking passport and visa times
+var DfltPassportClockSkew = "60s"
+
+// DfltPassportCacheTTL default time the visas of a verified passport are reused for
+var DfltPassportCacheTTL = "60s"
+
+// DfltPassportCacheSize default number of verified passports whose visas are kept
+var DfltPassportCacheSize = 1000
+
+// DfltRevocationRefresh default time a visa revocation list is used before it is reloaded
+var DfltRevocationRefresh = "5m"
+
+// DfltRevocationMaxStaleness default time a visa revocation list that cannot be
+// reloaded is used for, counted from when it was loaded
+var DfltRevocationMaxStaleness = "1h"
+
+/* **************************************************
+ * MANIFESTS
+ * ************************************************** */
+
+// DfltManifestProvider default provider manifests are loaded with
+var DfltManifestProvider = "http"
+
+// DfltManifestCacheTTL default time a fetched manifest is used before it is revalidated
+var DfltManifestCacheTTL = "5m"
+
+// DfltManifestTimeout default timeout for manifest http requests
+var DfltManifestTimeout = "15s"
+
+// DfltManifestBreakerThreshold default consecutive failed fetches before an issuer is no longer called
+var DfltManifestBreakerThreshold = 5
+
+// DfltManifestBreakerCooldown default time an issuer is no longer called after repeated failures
+var DfltManifestBreakerCooldown = "30s"
+
+// DfltManifestClipRegions default for whether requested regions are clipped to the manifest regions
+var DfltManifestClipRegions = false
+
+/* **************************************************
+ * AUDIT
+ * ************************************************** */
+
+// DfltAuditMaxSizeMB default size in megabytes the audit log grows to before it is rotated
+var DfltAuditMaxSizeMB = 100
+
+// DfltAuditMaxFiles default number of rotated audit logs kept
+var DfltAuditMaxFiles = 10
+
+/* **************************************************
+ * QUOTAS
+ * ************************************************** */
+
+// DfltQuotaWindow default window that quota usage is counted over
+var DfltQuotaWindow = "24h"
+
 /* **************************************************
  * READS DATA SOURCE REGISTRY
  * ************************************************** */
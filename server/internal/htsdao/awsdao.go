@@ -1,13 +1,15 @@
 package htsdao
 
 import (
-	"compress/gzip"
 	"github.com/ga4gh/htsget-refserver/internal/awsutils"
 	"github.com/ga4gh/htsget-refserver/internal/bgzf"
+	"github.com/ga4gh/htsget-refserver/internal/csi"
 	log "github.com/ga4gh/htsget-refserver/internal/htslog"
 	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
 	"github.com/ga4gh/htsget-refserver/internal/htsticket"
 	"github.com/ga4gh/htsget-refserver/internal/tabix"
+	"io"
+	"io/ioutil"
 	"sort"
 	"time"
 )
@@ -23,6 +25,9 @@ type Index interface {
 	Skip() int
 }
 
+// a CSI index carries the same tabix-like configuration as a tabix index
+var _ Index = (*csi.Index)(nil)
+
 type tIndex struct{ *tabix.Index }
 
 func (t tIndex) NameColumn() int {
@@ -48,9 +53,15 @@ func (t tIndex) Skip() int {
 	return int(t.Index.Skip)
 }
 
+// AWSDao serves an object on S3 through presigned urls. the bounds of the data
+// of the object are read once, so are only kept for the ticket the dao was
+// created for
 type AWSDao struct {
-	id  string
-	url string
+	id         string
+	url        string
+	boundsRead bool
+	dataEndAt  int64
+	size       int64
 }
 
 func NewAWSDao(id string, url string) *AWSDao {
@@ -75,42 +86,119 @@ func (dao *AWSDao) GetContentLength() int64 {
 	}
 }
 
-func (dao *AWSDao) GetHeaderByteRangeUrl() *htsticket.URL {
-
-	indexBodyReader, err := awsutils.GetS3Object(awsutils.S3Dto{
-		ObjPath: dao.url + ".tbi",
+// readIndex reads the index alongside the object
+func (dao *AWSDao) readIndex() (regionIndex, error) {
+	return readRegionIndex(dao.url, func(suffix string) (io.ReadCloser, error) {
+		return awsutils.GetS3Object(awsutils.S3Dto{
+			ObjPath: dao.url + suffix,
+		})
 	})
+}
+
+// openRange opens an inclusive byte range of the object
+func (dao *AWSDao) openRange(start, end int64) (io.ReadCloser, error) {
+	return awsutils.GetS3ObjectRange(awsutils.S3Dto{
+		ObjPath: dao.url,
+	}, start, end)
+}
 
-	gz, err := gzip.NewReader(indexBodyReader)
+// dataBounds gets the offset the data of the object ends at, before its EOF
+// block or container, along with the size of the object. they are read from
+// the object the first time they are needed
+func (dao *AWSDao) dataBounds() (int64, int64) {
+	if !dao.boundsRead {
+		dao.dataEndAt, dao.size = dao.readDataBounds()
+		dao.boundsRead = true
+	}
+	return dao.dataEndAt, dao.size
+}
 
+// readDataBounds reads the bounds of the data from the size of the object and
+// the bytes it ends with
+func (dao *AWSDao) readDataBounds() (int64, int64) {
+	size := dao.GetContentLength()
+	tailSize := int64(eofTailSize)
+	if size < tailSize {
+		tailSize = size
+	}
+	if tailSize == 0 {
+		return size, size
+	}
+
+	tailReader, err := awsutils.GetS3ObjectRange(awsutils.S3Dto{
+		ObjPath: dao.url,
+	}, size-tailSize, size-1)
 	if err != nil {
-		log.Error("GetHeaderByteRangeUrl: %v", err)
-		return nil
+		log.Error("Reading the end of %s: %v", dao.url, err)
+		return size, size
 	}
+	defer tailReader.Close()
 
-	defer gz.Close()
+	tail, err := ioutil.ReadAll(tailReader)
+	if err != nil {
+		log.Error("Reading the end of %s: %v", dao.url, err)
+		return size, size
+	}
+	return dataEndOf(dao.url, tail, size), size
+}
 
-	t, err := tabix.ReadFrom(gz)
+// dataEnd gets the offset the data of the object ends at, before its EOF block
+// or container
+func (dao *AWSDao) dataEnd() int64 {
+	dataEnd, _ := dao.dataBounds()
+	return dataEnd
+}
+
+// makeRangeUrl presigns a url for an inclusive byte range of the object
+func (dao *AWSDao) makeRangeUrl(block byteRange) (*htsticket.URL, error) {
+	req, err := awsutils.PresignGetObjectRange(awsutils.S3Dto{
+		ObjPath: dao.url,
+	}, block.start, block.end)
 	if err != nil {
-		log.Error("GetHeaderByteRangeUrl: %v", err)
-		return nil
+		return nil, err
 	}
 
-	for _, name := range t.Names() {
-		chunks, _ := t.Chunks(name, 0, 1000000000)
+	return htsticket.NewURL().
+		SetURL(req).
+		SetHeaders(htsticket.NewHeaders().SetRangeHeader(block.start, block.end)), nil
+}
 
-		for _, chunk := range chunks {
-			return MakeHeaderUrl(dao, chunk)
-		}
+func (dao *AWSDao) GetHeaderByteRangeUrl() *htsticket.URL {
+	t, err := dao.readIndex()
+	if err != nil {
+		log.Error("GetHeaderByteRangeUrl: %v", err)
+		return nil
+	}
 
+	header, ok := indexHeaderRange(t)
+	if !ok {
 		return nil
 	}
 
-	return nil
+	url, err := dao.makeRangeUrl(header)
+	if err != nil {
+		log.Error("Creating pre-signed URL %v", err)
+		return nil
+	}
+	return url.SetClassHeader()
 }
 
 func (dao *AWSDao) GetBgzipEof() *htsticket.URL {
 
+	// a BAM object is served its own EOF block, and a CRAM object its own EOF container
+	if isBamPath(dao.url) || isCramPath(dao.url) {
+		dataEnd, size := dao.dataBounds()
+		if dataEnd == size {
+			return nil
+		}
+		url, err := dao.makeRangeUrl(byteRange{dataEnd, size - 1})
+		if err != nil {
+			log.Error("Creating pre-signed URL %v", err)
+			return nil
+		}
+		return url.SetClassBody()
+	}
+
 	// TODO: this should come from a config setting.. or we should teach the server htsget inlining
 	req, _ := awsutils.PresignGetObject(awsutils.S3Dto{
 		ObjPath: "s3://umccr-10g-data-dev/bgzip-eof.bin",
@@ -125,28 +213,15 @@ func (dao *AWSDao) GetBgzipEof() *htsticket.URL {
 // GetByteRangeUrls return the content of this file as a set of 'block' URLs
 func (dao *AWSDao) GetByteRangeUrls() []*htsticket.URL {
 
-	indexBodyReader, err := awsutils.GetS3Object(awsutils.S3Dto{
-		ObjPath: dao.url + ".tbi",
-	})
-
+	t, err := dao.readIndex()
 	if err != nil {
 		log.Error("GetByteRangeUrls: %v", err)
 		return nil
 	}
 
-	gz, err := gzip.NewReader(indexBodyReader)
-
-	if err != nil {
-		log.Error("GetByteRangeUrls: %v", err)
-		return nil
-	}
-
-	defer gz.Close()
-
-	t, err := tabix.ReadFrom(gz)
-	if err != nil {
-		log.Error("GetByteRangeUrls: %v", err)
-		return nil
+	// the containers of a CRAM object are only ever served whole, so all of its data is served in one
+	if isCramPath(dao.url) {
+		return dao.getWholeDataUrls(t)
 	}
 
 	var goodNames = []string{"chr1", "chr2", "chr3", "chr4", "chr5", "chr6", "chr7", "chr8", "chr9", "chr10", "chr11", "chr12", "chr13", "chr14", "chr15", "chr16", "chr17", "chr18", "chr19", "chr20", "chr21", "chr22", "chr23", "chrM", "chrX", "chrY"}
@@ -187,26 +262,41 @@ func (dao *AWSDao) GetByteRangeUrls() []*htsticket.URL {
 	return urls
 }
 
+// getWholeDataUrls return the URLs of the header of the object, as located
+// through its index, and of all the data that follows it up to its EOF block
+// or container
+func (dao *AWSDao) getWholeDataUrls(t regionIndex) []*htsticket.URL {
+	urls := []*htsticket.URL{}
+
+	header, ok := indexHeaderRange(t)
+	if !ok {
+		return urls
+	}
+	url, err := dao.makeRangeUrl(header)
+	if err != nil {
+		log.Error("Creating pre-signed URL %v", err)
+		return urls
+	}
+	urls = append(urls, url.SetClassHeader())
+
+	if dataEnd := dao.dataEnd(); dataEnd > header.end+1 {
+		url, err := dao.makeRangeUrl(byteRange{header.end + 1, dataEnd - 1})
+		if err != nil {
+			log.Error("Creating pre-signed URL %v", err)
+			return urls
+		}
+		urls = append(urls, url.SetClassBody())
+	}
+	return urls
+}
+
 // GetChunkedInPlaceBlocks return the URLs for this
 func (dao *AWSDao) GetChunkedInPlaceBlocks(regions []*htsrequest.Region) []*htsticket.URL {
 
 	startTime := time.Now()
 
 	// locate the index file and read it in
-	indexBodyReader, err := awsutils.GetS3Object(awsutils.S3Dto{
-		ObjPath: dao.url + ".tbi",
-	})
-
-	gz, err := gzip.NewReader(indexBodyReader)
-
-	if err != nil {
-		log.Error("GetChunkedInPlaceBlocks: %v", err)
-		return nil
-	}
-
-	defer gz.Close()
-
-	t, err := tabix.ReadFrom(gz)
+	t, err := dao.readIndex()
 	if err != nil {
 		log.Error("GetChunkedInPlaceBlocks: %v", err)
 		return nil
@@ -215,118 +305,37 @@ func (dao *AWSDao) GetChunkedInPlaceBlocks(regions []*htsrequest.Region) []*htst
 	// Code to measure
 	duration := time.Since(startTime)
 
-	log.Debug("loading tabix = %s", duration)
+	log.Debug("loading index = %s", duration)
 
 	// we are going to build an array of URLs pointing directly at the blocks in S3
 	urls := make([]*htsticket.URL, 0)
 
 	// start by adding in the header (everything *before* the first index chunk)
-	for _, name := range t.Names() {
-		chunks, _ := t.Chunks(name, 0, 1000000000)
-
-		for _, chunk := range chunks {
-			urls = append(urls, MakeHeaderUrl(dao, chunk))
-			break
+	if header, ok := indexHeaderRange(t); ok {
+		url, err := dao.makeRangeUrl(header)
+		if err != nil {
+			log.Error("Creating pre-signed URL %v", err)
+		} else {
+			urls = append(urls, url.SetClassHeader())
 		}
-		break
 	}
 
-	// for every region requested
+	// for every region requested, the index gives the blocks to serve - a region running to the end
+	// of the data is served up to the EOF block of the object
+	length := cachedBlockLength(func(offset int64) (int64, error) {
+		return readBlockLength(rangeReader(dao.openRange), offset)
+	})
 	for _, r := range regions {
-		// handle open-ended region request
-		start := 0
-		if r.StartRequested() {
-			start = r.GetStart()
-		}
-
-		// handle open-ended region request (i.e all of "chr1") by asking for the region up to maxint unless set
-		end := 1000000000
-		if r.EndRequested() {
-			end = r.GetEnd()
-		}
-
-		startTime = time.Now()
-
-		// consult the index for the block range of the asked for region
-		chunks, next, _ := t.ChunksWithNext(r.GetReferenceName(), start, end)
-
-		chunksLookupDuration := time.Since(startTime)
-
-		log.Debug("Region %s %d-%d lookup into %d BGZIP chunks took %s", r.GetReferenceName(), start, end, len(chunks), chunksLookupDuration)
-
-
-		for _, chunk := range chunks {
-			startTime = time.Now()
-
-			// reads the GZIP block header from the actual file data
-			// this is the only location for the actual block size data
-			//lastBlockReader, _ := awsutils.GetS3ObjectRange(awsutils.S3Dto{
-			//	ObjPath: dao.url,
-			//}, chunk.End.File, chunk.End.File+128)
-
-			//lastBlockContents, _ := ioutil.ReadAll(lastBlockReader)
-			//lastBlockSize := binary.LittleEndian.Uint16(lastBlockContents[16:]) + 1
-
-			blockHeaders := htsticket.NewHeaders().SetRangeHeader(chunk.Begin.File, next-1)
-
-			req, err := awsutils.PresignGetObjectRange(awsutils.S3Dto{
-				ObjPath: dao.url,
-			}, chunk.Begin.File, next-1)
-
-			chunkDuration := time.Since(startTime)
-
-			log.Debug("Index chunk %v extended out to %d and took %s", chunk, next, chunkDuration)
-			// log.Debug("Index chunk %v and a final block size of %d (from data 2 bytes before .. %v .. 2 bytes after) took %s", chunk, lastBlockSize, lastBlockContents[14:20], chunkDuration)
-
+		for _, block := range indexRegionRanges(t, r, dao.dataEnd, length) {
+			url, err := dao.makeRangeUrl(block)
 			if err != nil {
 				log.Error("Skipping chunk due to error creating pre-signed S3 link %v", err)
-
-			} else {
-				url := htsticket.NewURL().
-					SetURL(req).
-					SetHeaders(blockHeaders).
-					SetClassBody()
-
-				urls = append(urls, url)
+				continue
 			}
-
+			urls = append(urls, url.SetClassBody())
 		}
 	}
 
-	// type Chunk struct {
-	//	Begin struct {
-	//	//	File  int64
-	//	//	Block uint16
-	//	//}
-	//	End   struct {
-	//	//	File  int64
-	//	//	Block uint16
-	//	//}
-	//}
-	//Chunk is a region of a BGZF file.
-	//type Offset ¶
-	//type Offset
-	//blockSize := htsconstants.SingleBlockByteSize
-	//var start, end, numBytes int64 = 0, 0, 0
-	//numBlocks := 0 //int(math.Ceil(float64(numBytes) / float64(blockSize)))
-	/*for i := 1; i <= numBlocks; i++ {
-		end = start + blockSize - 1
-		if end >= numBytes {
-			end = numBytes - 1
-		}
-		headers := htsticket.NewHeaders()
-		headers.SetRangeHeader(start, end)
-		url := htsticket.NewURL()
-		url.SetURL(dao.url)
-		url.SetHeaders(headers)
-		start = end + 1
-		urls = append(urls, url)
-	}*/
-	//nBlocks := handler.HtsReq.NRegions() + 1
-	//blockURLs = addHeaderBlockURL(blockURLs, handler.HtsReq, nBlocks)
-	//for i := range handler.HtsReq.GetRegions() {
-	//	blockURLs = addBodyBlockURL(blockURLs, handler.HtsReq, i+1, nBlocks, true, i)
-	//}
 	return urls
 }
 
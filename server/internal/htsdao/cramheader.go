@@ -0,0 +1,214 @@
+package htsdao
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// cramFileDefinitionSize size of the file definition a CRAM file starts with,
+// i.e. the magic number, the version and the file id
+const cramFileDefinitionSize = 26
+
+// cramFileHeaderContent content type of the block holding the SAM header
+const cramFileHeaderContent = 0
+
+// isCramPath checks if a path or url names a CRAM file, which is indexed by a
+// CRAI index rather than a tabix index
+func isCramPath(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".cram")
+}
+
+// readCramReferenceNames reads the names of the references of a CRAM file, in
+// the order of the @SQ lines of the SAM header held by its header container,
+// which is the order its CRAI index numbers them in. only as much of the file
+// as holds the header is read
+func readCramReferenceNames(reader io.Reader) ([]string, error) {
+	r := bufio.NewReader(reader)
+
+	var definition [cramFileDefinitionSize]byte
+	if _, err := io.ReadFull(r, definition[:]); err != nil {
+		return nil, err
+	}
+	if string(definition[:4]) != "CRAM" {
+		return nil, errors.New("cram: magic number mismatch")
+	}
+	major, minor := definition[4], definition[5]
+	if major != 2 && major != 3 {
+		return nil, fmt.Errorf("cram: version %d.%d not supported", major, minor)
+	}
+
+	// the header container: its length, then the reference, position, span,
+	// record count, record counter, base count, block count and landmarks
+	var length int32
+	if err := binary.Read(r, binary.LittleEndian, &length); err != nil {
+		return nil, err
+	}
+	for _, read := range []func(io.ByteReader) (int64, error){readItf8, readItf8, readItf8, readItf8, readLtf8, readLtf8, readItf8} {
+		if _, err := read(r); err != nil {
+			return nil, err
+		}
+	}
+	landmarks, err := readItf8(r)
+	if err != nil {
+		return nil, err
+	}
+	for i := int64(0); i < landmarks; i++ {
+		if _, err := readItf8(r); err != nil {
+			return nil, err
+		}
+	}
+	if major >= 3 {
+		if _, err := io.CopyN(ioutil.Discard, r, 4); err != nil {
+			return nil, err
+		}
+	}
+
+	text, err := readCramHeaderBlock(r)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		if !strings.HasPrefix(line, "@SQ\t") {
+			continue
+		}
+		for _, field := range strings.Split(line, "\t")[1:] {
+			if strings.HasPrefix(field, "SN:") {
+				names = append(names, strings.TrimPrefix(field, "SN:"))
+				break
+			}
+		}
+	}
+	return names, nil
+}
+
+// readCramHeaderBlock reads the first block of the header container of a
+// CRAM file, returning the SAM header text it holds
+func readCramHeaderBlock(r *bufio.Reader) (string, error) {
+	method, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	contentType, err := r.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if contentType != cramFileHeaderContent {
+		return "", fmt.Errorf("cram: header container starts with block of content type %d", contentType)
+	}
+	var sizes [3]int64
+	for i := range sizes {
+		if sizes[i], err = readItf8(r); err != nil {
+			return "", err
+		}
+	}
+	compressedSize := sizes[1]
+	if compressedSize < 0 {
+		return "", errors.New("cram: invalid header block size")
+	}
+	data := make([]byte, compressedSize)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", err
+	}
+
+	switch method {
+	case 0:
+		// raw
+	case 1:
+		gz, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		if data, err = ioutil.ReadAll(gz); err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("cram: header block compression method %d not supported", method)
+	}
+
+	if len(data) < 4 {
+		return "", errors.New("cram: header block too short")
+	}
+	textLength := int64(binary.LittleEndian.Uint32(data))
+	if textLength > int64(len(data)-4) {
+		return "", errors.New("cram: header text longer than its block")
+	}
+	return strings.TrimRight(string(data[4:4+textLength]), "\x00"), nil
+}
+
+// readItf8 reads a CRAM ITF-8 integer, a 32 bit integer of 1 to 5 bytes, the
+// count of leading set bits of the first byte giving the number of bytes that
+// follow
+func readItf8(r io.ByteReader) (int64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	extra := leadingOnes(first)
+	if extra >= 4 {
+		// the last byte only contributes its low 4 bits
+		value := uint32(first & 0x0f)
+		for i := 0; i < 3; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, err
+			}
+			value = value<<8 | uint32(b)
+		}
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		return int64(int32(value<<4 | uint32(b&0x0f))), nil
+	}
+	value := uint32(first & (0xff >> uint(extra+1)))
+	for i := 0; i < extra; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<8 | uint32(b)
+	}
+	return int64(int32(value)), nil
+}
+
+// readLtf8 reads a CRAM LTF-8 integer, a 64 bit integer of 1 to 9 bytes, the
+// count of leading set bits of the first byte giving the number of bytes that
+// follow
+func readLtf8(r io.ByteReader) (int64, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	extra := leadingOnes(first)
+	var value uint64
+	if extra < 8 {
+		value = uint64(first & (0xff >> uint(extra+1)))
+	}
+	for i := 0; i < extra; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value = value<<8 | uint64(b)
+	}
+	return int64(value), nil
+}
+
+// leadingOnes counts the leading set bits of a byte
+func leadingOnes(b byte) int {
+	n := 0
+	for mask := byte(0x80); mask != 0 && b&mask != 0; mask >>= 1 {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,180 @@
+package htsdao
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
+	"github.com/stretchr/testify/assert"
+)
+
+// cramTestHeader SAM header of the test CRAM file
+const cramTestHeader = "@HD\tVN:1.6\tSO:coordinate\n@SQ\tSN:chr1\tLN:248956422\n@SQ\tSN:chr2\tLN:242193529\n@SQ\tSN:chr3\tLN:198295559\n"
+
+// cramTestIndex CRAI index of the test CRAM file. chr1 is placed in the
+// containers at 200 and 500, chr2 in the containers at 500 and 700, and the
+// unplaced unmapped reads in the container at 1000
+const cramTestIndex = "0\t1\t1000\t200\t100\t90\n" +
+	"0\t1001\t5000\t500\t100\t90\n" +
+	"1\t1\t2000\t500\t190\t90\n" +
+	"1\t2001\t1000\t700\t100\t190\n" +
+	"-1\t0\t0\t1000\t100\t100\n"
+
+// itf8 encodes a CRAM ITF-8 integer of up to 14 bits
+func itf8(v int) []byte {
+	if v < 0x80 {
+		return []byte{byte(v)}
+	}
+	return []byte{0x80 | byte(v>>8), byte(v)}
+}
+
+// cramHeaderContainer encodes the file definition and header container of a
+// CRAM 3 file holding a SAM header, in a raw or gzip compressed block
+func cramHeaderContainer(t *testing.T, text string, compressed bool) []byte {
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(len(text)))
+	data = append(data, text...)
+	raw := len(data)
+	method := byte(0)
+	if compressed {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		gz.Write(data)
+		gz.Close()
+		data = buf.Bytes()
+		method = 1
+	}
+
+	var block bytes.Buffer
+	block.Write([]byte{method, cramFileHeaderContent, 0})
+	block.Write(itf8(len(data)))
+	block.Write(itf8(raw))
+	block.Write(data)
+	block.Write([]byte{0, 0, 0, 0})
+
+	var file bytes.Buffer
+	file.WriteString("CRAM")
+	file.Write([]byte{3, 0})
+	file.Write(make([]byte, 20))
+	binary.Write(&file, binary.LittleEndian, int32(block.Len()))
+	// reference, position, span, records, record counter, bases, blocks, landmarks, crc
+	file.Write([]byte{0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 0})
+	file.Write(block.Bytes())
+	if file.Len() > 200 {
+		t.Fatalf("header container of %d bytes does not fit before the first data container", file.Len())
+	}
+	return file.Bytes()
+}
+
+// writeCramFile writes a CRAM file whose header container is padded out to
+// the first data container at 200, followed by data containers up to 1200 and
+// the CRAM EOF container, along with its CRAI index
+func writeCramFile(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "sample.cram")
+	file := make([]byte, 1200)
+	copy(file, cramHeaderContainer(t, cramTestHeader, false))
+	if err := ioutil.WriteFile(path, append(file, htsconstants.CramEOF...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	indexFile, err := os.Create(path + ".crai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexFile.Close()
+	gz := gzip.NewWriter(indexFile)
+	gz.Write([]byte(cramTestIndex))
+	gz.Close()
+	return path
+}
+
+// TestReadCramReferenceNames tests that the references are named from the
+// SAM header of a CRAM file, whether its block is compressed or not
+func TestReadCramReferenceNames(t *testing.T) {
+	for _, compressed := range []bool{false, true} {
+		names, err := readCramReferenceNames(bytes.NewReader(cramHeaderContainer(t, cramTestHeader, compressed)))
+		assert.Nil(t, err)
+		assert.Equal(t, []string{"chr1", "chr2", "chr3"}, names)
+	}
+
+	_, err := readCramReferenceNames(strings.NewReader("BAM\x01"))
+	assert.NotNil(t, err)
+}
+
+// TestReadCramIntegers tests the decoding of CRAM ITF-8 and LTF-8 integers
+func TestReadCramIntegers(t *testing.T) {
+	tc := []struct {
+		encoded []byte
+		ltf8    bool
+		exp     int64
+	}{
+		{[]byte{0x05}, false, 5},
+		{[]byte{0x81, 0x00}, false, 256},
+		{[]byte{0xe0, 0x45, 0x4f, 0x46}, false, 4542278},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0x0f}, false, -1},
+		{[]byte{0x00}, true, 0},
+		{[]byte{0x81, 0x00}, true, 256},
+		{[]byte{0xff, 0, 0, 0, 0, 0, 0, 1, 0}, true, 256},
+	}
+	for _, c := range tc {
+		r := bytes.NewReader(c.encoded)
+		read := readItf8
+		if c.ltf8 {
+			read = readLtf8
+		}
+		v, err := read(r)
+		assert.Nil(t, err)
+		assert.Equal(t, c.exp, v)
+		assert.Equal(t, 0, r.Len())
+	}
+}
+
+// TestFilePathDaoCramBlocks tests that the header, region and EOF urls of a
+// local CRAM file are located through its CRAI index, as whole containers
+func TestFilePathDaoCramBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filepathdao")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeCramFile(t, dir)
+	dao := NewFilePathDao(htsconstants.APIEndpointReadsTicket, "sample", path)
+
+	header := dao.GetHeaderByteRangeUrl()
+	if assert.NotNil(t, header) {
+		assert.Equal(t, "bytes=0-199", header.Headers.Range)
+		assert.Equal(t, "header", header.Class)
+	}
+
+	eof := dao.GetBgzipEof()
+	if assert.NotNil(t, eof) {
+		assert.Equal(t, "bytes=1200-1237", eof.Headers.Range)
+	}
+
+	tc := []struct {
+		regions   []*htsrequest.Region
+		expRanges [][2]string
+	}{
+		// a region is served up to the container that follows its last container
+		{[]*htsrequest.Region{region("chr1", 0, 500)}, [][2]string{{"bytes=0-199", "header"}, {"bytes=200-499", "body"}}},
+		{[]*htsrequest.Region{region("chr1", -1, -1)}, [][2]string{{"bytes=0-199", "header"}, {"bytes=200-699", "body"}}},
+		// a container holding slices of two references is served for either
+		{[]*htsrequest.Region{region("chr2", 0, 100)}, [][2]string{{"bytes=0-199", "header"}, {"bytes=500-699", "body"}}},
+		{[]*htsrequest.Region{region("chr2", -1, -1)}, [][2]string{{"bytes=0-199", "header"}, {"bytes=500-999", "body"}}},
+		// the unplaced unmapped reads are served up to the EOF container
+		{[]*htsrequest.Region{region("*", -1, -1)}, [][2]string{{"bytes=0-199", "header"}, {"bytes=1000-1199", "body"}}},
+		// references with no slices are left out
+		{[]*htsrequest.Region{region("chr3", -1, -1)}, [][2]string{{"bytes=0-199", "header"}}},
+	}
+
+	for _, c := range tc {
+		assert.Equal(t, c.expRanges, rangesOf(dao.GetChunkedInPlaceBlocks(c.regions)))
+	}
+}
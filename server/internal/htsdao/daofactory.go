@@ -3,12 +3,13 @@ package htsdao
 import (
 	"github.com/ga4gh/htsget-refserver/internal/awsutils"
 	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
 	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
 	"github.com/ga4gh/htsget-refserver/internal/htsutils"
 	"strings"
 )
 
-func getMatchingDao(id string, registry *htsconfig.DataSourceRegistry) (DataAccessObject, error) {
+func getMatchingDao(endpoint htsconstants.APIEndpoint, id string, registry *htsconfig.DataSourceRegistry) (DataAccessObject, error) {
 	path, err := registry.GetMatchingPath(id)
 	if err != nil {
 		return nil, err
@@ -20,10 +21,10 @@ func getMatchingDao(id string, registry *htsconfig.DataSourceRegistry) (DataAcce
 			return NewURLDao(id, path), nil
 		}
 	}
-	return NewFilePathDao(id, path), nil
+	return NewFilePathDao(endpoint, id, path), nil
 }
 
 func GetDao(req *htsrequest.HtsgetRequest) (DataAccessObject, error) {
 	registry := req.GetDataSourceRegistry()
-	return getMatchingDao(req.GetID(), registry)
+	return getMatchingDao(req.GetEndpoint(), req.GetID(), registry)
 }
@@ -2,41 +2,54 @@ package htsdao
 
 import (
 	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
+	"io"
 	"math"
+	"net/url"
 	"os"
 
 	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
 	"github.com/ga4gh/htsget-refserver/internal/htsticket"
+	"github.com/ga4gh/htsget-refserver/internal/htsutils"
 )
 
 type FilePathDao struct {
+	endpoint htsconstants.APIEndpoint
 	id       string
 	filePath string
 }
 
-func NewFilePathDao(id string, filePath string) *FilePathDao {
+// NewFilePathDao instantiates a dao for a local file, whose byte ranges are
+// served by the bytes endpoint of the ticket endpoint it was requested from
+func NewFilePathDao(endpoint htsconstants.APIEndpoint, id string, filePath string) *FilePathDao {
 	dao := new(FilePathDao)
+	dao.endpoint = endpoint
 	dao.id = id
 	dao.filePath = filePath
 	return dao
 }
 
 func (dao *FilePathDao) GetContentLength() int64 {
-	fileInfo, _ := os.Stat(dao.filePath)
+	fileInfo, err := os.Stat(dao.filePath)
+	if err != nil {
+		log.Error("GetContentLength: %v", err)
+		return 0
+	}
 	return fileInfo.Size()
 }
 
+// constructByteRangeURL gets the url of a byte range of the file, served by
+// the bytes endpoint, which only resolves the file through its id
 func (dao *FilePathDao) constructByteRangeURL(start int64, end int64) *htsticket.URL {
-	host := htsconfig.GetHost()
-	path := host + htsconstants.FileByteRangeURLPath
+	host := htsutils.RemoveTrailingSlash(htsconfig.GetHost())
+	path := host + dao.endpoint.BytesEndpointPath() + url.PathEscape(dao.id)
 	headers := htsticket.NewHeaders()
 	headers.SetRangeHeader(start, end)
-	headers.SetFilePathHeader(dao.filePath)
-	url := htsticket.NewURL()
-	url.SetURL(path)
-	url.SetHeaders(headers)
-	return url
+	byteRangeURL := htsticket.NewURL()
+	byteRangeURL.SetURL(path)
+	byteRangeURL.SetHeaders(headers)
+	return byteRangeURL
 }
 
 func (dao *FilePathDao) GetByteRangeUrls() []*htsticket.URL {
@@ -57,16 +70,95 @@ func (dao *FilePathDao) GetByteRangeUrls() []*htsticket.URL {
 	return urls
 }
 
+// readIndex reads the index alongside the file
+func (dao *FilePathDao) readIndex() (regionIndex, error) {
+	return readRegionIndex(dao.filePath, func(suffix string) (io.ReadCloser, error) {
+		return os.Open(dao.filePath + suffix)
+	})
+}
+
+// dataBounds gets the offset the data of the file ends at, before its EOF
+// block or container, along with the size of the file
+func (dao *FilePathDao) dataBounds() (int64, int64) {
+	file, err := os.Open(dao.filePath)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return 0, 0
+	}
+	return readDataEnd(dao.filePath, file, fileInfo.Size()), fileInfo.Size()
+}
+
+// dataEnd gets the offset the data of the file ends at, before its EOF block
+// or container
+func (dao *FilePathDao) dataEnd() int64 {
+	dataEnd, _ := dao.dataBounds()
+	return dataEnd
+}
+
+// GetChunkedInPlaceBlocks return the bytes endpoint URLs of the header and of the
+// blocks holding each region, as located through the index
 func (dao *FilePathDao) GetChunkedInPlaceBlocks(regions []*htsrequest.Region) []*htsticket.URL {
-	return nil
+	t, err := dao.readIndex()
+	if err != nil {
+		log.Error("GetChunkedInPlaceBlocks: %v", err)
+		return nil
+	}
+
+	urls := make([]*htsticket.URL, 0)
+
+	// start by adding in the header (everything *before* the first index chunk)
+	if header, ok := indexHeaderRange(t); ok {
+		urls = append(urls, dao.constructByteRangeURL(header.start, header.end).SetClassHeader())
+	}
+
+	file, err := os.Open(dao.filePath)
+	if err != nil {
+		log.Error("GetChunkedInPlaceBlocks: %v", err)
+		return nil
+	}
+	defer file.Close()
+	length := cachedBlockLength(func(offset int64) (int64, error) {
+		return readBlockLength(file, offset)
+	})
+
+	for _, r := range regions {
+		for _, block := range indexRegionRanges(t, r, dao.dataEnd, length) {
+			urls = append(urls, dao.constructByteRangeURL(block.start, block.end).SetClassBody())
+		}
+	}
+	return urls
 }
 
+// GetHeaderByteRangeUrl return the bytes endpoint URL of the header, as located
+// through the index
 func (dao *FilePathDao) GetHeaderByteRangeUrl() *htsticket.URL {
-	return nil
+	t, err := dao.readIndex()
+	if err != nil {
+		log.Error("GetHeaderByteRangeUrl: %v", err)
+		return nil
+	}
+
+	header, ok := indexHeaderRange(t)
+	if !ok {
+		return nil
+	}
+	return dao.constructByteRangeURL(header.start, header.end).SetClassHeader()
 }
 
+// GetBgzipEof return the bytes endpoint URL of the BGZF EOF block the file ends
+// with, or of the EOF container of a CRAM file, or nil if it does not end
+// with one
 func (dao *FilePathDao) GetBgzipEof() *htsticket.URL {
-	return nil
+	dataEnd, size := dao.dataBounds()
+	if size == 0 || dataEnd == size {
+		return nil
+	}
+	return dao.constructByteRangeURL(dataEnd, size-1).SetClassBody()
 }
 
 func (dao *FilePathDao) String() string {
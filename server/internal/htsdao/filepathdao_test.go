@@ -0,0 +1,128 @@
+package htsdao
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ga4gh/htsget-refserver/internal/bgzf"
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
+	"github.com/ga4gh/htsget-refserver/internal/htsticket"
+	"github.com/ga4gh/htsget-refserver/internal/tabix"
+	"github.com/stretchr/testify/assert"
+)
+
+// bgzfEOF the BGZF EOF block
+const bgzfEOF = "\x1f\x8b\x08\x04\x00\x00\x00\x00\x00\xff\x06\x00\x42\x43\x02\x00\x1b\x00\x03\x00\x00\x00\x00\x00\x00\x00\x00\x00"
+
+// testRecord a record placed on a reference by the test index
+type testRecord struct {
+	refName    string
+	start, end int
+}
+
+func (r testRecord) RefName() string { return r.refName }
+func (r testRecord) Start() int      { return r.start }
+func (r testRecord) End() int        { return r.end }
+
+// writeIndexedFile writes a file of 1000 data bytes followed by the BGZF EOF
+// block, along with a tabix index placing records in its blocks
+func writeIndexedFile(t *testing.T, dir string) string {
+	path := filepath.Join(dir, "sample.vcf.gz")
+	data := make([]byte, 1000)
+	if err := ioutil.WriteFile(path, append(data, []byte(bgzfEOF)...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	chunk := func(begin int64, end int64) bgzf.Chunk {
+		return bgzf.Chunk{Begin: bgzf.Offset{File: begin}, End: bgzf.Offset{File: end}}
+	}
+	idx := tabix.New()
+	idx.Add(testRecord{"chr1", 100, 200}, chunk(100, 300), true, true)
+	idx.Add(testRecord{"chr1", 5000000, 5000100}, chunk(400, 450), true, true)
+	idx.Add(testRecord{"chr2", 100, 200}, chunk(600, 700), true, true)
+
+	indexFile, err := os.Create(path + ".tbi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexFile.Close()
+	gz := gzip.NewWriter(indexFile)
+	if err := tabix.WriteTo(gz, idx); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return path
+}
+
+// region creates a requested region, with -1 leaving it open at that side
+func region(referenceName string, start int, end int) *htsrequest.Region {
+	r := &htsrequest.Region{ReferenceName: referenceName}
+	if start >= 0 {
+		r.SetStart(start)
+	}
+	if end >= 0 {
+		r.SetEnd(end)
+	}
+	return r
+}
+
+// rangesOf gets the range header and class of each url
+func rangesOf(urls []*htsticket.URL) [][2]string {
+	ranges := make([][2]string, 0)
+	for _, url := range urls {
+		ranges = append(ranges, [2]string{url.Headers.Range, url.Class})
+	}
+	return ranges
+}
+
+// TestFilePathDaoIndexedBlocks tests that the header, region and EOF urls of a
+// local file are located through its tabix index
+func TestFilePathDaoIndexedBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filepathdao")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := writeIndexedFile(t, dir)
+	dao := NewFilePathDao(htsconstants.APIEndpointVariantsTicket, "sample", path)
+
+	header := dao.GetHeaderByteRangeUrl()
+	if assert.NotNil(t, header) {
+		assert.Equal(t, "bytes=0-99", header.Headers.Range)
+		assert.Equal(t, "http://localhost:3000/variants/bytes/sample", header.URL)
+		assert.Equal(t, "header", header.Class)
+	}
+
+	eof := dao.GetBgzipEof()
+	if assert.NotNil(t, eof) {
+		assert.Equal(t, "bytes=1000-1027", eof.Headers.Range)
+	}
+
+	tc := []struct {
+		regions   []*htsrequest.Region
+		expRanges [][2]string
+	}{
+		// a region is served up to the end of its chunk, not up to the next block the index knows of
+		{[]*htsrequest.Region{region("chr1", 0, 1000)}, [][2]string{{"bytes=0-99", "header"}, {"bytes=100-299", "body"}}},
+		// a region whose chunks are apart is served as a range for each
+		{[]*htsrequest.Region{region("chr1", -1, -1)}, [][2]string{{"bytes=0-99", "header"}, {"bytes=100-299", "body"}, {"bytes=400-449", "body"}}},
+		{[]*htsrequest.Region{region("chr2", -1, -1)}, [][2]string{{"bytes=0-99", "header"}, {"bytes=600-699", "body"}}},
+		{[]*htsrequest.Region{region("chr1", 0, 1000), region("chr2", 50, -1)}, [][2]string{{"bytes=0-99", "header"}, {"bytes=100-299", "body"}, {"bytes=600-699", "body"}}},
+		// references the index does not know are left out
+		{[]*htsrequest.Region{region("chr3", -1, -1)}, [][2]string{{"bytes=0-99", "header"}}},
+	}
+
+	for _, c := range tc {
+		assert.Equal(t, c.expRanges, rangesOf(dao.GetChunkedInPlaceBlocks(c.regions)))
+	}
+
+	// without an index, no blocks can be located
+	unindexed := NewFilePathDao(htsconstants.APIEndpointVariantsTicket, "unindexed", filepath.Join(dir, "unindexed.vcf.gz"))
+	assert.Nil(t, unindexed.GetChunkedInPlaceBlocks([]*htsrequest.Region{region("chr1", -1, -1)}))
+	assert.Nil(t, unindexed.GetHeaderByteRangeUrl())
+	assert.Nil(t, unindexed.GetBgzipEof())
+}
@@ -0,0 +1,120 @@
+package htsdao
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+)
+
+// remoteIndex the index of a file fetched over http, along with the bounds of
+// the file it indexes
+//
+// Attributes
+//	index (regionIndex): index of the file
+//	dataEnd (int64): offset the data of the file ends at, before its EOF block
+//	size (int64): size of the file
+//	expiresAt (time.Time): time after which the index is fetched again
+type remoteIndex struct {
+	index     regionIndex
+	dataEnd   int64
+	size      int64
+	expiresAt time.Time
+}
+
+// IndexCache a cache of the indexes of files fetched over http, keyed by the
+// url of the file, so that a ticket does not fetch the whole index each time
+type IndexCache struct {
+	ttl     time.Duration
+	mutex   sync.Mutex
+	entries map[string]*remoteIndex
+}
+
+// NewIndexCache instantiates an empty index cache
+//
+// Arguments
+//	ttl (time.Duration): time an index is kept, zero disabling the cache
+// Returns
+//	(*IndexCache): empty index cache
+func NewIndexCache(ttl time.Duration) *IndexCache {
+	cache := new(IndexCache)
+	cache.ttl = ttl
+	cache.entries = make(map[string]*remoteIndex)
+	return cache
+}
+
+// get gets the cached index of a file that has not yet expired, or nil
+func (cache *IndexCache) get(url string, now time.Time) *remoteIndex {
+	if cache.ttl <= 0 {
+		return nil
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cached, ok := cache.entries[url]
+	if !ok {
+		return nil
+	}
+	if !now.Before(cached.expiresAt) {
+		delete(cache.entries, url)
+		return nil
+	}
+	return cached
+}
+
+// put caches the index of a file, removing any indexes that have expired
+func (cache *IndexCache) put(url string, cached *remoteIndex, now time.Time) {
+	if cache.ttl <= 0 {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	for entryURL, entry := range cache.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(cache.entries, entryURL)
+		}
+	}
+	cached.expiresAt = now.Add(cache.ttl)
+	cache.entries[url] = cached
+}
+
+// Len gets the number of indexes in the cache
+//
+//	Type: IndexCache
+// Returns
+//	(int): number of cached indexes, including any that have expired
+func (cache *IndexCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return len(cache.entries)
+}
+
+// indexCache process-wide index cache, created from the configuration on
+// first use
+var indexCache *IndexCache
+
+// indexCacheMutex guards indexCache
+var indexCacheMutex sync.Mutex
+
+// GetIndexCache gets the process-wide index cache, creating it from the
+// configuration on first use
+func GetIndexCache() *IndexCache {
+	indexCacheMutex.Lock()
+	defer indexCacheMutex.Unlock()
+
+	if indexCache == nil {
+		indexCache = NewIndexCache(htsconfig.GetIndexCacheTTL())
+	}
+	return indexCache
+}
+
+// SetIndexCache replaces the process-wide index cache. if nil, the next call
+// to GetIndexCache creates it again from the configuration
+func SetIndexCache(cache *IndexCache) {
+	indexCacheMutex.Lock()
+	defer indexCacheMutex.Unlock()
+
+	indexCache = cache
+}
@@ -0,0 +1,615 @@
+package htsdao
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/ga4gh/htsget-refserver/internal/bai"
+	"github.com/ga4gh/htsget-refserver/internal/bgzf"
+	"github.com/ga4gh/htsget-refserver/internal/crai"
+	"github.com/ga4gh/htsget-refserver/internal/csi"
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
+	"github.com/ga4gh/htsget-refserver/internal/tabix"
+)
+
+// indexRegionOpenEnd end position used for a region request that is open at its end
+const indexRegionOpenEnd = 1000000000
+
+// bgzfEOFSize size of the BGZF EOF block that terminates a BGZF file
+const bgzfEOFSize = 28
+
+// eofTailSize number of bytes read from the end of a file to find whether it
+// ends with an EOF block, enough to hold the longer EOF container of CRAM
+const eofTailSize = 38
+
+// maxBamReferenceNameLength longest reference name, with its NUL terminator, read
+// from a BAM header. longer names are taken as a malformed header
+const maxBamReferenceNameLength = 1 << 16
+
+// regionIndex an index locating the blocks of a file that hold each of its
+// references, i.e. a tabix or CSI index, or a BAI or CRAI index named from the
+// header of its BAM or CRAM file
+type regionIndex interface {
+	Names() []string
+	Chunks(ref string, beg, end int) ([]bgzf.Chunk, error)
+}
+
+// containerIndex an index of the containers of a CRAM file, which records
+// where the containers holding each reference start but not where their
+// records end, so the containers of a region run up to the container after them
+type containerIndex interface {
+	ChunksWithNext(ref string, beg, end int) ([]bgzf.Chunk, int64, error)
+}
+
+// blockLength gets the length of the BGZF block that starts at an offset of a file
+type blockLength func(offset int64) (int64, error)
+
+// cachedBlockLength wraps a blockLength so that the length of each block is
+// read once, however many chunks of a ticket end in it. a length that could
+// not be read is not cached
+func cachedBlockLength(length blockLength) blockLength {
+	lengths := make(map[int64]int64)
+	return func(offset int64) (int64, error) {
+		if n, ok := lengths[offset]; ok {
+			return n, nil
+		}
+		n, err := length(offset)
+		if err != nil {
+			return 0, err
+		}
+		lengths[offset] = n
+		return n, nil
+	}
+}
+
+// unplacedIndex an index that also locates the unplaced unmapped reads, which
+// follow the reads placed on every reference
+type unplacedIndex interface {
+	UnplacedOffset() (int64, bool)
+}
+
+// byteRange an inclusive range of bytes of an indexed file
+type byteRange struct {
+	start int64
+	end   int64
+}
+
+// indexOpener opens the file a path names with a suffix appended, i.e. an index
+// alongside it, or with an empty suffix, the file itself
+type indexOpener func(suffix string) (io.ReadCloser, error)
+
+// readRegionIndex reads the index alongside a file: the CRAI index of a CRAM
+// file, or else a CSI index if there is one, and otherwise the BAI index of a
+// BAM file or the tabix index of any other file
+func readRegionIndex(path string, open indexOpener) (regionIndex, error) {
+	if isCramPath(path) {
+		craiReader, err := open(".crai")
+		if err != nil {
+			return nil, err
+		}
+		defer craiReader.Close()
+
+		// only the start of the file holding the header is read before it is closed
+		cramReader, err := open("")
+		if err != nil {
+			return nil, err
+		}
+		defer cramReader.Close()
+
+		idx, err := readCramIndex(craiReader, cramReader)
+		if err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+
+	csiReader, err := open(".csi")
+	if err == nil {
+		defer csiReader.Close()
+		idx, err := readCsiIndex(path, csiReader, open)
+		if err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+	log.Debug("No CSI index alongside %s: %v", path, err)
+
+	if isBamPath(path) {
+		baiReader, err := open(".bai")
+		if err != nil {
+			return nil, err
+		}
+		defer baiReader.Close()
+
+		// only the start of the file holding the header is read before it is closed
+		bamReader, err := open("")
+		if err != nil {
+			return nil, err
+		}
+		defer bamReader.Close()
+
+		idx, err := readBamIndex(baiReader, bamReader)
+		if err != nil {
+			return nil, err
+		}
+		return idx, nil
+	}
+
+	tbiReader, err := open(".tbi")
+	if err != nil {
+		return nil, err
+	}
+	defer tbiReader.Close()
+
+	t, err := readTabixIndex(tbiReader)
+	if err != nil {
+		return nil, err
+	}
+	if t == nil {
+		return nil, errors.New("tabix: index holds no references")
+	}
+	return t, nil
+}
+
+// readTabixIndex reads a BGZF compressed tabix index
+func readTabixIndex(reader io.Reader) (*tabix.Index, error) {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	return tabix.ReadFrom(gz)
+}
+
+// readCsiIndex reads a BGZF compressed CSI index. the references of the index
+// of a BAM or BCF file are named from the header of the file, as only the index
+// of a VCF or other text file names them itself
+func readCsiIndex(path string, reader io.Reader, open indexOpener) (*csi.Index, error) {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	idx, err := csi.ReadFrom(gz)
+	if err != nil {
+		return nil, err
+	}
+	if idx.HasNames() {
+		return idx, nil
+	}
+
+	var readNames func(io.Reader) ([]string, error)
+	switch {
+	case isBamPath(path):
+		readNames = readBamReferenceNames
+	case isBcfPath(path):
+		readNames = readBcfReferenceNames
+	default:
+		return nil, errors.New("csi: index does not name its references")
+	}
+
+	// only the start of the file holding the header is read before it is closed
+	dataReader, err := open("")
+	if err != nil {
+		return nil, err
+	}
+	defer dataReader.Close()
+
+	names, err := readNames(dataReader)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.SetNames(names); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// isBamPath checks if a path or url names a BAM file, which is indexed by a
+// BAI index rather than a tabix index
+func isBamPath(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".bam")
+}
+
+// isBcfPath checks if a path or url names a BCF file, which is only indexed by
+// a CSI index
+func isBcfPath(path string) bool {
+	return strings.HasSuffix(strings.ToLower(path), ".bcf")
+}
+
+// readBamIndex reads a BAI index, naming its references from the header of
+// the BAM file it indexes
+func readBamIndex(indexReader io.Reader, bamReader io.Reader) (*bai.Index, error) {
+	idx, err := bai.ReadFrom(indexReader)
+	if err != nil {
+		return nil, err
+	}
+	names, err := readBamReferenceNames(bamReader)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.SetNames(names); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// readCramIndex reads a gzip compressed CRAI index, naming its references from
+// the header of the CRAM file it indexes
+func readCramIndex(indexReader io.Reader, cramReader io.Reader) (*crai.Index, error) {
+	gz, err := gzip.NewReader(indexReader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	idx, err := crai.ReadFrom(gz)
+	if err != nil {
+		return nil, err
+	}
+	names, err := readCramReferenceNames(cramReader)
+	if err != nil {
+		return nil, err
+	}
+	if err := idx.SetNames(names); err != nil {
+		return nil, err
+	}
+	return idx, nil
+}
+
+// readBamReferenceNames reads the names of the references of a BAM file, in
+// the order of the @SQ lines of its header, which is the order its BAI index
+// numbers them in. only as much of the file as holds the header is read
+func readBamReferenceNames(reader io.Reader) ([]string, error) {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var magic [4]byte
+	if err := binary.Read(gz, binary.LittleEndian, &magic); err != nil {
+		return nil, err
+	}
+	if magic != [4]byte{'B', 'A', 'M', 0x1} {
+		return nil, errors.New("bam: magic number mismatch")
+	}
+
+	// skip the header text, the binary reference list that follows holds the same @SQ lines
+	var textLength int32
+	if err := binary.Read(gz, binary.LittleEndian, &textLength); err != nil {
+		return nil, err
+	}
+	if textLength < 0 {
+		return nil, fmt.Errorf("bam: invalid header text length %d", textLength)
+	}
+	if _, err := io.CopyN(ioutil.Discard, gz, int64(textLength)); err != nil {
+		return nil, err
+	}
+
+	var nRef int32
+	if err := binary.Read(gz, binary.LittleEndian, &nRef); err != nil {
+		return nil, err
+	}
+	if nRef < 0 {
+		return nil, fmt.Errorf("bam: invalid number of references %d", nRef)
+	}
+	// the names are not preallocated by the count, which a malformed header may inflate
+	names := make([]string, 0)
+	for i := int32(0); i < nRef; i++ {
+		var nameLength int32
+		if err := binary.Read(gz, binary.LittleEndian, &nameLength); err != nil {
+			return nil, err
+		}
+		if nameLength < 1 || nameLength > maxBamReferenceNameLength {
+			return nil, fmt.Errorf("bam: invalid length %d of reference name %d", nameLength, i)
+		}
+		name := make([]byte, nameLength)
+		if _, err := io.ReadFull(gz, name); err != nil {
+			return nil, err
+		}
+		var referenceLength int32
+		if err := binary.Read(gz, binary.LittleEndian, &referenceLength); err != nil {
+			return nil, err
+		}
+		names = append(names, strings.TrimRight(string(name), "\x00"))
+	}
+	return names, nil
+}
+
+// readBcfReferenceNames reads the names of the contigs of a BCF file, in the
+// order of the ##contig lines of its header unless they are numbered by an IDX
+// field. only as much of the file as holds the header is read
+func readBcfReferenceNames(reader io.Reader) ([]string, error) {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var magic [5]byte
+	if _, err := io.ReadFull(gz, magic[:]); err != nil {
+		return nil, err
+	}
+	if string(magic[:4]) != "BCF\x02" {
+		return nil, errors.New("bcf: magic number mismatch")
+	}
+	var textLength uint32
+	if err := binary.Read(gz, binary.LittleEndian, &textLength); err != nil {
+		return nil, err
+	}
+	text := make([]byte, textLength)
+	if _, err := io.ReadFull(gz, text); err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, line := range strings.Split(strings.TrimRight(string(text), "\x00"), "\n") {
+		if !strings.HasPrefix(line, "##contig=<") {
+			continue
+		}
+		var id string
+		idx := len(names)
+		for _, field := range strings.Split(strings.TrimSuffix(strings.TrimPrefix(line, "##contig=<"), ">"), ",") {
+			if strings.HasPrefix(field, "ID=") {
+				id = strings.TrimPrefix(field, "ID=")
+			}
+			if strings.HasPrefix(field, "IDX=") {
+				if n, err := strconv.Atoi(strings.TrimPrefix(field, "IDX=")); err == nil && n >= 0 {
+					idx = n
+				}
+			}
+		}
+		for len(names) <= idx {
+			names = append(names, "")
+		}
+		names[idx] = id
+	}
+	return names, nil
+}
+
+// indexHeaderRange gets the byte range of the header of an indexed file. the
+// header is everything before the first chunk of the first reference in the
+// index that has any. when that chunk starts within the first block, i.e. the
+// header shares its block with the first records, the header is the whole of
+// the first block, up to the next block the index knows of
+func indexHeaderRange(t regionIndex) (byteRange, bool) {
+	names := t.Names()
+	for i, name := range names {
+		chunks, _ := t.Chunks(name, 0, indexRegionOpenEnd)
+
+		for _, chunk := range chunks {
+			if chunk.Begin.File > 0 {
+				log.Debug("Header was discovered to finish at %d", chunk.Begin.File-1)
+				return byteRange{0, chunk.Begin.File - 1}, true
+			}
+			next := indexNextBlock(t, names[i:], 0)
+			if next == 0 {
+				return byteRange{}, false
+			}
+			log.Debug("Header shares its block with records, finishing at %d", next-1)
+			return byteRange{0, next - 1}, true
+		}
+	}
+	return byteRange{}, false
+}
+
+// indexRegionRanges gets the byte ranges of the blocks of an indexed file that
+// hold a requested region. each range runs from the block the region's chunk
+// begins in to the end of the block its chunk ends in, or, for the containers
+// of a CRAM file, up to the container after them. no block past the records of
+// the region is served, so a region clipped to a part of a reference is not
+// widened beyond it
+func indexRegionRanges(t regionIndex, r *htsrequest.Region, dataEnd func() int64, length blockLength) []byteRange {
+	// the unplaced unmapped reads (i.e "*") run from the end of the placed reads to the end of the data
+	if r.GetReferenceName() == "*" {
+		unplaced, ok := t.(unplacedIndex)
+		if !ok {
+			return nil
+		}
+		start, ok := unplaced.UnplacedOffset()
+		end := dataEnd()
+		if !ok || start >= end {
+			return nil
+		}
+		log.Debug("Unplaced unmapped reads lookup into blocks %d-%d", start, end-1)
+		return []byteRange{{start, end - 1}}
+	}
+
+	// handle open-ended region request (i.e all of "chr1") by asking for the region up to maxint unless set
+	start := 0
+	if r.StartRequested() {
+		start = r.GetStart()
+	}
+	end := indexRegionOpenEnd
+	if r.EndRequested() {
+		end = r.GetEnd()
+	}
+
+	// consult the index for the block range of the asked for region
+	var ranges []byteRange
+	var err error
+	if containers, ok := t.(containerIndex); ok {
+		ranges, err = indexContainerRanges(containers, r.GetReferenceName(), start, end, dataEnd)
+	} else {
+		ranges, err = indexChunkRanges(t, r.GetReferenceName(), start, end, dataEnd, length)
+	}
+	if err != nil {
+		log.Debug("Region %s %d-%d has no blocks in the index: %v", r.GetReferenceName(), start, end, err)
+		return nil
+	}
+
+	// the blocks of the header are already served ahead of every region
+	header, hasHeader := indexHeaderRange(t)
+	clipped := make([]byteRange, 0, len(ranges))
+	for _, block := range ranges {
+		if hasHeader && block.start <= header.end {
+			block.start = header.end + 1
+		}
+		if block.start <= block.end {
+			clipped = append(clipped, block)
+		}
+	}
+	if len(clipped) == 0 {
+		return nil
+	}
+	log.Debug("Region %s %d-%d lookup into blocks %v", r.GetReferenceName(), start, end, clipped)
+	return clipped
+}
+
+// indexChunkRanges gets the byte ranges of the BGZF blocks the chunks of a
+// region span. a chunk ends at a virtual offset, so its last block is the one
+// that offset points into, unless it points at the very start of a block, as
+// the chunk of the last records of a file may, past its EOF block
+func indexChunkRanges(t regionIndex, referenceName string, start, end int, dataEnd func() int64, length blockLength) ([]byteRange, error) {
+	chunks, err := t.Chunks(referenceName, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	ranges := make([]byteRange, 0, len(chunks))
+	for _, chunk := range chunks {
+		last := chunk.End.File - 1
+		if chunk.End.Block > 0 {
+			n, err := length(chunk.End.File)
+			if err != nil {
+				return nil, err
+			}
+			last = chunk.End.File + n - 1
+		} else if end := dataEnd(); last >= end {
+			last = end - 1
+		}
+		if last < chunk.Begin.File {
+			continue
+		}
+
+		// chunks sharing a block are served as one range, so that no block is served twice
+		if n := len(ranges); n > 0 && chunk.Begin.File <= ranges[n-1].end+1 {
+			if last > ranges[n-1].end {
+				ranges[n-1].end = last
+			}
+			continue
+		}
+		ranges = append(ranges, byteRange{chunk.Begin.File, last})
+	}
+	return ranges, nil
+}
+
+// indexContainerRanges gets the byte range of the CRAM containers holding a
+// region, from the first of them up to the container after the last of them,
+// or up to dataEnd when nothing is indexed after it
+func indexContainerRanges(t containerIndex, referenceName string, start, end int, dataEnd func() int64) ([]byteRange, error) {
+	chunks, next, err := t.ChunksWithNext(referenceName, start, end)
+	if err != nil || len(chunks) == 0 {
+		return nil, err
+	}
+	if next == 0 {
+		next = dataEnd()
+	}
+	return []byteRange{{chunks[0].Begin.File, next - 1}}, nil
+}
+
+// indexNextBlock gets the offset of the first block of a list of references
+// that starts after an offset, or zero if there is none
+func indexNextBlock(t regionIndex, names []string, after int64) int64 {
+	for _, name := range names {
+		chunks, _ := t.Chunks(name, 0, indexRegionOpenEnd)
+		for _, chunk := range chunks {
+			if chunk.Begin.File > after {
+				return chunk.Begin.File
+			}
+		}
+	}
+	return 0
+}
+
+// dataEndOf gets the offset the data of a file ends at from its last bytes:
+// before the EOF container of a CRAM file, or the BGZF EOF block of any other
+// file, if it ends with one
+func dataEndOf(path string, tail []byte, size int64) int64 {
+	if isCramPath(path) {
+		if bytes.HasSuffix(tail, htsconstants.CramEOF) {
+			return size - int64(htsconstants.CramEOFLen)
+		}
+		return size
+	}
+	hasEOF, err := bgzf.HasEOF(bytes.NewReader(tail))
+	if err != nil || !hasEOF {
+		return size
+	}
+	return size - bgzfEOFSize
+}
+
+// bgzfHeaderSize size of the fixed part of the gzip header of a BGZF block,
+// ahead of its extra subfields
+const bgzfHeaderSize = 12
+
+// readBlockLength gets the length of the BGZF block that starts at an offset,
+// from the BC extra subfield of its gzip header, which holds the block size
+// less one
+func readBlockLength(reader io.ReaderAt, offset int64) (int64, error) {
+	header := make([]byte, bgzfHeaderSize)
+	if _, err := reader.ReadAt(header, offset); err != nil {
+		return 0, err
+	}
+	if header[0] != 0x1f || header[1] != 0x8b || header[3]&0x04 == 0 {
+		return 0, fmt.Errorf("no BGZF block at offset %d", offset)
+	}
+	extra := make([]byte, binary.LittleEndian.Uint16(header[10:]))
+	if _, err := reader.ReadAt(extra, offset+bgzfHeaderSize); err != nil {
+		return 0, err
+	}
+	for len(extra) >= 4 {
+		size := int(binary.LittleEndian.Uint16(extra[2:]))
+		if extra[0] == 'B' && extra[1] == 'C' && size == 2 && len(extra) >= 6 {
+			return int64(binary.LittleEndian.Uint16(extra[4:])) + 1, nil
+		}
+		if len(extra) < 4+size {
+			break
+		}
+		extra = extra[4+size:]
+	}
+	return 0, fmt.Errorf("no BGZF block size at offset %d", offset)
+}
+
+// rangeReader reads an inclusive byte range of a file, i.e. of an object
+// only served in ranges
+type rangeReader func(start, end int64) (io.ReadCloser, error)
+
+// ReadAt reads the bytes of the file at an offset through a single range
+func (read rangeReader) ReadAt(p []byte, offset int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	body, err := read(offset, offset+int64(len(p))-1)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	return io.ReadFull(body, p)
+}
+
+// readDataEnd gets the offset the data of a file ends at, before its EOF block
+// or container if it has one, reading its last bytes
+func readDataEnd(path string, reader io.ReaderAt, size int64) int64 {
+	tailSize := int64(eofTailSize)
+	if size < tailSize {
+		tailSize = size
+	}
+	tail := make([]byte, tailSize)
+	if _, err := reader.ReadAt(tail, size-tailSize); err != nil {
+		return size
+	}
+	return dataEndOf(path, tail, size)
+}
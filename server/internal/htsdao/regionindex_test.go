@@ -0,0 +1,268 @@
+package htsdao
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/ga4gh/htsget-refserver/internal/csi"
+	"github.com/stretchr/testify/assert"
+)
+
+// bamPath BAM file with a BAI index used in tests
+const bamPath = "../../data/test/sources/tabulamuris/A1-B000168-3_57_F-1-1_R2.mus.Aligned.out.sorted.bam"
+
+// csiPath VCF file with only a CSI index used in tests
+const csiPath = "../../data/test/sources/giab/HG002_GIAB.filtered.vcf.gz"
+
+// localBlockLength gets the length of the BGZF blocks of an open local file
+func localBlockLength(file *os.File) blockLength {
+	return func(offset int64) (int64, error) {
+		return readBlockLength(file, offset)
+	}
+}
+
+// openLocal opens a local file alongside a path
+func openLocal(path string) indexOpener {
+	return func(suffix string) (io.ReadCloser, error) {
+		return os.Open(path + suffix)
+	}
+}
+
+// TestReadBamIndex tests that the references of a BAI index are named from
+// the header of its BAM file, and that the blocks of each are located
+func TestReadBamIndex(t *testing.T) {
+	indexFile, err := os.Open(bamPath + ".bai")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexFile.Close()
+	bamFile, err := os.Open(bamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bamFile.Close()
+
+	idx, err := readBamIndex(indexFile, bamFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 162, len(idx.Names()))
+	assert.Equal(t, "chr1", idx.Names()[0])
+	assert.Equal(t, "zsGreen_transgene", idx.Names()[161])
+
+	header, ok := indexHeaderRange(idx)
+	assert.True(t, ok)
+	assert.Equal(t, byteRange{0, 2579}, header)
+
+	dataEnd := func() int64 { return 41130 }
+	tc := []struct {
+		referenceName string
+		expRanges     []byteRange
+	}{
+		// references are served up to the end of the block their last chunk ends in
+		{"chr1", []byteRange{{2580, 22174}}},
+		{"chr18", []byteRange{{22175, 40469}}},
+		// the last chunk ends past the EOF block, which is left out
+		{"ERCC-00171", []byteRange{{40470, 41129}}},
+		// references without reads, or unknown to the header, are left out
+		{"chrY", nil},
+		{"chr23", nil},
+		// every read of this file is placed, so there are no unplaced unmapped reads
+		{"*", nil},
+	}
+	for _, c := range tc {
+		assert.Equal(t, c.expRanges, indexRegionRanges(idx, region(c.referenceName, -1, -1), dataEnd, localBlockLength(bamFile)), c.referenceName)
+	}
+
+	// unplaced unmapped reads follow the last placed read
+	unplaced, ok := idx.UnplacedOffset()
+	assert.True(t, ok)
+	assert.Equal(t, int64(41158), unplaced)
+	assert.Equal(t, []byteRange{{41158, 41999}}, indexRegionRanges(idx, region("*", -1, -1), func() int64 { return 42000 }, localBlockLength(bamFile)))
+}
+
+// TestReadBamIndexMismatch tests that an index is refused when it is not the
+// BAI index of the BAM file
+func TestReadBamIndexMismatch(t *testing.T) {
+	bamFile, err := os.Open(bamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bamFile.Close()
+	csiFile, err := os.Open("../../data/test/sources/giab/HG002_GIAB.filtered.vcf.gz.csi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer csiFile.Close()
+
+	_, err = readBamIndex(csiFile, bamFile)
+	assert.NotNil(t, err)
+}
+
+// bamHeader compresses the start of a BAM header, with the given header text
+// length, reference count and reference name lengths
+func bamHeader(textLength int32, nRef int32, nameLengths ...int32) io.Reader {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	gz.Write([]byte{'B', 'A', 'M', 0x1})
+	binary.Write(gz, binary.LittleEndian, textLength)
+	binary.Write(gz, binary.LittleEndian, nRef)
+	for _, nameLength := range nameLengths {
+		binary.Write(gz, binary.LittleEndian, nameLength)
+		if nameLength > 0 {
+			gz.Write(append(bytes.Repeat([]byte{'c'}, int(nameLength)-1), 0))
+		}
+		binary.Write(gz, binary.LittleEndian, int32(1000))
+	}
+	gz.Close()
+	return &buffer
+}
+
+// TestReadBamReferenceNames tests that the reference names are read from a BAM
+// header, and that a malformed header is refused rather than read
+func TestReadBamReferenceNames(t *testing.T) {
+	tc := []struct {
+		name     string
+		header   io.Reader
+		expNames []string
+		expErr   bool
+	}{
+		{"valid", bamHeader(0, 2, 5, 3), []string{"cccc", "cc"}, false},
+		{"negative text length", bamHeader(-1, 1, 5), nil, true},
+		{"negative reference count", bamHeader(0, -1), nil, true},
+		{"negative name length", bamHeader(0, 1, -1), nil, true},
+		{"empty name", bamHeader(0, 1, 0), nil, true},
+		{"long name", bamHeader(0, 1, maxBamReferenceNameLength+1), nil, true},
+		{"truncated", bamHeader(0, 2, 5), nil, true},
+	}
+	for _, c := range tc {
+		names, err := readBamReferenceNames(c.header)
+		assert.Equal(t, c.expErr, err != nil, c.name)
+		if !c.expErr {
+			assert.Equal(t, c.expNames, names, c.name)
+		}
+	}
+}
+
+// TestReadCsiIndex tests that the CSI index alongside a VCF is read, with its
+// binning and references taken from the index itself, and that the blocks of
+// each reference are located
+func TestReadCsiIndex(t *testing.T) {
+	idx, err := readRegionIndex(csiPath, openLocal(csiPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !assert.IsType(t, &csi.Index{}, idx) {
+		return
+	}
+	c := idx.(*csi.Index)
+	assert.Equal(t, 14, c.MinShift())
+	assert.Equal(t, 6, c.Depth())
+	assert.Equal(t, 22, len(c.Names()))
+	assert.Equal(t, "1", c.Names()[0])
+	assert.Equal(t, 1, c.NameColumn())
+	assert.Equal(t, 2, c.BeginColumn())
+	assert.Equal(t, '#', c.MetaChar())
+
+	// the header shares the first block with the first records, so it is served whole
+	header, ok := indexHeaderRange(idx)
+	assert.True(t, ok)
+	assert.Equal(t, byteRange{0, 15835}, header)
+
+	vcfFile, err := os.Open(csiPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vcfFile.Close()
+
+	dataEnd := func() int64 { return 185210 }
+	tc := []struct {
+		referenceName string
+		start         int
+		end           int
+		expRanges     []byteRange
+	}{
+		// blocks already served with the header are left out
+		{"1", -1, -1, []byteRange{{15836, 19590}}},
+		{"1", 1000000, 2000000, nil},
+		{"2", -1, -1, []byteRange{{15836, 34318}}},
+		// the last reference is served up to the EOF block
+		{"22", -1, -1, []byteRange{{181735, 185209}}},
+		// references unknown to the index are left out
+		{"X", -1, -1, nil},
+	}
+	for _, c := range tc {
+		assert.Equal(t, c.expRanges, indexRegionRanges(idx, region(c.referenceName, c.start, c.end), dataEnd, localBlockLength(vcfFile)), c.referenceName)
+	}
+}
+
+// TestReadRegionIndexMissing tests that a file with no index alongside it is
+// refused
+func TestReadRegionIndexMissing(t *testing.T) {
+	_, err := readRegionIndex(csiPath+".missing", openLocal(csiPath+".missing"))
+	assert.NotNil(t, err)
+}
+
+// TestReadBlockLength tests that the length of a BGZF block is read from its
+// header, and that anything else is refused
+func TestReadBlockLength(t *testing.T) {
+	bamFile, err := os.Open(bamPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bamFile.Close()
+
+	tc := []struct {
+		offset    int64
+		expLength int64
+		expErr    bool
+	}{
+		{2580, 19595, false},
+		// the EOF block
+		{41130, 28, false},
+		// inside a block
+		{2581, 0, true},
+		// past the end of the file
+		{41158, 0, true},
+	}
+	for _, c := range tc {
+		length, err := readBlockLength(bamFile, c.offset)
+		assert.Equal(t, c.expLength, length, c.offset)
+		assert.Equal(t, c.expErr, err != nil, c.offset)
+	}
+}
+
+// TestCachedBlockLength tests that the length of a block is read once however
+// many times it is asked for, and that a length that could not be read is not
+// cached
+func TestCachedBlockLength(t *testing.T) {
+	reads := make(map[int64]int)
+	fail := true
+	length := cachedBlockLength(func(offset int64) (int64, error) {
+		reads[offset]++
+		if offset == 20 && fail {
+			return 0, errors.New("block could not be read")
+		}
+		return offset + 1, nil
+	})
+
+	for i := 0; i < 3; i++ {
+		n, err := length(10)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(11), n)
+	}
+	assert.Equal(t, 1, reads[10])
+
+	_, err := length(20)
+	assert.NotNil(t, err)
+	fail = false
+	n, err := length(20)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(21), n)
+	assert.Equal(t, 2, reads[20])
+}
@@ -1,16 +1,24 @@
 package htsdao
 
 import (
+	"fmt"
 	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
+	"io"
+	"io/ioutil"
 	"math"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/ga4gh/htsget-refserver/internal/awsutils"
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
 	"github.com/ga4gh/htsget-refserver/internal/htsticket"
 )
 
+// urlDaoClient client the indexes and bounds of files are fetched with
+var urlDaoClient = &http.Client{Timeout: 30 * time.Second}
+
 type URLDao struct {
 	id  string
 	url string
@@ -30,16 +38,139 @@ func (dao *URLDao) GetContentLength() int64 {
 		})
 		return contentLength
 	}
-	res, _ := http.Head(dao.url)
+	res, err := http.Head(dao.url)
+	if err != nil {
+		log.Error("GetContentLength: %v", err)
+		return 0
+	}
+	res.Body.Close()
 	return res.ContentLength
 }
 
+// makeRangeUrl creates a url for an inclusive byte range of the file, served
+// straight from its origin
+func (dao *URLDao) makeRangeUrl(block byteRange) *htsticket.URL {
+	return htsticket.NewURL().
+		SetURL(dao.url).
+		SetHeaders(htsticket.NewHeaders().SetRangeHeader(block.start, block.end))
+}
+
+// open fetches the file with a suffix appended to its url, i.e. an index
+// alongside it, or with an empty suffix, the file itself
+func (dao *URLDao) open(suffix string) (io.ReadCloser, error) {
+	res, err := urlDaoClient.Get(dao.url + suffix)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s%s could not be fetched: %s", dao.url, suffix, res.Status)
+	}
+	return res.Body, nil
+}
+
+// openRange opens an inclusive byte range of the file at the origin
+func (dao *URLDao) openRange(start, end int64) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, dao.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	res, err := urlDaoClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusPartialContent {
+		res.Body.Close()
+		return nil, fmt.Errorf("%s does not serve byte ranges: %s", dao.url, res.Status)
+	}
+	return res.Body, nil
+}
+
+// fetchIndex gets the index alongside the file, along with the bounds of the
+// file, fetching them from the origin unless they are cached
+func (dao *URLDao) fetchIndex() (*remoteIndex, error) {
+	cache := GetIndexCache()
+	now := time.Now()
+	if cached := cache.get(dao.url, now); cached != nil {
+		return cached, nil
+	}
+
+	t, err := readRegionIndex(dao.url, dao.open)
+	if err != nil {
+		return nil, err
+	}
+
+	dataEnd, size, err := dao.fetchBounds()
+	if err != nil {
+		return nil, err
+	}
+
+	cached := &remoteIndex{index: t, dataEnd: dataEnd, size: size}
+	cache.put(dao.url, cached, now)
+	return cached, nil
+}
+
+// fetchBounds gets the offset the data of the file ends at, before its EOF
+// block or container, along with the size of the file, by requesting its last
+// bytes. the origin must serve byte ranges, as every url of a ticket is a
+// byte range
+func (dao *URLDao) fetchBounds() (int64, int64, error) {
+	req, err := http.NewRequest(http.MethodGet, dao.url, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=-%d", eofTailSize))
+	res, err := urlDaoClient.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusPartialContent {
+		return 0, 0, fmt.Errorf("%s does not serve byte ranges: %s", dao.url, res.Status)
+	}
+
+	var start, end, size int64
+	if _, err := fmt.Sscanf(res.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, &end, &size); err != nil {
+		return 0, 0, fmt.Errorf("%s served an invalid Content-Range %q", dao.url, res.Header.Get("Content-Range"))
+	}
+	tail, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return 0, 0, err
+	}
+	return dataEndOf(dao.url, tail, size), size, nil
+}
+
+// GetHeaderByteRangeUrl return the url of the header, as located through the
+// index
 func (dao *URLDao) GetHeaderByteRangeUrl() *htsticket.URL {
-	return nil
+	cached, err := dao.fetchIndex()
+	if err != nil {
+		log.Error("GetHeaderByteRangeUrl: %v", err)
+		return nil
+	}
+
+	header, ok := indexHeaderRange(cached.index)
+	if !ok {
+		return nil
+	}
+	return dao.makeRangeUrl(header).SetClassHeader()
 }
 
+// GetBgzipEof return the url of the BGZF EOF block the file ends with, or of
+// the EOF container of a CRAM file, or nil if it does not end with one. the
+// file is only served in ranges other than as a whole once its index is
+// known, so nor is the EOF block until then
 func (dao *URLDao) GetBgzipEof() *htsticket.URL {
-	return nil
+	cached, err := dao.fetchIndex()
+	if err != nil {
+		log.Debug("GetBgzipEof: %v", err)
+		return nil
+	}
+	if cached.dataEnd == cached.size {
+		return nil
+	}
+	return dao.makeRangeUrl(byteRange{cached.dataEnd, cached.size - 1}).SetClassBody()
 }
 
 func (dao *URLDao) GetByteRangeUrls() []*htsticket.URL {
@@ -54,19 +185,40 @@ func (dao *URLDao) GetByteRangeUrls() []*htsticket.URL {
 		if end >= numBytes {
 			end = numBytes - 1
 		}
-		headers := htsticket.NewHeaders()
-		headers.SetRangeHeader(start, end)
-		url := htsticket.NewURL()
-		url.SetURL(dao.url)
-		url.SetHeaders(headers)
+		url := dao.makeRangeUrl(byteRange{start, end})
 		start = end + 1
 		urls = append(urls, url)
 	}
 	return urls
 }
 
+// GetChunkedInPlaceBlocks return the urls of the header and of the blocks
+// holding each region, as located through the index, pointing straight
+// at the origin
 func (dao *URLDao) GetChunkedInPlaceBlocks(regions []*htsrequest.Region) []*htsticket.URL {
-	return nil
+	cached, err := dao.fetchIndex()
+	if err != nil {
+		log.Error("GetChunkedInPlaceBlocks: %v", err)
+		return nil
+	}
+
+	urls := make([]*htsticket.URL, 0)
+
+	// start by adding in the header (everything *before* the first index chunk)
+	if header, ok := indexHeaderRange(cached.index); ok {
+		urls = append(urls, dao.makeRangeUrl(header).SetClassHeader())
+	}
+
+	dataEnd := func() int64 { return cached.dataEnd }
+	length := cachedBlockLength(func(offset int64) (int64, error) {
+		return readBlockLength(rangeReader(dao.openRange), offset)
+	})
+	for _, r := range regions {
+		for _, block := range indexRegionRanges(cached.index, r, dataEnd, length) {
+			urls = append(urls, dao.makeRangeUrl(block).SetClassBody())
+		}
+	}
+	return urls
 }
 
 func (dao *URLDao) String() string {
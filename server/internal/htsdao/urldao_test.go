@@ -0,0 +1,111 @@
+package htsdao
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestURLDaoIndexedBlocks tests that the header, region and EOF urls of a file
+// served over http are located through its tabix index, fetched from the
+// origin once and then reused
+func TestURLDaoIndexedBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urldao")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeIndexedFile(t, dir)
+
+	var indexRequests int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ".tbi") {
+			atomic.AddInt32(&indexRequests, 1)
+		}
+		http.ServeFile(w, r, filepath.Join(dir, filepath.Base(r.URL.Path)))
+	}))
+	defer origin.Close()
+	SetIndexCache(NewIndexCache(time.Minute))
+	defer SetIndexCache(nil)
+
+	url := origin.URL + "/sample.vcf.gz"
+	dao := NewURLDao("sample", url)
+
+	header := dao.GetHeaderByteRangeUrl()
+	if assert.NotNil(t, header) {
+		assert.Equal(t, url, header.URL)
+		assert.Equal(t, "bytes=0-99", header.Headers.Range)
+		assert.Equal(t, "header", header.Class)
+	}
+
+	eof := dao.GetBgzipEof()
+	if assert.NotNil(t, eof) {
+		assert.Equal(t, "bytes=1000-1027", eof.Headers.Range)
+	}
+
+	urls := dao.GetChunkedInPlaceBlocks([]*htsrequest.Region{region("chr1", 0, 1000), region("chr2", -1, -1)})
+	assert.Equal(t, [][2]string{{"bytes=0-99", "header"}, {"bytes=100-299", "body"}, {"bytes=600-699", "body"}}, rangesOf(urls))
+	for _, u := range urls {
+		assert.Equal(t, url, u.URL)
+	}
+	assert.Equal(t, int32(1), atomic.LoadInt32(&indexRequests))
+	assert.Equal(t, 1, GetIndexCache().Len())
+
+	// a disabled cache fetches the index for every ticket
+	SetIndexCache(NewIndexCache(0))
+	dao.GetHeaderByteRangeUrl()
+	dao.GetHeaderByteRangeUrl()
+	assert.Equal(t, int32(3), atomic.LoadInt32(&indexRequests))
+
+	// without an index, no blocks can be located
+	unindexed := NewURLDao("unindexed", origin.URL+"/unindexed.vcf.gz")
+	assert.Nil(t, unindexed.GetChunkedInPlaceBlocks([]*htsrequest.Region{region("chr1", -1, -1)}))
+	assert.Nil(t, unindexed.GetHeaderByteRangeUrl())
+	assert.Nil(t, unindexed.GetBgzipEof())
+}
+
+// TestURLDaoBamBlocks tests that the block a region's chunk ends in is
+// measured by reading its header from the origin, so a region is served up to
+// the end of that block and no further
+func TestURLDaoBamBlocks(t *testing.T) {
+	origin := httptest.NewServer(http.FileServer(http.Dir(filepath.Dir(bamPath))))
+	defer origin.Close()
+	SetIndexCache(NewIndexCache(0))
+	defer SetIndexCache(nil)
+
+	dao := NewURLDao("A1", origin.URL+"/"+filepath.Base(bamPath))
+	urls := dao.GetChunkedInPlaceBlocks([]*htsrequest.Region{region("chr1", -1, -1), region("ERCC-00171", -1, -1)})
+	assert.Equal(t, [][2]string{{"bytes=0-2579", "header"}, {"bytes=2580-22174", "body"}, {"bytes=40470-41129", "body"}}, rangesOf(urls))
+}
+
+// TestURLDaoWithoutByteRanges tests that no blocks are located in a file whose
+// origin does not serve byte ranges
+func TestURLDaoWithoutByteRanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "urldao")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeIndexedFile(t, dir)
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadFile(filepath.Join(dir, filepath.Base(r.URL.Path)))
+		w.Write(body)
+	}))
+	defer origin.Close()
+	SetIndexCache(NewIndexCache(time.Minute))
+	defer SetIndexCache(nil)
+
+	dao := NewURLDao("sample", origin.URL+"/sample.vcf.gz")
+	assert.Nil(t, dao.GetChunkedInPlaceBlocks([]*htsrequest.Region{region("chr1", -1, -1)}))
+	assert.Equal(t, 0, GetIndexCache().Len())
+}
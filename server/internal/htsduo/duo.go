@@ -0,0 +1,142 @@
+// Package htsduo checks the purpose a client declares for accessing a dataset
+// against the dataset's Data Use Ontology (DUO) conditions
+//
+// Module duo parses DUO codes and decides if a declared purpose is compatible
+// with the data use permissions of a dataset
+package htsduo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CodeNoRestriction DUO permission allowing any use (DUO:0000004)
+const CodeNoRestriction = "NRES"
+
+// CodeGeneralResearch DUO permission allowing general research use (DUO:0000042)
+const CodeGeneralResearch = "GRU"
+
+// CodeHealthMedical DUO permission allowing health, medical or biomedical
+// research (DUO:0000006)
+const CodeHealthMedical = "HMB"
+
+// CodeDiseaseSpecific prefix of the DUO permission allowing research on a
+// specific disease only (DUO:0000007), e.g. DS-MONDO:0005015
+const CodeDiseaseSpecific = "DS-"
+
+// CodePopulationAncestry DUO permission allowing population origins or
+// ancestry research only (DUO:0000011)
+const CodePopulationAncestry = "POA"
+
+// curies maps the DUO identifiers of permissions without a parameter to their
+// short codes
+var curies = map[string]string{
+	"DUO:0000004": CodeNoRestriction,
+	"DUO:0000042": CodeGeneralResearch,
+	"DUO:0000006": CodeHealthMedical,
+	"DUO:0000011": CodePopulationAncestry,
+}
+
+// normalise converts a DUO code to its upper case short code, keeping the case
+// of a disease identifier
+func normalise(code string) string {
+	code = strings.TrimSpace(code)
+	if short, ok := curies[strings.ToUpper(code)]; ok {
+		return short
+	}
+	if strings.HasPrefix(strings.ToUpper(code), CodeDiseaseSpecific) {
+		return CodeDiseaseSpecific + code[len(CodeDiseaseSpecific):]
+	}
+	return strings.ToUpper(code)
+}
+
+// isPermission checks if a normalised code is a data use permission, rather
+// than a modifier such as NCU or IRB
+func isPermission(code string) bool {
+	switch code {
+	case CodeNoRestriction, CodeGeneralResearch, CodeHealthMedical, CodePopulationAncestry:
+		return true
+	}
+	return strings.HasPrefix(code, CodeDiseaseSpecific) && len(code) > len(CodeDiseaseSpecific)
+}
+
+// ParsePurpose parses the purpose a client declares for accessing a dataset.
+// the purpose is expressed as the DUO permission code the research falls
+// under, e.g. HMB for biomedical research or DS-MONDO:0005015 for research on
+// a specific disease. NRES is not a purpose, as it only describes data
+//
+// Arguments
+//	purpose (string): declared purpose
+// Returns
+//	(string): normalised purpose
+//	(error): the purpose is not a DUO permission code
+func ParsePurpose(purpose string) (string, error) {
+	code := normalise(purpose)
+	if !isPermission(code) || code == CodeNoRestriction {
+		return "", fmt.Errorf("purpose %s is not one of GRU, HMB, POA or DS-{disease}", purpose)
+	}
+	return code, nil
+}
+
+// allows checks if a single data use permission allows a purpose
+func allows(permission string, purpose string) bool {
+	switch permission {
+	case CodeNoRestriction:
+		return true
+	case CodeGeneralResearch:
+		// general research use covers every kind of research
+		return true
+	case CodeHealthMedical:
+		return purpose == CodeHealthMedical || strings.HasPrefix(purpose, CodeDiseaseSpecific)
+	case CodePopulationAncestry:
+		return purpose == CodePopulationAncestry
+	}
+	return strings.EqualFold(permission, purpose)
+}
+
+// CheckPurpose checks a declared purpose against the DUO conditions of a
+// dataset. the purpose must be allowed by one of the data use permissions
+// listed. modifiers such as NCU or IRB cannot be checked from the purpose, so
+// are left to the issuer of the visa. a dataset without conditions allows any
+// purpose, and does not require one to be declared
+//
+// Arguments
+//	purpose (string): purpose declared by the client, empty if none was
+//	conditions ([]string): DUO codes the dataset is labelled with
+// Returns
+//	(error): describes why the purpose is not compatible with the conditions
+func CheckPurpose(purpose string, conditions []string) error {
+	if len(conditions) == 0 {
+		return nil
+	}
+
+	permissions := make([]string, 0)
+	for _, condition := range conditions {
+		if code := normalise(condition); isPermission(code) {
+			permissions = append(permissions, code)
+		}
+	}
+	if len(permissions) == 0 {
+		return fmt.Errorf("the data use conditions %s of the dataset grant no use that can be checked", strings.Join(conditions, ", "))
+	}
+
+	if purpose == "" {
+		for _, permission := range permissions {
+			if permission == CodeNoRestriction {
+				return nil
+			}
+		}
+		return fmt.Errorf("a purpose must be declared to access a dataset with data use conditions %s", strings.Join(conditions, ", "))
+	}
+
+	code, err := ParsePurpose(purpose)
+	if err != nil {
+		return err
+	}
+	for _, permission := range permissions {
+		if allows(permission, code) {
+			return nil
+		}
+	}
+	return fmt.Errorf("purpose %s is not compatible with the data use conditions %s of the dataset", code, strings.Join(conditions, ", "))
+}
@@ -0,0 +1,76 @@
+// Package htsduo checks the purpose a client declares for accessing a dataset
+// against the dataset's Data Use Ontology (DUO) conditions
+//
+// Module duo_test tests module duo
+package htsduo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// parsePurposeTC test cases for ParsePurpose
+var parsePurposeTC = []struct {
+	purpose    string
+	expPurpose string
+	expError   bool
+}{
+	{"HMB", "HMB", false},
+	{"gru", "GRU", false},
+	{"DUO:0000011", "POA", false},
+	{"ds-MONDO:0005015", "DS-MONDO:0005015", false},
+	{"NRES", "", true},
+	{"DS-", "", true},
+	{"NCU", "", true},
+	{"", "", true},
+}
+
+// TestParsePurpose tests ParsePurpose function
+func TestParsePurpose(t *testing.T) {
+	for _, tc := range parsePurposeTC {
+		purpose, err := ParsePurpose(tc.purpose)
+		assert.Equal(t, tc.expPurpose, purpose, tc.purpose)
+		assert.Equal(t, tc.expError, err != nil, tc.purpose)
+	}
+}
+
+// checkPurposeTC test cases for CheckPurpose
+var checkPurposeTC = []struct {
+	purpose    string
+	conditions []string
+	expAllowed bool
+}{
+	// datasets without conditions allow anything
+	{"", []string{}, true},
+	{"POA", nil, true},
+	// no restriction allows an undeclared purpose
+	{"", []string{"NRES"}, true},
+	{"", []string{"GRU"}, false},
+	// general research use covers all research
+	{"HMB", []string{"GRU", "NCU"}, true},
+	{"POA", []string{"DUO:0000042"}, true},
+	// health/medical/biomedical covers disease specific research only
+	{"HMB", []string{"HMB"}, true},
+	{"DS-MONDO:0005015", []string{"HMB"}, true},
+	{"POA", []string{"HMB"}, false},
+	{"GRU", []string{"HMB"}, false},
+	// disease specific research must be on the same disease
+	{"DS-MONDO:0005015", []string{"DS-MONDO:0005015"}, true},
+	{"DS-MONDO:0004992", []string{"DS-MONDO:0005015"}, false},
+	{"HMB", []string{"DS-MONDO:0005015"}, false},
+	// any listed permission may allow the purpose
+	{"POA", []string{"DS-MONDO:0005015", "POA"}, true},
+	// modifiers alone grant nothing
+	{"HMB", []string{"NCU", "IRB"}, false},
+	// invalid purposes are refused
+	{"commercial", []string{"GRU"}, false},
+}
+
+// TestCheckPurpose tests CheckPurpose function
+func TestCheckPurpose(t *testing.T) {
+	for _, tc := range checkPurposeTC {
+		err := CheckPurpose(tc.purpose, tc.conditions)
+		assert.Equal(t, tc.expAllowed, err == nil, "%s %v", tc.purpose, tc.conditions)
+	}
+}
@@ -23,9 +23,18 @@ const codePermissionDenied = http.StatusForbidden
 // codeNotFound status code for Not Found errors
 const codeNotFound = http.StatusNotFound
 
+// codeTooManyRequests status code for requests exceeding a quota
+const codeTooManyRequests = http.StatusTooManyRequests
+
 // codeInternalServerError status code for unspecified server-side error
 const codeInternalServerError = http.StatusInternalServerError
 
+// codeBadGateway status code for failures of an upstream service
+const codeBadGateway = http.StatusBadGateway
+
+// codeServiceUnavailable status code for upstream services temporarily not called
+const codeServiceUnavailable = http.StatusServiceUnavailable
+
 /* Error Names: htsget canonical error names */
 
 // errorBadRequestUnsupportedFormat error name for unsupported format
@@ -46,9 +55,18 @@ const errorPermissionDenied = "PermissionDenied"
 // errorNotFound error name for not found
 const errorNotFound = "NotFound"
 
+// errorTooManyRequests error name for requests exceeding a quota
+const errorTooManyRequests = "TooManyRequests"
+
 // errorInternalServerError error name for unspecified server errors
 const errorInternalServerError = "InternalServerError"
 
+// errorBadGateway error name for failures of an upstream service
+const errorBadGateway = "BadGateway"
+
+// errorServiceUnavailable error name for upstream services temporarily not called
+const errorServiceUnavailable = "ServiceUnavailable"
+
 /* Default Messages: default error message by error name */
 
 // dfltMsgBadRequestUnsupportedFormat default unsupported format message
@@ -69,9 +87,18 @@ const dfltMsgPermissionDenied = "Authorization is required to access the resourc
 // dfltMsgNotFound default not found error message
 const dfltMsgNotFound = "The resource requested was not found"
 
+// dfltMsgTooManyRequests default message for requests exceeding a quota
+const dfltMsgTooManyRequests = "The request quota has been used up, so no further requests are served until it is reset"
+
 // dfltMsgInternalServerError default message for unspecified errors
 const dfltMsgInternalServerError = "Internal server error"
 
+// dfltMsgBadGateway default message for upstream service failures
+const dfltMsgBadGateway = "An upstream service required to process the request failed"
+
+// dfltMsgServiceUnavailable default message for upstream services temporarily not called
+const dfltMsgServiceUnavailable = "An upstream service required to process the request is temporarily unavailable"
+
 // errorInfoMap maps error name to status code and default message
 var errorInfoMap = map[string]map[string]string{
 	errorBadRequestUnsupportedFormat: {
@@ -98,8 +125,20 @@ var errorInfoMap = map[string]map[string]string{
 		"code":    strconv.Itoa(codeNotFound),
 		"dfltMsg": dfltMsgNotFound,
 	},
+	errorTooManyRequests: {
+		"code":    strconv.Itoa(codeTooManyRequests),
+		"dfltMsg": dfltMsgTooManyRequests,
+	},
 	errorInternalServerError: {
 		"code":    strconv.Itoa(codeInternalServerError),
 		"dfltMsg": dfltMsgInternalServerError,
 	},
+	errorBadGateway: {
+		"code":    strconv.Itoa(codeBadGateway),
+		"dfltMsg": dfltMsgBadGateway,
+	},
+	errorServiceUnavailable: {
+		"code":    strconv.Itoa(codeServiceUnavailable),
+		"dfltMsg": dfltMsgServiceUnavailable,
+	},
 }
@@ -106,7 +106,22 @@ func NotFound(writer http.ResponseWriter, msgPtr *string) {
 	htsgetErrorTemplate(writer, errorNotFound, msgPtr)
 }
 
+// TooManyRequests writes a TooManyRequests error to the HTTP ResponseWriter
+func TooManyRequests(writer http.ResponseWriter, msgPtr *string) {
+	htsgetErrorTemplate(writer, errorTooManyRequests, msgPtr)
+}
+
 // InternalServerError writes an InternalServerError error to the HTTP ResponseWriter
 func InternalServerError(writer http.ResponseWriter, msgPtr *string) {
 	htsgetErrorTemplate(writer, errorInternalServerError, msgPtr)
 }
+
+// BadGateway writes a BadGateway error to the HTTP ResponseWriter
+func BadGateway(writer http.ResponseWriter, msgPtr *string) {
+	htsgetErrorTemplate(writer, errorBadGateway, msgPtr)
+}
+
+// ServiceUnavailable writes a ServiceUnavailable error to the HTTP ResponseWriter
+func ServiceUnavailable(writer http.ResponseWriter, msgPtr *string) {
+	htsgetErrorTemplate(writer, errorServiceUnavailable, msgPtr)
+}
@@ -65,12 +65,30 @@ var errorsTC = []struct {
 		"NotFound: The resource requested was not found",
 		codeNotFound,
 	},
+	{
+		TooManyRequests,
+		nil,
+		"TooManyRequests: The request quota has been used up, so no further requests are served until it is reset",
+		codeTooManyRequests,
+	},
 	{
 		InternalServerError,
 		nil,
 		"InternalServerError: Internal server error",
 		codeInternalServerError,
 	},
+	{
+		BadGateway,
+		nil,
+		"BadGateway: An upstream service required to process the request failed",
+		codeBadGateway,
+	},
+	{
+		ServiceUnavailable,
+		nil,
+		"ServiceUnavailable: An upstream service required to process the request is temporarily unavailable",
+		codeServiceUnavailable,
+	},
 }
 
 // TestErrors tests various error-generating functions
@@ -0,0 +1,71 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module breaker stops calling an issuer whose manifest fetches keep failing,
+// so that requests fail fast rather than waiting on an issuer that is down
+package htsmanifest
+
+import (
+	"time"
+)
+
+// circuitBreaker counts consecutive failed fetches from a single issuer. once
+// the threshold is reached the breaker opens, and no fetches are allowed until
+// the cooldown has passed. a single trial fetch is then allowed, closing the
+// breaker if it succeeds and opening it again if it fails
+type circuitBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	failures  int
+	openedAt  time.Time
+	trial     bool
+}
+
+// newCircuitBreaker instantiates a closed circuit breaker
+func newCircuitBreaker(threshold int, cooldown time.Duration) *circuitBreaker {
+	breaker := new(circuitBreaker)
+	breaker.threshold = threshold
+	breaker.cooldown = cooldown
+	return breaker
+}
+
+// allow checks if a fetch may be attempted, starting a trial fetch if the
+// breaker is open and the cooldown has passed
+//
+//	Type: circuitBreaker
+// Arguments
+//	now (time.Time): current time
+// Returns
+//	(bool): if true, the fetch may be attempted
+func (breaker *circuitBreaker) allow(now time.Time) bool {
+	if breaker.failures < breaker.threshold {
+		return true
+	}
+	if breaker.trial || now.Before(breaker.openedAt.Add(breaker.cooldown)) {
+		return false
+	}
+	breaker.trial = true
+	return true
+}
+
+// success records a successful fetch, closing the breaker
+//
+//	Type: circuitBreaker
+func (breaker *circuitBreaker) success() {
+	breaker.failures = 0
+	breaker.trial = false
+}
+
+// failure records a failed fetch, opening the breaker once the threshold is
+// reached
+//
+//	Type: circuitBreaker
+// Arguments
+//	now (time.Time): current time
+func (breaker *circuitBreaker) failure(now time.Time) {
+	breaker.failures++
+	breaker.trial = false
+	if breaker.failures >= breaker.threshold {
+		breaker.openedAt = now
+	}
+}
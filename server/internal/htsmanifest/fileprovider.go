@@ -0,0 +1,75 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module fileprovider reads manifests from a local directory, for offline
+// testing and for sites that cannot reach the issuers of their visas
+package htsmanifest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider reads the manifest of each dataset from {dir}/{dataset}.json,
+// whichever issuer granted access to it
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider instantiates a manifest provider reading from a directory
+//
+// Arguments
+//	dir (string): directory holding a {dataset}.json manifest per dataset
+// Returns
+//	(*FileProvider): manifest provider
+func NewFileProvider(dir string) *FileProvider {
+	provider := new(FileProvider)
+	provider.dir = dir
+	return provider
+}
+
+// GetManifest reads the manifest of a dataset from the directory
+//
+//	Type: FileProvider
+// Arguments
+//	issuer (string): issuer of the visa granting access to the dataset
+//	datasetID (string): dataset the manifest is requested for
+// Returns
+//	(*Manifest): manifest of the dataset
+//	(error): a *ManifestError, if the manifest could not be loaded
+func (provider *FileProvider) GetManifest(issuer string, datasetID string) (*Manifest, error) {
+	manifest, err := provider.read(datasetID)
+	if err != nil {
+		return nil, &ManifestError{Issuer: issuer, DatasetID: datasetID, Err: err}
+	}
+	return manifest, nil
+}
+
+// read reads and parses the manifest file of a dataset
+//
+//	Type: FileProvider
+// Arguments
+//	datasetID (string): dataset the manifest is requested for
+// Returns
+//	(*Manifest): manifest of the dataset
+//	(error): the manifest file could not be read or parsed
+func (provider *FileProvider) read(datasetID string) (*Manifest, error) {
+	// the dataset id comes from the request path, so must not be able to name a
+	// file outside the manifest directory
+	if datasetID == "" || datasetID == "." || datasetID == ".." || strings.ContainsAny(datasetID, "/\\") {
+		return nil, fmt.Errorf("dataset id %s cannot name a manifest file", datasetID)
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(provider.dir, datasetID+".json"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := new(Manifest)
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return nil, fmt.Errorf("malformed manifest: %v", err)
+	}
+	return manifest, nil
+}
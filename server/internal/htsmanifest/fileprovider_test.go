@@ -0,0 +1,43 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module fileprovider_test tests module fileprovider
+package htsmanifest
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestFileProvider tests FileProvider GetManifest function
+func TestFileProvider(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "10g.json"), []byte(`{"id":"10g","htsgetRegions":[{"chromosome":"1","start":100}]}`), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "giab.json"), []byte(`{"id":`), 0644)
+	ioutil.WriteFile(filepath.Join(filepath.Dir(dir), "outside.json"), []byte(`{"id":"outside"}`), 0644)
+	defer os.Remove(filepath.Join(filepath.Dir(dir), "outside.json"))
+
+	provider := NewFileProvider(dir)
+
+	manifest, err := provider.GetManifest("https://dac.example.org", "10g")
+	assert.Nil(t, err)
+	assert.Equal(t, "10g", manifest.Id)
+	assert.Equal(t, "1", manifest.Regions[0].Id)
+	assert.Equal(t, 100, *manifest.Regions[0].Start)
+	assert.Nil(t, manifest.Regions[0].End)
+
+	for _, datasetID := range []string{"giab", "1kg", "../outside", "..", ""} {
+		manifest, err = provider.GetManifest("https://dac.example.org", datasetID)
+		assert.Nil(t, manifest, datasetID)
+		assert.Equal(t, datasetID, err.(*ManifestError).DatasetID)
+		assert.False(t, err.(*ManifestError).Unavailable)
+	}
+}
@@ -0,0 +1,172 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module httpprovider fetches manifests from the issuer of each visa, caching
+// them for a time and revalidating them with their ETag
+package htsmanifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+)
+
+// cachedManifest a fetched manifest along with the ETag it was served with
+type cachedManifest struct {
+	manifest  *Manifest
+	etag      string
+	fetchedAt time.Time
+}
+
+// HTTPProvider fetches manifests from {issuer}/api/manifest/{dataset}. fetched
+// manifests are used until the cache ttl has passed, then revalidated with the
+// issuer. issuers whose fetches keep failing are not called again until their
+// circuit breaker cooldown has passed
+type HTTPProvider struct {
+	client           *http.Client
+	ttl              time.Duration
+	breakerThreshold int
+	breakerCooldown  time.Duration
+	now              func() time.Time
+	mutex            sync.Mutex
+	cache            map[string]*cachedManifest
+	breakers         map[string]*circuitBreaker
+}
+
+// NewHTTPProvider instantiates a manifest provider fetching manifests over http
+//
+// Arguments
+//	timeout (time.Duration): timeout for each manifest request
+//	ttl (time.Duration): time a fetched manifest is used before it is revalidated
+//	breakerThreshold (int): consecutive failed fetches before an issuer is no longer called
+//	breakerCooldown (time.Duration): time an issuer is no longer called after repeated failures
+// Returns
+//	(*HTTPProvider): manifest provider with an empty cache
+func NewHTTPProvider(timeout time.Duration, ttl time.Duration, breakerThreshold int, breakerCooldown time.Duration) *HTTPProvider {
+	provider := new(HTTPProvider)
+	provider.client = &http.Client{Timeout: timeout}
+	provider.ttl = ttl
+	provider.breakerThreshold = breakerThreshold
+	provider.breakerCooldown = breakerCooldown
+	provider.now = time.Now
+	provider.cache = map[string]*cachedManifest{}
+	provider.breakers = map[string]*circuitBreaker{}
+	return provider
+}
+
+// GetManifestURL gets the location an issuer serves the manifest of a dataset at
+func GetManifestURL(issuer string, datasetID string) string {
+	return fmt.Sprintf("%s/api/manifest/%s", strings.TrimSuffix(issuer, "/"), url.PathEscape(datasetID))
+}
+
+// GetManifest gets the manifest of a dataset from the issuer, or from the cache
+// if it was fetched within the ttl
+//
+//	Type: HTTPProvider
+// Arguments
+//	issuer (string): issuer of the visa granting access to the dataset
+//	datasetID (string): dataset the manifest is requested for
+// Returns
+//	(*Manifest): manifest of the dataset
+//	(error): a *ManifestError, if the manifest could not be loaded
+func (provider *HTTPProvider) GetManifest(issuer string, datasetID string) (*Manifest, error) {
+	manifestURL := GetManifestURL(issuer, datasetID)
+
+	provider.mutex.Lock()
+	now := provider.now()
+	cached := provider.cache[manifestURL]
+	if cached != nil && now.Before(cached.fetchedAt.Add(provider.ttl)) {
+		provider.mutex.Unlock()
+		return cached.manifest, nil
+	}
+	breaker, ok := provider.breakers[issuer]
+	if !ok {
+		breaker = newCircuitBreaker(provider.breakerThreshold, provider.breakerCooldown)
+		provider.breakers[issuer] = breaker
+	}
+	allowed := breaker.allow(now)
+	provider.mutex.Unlock()
+
+	if !allowed {
+		return nil, &ManifestError{
+			Issuer:      issuer,
+			DatasetID:   datasetID,
+			Unavailable: true,
+			Err:         errors.New("issuer is not being called after repeated failures"),
+		}
+	}
+
+	fetched, issuerFailed, err := provider.fetch(manifestURL, cached)
+
+	provider.mutex.Lock()
+	defer provider.mutex.Unlock()
+	if err != nil {
+		// only failures of the issuer itself count towards opening the breaker,
+		// a missing or malformed manifest says nothing of the issuer's health
+		if issuerFailed {
+			breaker.failure(provider.now())
+		} else {
+			breaker.success()
+		}
+		return nil, &ManifestError{Issuer: issuer, DatasetID: datasetID, Err: err}
+	}
+	breaker.success()
+	fetched.fetchedAt = provider.now()
+	provider.cache[manifestURL] = fetched
+	return fetched.manifest, nil
+}
+
+// fetch requests a manifest, revalidating the cached manifest if there is one
+//
+//	Type: HTTPProvider
+// Arguments
+//	manifestURL (string): location of the manifest
+//	cached (*cachedManifest): previously fetched manifest, or nil
+// Returns
+//	(*cachedManifest): the fetched or revalidated manifest
+//	(bool): if true, the failure was a failure of the issuer itself
+//	(error): the manifest could not be fetched
+func (provider *HTTPProvider) fetch(manifestURL string, cached *cachedManifest) (*cachedManifest, bool, error) {
+	request, err := http.NewRequest(http.MethodGet, manifestURL, nil)
+	if err != nil {
+		return nil, false, err
+	}
+	request.Header.Set("Accept", "application/json")
+	if cached != nil && cached.etag != "" {
+		request.Header.Set("If-None-Match", cached.etag)
+	}
+
+	response, err := provider.client.Do(request)
+	if err != nil {
+		return nil, true, err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotModified && cached != nil {
+		log.Debug("Manifest %s not modified", manifestURL)
+		return &cachedManifest{manifest: cached.manifest, etag: cached.etag}, false, nil
+	}
+	if response.StatusCode != http.StatusOK {
+		issuerFailed := response.StatusCode >= http.StatusInternalServerError
+		return nil, issuerFailed, fmt.Errorf("%s responded %s", manifestURL, response.Status)
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, true, err
+	}
+	manifest := new(Manifest)
+	if err := json.Unmarshal(body, manifest); err != nil {
+		return nil, false, fmt.Errorf("%s served a malformed manifest: %v", manifestURL, err)
+	}
+	log.Debug("Fetched manifest %s", manifestURL)
+	return &cachedManifest{manifest: manifest, etag: response.Header.Get("ETag")}, false, nil
+}
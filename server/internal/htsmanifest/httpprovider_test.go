@@ -0,0 +1,181 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module httpprovider_test tests module httpprovider
+package htsmanifest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// standInIssuer serves manifests as an issuer would, counting the requests it
+// receives
+type standInIssuer struct {
+	server       *httptest.Server
+	mutex        sync.Mutex
+	requests     int
+	conditionals int
+	status       int
+	etag         string
+	regions      []Region
+}
+
+// newStandInIssuer starts an issuer serving a manifest of dataset 10g
+func newStandInIssuer() *standInIssuer {
+	issuer := &standInIssuer{status: http.StatusOK, etag: `"v1"`, regions: []Region{{Id: "1"}}}
+	issuer.server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		issuer.requests++
+		if request.URL.Path != "/api/manifest/10g" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if issuer.status != http.StatusOK {
+			writer.WriteHeader(issuer.status)
+			return
+		}
+		if request.Header.Get("If-None-Match") == issuer.etag {
+			issuer.conditionals++
+			writer.WriteHeader(http.StatusNotModified)
+			return
+		}
+		writer.Header().Set("ETag", issuer.etag)
+		json.NewEncoder(writer).Encode(Manifest{Id: "10g", Regions: issuer.regions})
+	}))
+	return issuer
+}
+
+// set changes what the issuer responds with
+func (issuer *standInIssuer) set(status int, etag string, regions ...Region) {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.status = status
+	issuer.etag = etag
+	if len(regions) > 0 {
+		issuer.regions = regions
+	}
+}
+
+// counts gets the number of requests, and of those the number answered as
+// not modified
+func (issuer *standInIssuer) counts() (int, int) {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	return issuer.requests, issuer.conditionals
+}
+
+// fakeClock a settable clock for the provider
+type fakeClock struct {
+	now time.Time
+}
+
+// newTestProvider creates a provider with a ttl of one minute and a breaker
+// opening after two failures for thirty seconds
+func newTestProvider(clock *fakeClock) *HTTPProvider {
+	provider := NewHTTPProvider(time.Second, time.Minute, 2, 30*time.Second)
+	provider.now = func() time.Time { return clock.now }
+	return provider
+}
+
+// TestGetManifestURL tests GetManifestURL function
+func TestGetManifestURL(t *testing.T) {
+	assert.Equal(t, "https://dac.example.org/api/manifest/10g", GetManifestURL("https://dac.example.org", "10g"))
+	assert.Equal(t, "https://dac.example.org/api/manifest/10g", GetManifestURL("https://dac.example.org/", "10g"))
+	assert.Equal(t, "https://dac.example.org/api/manifest/a%2Fb", GetManifestURL("https://dac.example.org", "a/b"))
+}
+
+// TestHTTPProviderCache tests that manifests are cached for the ttl, then
+// revalidated with their ETag
+func TestHTTPProviderCache(t *testing.T) {
+	issuer := newStandInIssuer()
+	defer issuer.server.Close()
+	clock := &fakeClock{now: time.Unix(1635724800, 0)}
+	provider := newTestProvider(clock)
+
+	manifest, err := provider.GetManifest(issuer.server.URL, "10g")
+	assert.Nil(t, err)
+	assert.Equal(t, "10g", manifest.Id)
+	manifest, err = provider.GetManifest(issuer.server.URL, "10g")
+	assert.Nil(t, err)
+	requests, conditionals := issuer.counts()
+	assert.Equal(t, 1, requests)
+
+	// once the ttl passes the unchanged manifest is revalidated, not refetched
+	clock.now = clock.now.Add(2 * time.Minute)
+	manifest, err = provider.GetManifest(issuer.server.URL, "10g")
+	assert.Nil(t, err)
+	assert.Equal(t, []Region{{Id: "1"}}, manifest.Regions)
+	requests, conditionals = issuer.counts()
+	assert.Equal(t, 2, requests)
+	assert.Equal(t, 1, conditionals)
+
+	// a changed manifest is picked up on the next revalidation
+	issuer.set(http.StatusOK, `"v2"`, Region{Id: "2"})
+	manifest, _ = provider.GetManifest(issuer.server.URL, "10g")
+	assert.Equal(t, []Region{{Id: "1"}}, manifest.Regions)
+	clock.now = clock.now.Add(2 * time.Minute)
+	manifest, err = provider.GetManifest(issuer.server.URL, "10g")
+	assert.Nil(t, err)
+	assert.Equal(t, []Region{{Id: "2"}}, manifest.Regions)
+}
+
+// TestHTTPProviderErrors tests that failed fetches are ManifestErrors, and that
+// only failures of the issuer open its breaker
+func TestHTTPProviderErrors(t *testing.T) {
+	issuer := newStandInIssuer()
+	defer issuer.server.Close()
+	clock := &fakeClock{now: time.Unix(1635724800, 0)}
+	provider := newTestProvider(clock)
+
+	// a missing manifest is not the issuer failing, so never opens the breaker
+	for i := 0; i < 3; i++ {
+		_, err := provider.GetManifest(issuer.server.URL, "giab")
+		assert.NotNil(t, err)
+		assert.False(t, err.(*ManifestError).Unavailable)
+		assert.Equal(t, "giab", err.(*ManifestError).DatasetID)
+	}
+	requests, _ := issuer.counts()
+	assert.Equal(t, 3, requests)
+
+	// the breaker opens once the issuer has failed twice
+	issuer.set(http.StatusInternalServerError, `"v1"`)
+	for i := 0; i < 2; i++ {
+		_, err := provider.GetManifest(issuer.server.URL, "10g")
+		assert.False(t, err.(*ManifestError).Unavailable)
+	}
+	_, err := provider.GetManifest(issuer.server.URL, "10g")
+	assert.True(t, err.(*ManifestError).Unavailable)
+	requests, _ = issuer.counts()
+	assert.Equal(t, 5, requests)
+
+	// after the cooldown a single trial is made, which reopens the breaker if it fails
+	clock.now = clock.now.Add(time.Minute)
+	_, err = provider.GetManifest(issuer.server.URL, "10g")
+	assert.False(t, err.(*ManifestError).Unavailable)
+	_, err = provider.GetManifest(issuer.server.URL, "10g")
+	assert.True(t, err.(*ManifestError).Unavailable)
+	requests, _ = issuer.counts()
+	assert.Equal(t, 6, requests)
+
+	// and closes the breaker if it succeeds
+	issuer.set(http.StatusOK, `"v1"`)
+	clock.now = clock.now.Add(time.Minute)
+	manifest, err := provider.GetManifest(issuer.server.URL, "10g")
+	assert.Nil(t, err)
+	assert.Equal(t, "10g", manifest.Id)
+
+	// an issuer that cannot be reached at all also opens the breaker
+	unreachable := "http://127.0.0.1:1"
+	provider.GetManifest(unreachable, "10g")
+	provider.GetManifest(unreachable, "10g")
+	_, err = provider.GetManifest(unreachable, "10g")
+	assert.True(t, err.(*ManifestError).Unavailable)
+}
@@ -0,0 +1,195 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module manifest contains the manifest document, the ManifestProvider
+// interface manifests are loaded through, and the process-wide provider
+package htsmanifest
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+	"github.com/ga4gh/htsget-refserver/internal/htsutils"
+)
+
+// Region a genomic region of a dataset that may be accessed, within its
+// window. a nil Start or End leaves the region open at that side
+type Region struct {
+	Id    string `json:"chromosome"`
+	Start *int   `json:"start,omitempty"`
+	End   *int   `json:"end,omitempty"`
+	Window
+}
+
+// ArtifactConcrete the files of a single sample, which may be accessed within
+// its window
+type ArtifactConcrete struct {
+	VariantsPath string `json:"variantsPath"`
+	ReadsPath    string `json:"readsPath,omitempty"`
+	Window
+}
+
+// Artifact the files of a single patient, keyed by sample, which may be
+// accessed within its window
+type Artifact struct {
+	Samples map[string]ArtifactConcrete `json:"samples"`
+	Window
+}
+
+// Manifest lists the artifacts and regions of a dataset that may be accessed,
+// and the Data Use Ontology codes the dataset is labelled with
+type Manifest struct {
+	Id         string              `json:"id"`
+	PatientIds []string            `json:"patientIds"`
+	Url        string              `json:"htsgetUrl"`
+	Artifacts  map[string]Artifact `json:"htsgetArtifacts"`
+	Regions    []Region            `json:"htsgetRegions"`
+	DataUse    []string            `json:"dataUse,omitempty"`
+}
+
+// Sample the files of a single sample listed in a manifest, with the patient
+// it belongs to
+type Sample struct {
+	PatientID string
+	SampleID  string
+	ArtifactConcrete
+}
+
+// Samples gets every sample in the manifest, ordered by patient and sample id.
+// if the manifest lists patient ids, only the samples of those patients are
+// included
+//
+//	Type: Manifest
+// Returns
+//	([]Sample): samples that may be accessed
+func (manifest *Manifest) Samples() []Sample {
+	samples := make([]Sample, 0)
+	for patientID, artifact := range manifest.Artifacts {
+		if len(manifest.PatientIds) > 0 && !htsutils.IsItemInArray(patientID, manifest.PatientIds) {
+			continue
+		}
+		for sampleID, sample := range artifact.Samples {
+			samples = append(samples, Sample{PatientID: patientID, SampleID: sampleID, ArtifactConcrete: sample})
+		}
+	}
+	sort.Slice(samples, func(i, j int) bool {
+		if samples[i].PatientID != samples[j].PatientID {
+			return samples[i].PatientID < samples[j].PatientID
+		}
+		return samples[i].SampleID < samples[j].SampleID
+	})
+	return samples
+}
+
+// ArtifactPaths gets the paths of the files of every sample in the manifest.
+// if the manifest lists patient ids, only the artifacts of those patients are
+// included
+//
+//	Type: Manifest
+// Returns
+//	([]string): paths of the artifact files
+func (manifest *Manifest) ArtifactPaths() []string {
+	paths := make([]string, 0)
+	for _, sample := range manifest.Samples() {
+		if sample.VariantsPath != "" {
+			paths = append(paths, sample.VariantsPath)
+		}
+		if sample.ReadsPath != "" {
+			paths = append(paths, sample.ReadsPath)
+		}
+	}
+	return paths
+}
+
+// AllowsObject checks if an object is one of the artifacts of the manifest, so
+// that a visa for the dataset grants access to it
+//
+//	Type: Manifest
+// Arguments
+//	objectPath (string): path of the requested object, as resolved through the data source registry
+// Returns
+//	(bool): if true, the object may be accessed
+func (manifest *Manifest) AllowsObject(objectPath string) bool {
+	return objectPath != "" && htsutils.IsItemInArray(objectPath, manifest.ArtifactPaths())
+}
+
+// ManifestProvider loads the manifest of a dataset
+type ManifestProvider interface {
+	// GetManifest gets the manifest of a dataset whose access was granted by a
+	// visa from the issuer. any error is a *ManifestError
+	GetManifest(issuer string, datasetID string) (*Manifest, error)
+}
+
+// ManifestError the manifest of a dataset could not be loaded
+//
+// Attributes
+//	Issuer (string): issuer the manifest was requested from
+//	DatasetID (string): dataset the manifest was requested for
+//	Unavailable (bool): if true, the manifest was not requested at all because the
+//	provider is temporarily not calling the issuer
+//	Err (error): the underlying failure
+type ManifestError struct {
+	Issuer      string
+	DatasetID   string
+	Unavailable bool
+	Err         error
+}
+
+// Error describes why the manifest could not be loaded
+//
+//	Type: ManifestError
+// Returns
+//	(string): description of the failure
+func (err *ManifestError) Error() string {
+	return fmt.Sprintf("manifest of dataset %s from %s could not be loaded: %v", err.DatasetID, err.Issuer, err.Err)
+}
+
+// provider process-wide manifest provider, created from the configuration on
+// first use
+var provider ManifestProvider
+
+// providerMutex guards provider
+var providerMutex sync.Mutex
+
+// newConfiguredProvider creates the manifest provider named in the
+// configuration
+func newConfiguredProvider() ManifestProvider {
+	switch htsconfig.GetManifestProvider() {
+	case htsconfig.ManifestProviderFile:
+		return NewFileProvider(htsconfig.GetManifestDir())
+	case htsconfig.ManifestProviderHTTP:
+	default:
+		log.Error("Unknown manifest provider %s, so fetching manifests over http", htsconfig.GetManifestProvider())
+	}
+	return NewHTTPProvider(
+		htsconfig.GetManifestTimeout(),
+		htsconfig.GetManifestCacheTTL(),
+		htsconfig.GetManifestBreakerThreshold(),
+		htsconfig.GetManifestBreakerCooldown(),
+	)
+}
+
+// GetProvider gets the process-wide manifest provider, creating it from the
+// configuration on first use so that fetched manifests are cached across
+// requests
+func GetProvider() ManifestProvider {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+
+	if provider == nil {
+		provider = newConfiguredProvider()
+	}
+	return provider
+}
+
+// SetProvider replaces the process-wide manifest provider. if nil, the next
+// call to GetProvider creates it again from the configuration
+func SetProvider(manifestProvider ManifestProvider) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+
+	provider = manifestProvider
+}
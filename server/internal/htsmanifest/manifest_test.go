@@ -0,0 +1,69 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module manifest_test tests module manifest
+package htsmanifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// manifestTC sample manifest used across test cases
+var manifestTC = &Manifest{
+	Id: "10g",
+	Artifacts: map[string]Artifact{
+		"P1": {Samples: map[string]ArtifactConcrete{
+			"S1": {VariantsPath: "s3://10g/P1/S1.vcf.gz", ReadsPath: "s3://10g/P1/S1.bam"},
+		}},
+		"P2": {Samples: map[string]ArtifactConcrete{
+			"S2": {VariantsPath: "s3://10g/P2/S2.vcf.gz"},
+		}},
+	},
+}
+
+// manifestAllowsObjectTC test cases for AllowsObject
+var manifestAllowsObjectTC = []struct {
+	manifest   *Manifest
+	objectPath string
+	exp        bool
+}{
+	{manifestTC, "s3://10g/P1/S1.vcf.gz", true},
+	{manifestTC, "s3://10g/P1/S1.bam", true},
+	{manifestTC, "s3://10g/P2/S2.vcf.gz", true},
+	{manifestTC, "s3://10g/P2/S2.bam", false},
+	{manifestTC, "s3://10g/P3/S3.vcf.gz", false},
+	{manifestTC, "", false},
+	{&Manifest{PatientIds: []string{"P2"}, Artifacts: manifestTC.Artifacts}, "s3://10g/P1/S1.vcf.gz", false},
+	{&Manifest{PatientIds: []string{"P2"}, Artifacts: manifestTC.Artifacts}, "s3://10g/P2/S2.vcf.gz", true},
+	{&Manifest{}, "s3://10g/P1/S1.vcf.gz", false},
+}
+
+// TestManifestAllowsObject tests AllowsObject function
+func TestManifestAllowsObject(t *testing.T) {
+	for _, tc := range manifestAllowsObjectTC {
+		assert.Equal(t, tc.exp, tc.manifest.AllowsObject(tc.objectPath), tc.objectPath)
+	}
+}
+
+// TestManifestSamples tests Samples function
+func TestManifestSamples(t *testing.T) {
+	var tc = []struct {
+		manifest *Manifest
+		exp      []string
+	}{
+		{manifestTC, []string{"P1/S1", "P2/S2"}},
+		{&Manifest{PatientIds: []string{"P2"}, Artifacts: manifestTC.Artifacts}, []string{"P2/S2"}},
+		{&Manifest{}, []string{}},
+	}
+
+	for _, c := range tc {
+		samples := make([]string, 0)
+		for _, sample := range c.manifest.Samples() {
+			samples = append(samples, sample.PatientID+"/"+sample.SampleID)
+		}
+		assert.Equal(t, c.exp, samples)
+	}
+	assert.Equal(t, "s3://10g/P1/S1.bam", manifestTC.Samples()[0].ReadsPath)
+}
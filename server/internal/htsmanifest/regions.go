@@ -0,0 +1,113 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module regions intersects requested genomic intervals with the union of the
+// regions a manifest permits
+package htsmanifest
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RegionOpenEnd end position standing in for a region that is open at its end
+const RegionOpenEnd = 1000000000
+
+// Interval a genomic interval on a single reference, from Start (inclusive)
+// to End (exclusive)
+type Interval struct {
+	ReferenceName string
+	Start         int
+	End           int
+}
+
+// Matches checks if the manifest region is on the requested reference. the
+// manifest names references without a chr prefix (e.g. 1, X), which requests
+// may include
+//
+//	Type: Region
+// Arguments
+//	referenceName (string): requested reference name
+// Returns
+//	(bool): if true, the manifest region is on the requested reference
+func (region *Region) Matches(referenceName string) bool {
+	return referenceName == region.Id || referenceName == fmt.Sprintf("chr%s", strings.TrimPrefix(region.Id, "chr"))
+}
+
+// bounds gets the start and end of the manifest region, filling in the bounds
+// of an open region
+//
+//	Type: Region
+// Returns
+//	(int): start of the region
+//	(int): end of the region
+func (region *Region) bounds() (int, int) {
+	start, end := 0, RegionOpenEnd
+	if region.Start != nil {
+		start = *region.Start
+	}
+	if region.End != nil {
+		end = *region.End
+	}
+	return start, end
+}
+
+// Clip intersects a requested interval with the union of the manifest regions
+// on the same reference. adjacent and overlapping manifest regions are merged,
+// so a requested interval spanning several of them is permitted as a whole
+//
+//	Type: Manifest
+// Arguments
+//	referenceName (string): requested reference name
+//	start (int): requested start
+//	end (int): requested end
+// Returns
+//	([]Interval): sorted parts of the requested interval the manifest permits
+//	([]Interval): sorted parts of the requested interval the manifest does not permit
+func (manifest *Manifest) Clip(referenceName string, start int, end int) ([]Interval, []Interval) {
+	intersections := make([]Interval, 0)
+	for _, region := range manifest.Regions {
+		if !region.Matches(referenceName) {
+			continue
+		}
+		regionStart, regionEnd := region.bounds()
+		if regionStart < start {
+			regionStart = start
+		}
+		if regionEnd > end {
+			regionEnd = end
+		}
+		if regionStart < regionEnd {
+			intersections = append(intersections, Interval{referenceName, regionStart, regionEnd})
+		}
+	}
+	sort.Slice(intersections, func(i, j int) bool {
+		return intersections[i].Start < intersections[j].Start
+	})
+
+	permitted := make([]Interval, 0)
+	for _, intersection := range intersections {
+		last := len(permitted) - 1
+		if last >= 0 && intersection.Start <= permitted[last].End {
+			if intersection.End > permitted[last].End {
+				permitted[last].End = intersection.End
+			}
+			continue
+		}
+		permitted = append(permitted, intersection)
+	}
+
+	withheld := make([]Interval, 0)
+	position := start
+	for _, interval := range permitted {
+		if interval.Start > position {
+			withheld = append(withheld, Interval{referenceName, position, interval.Start})
+		}
+		position = interval.End
+	}
+	if position < end {
+		withheld = append(withheld, Interval{referenceName, position, end})
+	}
+	return permitted, withheld
+}
@@ -0,0 +1,71 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module regions_test tests module regions
+package htsmanifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bounded creates a manifest region with a start and end
+func bounded(id string, start int, end int) Region {
+	return Region{Id: id, Start: &start, End: &end}
+}
+
+// clipTC test cases for Clip
+var clipTC = []struct {
+	regions       []Region
+	referenceName string
+	start, end    int
+	permitted     []Interval
+	withheld      []Interval
+}{
+	// request inside a single manifest region
+	{
+		[]Region{bounded("1", 100, 200)},
+		"chr1", 120, 180,
+		[]Interval{{"chr1", 120, 180}},
+		[]Interval{},
+	},
+	// request spanning adjacent and overlapping manifest regions
+	{
+		[]Region{bounded("1", 150, 300), bounded("1", 100, 200), bounded("1", 300, 400)},
+		"1", 100, 400,
+		[]Interval{{"1", 100, 400}},
+		[]Interval{},
+	},
+	// request overhanging both sides and a gap between manifest regions
+	{
+		[]Region{bounded("1", 100, 200), bounded("1", 300, 400), bounded("2", 0, 1000)},
+		"chr1", 50, 450,
+		[]Interval{{"chr1", 100, 200}, {"chr1", 300, 400}},
+		[]Interval{{"chr1", 50, 100}, {"chr1", 200, 300}, {"chr1", 400, 450}},
+	},
+	// open manifest region
+	{
+		[]Region{{Id: "X"}},
+		"chrX", 0, RegionOpenEnd,
+		[]Interval{{"chrX", 0, RegionOpenEnd}},
+		[]Interval{},
+	},
+	// no manifest region on the requested reference
+	{
+		[]Region{bounded("1", 100, 200)},
+		"chr2", 100, 200,
+		[]Interval{},
+		[]Interval{{"chr2", 100, 200}},
+	},
+}
+
+// TestClip tests Manifest Clip function
+func TestClip(t *testing.T) {
+	for _, tc := range clipTC {
+		manifest := &Manifest{Regions: tc.regions}
+		permitted, withheld := manifest.Clip(tc.referenceName, tc.start, tc.end)
+		assert.Equal(t, tc.permitted, permitted)
+		assert.Equal(t, tc.withheld, withheld)
+	}
+}
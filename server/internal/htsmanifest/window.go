@@ -0,0 +1,140 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module window restricts manifest regions and artifacts to the period they
+// may be accessed in, e.g. after the embargo of a data release has ended
+package htsmanifest
+
+import (
+	"time"
+)
+
+// Window the period a region or artifact of a manifest may be accessed in. a
+// nil NotBefore or NotAfter leaves the window open at that side
+//
+// Attributes
+//	NotBefore (*time.Time): time access begins, e.g. the end of an embargo
+//	NotAfter (*time.Time): time access ends
+type Window struct {
+	NotBefore *time.Time `json:"notBefore,omitempty"`
+	NotAfter  *time.Time `json:"notAfter,omitempty"`
+}
+
+// ActiveAt checks if access is permitted at a time. access begins at NotBefore
+// and ends at NotAfter
+//
+//	Type: Window
+// Arguments
+//	now (time.Time): time access is checked at
+// Returns
+//	(bool): if true, access is permitted
+func (window *Window) ActiveAt(now time.Time) bool {
+	return window.Restriction(now) == ""
+}
+
+// Restriction describes why access is not permitted at a time
+//
+//	Type: Window
+// Arguments
+//	now (time.Time): time access is checked at
+// Returns
+//	(string): e.g. "embargoed until 2021-11-02T00:00:00Z", empty if access is permitted
+func (window *Window) Restriction(now time.Time) string {
+	if window.NotBefore != nil && now.Before(*window.NotBefore) {
+		return "embargoed until " + window.NotBefore.UTC().Format(time.RFC3339)
+	}
+	if window.NotAfter != nil && !now.Before(*window.NotAfter) {
+		return "no longer accessible since " + window.NotAfter.UTC().Format(time.RFC3339)
+	}
+	return ""
+}
+
+// At gets the manifest as it applies at a time, leaving out the regions,
+// patients and samples that may not be accessed then
+//
+//	Type: Manifest
+// Arguments
+//	now (time.Time): time access is checked at
+// Returns
+//	(*Manifest): copy of the manifest holding only what may be accessed
+func (manifest *Manifest) At(now time.Time) *Manifest {
+	active := *manifest
+
+	active.Regions = make([]Region, 0)
+	for _, region := range manifest.Regions {
+		if region.ActiveAt(now) {
+			active.Regions = append(active.Regions, region)
+		}
+	}
+
+	active.Artifacts = make(map[string]Artifact)
+	for patientID, artifact := range manifest.Artifacts {
+		if !artifact.ActiveAt(now) {
+			continue
+		}
+		samples := make(map[string]ArtifactConcrete)
+		for sampleID, sample := range artifact.Samples {
+			if sample.ActiveAt(now) {
+				samples[sampleID] = sample
+			}
+		}
+		artifact.Samples = samples
+		active.Artifacts[patientID] = artifact
+	}
+	return &active
+}
+
+// ObjectRestriction describes why an artifact of the manifest may not be
+// accessed at a time, taking the window of its patient into account
+//
+//	Type: Manifest
+// Arguments
+//	objectPath (string): path of the requested object
+//	now (time.Time): time access is checked at
+// Returns
+//	(string): why the artifact may not be accessed, empty if it may be or is not an artifact of the manifest
+func (manifest *Manifest) ObjectRestriction(objectPath string, now time.Time) string {
+	if objectPath == "" {
+		return ""
+	}
+	for _, sample := range manifest.Samples() {
+		if sample.VariantsPath != objectPath && sample.ReadsPath != objectPath {
+			continue
+		}
+		patient := manifest.Artifacts[sample.PatientID]
+		if restriction := patient.Restriction(now); restriction != "" {
+			return restriction
+		}
+		if restriction := sample.Restriction(now); restriction != "" {
+			return restriction
+		}
+	}
+	return ""
+}
+
+// RegionRestriction describes why a manifest region overlapping a requested
+// interval may not be accessed at a time
+//
+//	Type: Manifest
+// Arguments
+//	referenceName (string): requested reference name
+//	start (int): requested start
+//	end (int): requested end
+//	now (time.Time): time access is checked at
+// Returns
+//	(string): why the first such region may not be accessed, empty if every overlapping region may be
+func (manifest *Manifest) RegionRestriction(referenceName string, start int, end int, now time.Time) string {
+	for _, region := range manifest.Regions {
+		if !region.Matches(referenceName) {
+			continue
+		}
+		regionStart, regionEnd := region.bounds()
+		if regionStart >= end || regionEnd <= start {
+			continue
+		}
+		if restriction := region.Restriction(now); restriction != "" {
+			return restriction
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+// Package htsmanifest loads the manifests of controlled datasets, which list
+// the artifacts and genomic regions a visa for the dataset grants access to
+//
+// Module window_test tests module window
+package htsmanifest
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// windowNow time access windows are checked at in tests
+var windowNow = time.Date(2021, 11, 2, 0, 0, 0, 0, time.UTC)
+
+// at gets a pointer to a time relative to windowNow
+func at(offset time.Duration) *time.Time {
+	t := windowNow.Add(offset)
+	return &t
+}
+
+// windowRestrictionTC test cases for Restriction
+var windowRestrictionTC = []struct {
+	window         Window
+	expRestriction string
+}{
+	{Window{}, ""},
+	{Window{NotBefore: at(-time.Hour), NotAfter: at(time.Hour)}, ""},
+	{Window{NotBefore: at(0)}, ""},
+	{Window{NotBefore: at(time.Hour)}, "embargoed until 2021-11-02T01:00:00Z"},
+	{Window{NotAfter: at(0)}, "no longer accessible since 2021-11-02T00:00:00Z"},
+	{Window{NotAfter: at(-time.Hour)}, "no longer accessible since 2021-11-01T23:00:00Z"},
+}
+
+// TestWindowRestriction tests that access is only permitted within a window
+func TestWindowRestriction(t *testing.T) {
+	for _, c := range windowRestrictionTC {
+		assert.Equal(t, c.expRestriction, c.window.Restriction(windowNow))
+		assert.Equal(t, c.expRestriction == "", c.window.ActiveAt(windowNow))
+	}
+}
+
+// TestManifestAt tests that regions and artifacts outside their windows are
+// left out of a manifest, and that the reasons they are left out are described
+func TestManifestAt(t *testing.T) {
+	body := `{
+		"id": "10g",
+		"htsgetArtifacts": {
+			"P1": {"samples": {
+				"S1": {"variantsPath": "s1.vcf.gz"},
+				"S2": {"variantsPath": "s2.vcf.gz", "notBefore": "2021-11-03T00:00:00Z"}
+			}},
+			"P2": {"samples": {"S3": {"variantsPath": "s3.vcf.gz"}}, "notAfter": "2021-11-01T00:00:00Z"}
+		},
+		"htsgetRegions": [
+			{"chromosome": "1", "start": 100, "end": 200},
+			{"chromosome": "1", "start": 200, "end": 300, "notAfter": "2021-11-01T00:00:00Z"},
+			{"chromosome": "2", "notBefore": "2021-11-03T00:00:00Z"}
+		]
+	}`
+	manifest := new(Manifest)
+	if err := json.Unmarshal([]byte(body), manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	active := manifest.At(windowNow)
+	assert.Equal(t, []string{"s1.vcf.gz"}, active.ArtifactPaths())
+	assert.Equal(t, 1, len(active.Regions))
+	assert.Equal(t, 3, len(manifest.Regions))
+
+	assert.Equal(t, "", manifest.ObjectRestriction("s1.vcf.gz", windowNow))
+	assert.Equal(t, "embargoed until 2021-11-03T00:00:00Z", manifest.ObjectRestriction("s2.vcf.gz", windowNow))
+	assert.Equal(t, "no longer accessible since 2021-11-01T00:00:00Z", manifest.ObjectRestriction("s3.vcf.gz", windowNow))
+	assert.Equal(t, "", manifest.ObjectRestriction("other.vcf.gz", windowNow))
+
+	assert.Equal(t, "", manifest.RegionRestriction("chr1", 120, 180, windowNow))
+	assert.Equal(t, "no longer accessible since 2021-11-01T00:00:00Z", manifest.RegionRestriction("chr1", 150, 250, windowNow))
+	assert.Equal(t, "embargoed until 2021-11-03T00:00:00Z", manifest.RegionRestriction("chr2", 0, RegionOpenEnd, windowNow))
+	assert.Equal(t, "", manifest.RegionRestriction("chr3", 0, RegionOpenEnd, windowNow))
+
+	// once the embargo ends, the embargoed artifact and region may be accessed
+	later := manifest.At(windowNow.Add(48 * time.Hour))
+	assert.Equal(t, []string{"s1.vcf.gz", "s2.vcf.gz"}, later.ArtifactPaths())
+	assert.Equal(t, 2, len(later.Regions))
+}
@@ -0,0 +1,213 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module cache keeps the verified visas of recently presented passports, so
+// that a client requesting many tickets in a row with the same passport only
+// has its signatures checked once
+package htspassport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+)
+
+// transientRejections reasons a visa can be rejected that may no longer apply
+// on the next request, so the visas of the passport are not cached
+var transientRejections = map[RejectionReason]bool{
+	RejectUnknownKey:        true,
+	RejectNotYetValid:       true,
+	RejectIssuedInFuture:    true,
+	RejectRevocationUnknown: true,
+}
+
+// cachedPassport a verified passport along with its decoded visas
+//
+// Attributes
+//	issuer (string): broker that signed the passport
+//	claims (map[string]interface{}): verified claims of the passport
+//	visas ([]*Visa): visas that were valid for the passport subject
+//	rejections ([]*VisaRejection): the reason each remaining visa was rejected
+//	expiresAt (time.Time): time after which the passport must be verified again
+type cachedPassport struct {
+	issuer     string
+	claims     map[string]interface{}
+	visas      []*Visa
+	rejections []*VisaRejection
+	expiresAt  time.Time
+}
+
+// PassportCache a bounded cache of verified passports and their visas, keyed
+// by the hash of the passport token. each passport is kept until the ttl has
+// passed, or until it or the earliest of its visas expires if that is sooner
+type PassportCache struct {
+	ttl        time.Duration
+	maxEntries int
+	mutex      sync.Mutex
+	entries    map[string]*cachedPassport
+}
+
+// NewPassportCache instantiates an empty passport cache
+//
+// Arguments
+//	ttl (time.Duration): longest time a passport is kept, zero disabling the cache
+//	maxEntries (int): number of passports kept at once
+// Returns
+//	(*PassportCache): empty passport cache
+func NewPassportCache(ttl time.Duration, maxEntries int) *PassportCache {
+	cache := new(PassportCache)
+	cache.ttl = ttl
+	cache.maxEntries = maxEntries
+	cache.entries = make(map[string]*cachedPassport)
+	return cache
+}
+
+// get gets a cached passport that has not yet expired, or nil
+func (cache *PassportCache) get(tokenHash string, now time.Time) *cachedPassport {
+	if cache == nil || cache.ttl <= 0 {
+		return nil
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	cached, ok := cache.entries[tokenHash]
+	if !ok {
+		return nil
+	}
+	if !now.Before(cached.expiresAt) {
+		delete(cache.entries, tokenHash)
+		return nil
+	}
+	return cached
+}
+
+// recheck gets the cached visas of a passport that are still acceptable, as
+// the issuer of a visa may have stopped being trusted, or revoked it, since it
+// was verified. each visa is checked again against the issuers trusted now and
+// their current revocation lists, on a copy so that the cached visa is left as
+// it was
+func (cached *cachedPassport) recheck() ([]*Visa, []*VisaRejection) {
+	visas := make([]*Visa, 0, len(cached.visas))
+	rejections := append(make([]*VisaRejection, 0, len(cached.rejections)), cached.rejections...)
+	for _, cachedVisa := range cached.visas {
+		trustedIssuer := htsconfig.GetTrustedIssuer(cachedVisa.Issuer)
+		if trustedIssuer == nil {
+			rejections = append(rejections, newIssuerRejection(cachedVisa.Issuer, RejectUntrustedIssuer, "issuer %s is no longer trusted", cachedVisa.Issuer))
+			continue
+		}
+		visa := *cachedVisa
+		if rejection := checkRevocation(trustedIssuer, &visa); rejection != nil {
+			rejections = append(rejections, rejection)
+			continue
+		}
+		visas = append(visas, &visa)
+	}
+	return visas, rejections
+}
+
+// put caches a verified passport and its visas, unless a visa was rejected for
+// a reason that may no longer apply on the next request
+func (cache *PassportCache) put(tokenHash string, passport *Passport, visas []*Visa, rejections []*VisaRejection, now time.Time) {
+	if cache == nil || cache.ttl <= 0 {
+		return
+	}
+	for _, rejection := range rejections {
+		if transientRejections[rejection.Reason] {
+			return
+		}
+	}
+
+	expiresAt := now.Add(cache.ttl)
+	if exp, ok := passport.Claims["exp"].(float64); ok && time.Unix(int64(exp), 0).Before(expiresAt) {
+		expiresAt = time.Unix(int64(exp), 0)
+	}
+	for _, visa := range visas {
+		if visa.ExpiresAt.Before(expiresAt) {
+			expiresAt = visa.ExpiresAt
+		}
+	}
+	if !now.Before(expiresAt) {
+		return
+	}
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if _, ok := cache.entries[tokenHash]; !ok && len(cache.entries) >= cache.maxEntries {
+		cache.evict(now)
+	}
+	cache.entries[tokenHash] = &cachedPassport{
+		issuer:     passport.Issuer,
+		claims:     passport.Claims,
+		visas:      visas,
+		rejections: rejections,
+		expiresAt:  expiresAt,
+	}
+}
+
+// evict makes room for a passport by removing the expired passports, or if
+// none have expired, the passport that is next to expire
+func (cache *PassportCache) evict(now time.Time) {
+	var nextHash string
+	var next *cachedPassport
+	for tokenHash, cached := range cache.entries {
+		if !now.Before(cached.expiresAt) {
+			delete(cache.entries, tokenHash)
+			continue
+		}
+		if next == nil || cached.expiresAt.Before(next.expiresAt) {
+			nextHash, next = tokenHash, cached
+		}
+	}
+	if len(cache.entries) >= cache.maxEntries && next != nil {
+		delete(cache.entries, nextHash)
+	}
+}
+
+// Len gets the number of passports in the cache
+//
+//	Type: PassportCache
+// Returns
+//	(int): number of cached passports, including any that have expired
+func (cache *PassportCache) Len() int {
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	return len(cache.entries)
+}
+
+// passportCache process-wide passport cache, created from the configuration on
+// first use
+var passportCache *PassportCache
+
+// passportCacheMutex guards passportCache
+var passportCacheMutex sync.Mutex
+
+// GetPassportCache gets the process-wide passport cache, creating it from the
+// configuration on first use
+func GetPassportCache() *PassportCache {
+	passportCacheMutex.Lock()
+	defer passportCacheMutex.Unlock()
+
+	if passportCache == nil {
+		passportCache = NewPassportCache(htsconfig.GetPassportCacheTTL(), htsconfig.GetPassportCacheSize())
+	}
+	return passportCache
+}
+
+// SetPassportCache replaces the process-wide passport cache. if nil, the next
+// call to GetPassportCache creates it again from the configuration
+func SetPassportCache(cache *PassportCache) {
+	passportCacheMutex.Lock()
+	defer passportCacheMutex.Unlock()
+
+	passportCache = cache
+}
+
+// passportHash gets the hex encoded SHA-256 hash a passport token is cached by
+func passportHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,194 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module cache_test tests module cache
+package htspassport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport/passporttest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestPassportCache tests that passports are cached until the ttl passes or
+// the passport or one of its visas expires, whichever is soonest
+func TestPassportCache(t *testing.T) {
+	now := time.Unix(1635811200, 0)
+	passport := func(exp time.Duration) *Passport {
+		return newPassport(PassportSourceBearer, "https://broker.example.org", map[string]interface{}{
+			"sub": "alice",
+			"exp": float64(now.Add(exp).Unix()),
+		})
+	}
+	visa := func(exp time.Duration) *Visa {
+		return &Visa{Issuer: "https://dac.example.org", ExpiresAt: now.Add(exp)}
+	}
+
+	tc := []struct {
+		passport     *Passport
+		visas        []*Visa
+		rejections   []*VisaRejection
+		expExpiresIn time.Duration
+	}{
+		{passport(time.Hour), []*Visa{visa(time.Hour)}, nil, time.Minute},
+		{passport(30 * time.Second), []*Visa{visa(time.Hour)}, nil, 30 * time.Second},
+		{passport(time.Hour), []*Visa{visa(time.Hour), visa(10 * time.Second)}, nil, 10 * time.Second},
+		{passport(time.Hour), nil, []*VisaRejection{{Reason: RejectExpired}}, time.Minute},
+		{passport(time.Hour), nil, []*VisaRejection{{Reason: RejectUnknownKey}}, 0},
+		{passport(time.Hour), nil, []*VisaRejection{{Reason: RejectRevocationUnknown}}, 0},
+		{passport(-time.Second), nil, nil, 0},
+	}
+
+	for i, c := range tc {
+		cache := NewPassportCache(time.Minute, 10)
+		cache.put("token", c.passport, c.visas, c.rejections, now)
+		if c.expExpiresIn == 0 {
+			assert.Nil(t, cache.get("token", now), i)
+			continue
+		}
+		if assert.NotNil(t, cache.get("token", now.Add(c.expExpiresIn-time.Second)), i) {
+			assert.Equal(t, c.visas, cache.get("token", now).visas, i)
+		}
+		assert.Nil(t, cache.get("token", now.Add(c.expExpiresIn)), i)
+		assert.Equal(t, 0, cache.Len(), i)
+	}
+
+	// a disabled cache keeps nothing
+	disabled := NewPassportCache(0, 10)
+	disabled.put("token", passport(time.Hour), nil, nil, now)
+	assert.Nil(t, disabled.get("token", now))
+
+	// a full cache makes room by removing the passport that is next to expire
+	full := NewPassportCache(time.Minute, 2)
+	full.put("first", passport(time.Hour), []*Visa{visa(time.Hour)}, nil, now)
+	full.put("second", passport(time.Hour), []*Visa{visa(10 * time.Second)}, nil, now)
+	full.put("third", passport(time.Hour), []*Visa{visa(time.Hour)}, nil, now)
+	assert.Equal(t, 2, full.Len())
+	assert.NotNil(t, full.get("first", now))
+	assert.Nil(t, full.get("second", now))
+	assert.NotNil(t, full.get("third", now))
+}
+
+// TestVerifyPassportCached tests that the visas of a passport presented again
+// are taken from the cache, only while its broker is still trusted
+func TestVerifyPassportCached(t *testing.T) {
+	issuer, err := passporttest.NewLocalIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer issuer.Close()
+	htsconfig.LoadConfig()
+	issuer.Trust("htsget", "10g")
+	SetPassportCache(NewPassportCache(time.Minute, 10))
+	defer SetPassportCache(nil)
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	token, err := issuer.Passport("alice", "htsget", expiresAt,
+		issuer.CompactVisa(fmt.Sprintf("c:10g e:%d u:alice", expiresAt.Unix())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := verifyPassport(PassportSourceBearer, token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(t, first.cached)
+	visas, _ := first.DecodeVisas(now, 0)
+	assert.Equal(t, 1, len(visas))
+	assert.Equal(t, 1, GetPassportCache().Len())
+
+	second, err := verifyPassport(PassportSourceHeader, token, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(t, second.cached)
+	assert.Equal(t, PassportSourceHeader, second.Source)
+	assert.Equal(t, "alice", second.Subject)
+	cachedVisas, _ := second.DecodeVisas(now, 0)
+	assert.Equal(t, visas, cachedVisas)
+
+	// once the broker is no longer trusted, the passport is verified again and refused
+	htsconfig.LoadConfig()
+	_, err = verifyPassport(PassportSourceBearer, token, now)
+	assert.NotNil(t, err)
+}
+
+// TestVerifyPassportCachedRecheck tests that the cached visas of a passport
+// are refused once their issuer is no longer trusted or has revoked them, while
+// the broker of the passport is still trusted
+func TestVerifyPassportCachedRecheck(t *testing.T) {
+	issuer, err := passporttest.NewLocalIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer issuer.Close()
+	defer htsconfig.LoadConfig()
+	SetPassportCache(NewPassportCache(time.Minute, 10))
+	defer SetPassportCache(nil)
+
+	dir, err := ioutil.TempDir("", "revocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	content := fmt.Sprintf("c:10g e:%d u:alice", expiresAt.Unix())
+	token, err := issuer.Passport("alice", "htsget", expiresAt, issuer.CompactVisa(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	revoked := filepath.Join(dir, "revoked.json")
+	if err := ioutil.WriteFile(revoked, []byte(`{"hashes": ["`+visaHash(content)+`"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	revoking := issuer.TrustedIssuer("10g")
+	revoking.Revocation = &htsconfig.IssuerRevocation{File: revoked}
+
+	tc := []struct {
+		trustedIssuer *htsconfig.TrustedIssuer
+		expReason     RejectionReason
+	}{
+		{issuer.TrustedIssuer("10g"), ""},
+		{nil, RejectUntrustedIssuer},
+		{revoking, RejectRevoked},
+	}
+
+	for _, c := range tc {
+		htsconfig.LoadConfig()
+		htsconfig.AddPassportBroker(issuer.Broker("htsget"))
+		if c.trustedIssuer != nil {
+			htsconfig.AddTrustedIssuer(c.trustedIssuer)
+		}
+
+		passport, err := verifyPassport(PassportSourceBearer, token, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		visas, rejections := passport.DecodeVisas(now, 0)
+		if c.expReason == "" {
+			assert.Equal(t, 1, len(visas))
+			continue
+		}
+		assert.NotNil(t, passport.cached, c.expReason)
+		assert.Equal(t, 0, len(visas), c.expReason)
+		if assert.Equal(t, 1, len(rejections), c.expReason) {
+			assert.Equal(t, c.expReason, rejections[0].Reason)
+		}
+	}
+
+	// the cached visa itself is left as it was first verified
+	cached := GetPassportCache().get(passportHash(token), now)
+	if assert.NotNil(t, cached) {
+		assert.Equal(t, RevocationNotChecked, cached.visas[0].Revocation)
+	}
+}
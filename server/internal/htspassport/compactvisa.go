@@ -0,0 +1,210 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module compactvisa verifies compact visas, whose space separated claims are
+// signed directly with an issuer key, and checks their claims against the
+// passport carrying them
+package htspassport
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CompactVisaPassportClaim the passport claim holding compact visas
+const CompactVisaPassportClaim = "ga4gh_passport_v2"
+
+// EdDSAAlgorithm JOSE algorithm name for ed25519 signatures
+const EdDSAAlgorithm = "EdDSA"
+
+// compact visa claim prefixes
+const (
+	compactClaimDataset   = "c:"
+	compactClaimExpiry    = "e:"
+	compactClaimIssuedAt  = "t:"
+	compactClaimNotBefore = "n:"
+	compactClaimSubject   = "u:"
+)
+
+// CompactVisaClaims is the typed form of the claims carried in a compact visa
+//
+// Attributes
+//	Datasets ([]string): dataset ids granted by the visa (c:)
+//	ExpiresAt (time.Time): time after which the visa is no longer valid (e:)
+//	IssuedAt (time.Time): time the visa was issued, zero if not present (t:)
+//	NotBefore (time.Time): time before which the visa is not valid, zero if not present (n:)
+//	Subject (string): subject the visa was issued to (u:)
+//	Unrecognised ([]string): claims with prefixes not understood by this server
+type CompactVisaClaims struct {
+	Datasets     []string
+	ExpiresAt    time.Time
+	IssuedAt     time.Time
+	NotBefore    time.Time
+	Subject      string
+	Unrecognised []string
+}
+
+// ParseCompactVisaClaims parses the space separated claims of a compact visa.
+// times are given as seconds since the unix epoch
+//
+// Arguments
+//	content (string): signed content of the compact visa
+// Returns
+//	(*CompactVisaClaims): typed visa claims
+//	(error): a VisaRejection if a claim could not be parsed
+func ParseCompactVisaClaims(content string) (*CompactVisaClaims, error) {
+	claims := new(CompactVisaClaims)
+
+	for _, claim := range strings.Fields(content) {
+		var err error
+		switch {
+		case strings.HasPrefix(claim, compactClaimDataset):
+			claims.Datasets = append(claims.Datasets, strings.TrimPrefix(claim, compactClaimDataset))
+		case strings.HasPrefix(claim, compactClaimExpiry):
+			claims.ExpiresAt, err = parseCompactTime(claim, compactClaimExpiry)
+		case strings.HasPrefix(claim, compactClaimIssuedAt):
+			claims.IssuedAt, err = parseCompactTime(claim, compactClaimIssuedAt)
+		case strings.HasPrefix(claim, compactClaimNotBefore):
+			claims.NotBefore, err = parseCompactTime(claim, compactClaimNotBefore)
+		case strings.HasPrefix(claim, compactClaimSubject):
+			claims.Subject = strings.TrimPrefix(claim, compactClaimSubject)
+		default:
+			claims.Unrecognised = append(claims.Unrecognised, claim)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// parseCompactTime parses a claim holding seconds since the unix epoch
+func parseCompactTime(claim string, prefix string) (time.Time, error) {
+	seconds, err := strconv.ParseInt(strings.TrimPrefix(claim, prefix), 10, 64)
+	if err != nil {
+		return time.Time{}, newVisaRejection(RejectMalformedClaim, "claim %s is not a unix time", claim)
+	}
+	return time.Unix(seconds, 0).UTC(), nil
+}
+
+// Visa gets the issuer independent form of the compact visa claims
+//
+//	Type: CompactVisaClaims
+// Arguments
+//	issuer (string): issuer of the compact visa
+// Returns
+//	(*Visa): visa carrying the claims
+func (claims *CompactVisaClaims) Visa(issuer string) *Visa {
+	return &Visa{
+		Issuer:    issuer,
+		Subject:   claims.Subject,
+		Datasets:  claims.Datasets,
+		ExpiresAt: claims.ExpiresAt,
+		IssuedAt:  claims.IssuedAt,
+		NotBefore: claims.NotBefore,
+	}
+}
+
+// CompactVisaDecoder decodes the compact visas of a ga4gh_passport_v2 claim,
+// a map of visa lists whose entries hold the signed content (v), issuer (i),
+// key id (k) and signature (s) of each visa
+//
+// Attributes
+//	TrustedIssuer (TrustedIssuerLookup): gets the configuration of trusted issuers
+type CompactVisaDecoder struct {
+	TrustedIssuer TrustedIssuerLookup
+}
+
+// PassportClaim gets the name of the passport claim holding compact visas
+func (decoder *CompactVisaDecoder) PassportClaim() string {
+	return CompactVisaPassportClaim
+}
+
+// Decode verifies the compact visas held in a ga4gh_passport_v2 claim
+func (decoder *CompactVisaDecoder) Decode(claim interface{}, passportSubject string, now time.Time, leeway time.Duration) ([]*Visa, []*VisaRejection) {
+	visas := make([]*Visa, 0)
+	rejections := make([]*VisaRejection, 0)
+
+	passportV2, ok := claim.(map[string]interface{})
+	if !ok {
+		rejections = append(rejections, newVisaRejection(RejectMalformedVisa, "%s claim is not a map of visa lists", CompactVisaPassportClaim))
+		return visas, rejections
+	}
+
+	for _, visaOuter := range passportV2 {
+		visaList, ok := visaOuter.([]interface{})
+		if !ok {
+			rejections = append(rejections, newVisaRejection(RejectMalformedVisa, "visa entry is not a list of compact visas"))
+			continue
+		}
+		for _, visaInner := range visaList {
+			visa, rejection := decoder.decodeVisa(visaInner, passportSubject, now, leeway)
+			if rejection != nil {
+				rejections = append(rejections, rejection)
+				continue
+			}
+			visas = append(visas, visa)
+		}
+	}
+	return visas, rejections
+}
+
+// decodeVisa verifies a single compact visa
+func (decoder *CompactVisaDecoder) decodeVisa(visaInner interface{}, passportSubject string, now time.Time, leeway time.Duration) (*Visa, *VisaRejection) {
+	compactVisa, ok := visaInner.(map[string]interface{})
+	if !ok {
+		return nil, newVisaRejection(RejectMalformedVisa, "visa entry is not a compact visa")
+	}
+	v, _ := compactVisa["v"].(string)
+	i, _ := compactVisa["i"].(string)
+	k, _ := compactVisa["k"].(string)
+	s, _ := compactVisa["s"].(string)
+
+	// we only proceed with known *trusted* issuers
+	trustedIssuer := decoder.TrustedIssuer(i)
+	if trustedIssuer == nil {
+		return nil, newIssuerRejection(i, RejectUntrustedIssuer, "issuer %s is not trusted", i)
+	}
+
+	// keys are configured, or fetched and cached per issuer for the life of the process
+	jwk, err := GetKeySource(trustedIssuer.Issuer, trustedIssuer.JwksUri, trustedIssuer.Jwks, trustedIssuer.JwksFile).GetKey(k)
+	if err != nil {
+		return nil, newIssuerRejection(i, RejectUnknownKey, "%v", err)
+	}
+
+	// compact visas do not name their algorithm, so it is the one the key signs with
+	alg, err := KeyAlgorithm(jwk)
+	if err != nil {
+		return nil, newIssuerRejection(i, RejectUnsupportedKey, "%v", err)
+	}
+	if !trustedIssuer.AllowsAlgorithm(alg) {
+		return nil, newIssuerRejection(i, RejectAlgorithmForbidden, "issuer is not permitted to sign with %s", alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, newIssuerRejection(i, RejectBadSignature, "signature could not be decoded: %v", err)
+	}
+	if err := VerifySignature(jwk, alg, []byte(v), signature); err != nil {
+		return nil, newIssuerRejection(i, RejectBadSignature, "%v", err)
+	}
+
+	claims, err := ParseCompactVisaClaims(v)
+	if err != nil {
+		rejection := err.(*VisaRejection)
+		rejection.Issuer = i
+		return nil, rejection
+	}
+
+	visa := claims.Visa(i)
+	visa.Hash = visaHash(v)
+	if err := visa.Validate(passportSubject, now, leeway); err != nil {
+		return nil, err.(*VisaRejection)
+	}
+	if rejection := checkRevocation(trustedIssuer, visa); rejection != nil {
+		return nil, rejection
+	}
+	return visa, nil
+}
@@ -0,0 +1,191 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module compactvisa_test tests module compactvisa
+package htspassport
+
+import (
+	"crypto"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// signCompactVisa creates a compact visa entry signed with an ed25519 key
+func signCompactVisa(issuer string, kid string, privateKey ed25519.PrivateKey, content string) map[string]interface{} {
+	return map[string]interface{}{
+		"v": content,
+		"i": issuer,
+		"k": kid,
+		"s": base64.RawURLEncoding.EncodeToString(ed25519.Sign(privateKey, []byte(content))),
+	}
+}
+
+// compactVisaParseTC test cases for ParseCompactVisaClaims
+var compactVisaParseTC = []struct {
+	content          string
+	expDatasets      []string
+	expExpiresAt     time.Time
+	expIssuedAt      time.Time
+	expNotBefore     time.Time
+	expSubject       string
+	expUnrecognised  []string
+	expRejectionCode RejectionReason
+}{
+	{
+		"c:10g e:1635811200 t:1635638400 u:alice",
+		[]string{"10g"},
+		unix(1635811200),
+		unix(1635638400),
+		time.Time{},
+		"alice",
+		nil,
+		"",
+	},
+	{
+		"c:10g c:1kg  n:1635638400 r:other e:1635811200",
+		[]string{"10g", "1kg"},
+		unix(1635811200),
+		time.Time{},
+		unix(1635638400),
+		"",
+		[]string{"r:other"},
+		"",
+	},
+	{
+		"c:10g e:tomorrow",
+		nil,
+		time.Time{},
+		time.Time{},
+		time.Time{},
+		"",
+		nil,
+		RejectMalformedClaim,
+	},
+}
+
+// TestParseCompactVisaClaims tests ParseCompactVisaClaims function
+func TestParseCompactVisaClaims(t *testing.T) {
+	for _, tc := range compactVisaParseTC {
+		claims, err := ParseCompactVisaClaims(tc.content)
+		if tc.expRejectionCode != "" {
+			assert.Nil(t, claims)
+			assert.Equal(t, tc.expRejectionCode, err.(*VisaRejection).Reason)
+			continue
+		}
+		assert.Nil(t, err)
+		assert.Equal(t, tc.expDatasets, claims.Datasets)
+		assert.Equal(t, tc.expExpiresAt, claims.ExpiresAt)
+		assert.Equal(t, tc.expIssuedAt, claims.IssuedAt)
+		assert.Equal(t, tc.expNotBefore, claims.NotBefore)
+		assert.Equal(t, tc.expSubject, claims.Subject)
+		assert.Equal(t, tc.expUnrecognised, claims.Unrecognised)
+
+		visa := claims.Visa("https://dac.example.org")
+		assert.Equal(t, "https://dac.example.org", visa.Issuer)
+		assert.Equal(t, tc.expDatasets, visa.Datasets)
+		assert.Equal(t, tc.expExpiresAt, visa.ExpiresAt)
+	}
+}
+
+// TestCompactVisaDecoder tests CompactVisaDecoder Decode function
+func TestCompactVisaDecoder(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+	_, otherPrivateKey, _ := ed25519.GenerateKey(nil)
+
+	valid := signCompactVisa(issuer.server.URL, "key-1", issuer.privateKey, "c:10g e:1635811200 u:alice")
+	tampered := signCompactVisa(issuer.server.URL, "key-1", issuer.privateKey, "c:10g e:1635811200 u:alice")
+	tampered["v"] = "c:1kg e:1635811200 u:alice"
+
+	tc := []struct {
+		entry            interface{}
+		algorithms       []string
+		expRejectionCode RejectionReason
+	}{
+		{valid, []string{EdDSAAlgorithm}, ""},
+		{valid, []string{"RS256"}, RejectAlgorithmForbidden},
+		{"c:10g", []string{EdDSAAlgorithm}, RejectMalformedVisa},
+		{signCompactVisa("https://other.example.org", "key-1", issuer.privateKey, "c:10g e:1635811200 u:alice"), []string{EdDSAAlgorithm}, RejectUntrustedIssuer},
+		{signCompactVisa(issuer.server.URL, "key-2", issuer.privateKey, "c:10g e:1635811200 u:alice"), []string{EdDSAAlgorithm}, RejectUnknownKey},
+		{signCompactVisa(issuer.server.URL, "key-1", otherPrivateKey, "c:10g e:1635811200 u:alice"), []string{EdDSAAlgorithm}, RejectBadSignature},
+		{tampered, []string{EdDSAAlgorithm}, RejectBadSignature},
+		{signCompactVisa(issuer.server.URL, "key-1", issuer.privateKey, "c:10g e:soon u:alice"), []string{EdDSAAlgorithm}, RejectMalformedClaim},
+		{signCompactVisa(issuer.server.URL, "key-1", issuer.privateKey, "c:10g u:alice"), []string{EdDSAAlgorithm}, RejectMissingExpiry},
+		{signCompactVisa(issuer.server.URL, "key-1", issuer.privateKey, "c:10g e:1635638400 u:alice"), []string{EdDSAAlgorithm}, RejectExpired},
+		{signCompactVisa(issuer.server.URL, "key-1", issuer.privateKey, "c:10g e:1635811200 u:bob"), []string{EdDSAAlgorithm}, RejectSubjectMismatch},
+	}
+
+	for _, c := range tc {
+		decoder := &CompactVisaDecoder{TrustedIssuer: trustStandInIssuer(issuer, c.algorithms...)}
+		claim := map[string]interface{}{"a": []interface{}{c.entry}}
+		visas, rejections := decoder.Decode(claim, "alice", visaNow, 0)
+		if c.expRejectionCode == "" {
+			assert.Equal(t, 0, len(rejections))
+			assert.Equal(t, 1, len(visas))
+			assert.Equal(t, issuer.server.URL, visas[0].Issuer)
+			assert.Equal(t, []string{"10g"}, visas[0].Datasets)
+		} else {
+			assert.Equal(t, 0, len(visas))
+			assert.Equal(t, 1, len(rejections))
+			assert.Equal(t, c.expRejectionCode, rejections[0].Reason)
+		}
+	}
+}
+
+// TestCompactVisaDecoderKeyTypes tests CompactVisaDecoder Decode function with
+// RSA and EC issuer keys
+func TestCompactVisaDecoderKeyTypes(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+	keys := newTestSigningKeys(t)
+	issuer.mutex.Lock()
+	issuer.keys = []jose.JSONWebKey{
+		{Key: keys.rsa.Public(), KeyID: "rsa", Use: "sig"},
+		{Key: keys.rsa.Public(), KeyID: "rsa-ps", Algorithm: PS256Algorithm, Use: "sig"},
+		{Key: keys.p256.Public(), KeyID: "ec", Algorithm: ES256Algorithm, Use: "sig"},
+		{Key: keys.p384.Public(), KeyID: "ec-mismatch", Algorithm: ES256Algorithm, Use: "sig"},
+	}
+	issuer.mutex.Unlock()
+
+	content := "c:10g e:1635811200 u:alice"
+	entry := func(kid string, key crypto.Signer, alg string) map[string]interface{} {
+		return map[string]interface{}{
+			"v": content,
+			"i": issuer.server.URL,
+			"k": kid,
+			"s": base64.RawURLEncoding.EncodeToString(signRaw(t, key, alg, []byte(content))),
+		}
+	}
+
+	tc := []struct {
+		entry            interface{}
+		algorithms       []string
+		expRejectionCode RejectionReason
+	}{
+		{entry("rsa", keys.rsa, RS256Algorithm), []string{RS256Algorithm}, ""},
+		{entry("rsa", keys.rsa, RS256Algorithm), []string{EdDSAAlgorithm}, RejectAlgorithmForbidden},
+		{entry("rsa", keys.rsa, PS256Algorithm), []string{RS256Algorithm}, RejectBadSignature},
+		{entry("rsa-ps", keys.rsa, PS256Algorithm), []string{PS256Algorithm}, ""},
+		{entry("ec", keys.p256, ES256Algorithm), []string{ES256Algorithm, ES384Algorithm}, ""},
+		{entry("ec", keys.p384, ES384Algorithm), []string{ES256Algorithm, ES384Algorithm}, RejectBadSignature},
+		{entry("ec-mismatch", keys.p384, ES384Algorithm), []string{ES256Algorithm, ES384Algorithm}, RejectUnsupportedKey},
+	}
+
+	for _, c := range tc {
+		decoder := &CompactVisaDecoder{TrustedIssuer: trustStandInIssuer(issuer, c.algorithms...)}
+		claim := map[string]interface{}{"a": []interface{}{c.entry}}
+		visas, rejections := decoder.Decode(claim, "alice", visaNow, 0)
+		if c.expRejectionCode == "" {
+			assert.Equal(t, 0, len(rejections))
+			assert.Equal(t, 1, len(visas))
+		} else {
+			assert.Equal(t, 0, len(visas))
+			assert.Equal(t, 1, len(rejections))
+			assert.Equal(t, c.expRejectionCode, rejections[0].Reason)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module extract finds the passport of a request wherever the client presented
+// it - a dedicated header, the body of a POST request, or the Authorization
+// header as a passport JWT or an opaque access token - and normalises its
+// verified claims
+package htspassport
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+)
+
+// PassportHeader dedicated request header a passport JWT may be presented in
+const PassportHeader = "X-GA4GH-Passport"
+
+// PassportBodyField field of a JSON POST body a passport JWT may be presented in
+const PassportBodyField = "passport"
+
+// where a passport was presented, or exchanged for
+const (
+	PassportSourceHeader        = "header"
+	PassportSourceBody          = "body"
+	PassportSourceBearer        = "bearer"
+	PassportSourceIntrospection = "introspection"
+	PassportSourceUserinfo      = "userinfo"
+)
+
+// maxPassportBodyBytes largest POST body searched for a passport
+const maxPassportBodyBytes = 1 << 20
+
+// errNoPassport no passport was presented with the request
+var errNoPassport = errors.New("no passport was presented")
+
+// Passport the verified claims of a passport, normalised across the ways it
+// can be presented
+//
+// Attributes
+//	Source (string): where the passport was presented, one of the PassportSource values
+//	Issuer (string): broker that signed the passport, or vouched for the opaque token
+//	Subject (string): user the passport was issued to
+//	Claims (map[string]interface{}): all claims of the passport, including its visas
+type Passport struct {
+	Source    string
+	Issuer    string
+	Subject   string
+	Claims    map[string]interface{}
+	tokenHash string
+	cached    *cachedPassport
+}
+
+// newPassport instantiates a passport from verified claims
+func newPassport(source string, issuer string, claims map[string]interface{}) *Passport {
+	passport := new(Passport)
+	passport.Source = source
+	passport.Issuer = issuer
+	passport.Subject, _ = claims["sub"].(string)
+	passport.Claims = claims
+	return passport
+}
+
+// DecodeVisas verifies and decodes the visas carried in the passport. the
+// visas of a passport JWT are cached, so that their signatures are only
+// verified again once the cache entry expires, but cached visas are still
+// checked against the issuers trusted now and their current revocation lists
+//
+//	Type: Passport
+// Arguments
+//	now (time.Time): current time
+//	leeway (time.Duration): clock skew tolerated between this server and visa issuers
+// Returns
+//	([]*Visa): visas that are valid for the passport subject
+//	([]*VisaRejection): the reason each remaining visa was rejected
+func (passport *Passport) DecodeVisas(now time.Time, leeway time.Duration) ([]*Visa, []*VisaRejection) {
+	if passport.cached != nil {
+		return passport.cached.recheck()
+	}
+	visas, rejections := DecodeVisas(passport.Claims, now, leeway)
+	if passport.tokenHash != "" {
+		GetPassportCache().put(passport.tokenHash, passport, visas, rejections, now)
+	}
+	return visas, rejections
+}
+
+// extractPassport finds and verifies the passport of a request. a passport in
+// the dedicated header takes precedence over one in the body, and both over
+// the Authorization header, which may hold either a passport JWT or an opaque
+// access token to be exchanged with a broker
+//
+// Arguments
+//	request (*http.Request): request, whose body is restored after being read
+//	now (time.Time): current time
+// Returns
+//	(*Passport): verified passport
+//	(error): errNoPassport, or why the presented passport was not accepted
+func extractPassport(request *http.Request, now time.Time) (*Passport, error) {
+	if token := strings.TrimSpace(request.Header.Get(PassportHeader)); token != "" {
+		return verifyPassport(PassportSourceHeader, token, now)
+	}
+	if token := getBodyPassport(request); token != "" {
+		return verifyPassport(PassportSourceBody, token, now)
+	}
+	if token := getBearerToken(request); token != "" {
+		if !isCompactJWT(token) {
+			return NewTokenIntrospector().Introspect(token, now)
+		}
+		return verifyPassport(PassportSourceBearer, token, now)
+	}
+	return nil, errNoPassport
+}
+
+// verifyPassport verifies a passport JWT signed by a trusted broker, unless it
+// was verified recently enough to still be cached
+func verifyPassport(source string, token string, now time.Time) (*Passport, error) {
+	tokenHash := passportHash(token)
+	// a cached passport is only reused while its broker is still trusted
+	if cached := GetPassportCache().get(tokenHash, now); cached != nil && htsconfig.GetPassportBroker(cached.issuer) != nil {
+		passport := newPassport(source, cached.issuer, cached.claims)
+		passport.cached = cached
+		return passport, nil
+	}
+
+	claims, err := NewPassportVerifier().Verify(token, now)
+	if err != nil {
+		return nil, err
+	}
+	issuer, _ := claims["iss"].(string)
+	passport := newPassport(source, issuer, claims)
+	passport.tokenHash = tokenHash
+	return passport, nil
+}
+
+// getBearerToken gets the bearer token from the Authorization header
+func getBearerToken(request *http.Request) string {
+	authorization := request.Header.Get("Authorization")
+	if len(authorization) < 7 || !strings.EqualFold(authorization[:7], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(authorization[7:])
+}
+
+// getBodyPassport gets the passport field of a JSON POST body. the body is
+// restored so that the request parameters can still be read from it
+func getBodyPassport(request *http.Request) string {
+	if request.Method != http.MethodPost || request.Body == nil {
+		return ""
+	}
+	// a body too large to hold a passport is passed on unread past the limit
+	body, err := ioutil.ReadAll(io.LimitReader(request.Body, maxPassportBodyBytes+1))
+	request.Body = readCloser{io.MultiReader(bytes.NewReader(body), request.Body), request.Body}
+	if err != nil || len(body) > maxPassportBodyBytes {
+		return ""
+	}
+
+	// a body that is not JSON is left for the request parameters to reject
+	fields := make(map[string]interface{})
+	if json.Unmarshal(body, &fields) != nil {
+		return ""
+	}
+	token, _ := fields[PassportBodyField].(string)
+	return strings.TrimSpace(token)
+}
+
+// readCloser a request body that is read from a reader, e.g. one replaying the
+// part of the body already read, and closed with the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// isCompactJWT checks if a token has the three segments of a compact
+// serialized JWT, rather than being an opaque access token
+func isCompactJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
@@ -0,0 +1,208 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module introspection exchanges opaque access tokens for passport claims,
+// through the RFC 7662 introspection endpoint or the OIDC userinfo endpoint of
+// the brokers that issued them
+package htspassport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+)
+
+// tokenExchangeTimeout timeout for introspection and userinfo http requests
+var tokenExchangeTimeout = 15 * time.Second
+
+// BrokerList gets the configuration of all trusted brokers
+type BrokerList func() []*htsconfig.PassportBroker
+
+// TokenIntrospector exchanges opaque access tokens for the passport claims of
+// the user they were issued to. tokens carry no issuer, so they are only ever
+// sent to brokers configured to accept them, in the order configured
+//
+// Attributes
+//	Brokers (BrokerList): gets the configuration of trusted brokers
+//	ClockSkew (time.Duration): tolerance applied when checking token times
+type TokenIntrospector struct {
+	Brokers   BrokerList
+	ClockSkew time.Duration
+	client    *http.Client
+}
+
+// NewTokenIntrospector instantiates a token introspector exchanging tokens with
+// the configured passport brokers
+func NewTokenIntrospector() *TokenIntrospector {
+	return &TokenIntrospector{
+		Brokers:   htsconfig.GetPassportBrokers,
+		ClockSkew: htsconfig.GetClockSkew(),
+		client:    &http.Client{Timeout: tokenExchangeTimeout},
+	}
+}
+
+// Introspect exchanges an opaque access token for passport claims with the
+// first broker that recognises it
+//
+//	Type: TokenIntrospector
+// Arguments
+//	token (string): opaque access token
+//	now (time.Time): current time
+// Returns
+//	(*Passport): passport claims of the token, vouched for by the broker
+//	(error): description of why no broker accepted the token
+func (introspector *TokenIntrospector) Introspect(token string, now time.Time) (*Passport, error) {
+	failures := make([]string, 0)
+	for _, broker := range introspector.Brokers() {
+		if !broker.AcceptsOpaqueTokens() {
+			continue
+		}
+		claims, err := introspector.exchange(broker, token, now)
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", broker.Issuer, err))
+			continue
+		}
+		source := PassportSourceIntrospection
+		if broker.IntrospectionEndpoint == "" {
+			source = PassportSourceUserinfo
+		}
+		return newPassport(source, broker.Issuer, claims), nil
+	}
+	if len(failures) == 0 {
+		return nil, errors.New("no passport broker is configured to accept opaque tokens")
+	}
+	return nil, fmt.Errorf("opaque token was not accepted: %s", strings.Join(failures, "; "))
+}
+
+// exchange gets the claims of a token from a single broker. the token is
+// introspected if the broker has an introspection endpoint, and its passport
+// claims are read from the userinfo endpoint if introspection does not return
+// them
+func (introspector *TokenIntrospector) exchange(broker *htsconfig.PassportBroker, token string, now time.Time) (map[string]interface{}, error) {
+	claims := make(map[string]interface{})
+	if broker.IntrospectionEndpoint != "" {
+		introspected, err := introspector.introspect(broker, token, now)
+		if err != nil {
+			return nil, err
+		}
+		claims = introspected
+	}
+
+	if broker.UserinfoEndpoint != "" && !hasVisaClaims(claims) {
+		userinfo, err := introspector.userinfo(broker, token)
+		if err != nil {
+			return nil, err
+		}
+		if subject, ok := claims["sub"]; ok && subject != userinfo["sub"] {
+			return nil, fmt.Errorf("userinfo subject %v does not match token subject %v", userinfo["sub"], subject)
+		}
+		// claims established by introspection are kept over those of userinfo
+		for name, value := range userinfo {
+			if _, ok := claims[name]; !ok {
+				claims[name] = value
+			}
+		}
+	}
+
+	if subject, _ := claims["sub"].(string); subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	return claims, nil
+}
+
+// introspect checks a token is active with the broker's RFC 7662 introspection
+// endpoint, and that the broker issued it for this server
+func (introspector *TokenIntrospector) introspect(broker *htsconfig.PassportBroker, token string, now time.Time) (map[string]interface{}, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequest(http.MethodPost, broker.IntrospectionEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if broker.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(broker.ClientID), url.QueryEscape(broker.ClientSecret))
+	}
+
+	claims := make(map[string]interface{})
+	if err := introspector.doJSON(req, &claims); err != nil {
+		return nil, fmt.Errorf("introspecting token: %v", err)
+	}
+
+	if active, _ := claims["active"].(bool); !active {
+		return nil, errors.New("token is not active")
+	}
+	if issuer, ok := claims["iss"]; ok && issuer != broker.Issuer {
+		return nil, fmt.Errorf("token issuer %v is not the broker", issuer)
+	}
+	if exp, ok := claims["exp"].(float64); ok && !now.Add(-introspector.ClockSkew).Before(time.Unix(int64(exp), 0)) {
+		return nil, errors.New("token has expired")
+	}
+	if !broker.AcceptsAudience(claimStrings(claims["aud"])) {
+		return nil, fmt.Errorf("token audience %v is not accepted", claims["aud"])
+	}
+	return claims, nil
+}
+
+// userinfo reads the claims of the user a token was issued to from the
+// broker's OIDC userinfo endpoint, which only answers for valid tokens
+func (introspector *TokenIntrospector) userinfo(broker *htsconfig.PassportBroker, token string) (map[string]interface{}, error) {
+	req, err := http.NewRequest(http.MethodGet, broker.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	claims := make(map[string]interface{})
+	if err := introspector.doJSON(req, &claims); err != nil {
+		return nil, fmt.Errorf("reading userinfo: %v", err)
+	}
+	return claims, nil
+}
+
+// doJSON sends a request and decodes its JSON response body into target
+func (introspector *TokenIntrospector) doJSON(req *http.Request, target interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	res, err := introspector.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected response status " + res.Status + " from " + req.URL.String())
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
+
+// hasVisaClaims checks if claims carry visas of any understood format
+func hasVisaClaims(claims map[string]interface{}) bool {
+	for _, decoder := range visaDecoders {
+		if _, ok := claims[decoder.PassportClaim()]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// claimStrings gets a claim that is either a single string or a list of
+// strings, such as aud
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		values := make([]string, 0)
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return []string{}
+}
@@ -0,0 +1,106 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module introspection_test tests module introspection
+package htspassport
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestBroker serves fixed introspection and userinfo responses, recording
+// the client credentials introspection requests authenticate with
+func newTestBroker(t *testing.T, introspection map[string]interface{}, userinfo map[string]interface{}) (*httptest.Server, *string) {
+	var clientID string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/introspect", func(writer http.ResponseWriter, request *http.Request) {
+		clientID, _, _ = request.BasicAuth()
+		assert.Equal(t, "opaque-token", request.PostFormValue("token"))
+		json.NewEncoder(writer).Encode(introspection)
+	})
+	mux.HandleFunc("/userinfo", func(writer http.ResponseWriter, request *http.Request) {
+		if userinfo == nil || request.Header.Get("Authorization") != "Bearer opaque-token" {
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(writer).Encode(userinfo)
+	})
+	return httptest.NewServer(mux), &clientID
+}
+
+// TestTokenIntrospectorIntrospect tests that opaque tokens are only accepted
+// when a broker vouches for them
+func TestTokenIntrospectorIntrospect(t *testing.T) {
+	now := time.Unix(1635811200, 0)
+	visas := map[string]interface{}{"c": []interface{}{}}
+	active := func(claims map[string]interface{}) map[string]interface{} {
+		introspection := map[string]interface{}{"active": true, "sub": "alice", "aud": "htsget", "exp": 1635814800}
+		for name, value := range claims {
+			introspection[name] = value
+		}
+		return introspection
+	}
+
+	var tc = []struct {
+		introspection map[string]interface{}
+		userinfo      map[string]interface{}
+		introspect    bool
+		expSource     string
+		expError      bool
+	}{
+		{active(nil), map[string]interface{}{"sub": "alice", CompactVisaPassportClaim: visas}, true, PassportSourceIntrospection, false},
+		{active(map[string]interface{}{CompactVisaPassportClaim: visas}), nil, true, PassportSourceIntrospection, false},
+		{active(map[string]interface{}{"aud": []interface{}{"portal", "htsget"}}), map[string]interface{}{"sub": "alice", CompactVisaPassportClaim: visas}, true, PassportSourceIntrospection, false},
+		{nil, map[string]interface{}{"sub": "alice", CompactVisaPassportClaim: visas}, false, PassportSourceUserinfo, false},
+		{nil, nil, false, "", true},
+		{nil, map[string]interface{}{CompactVisaPassportClaim: visas}, false, "", true},
+		{map[string]interface{}{"active": false}, nil, true, "", true},
+		{active(map[string]interface{}{"exp": 1635807600}), nil, true, "", true},
+		{active(map[string]interface{}{"aud": "portal"}), nil, true, "", true},
+		{active(map[string]interface{}{"iss": "https://elsewhere.example.org"}), nil, true, "", true},
+		{active(nil), map[string]interface{}{"sub": "bob", CompactVisaPassportClaim: visas}, true, "", true},
+		{active(nil), nil, true, "", true},
+	}
+
+	for i, c := range tc {
+		server, clientID := newTestBroker(t, c.introspection, c.userinfo)
+		broker := &htsconfig.PassportBroker{Issuer: server.URL, Audiences: []string{"htsget"}, UserinfoEndpoint: server.URL + "/userinfo"}
+		if c.introspect {
+			broker.IntrospectionEndpoint = server.URL + "/introspect"
+			broker.ClientID = "htsget"
+			broker.ClientSecret = "secret"
+		}
+		introspector := NewTokenIntrospector()
+		introspector.Brokers = func() []*htsconfig.PassportBroker {
+			return []*htsconfig.PassportBroker{{Issuer: "https://jwt-only.example.org"}, broker}
+		}
+
+		passport, err := introspector.Introspect("opaque-token", now)
+		if c.expError {
+			assert.NotNil(t, err, i)
+		} else if assert.Nil(t, err, i) {
+			assert.Equal(t, c.expSource, passport.Source)
+			assert.Equal(t, server.URL, passport.Issuer)
+			assert.Equal(t, "alice", passport.Subject)
+			assert.Contains(t, passport.Claims, CompactVisaPassportClaim)
+			if c.introspect {
+				assert.Equal(t, "htsget", *clientID)
+			}
+		}
+		server.Close()
+	}
+
+	// opaque tokens are refused outright when no broker accepts them
+	introspector := NewTokenIntrospector()
+	introspector.Brokers = func() []*htsconfig.PassportBroker {
+		return []*htsconfig.PassportBroker{{Issuer: "https://jwt-only.example.org"}}
+	}
+	_, err := introspector.Introspect("opaque-token", now)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,220 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module jwtvisa verifies GA4GH Passport v1.x visas, each a JWT signed by its
+// issuer, and maps ControlledAccessGrants visas to dataset ids
+package htspassport
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// JWTVisaPassportClaim the passport claim holding JWT visas
+const JWTVisaPassportClaim = "ga4gh_passport_v1"
+
+// ControlledAccessGrantsVisaType the visa type granting access to a dataset
+const ControlledAccessGrantsVisaType = "ControlledAccessGrants"
+
+// jkuHeader JOSE header naming the key set holding the signing key
+const jkuHeader = jose.HeaderKey("jku")
+
+// jwtVisaClaims the claims of a JWT visa
+type jwtVisaClaims struct {
+	jwt.Claims
+	Visa struct {
+		Type     string `json:"type"`
+		Asserted int64  `json:"asserted"`
+		Value    string `json:"value"`
+		Source   string `json:"source"`
+		By       string `json:"by"`
+	} `json:"ga4gh_visa_v1"`
+}
+
+// JWTVisaDecoder decodes the JWT visas of a ga4gh_passport_v1 claim, a list of
+// signed visa JWTs
+//
+// Attributes
+//	TrustedIssuer (TrustedIssuerLookup): gets the configuration of trusted issuers
+type JWTVisaDecoder struct {
+	TrustedIssuer TrustedIssuerLookup
+}
+
+// PassportClaim gets the name of the passport claim holding JWT visas
+func (decoder *JWTVisaDecoder) PassportClaim() string {
+	return JWTVisaPassportClaim
+}
+
+// Decode verifies the JWT visas held in a ga4gh_passport_v1 claim
+func (decoder *JWTVisaDecoder) Decode(claim interface{}, passportSubject string, now time.Time, leeway time.Duration) ([]*Visa, []*VisaRejection) {
+	visas := make([]*Visa, 0)
+	rejections := make([]*VisaRejection, 0)
+
+	passportV1, ok := claim.([]interface{})
+	if !ok {
+		rejections = append(rejections, newVisaRejection(RejectMalformedVisa, "%s claim is not a list of visas", JWTVisaPassportClaim))
+		return visas, rejections
+	}
+
+	for _, rawVisa := range passportV1 {
+		visa, rejection := decoder.decodeVisa(rawVisa, passportSubject, now, leeway)
+		if rejection != nil {
+			rejections = append(rejections, rejection)
+			continue
+		}
+		visas = append(visas, visa)
+	}
+	return visas, rejections
+}
+
+// decodeVisa verifies a single JWT visa
+func (decoder *JWTVisaDecoder) decodeVisa(rawVisa interface{}, passportSubject string, now time.Time, leeway time.Duration) (*Visa, *VisaRejection) {
+	serialized, ok := rawVisa.(string)
+	if !ok {
+		return nil, newVisaRejection(RejectMalformedVisa, "visa entry is not a JWT")
+	}
+	token, err := jwt.ParseSigned(serialized)
+	if err != nil {
+		return nil, newVisaRejection(RejectMalformedVisa, "visa could not be parsed: %v", err)
+	}
+	if len(token.Headers) != 1 {
+		return nil, newVisaRejection(RejectMalformedVisa, "visa must have exactly one signature")
+	}
+	header := token.Headers[0]
+
+	// the issuer is needed to find the key, so is read before the signature
+	// has been verified - it is checked again against the verified claims
+	unverified := new(jwt.Claims)
+	if err := token.UnsafeClaimsWithoutVerification(unverified); err != nil {
+		return nil, newVisaRejection(RejectMalformedVisa, "visa claims could not be parsed: %v", err)
+	}
+	issuer := unverified.Issuer
+
+	trustedIssuer := decoder.TrustedIssuer(issuer)
+	if trustedIssuer == nil {
+		return nil, newIssuerRejection(issuer, RejectUntrustedIssuer, "issuer %s is not trusted", issuer)
+	}
+	if !trustedIssuer.AllowsAlgorithm(header.Algorithm) {
+		return nil, newIssuerRejection(issuer, RejectAlgorithmForbidden, "issuer is not permitted to sign with %s", header.Algorithm)
+	}
+
+	jwksUri, rejection := keySetLocation(trustedIssuer, header)
+	if rejection != nil {
+		return nil, rejection
+	}
+	jwk, err := GetKeySource(trustedIssuer.Issuer, jwksUri, trustedIssuer.Jwks, trustedIssuer.JwksFile).GetKey(header.KeyID)
+	if err != nil {
+		return nil, newIssuerRejection(issuer, RejectUnknownKey, "%v", err)
+	}
+	if err := CheckKeyAlgorithm(jwk, header.Algorithm); err != nil {
+		return nil, newIssuerRejection(issuer, RejectUnsupportedKey, "%v", err)
+	}
+
+	claims := new(jwtVisaClaims)
+	if err := token.Claims(jwk.Key, claims); err != nil {
+		return nil, newIssuerRejection(issuer, RejectBadSignature, "signature check failed with key %s: %v", header.KeyID, err)
+	}
+	if claims.Issuer != issuer {
+		return nil, newIssuerRejection(issuer, RejectMalformedVisa, "visa issuer changed during verification")
+	}
+	if claims.Visa.Type != ControlledAccessGrantsVisaType {
+		return nil, newIssuerRejection(issuer, RejectUnsupportedType, "visa type %s does not grant dataset access", claims.Visa.Type)
+	}
+
+	visa := &Visa{
+		Issuer:    issuer,
+		Subject:   claims.Subject,
+		Datasets:  []string{DatasetFromGrant(claims.Visa.Value)},
+		ExpiresAt: numericDateTime(claims.Expiry),
+		IssuedAt:  numericDateTime(claims.IssuedAt),
+		NotBefore: numericDateTime(claims.NotBefore),
+		Hash:      visaHash(serialized),
+		ID:        claims.ID,
+	}
+	if err := visa.Validate(passportSubject, now, leeway); err != nil {
+		return nil, err.(*VisaRejection)
+	}
+	if rejection := checkRevocation(trustedIssuer, visa); rejection != nil {
+		return nil, rejection
+	}
+	return visa, nil
+}
+
+// keySetLocation gets the key set to verify a JWT visa with. a jku header is
+// only followed if it names the issuer's configured key set or, when none is
+// configured, the key set named by the issuer's discovery document, so that a
+// jku can never introduce a key set of its own. a key set configured inline or
+// as a file is used in place of whichever location is returned, so a jku is
+// then only checked to be hosted by the issuer
+func keySetLocation(trustedIssuer *htsconfig.TrustedIssuer, header jose.Header) (string, *VisaRejection) {
+	jku, _ := header.ExtraHeaders[jkuHeader].(string)
+	if jku == "" {
+		return trustedIssuer.JwksUri, nil
+	}
+
+	if trustedIssuer.JwksUri != "" {
+		if jku != trustedIssuer.JwksUri {
+			return "", newIssuerRejection(trustedIssuer.Issuer, RejectUntrustedKeySet, "jku %s is not the configured key set", jku)
+		}
+		return jku, nil
+	}
+
+	if trustedIssuer.JwksFile != "" || len(trustedIssuer.Jwks) > 0 {
+		jkuUrl, err := url.Parse(jku)
+		if err != nil {
+			return "", newIssuerRejection(trustedIssuer.Issuer, RejectUntrustedKeySet, "jku %s could not be parsed", jku)
+		}
+		issuerUrl, err := url.Parse(trustedIssuer.Issuer)
+		if err != nil || jkuUrl.Scheme != issuerUrl.Scheme || jkuUrl.Host != issuerUrl.Host {
+			return "", newIssuerRejection(trustedIssuer.Issuer, RejectUntrustedKeySet, "jku %s is not hosted by the issuer", jku)
+		}
+		return "", nil
+	}
+
+	// the key set is looked up through the same key manager as a visa without
+	// a jku, so no key manager is ever created for a location a visa names
+	discovered, err := GetKeyManager(trustedIssuer.Issuer, "").JwksUri()
+	if err != nil {
+		return "", newIssuerRejection(trustedIssuer.Issuer, RejectUnknownKey, "%v", err)
+	}
+	if jku != discovered {
+		return "", newIssuerRejection(trustedIssuer.Issuer, RejectUntrustedKeySet, "jku %s is not the key set discovered for the issuer", jku)
+	}
+	return "", nil
+}
+
+// numericDateTime converts an optional JWT time claim, zero if not present
+func numericDateTime(date *jwt.NumericDate) time.Time {
+	if date == nil {
+		return time.Time{}
+	}
+	return date.Time().UTC()
+}
+
+// DatasetFromGrant gets the dataset id named by the value of a
+// ControlledAccessGrants visa. values may be a url whose final path segment is
+// the dataset id (e.g. https://dac.example.org/datasets/10g), a urn whose final
+// component is the dataset id (e.g. urn:example:dataset:10g), or the dataset
+// id itself
+//
+// Arguments
+//	value (string): value of the ControlledAccessGrants visa
+// Returns
+//	(string): dataset id
+func DatasetFromGrant(value string) string {
+	trimmed := strings.TrimRight(value, "/")
+
+	parsed, err := url.Parse(trimmed)
+	if err == nil && parsed.Scheme != "" && parsed.Host != "" && parsed.Path != "" {
+		return path.Base(parsed.Path)
+	}
+	if strings.HasPrefix(strings.ToLower(trimmed), "urn:") {
+		return trimmed[strings.LastIndex(trimmed, ":")+1:]
+	}
+	return trimmed
+}
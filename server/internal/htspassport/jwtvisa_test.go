@@ -0,0 +1,164 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module jwtvisa_test tests module jwtvisa
+package htspassport
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// jwtVisaClaimsFor creates the claims of a ControlledAccessGrants visa valid
+// at visaNow
+func jwtVisaClaimsFor(issuer string, subject string, value string) *jwtVisaClaims {
+	claims := new(jwtVisaClaims)
+	claims.Issuer = issuer
+	claims.Subject = subject
+	claims.IssuedAt = jwt.NewNumericDate(unix(1635638400))
+	claims.Expiry = jwt.NewNumericDate(unix(1635811200))
+	claims.Visa.Type = ControlledAccessGrantsVisaType
+	claims.Visa.Asserted = 1635638400
+	claims.Visa.Value = value
+	claims.Visa.Source = "https://dac.example.org"
+	claims.Visa.By = "dac"
+	return claims
+}
+
+// signJWTVisa signs visa claims with the stand-in issuer's key
+func signJWTVisa(t *testing.T, issuer *standInIssuer, kid string, claims *jwtVisaClaims, headers ...string) string {
+	options := (&jose.SignerOptions{}).WithType("JWT")
+	for i := 0; i+1 < len(headers); i += 2 {
+		options = options.WithHeader(jose.HeaderKey(headers[i]), headers[i+1])
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.EdDSA,
+		Key:       jose.JSONWebKey{Key: issuer.privateKey, KeyID: kid},
+	}, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serialized, err := jwt.Signed(signer).Claims(claims).CompactSerialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return serialized
+}
+
+// TestJWTVisaDecoder tests JWTVisaDecoder Decode function
+func TestJWTVisaDecoder(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+	url := issuer.server.URL
+
+	expired := jwtVisaClaimsFor(url, "alice", "10g")
+	expired.Expiry = jwt.NewNumericDate(unix(1635638400))
+	affiliation := jwtVisaClaimsFor(url, "alice", "faculty@example.org")
+	affiliation.Visa.Type = "AffiliationAndRole"
+
+	tc := []struct {
+		entry            interface{}
+		algorithms       []string
+		expRejectionCode RejectionReason
+	}{
+		{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "10g")), []string{EdDSAAlgorithm}, ""},
+		{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "https://dac.example.org/datasets/10g")), []string{EdDSAAlgorithm}, ""},
+		{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "10g"), "jku", url+"/keys"), []string{EdDSAAlgorithm}, ""},
+		{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "10g"), "jku", "https://attacker.example.org/keys"), []string{EdDSAAlgorithm}, RejectUntrustedKeySet},
+		{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "10g"), "jku", url+"/uploads/keys"), []string{EdDSAAlgorithm}, RejectUntrustedKeySet},
+		{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "10g")), []string{"RS256"}, RejectAlgorithmForbidden},
+		{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor("https://other.example.org", "alice", "10g")), []string{EdDSAAlgorithm}, RejectUntrustedIssuer},
+		{signJWTVisa(t, issuer, "key-2", jwtVisaClaimsFor(url, "alice", "10g")), []string{EdDSAAlgorithm}, RejectUnknownKey},
+		{signJWTVisa(t, issuer, "key-1", affiliation), []string{EdDSAAlgorithm}, RejectUnsupportedType},
+		{signJWTVisa(t, issuer, "key-1", expired), []string{EdDSAAlgorithm}, RejectExpired},
+		{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "bob", "10g")), []string{EdDSAAlgorithm}, RejectSubjectMismatch},
+		{"not.a.jwt", []string{EdDSAAlgorithm}, RejectMalformedVisa},
+		{42, []string{EdDSAAlgorithm}, RejectMalformedVisa},
+	}
+
+	for _, c := range tc {
+		decoder := &JWTVisaDecoder{TrustedIssuer: trustStandInIssuer(issuer, c.algorithms...)}
+		visas, rejections := decoder.Decode([]interface{}{c.entry}, "alice", visaNow, 0)
+		if c.expRejectionCode == "" {
+			assert.Equal(t, 0, len(rejections))
+			assert.Equal(t, 1, len(visas))
+			assert.Equal(t, url, visas[0].Issuer)
+			assert.Equal(t, []string{"10g"}, visas[0].Datasets)
+			assert.Equal(t, unix(1635811200), visas[0].ExpiresAt)
+		} else {
+			assert.Equal(t, 0, len(visas))
+			assert.Equal(t, 1, len(rejections))
+			assert.Equal(t, c.expRejectionCode, rejections[0].Reason)
+		}
+	}
+}
+
+// TestJWTVisaDecoderKeyManagers tests that a jku does not create a key
+// manager of its own, whichever location on the issuer it names
+func TestJWTVisaDecoderKeyManagers(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+	url := issuer.server.URL
+
+	decoder := &JWTVisaDecoder{TrustedIssuer: trustStandInIssuer(issuer, EdDSAAlgorithm)}
+	decoder.Decode([]interface{}{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "10g"))}, "alice", visaNow, 0)
+	keyManagersMutex.Lock()
+	before := len(keyManagers)
+	keyManagersMutex.Unlock()
+
+	for i := 0; i < 10; i++ {
+		jku := fmt.Sprintf("%s/keys/%d", url, i)
+		visas, rejections := decoder.Decode([]interface{}{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "10g"), "jku", jku)}, "alice", visaNow, 0)
+		assert.Equal(t, 0, len(visas))
+		if assert.Equal(t, 1, len(rejections)) {
+			assert.Equal(t, RejectUntrustedKeySet, rejections[0].Reason)
+		}
+	}
+	visas, _ := decoder.Decode([]interface{}{signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(url, "alice", "10g"), "jku", url+"/keys")}, "alice", visaNow, 0)
+	assert.Equal(t, 1, len(visas))
+
+	keyManagersMutex.Lock()
+	defer keyManagersMutex.Unlock()
+	assert.Equal(t, before, len(keyManagers))
+}
+
+// TestJWTVisaDecoderTamperedSignature tests that visas whose payload has been
+// altered are rejected
+func TestJWTVisaDecoderTamperedSignature(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+
+	original := signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(issuer.server.URL, "alice", "10g"))
+	other := signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(issuer.server.URL, "alice", "1kg"))
+	originalParts := strings.Split(original, ".")
+	otherParts := strings.Split(other, ".")
+	tampered := originalParts[0] + "." + otherParts[1] + "." + originalParts[2]
+
+	decoder := &JWTVisaDecoder{TrustedIssuer: trustStandInIssuer(issuer, EdDSAAlgorithm)}
+	visas, rejections := decoder.Decode([]interface{}{tampered}, "alice", visaNow, 0)
+	assert.Equal(t, 0, len(visas))
+	assert.Equal(t, RejectBadSignature, rejections[0].Reason)
+}
+
+// datasetFromGrantTC test cases for DatasetFromGrant
+var datasetFromGrantTC = []struct {
+	value string
+	exp   string
+}{
+	{"10g", "10g"},
+	{"https://dac.example.org/datasets/10g", "10g"},
+	{"https://dac.example.org/datasets/10g/", "10g"},
+	{"https://dac.example.org", "https://dac.example.org"},
+	{"urn:example:dataset:giab", "giab"},
+}
+
+// TestDatasetFromGrant tests DatasetFromGrant function
+func TestDatasetFromGrant(t *testing.T) {
+	for _, tc := range datasetFromGrantTC {
+		assert.Equal(t, tc.exp, DatasetFromGrant(tc.value))
+	}
+}
@@ -0,0 +1,215 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module keymanager maintains a process-wide cache of the JSON web keys
+// published by each trusted issuer, locating them via OIDC discovery
+package htspassport
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+	"github.com/ga4gh/htsget-refserver/internal/htsutils"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// keyRefreshInterval how long a fetched key set is used before it is refetched
+var keyRefreshInterval = time.Hour
+
+// keyExpiryInterval how long a fetched key set may continue to be used while
+// the issuer cannot be reached
+var keyExpiryInterval = 12 * time.Hour
+
+// unknownKeyRefetchInterval minimum time between refetches triggered by
+// requests for key ids that are not in the current key set
+var unknownKeyRefetchInterval = 30 * time.Second
+
+// keyFetchTimeout timeout for discovery and key set http requests
+var keyFetchTimeout = 15 * time.Second
+
+// KeyManager holds the current key set of a single issuer, refetching it as
+// keys are rotated
+type KeyManager struct {
+	issuer        string
+	jwksUri       string
+	resolvedUri   string
+	client        *http.Client
+	now           func() time.Time
+	mutex         sync.Mutex
+	keys          *jose.JSONWebKeySet
+	fetchedAt     time.Time
+	lastAttemptAt time.Time
+}
+
+// keyManagers process-wide key managers, keyed by issuer and jwks location
+var keyManagers = map[string]*KeyManager{}
+
+// keyManagersMutex guards keyManagers
+var keyManagersMutex sync.Mutex
+
+// newKeyManager instantiates a key manager for an issuer. if jwksUri is
+// empty, the key set location is resolved through OIDC discovery
+func newKeyManager(issuer string, jwksUri string) *KeyManager {
+	keyManager := new(KeyManager)
+	keyManager.issuer = issuer
+	keyManager.jwksUri = jwksUri
+	keyManager.client = &http.Client{Timeout: keyFetchTimeout}
+	keyManager.now = time.Now
+	return keyManager
+}
+
+// GetKeyManager gets the process-wide key manager for an issuer, creating it
+// on first use so that keys are cached across requests
+func GetKeyManager(issuer string, jwksUri string) *KeyManager {
+	keyManagersMutex.Lock()
+	defer keyManagersMutex.Unlock()
+
+	cacheKey := issuer + " " + jwksUri
+	keyManager, ok := keyManagers[cacheKey]
+	if !ok {
+		keyManager = newKeyManager(issuer, jwksUri)
+		keyManagers[cacheKey] = keyManager
+	}
+	return keyManager
+}
+
+// GetDiscoveryUri gets the OIDC discovery document location for an issuer
+func GetDiscoveryUri(issuer string) string {
+	return fmt.Sprintf("%s/.well-known/openid-configuration", htsutils.RemoveTrailingSlash(issuer))
+}
+
+// GetKey gets the issuer's signing key with the given key id. the key set is
+// refetched when it has gone stale, and refetched once if the key id is not
+// known (i.e. the issuer has rotated in a new key)
+func (keyManager *KeyManager) GetKey(kid string) (*jose.JSONWebKey, error) {
+	keyManager.mutex.Lock()
+	defer keyManager.mutex.Unlock()
+
+	now := keyManager.now()
+
+	if keyManager.keys == nil || now.Sub(keyManager.fetchedAt) >= keyRefreshInterval {
+		err := keyManager.fetch()
+		if err != nil {
+			if keyManager.keys == nil || now.Sub(keyManager.fetchedAt) >= keyExpiryInterval {
+				return nil, err
+			}
+			log.Warn("Continuing with cached keys for issuer %s after refresh failed: %v", keyManager.issuer, err)
+		}
+	}
+
+	if key := keyManager.lookup(kid); key != nil {
+		return key, nil
+	}
+
+	if now.Sub(keyManager.lastAttemptAt) >= unknownKeyRefetchInterval {
+		log.Debug("Key %s not known for issuer %s so refetching key set", kid, keyManager.issuer)
+		err := keyManager.fetch()
+		if err != nil {
+			return nil, err
+		}
+		if key := keyManager.lookup(kid); key != nil {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("key %s was not found in the key set of issuer %s", kid, keyManager.issuer)
+}
+
+// JwksUri gets the location of the issuer's key set, as configured or as
+// named by the jwks_uri of its OIDC discovery document
+//
+//	Type: KeyManager
+// Returns
+//	(string): key set location
+//	(error): the issuer's discovery document could not be fetched
+func (keyManager *KeyManager) JwksUri() (string, error) {
+	keyManager.mutex.Lock()
+	defer keyManager.mutex.Unlock()
+
+	return keyManager.resolveJwksUri()
+}
+
+// lookup finds a key by id in the current key set
+func (keyManager *KeyManager) lookup(kid string) *jose.JSONWebKey {
+	if keyManager.keys == nil {
+		return nil
+	}
+	keys := keyManager.keys.Key(kid)
+	if len(keys) == 0 {
+		return nil
+	}
+	return &keys[0]
+}
+
+// fetch retrieves the issuer's current key set, replacing any cached keys so
+// that keys removed by the issuer are no longer trusted
+func (keyManager *KeyManager) fetch() error {
+	keyManager.lastAttemptAt = keyManager.now()
+
+	jwksUri, err := keyManager.resolveJwksUri()
+	if err != nil {
+		return err
+	}
+
+	keys := new(jose.JSONWebKeySet)
+	err = keyManager.getJSON(jwksUri, keys)
+	if err != nil {
+		// the discovered location may have moved, so rediscover next time
+		keyManager.resolvedUri = ""
+		return fmt.Errorf("fetching key set for issuer %s: %v", keyManager.issuer, err)
+	}
+
+	log.Debug("Fetched %d keys for issuer %s from %s", len(keys.Keys), keyManager.issuer, jwksUri)
+	keyManager.keys = keys
+	keyManager.fetchedAt = keyManager.lastAttemptAt
+	return nil
+}
+
+// resolveJwksUri gets the key set location, using the configured location if
+// present and otherwise the jwks_uri of the issuer's OIDC discovery document
+func (keyManager *KeyManager) resolveJwksUri() (string, error) {
+	if keyManager.jwksUri != "" {
+		return keyManager.jwksUri, nil
+	}
+	if keyManager.resolvedUri != "" {
+		return keyManager.resolvedUri, nil
+	}
+
+	discovery := struct {
+		JwksUri string `json:"jwks_uri"`
+	}{}
+	err := keyManager.getJSON(GetDiscoveryUri(keyManager.issuer), &discovery)
+	if err != nil {
+		return "", fmt.Errorf("discovering key set for issuer %s: %v", keyManager.issuer, err)
+	}
+	if discovery.JwksUri == "" {
+		return "", fmt.Errorf("discovery document for issuer %s has no jwks_uri", keyManager.issuer)
+	}
+
+	keyManager.resolvedUri = discovery.JwksUri
+	return keyManager.resolvedUri, nil
+}
+
+// getJSON fetches a url and decodes its JSON body into target
+func (keyManager *KeyManager) getJSON(url string, target interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := keyManager.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected response status " + res.Status + " from " + url)
+	}
+	return json.NewDecoder(res.Body).Decode(target)
+}
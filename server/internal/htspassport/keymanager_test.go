@@ -0,0 +1,195 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module keymanager_test tests module keymanager
+package htspassport
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// standInIssuer is a local issuer publishing an OIDC discovery document and
+// a rotatable key set
+type standInIssuer struct {
+	server         *httptest.Server
+	privateKey     ed25519.PrivateKey
+	mutex          sync.Mutex
+	keys           []jose.JSONWebKey
+	discoveryCount int
+	jwksCount      int
+	failing        bool
+}
+
+// newStandInIssuer starts a stand-in issuer publishing a single ed25519 key
+func newStandInIssuer(t *testing.T, kid string) *standInIssuer {
+	issuer := new(standInIssuer)
+	issuer.privateKey = issuer.rotate(t, kid)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		issuer.discoveryCount++
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   issuer.server.URL,
+			"jwks_uri": issuer.server.URL + "/keys",
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		issuer.mutex.Lock()
+		defer issuer.mutex.Unlock()
+		issuer.jwksCount++
+		if issuer.failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: issuer.keys})
+	})
+	issuer.server = httptest.NewServer(mux)
+	return issuer
+}
+
+// rotate replaces the published key set with a single new key, returning the
+// private key for signing test visas
+func (issuer *standInIssuer) rotate(t *testing.T, kid string) ed25519.PrivateKey {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.keys = []jose.JSONWebKey{{Key: publicKey, KeyID: kid, Algorithm: "EdDSA", Use: "sig"}}
+	return privateKey
+}
+
+// counts gets the number of discovery and key set requests served
+func (issuer *standInIssuer) counts() (int, int) {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	return issuer.discoveryCount, issuer.jwksCount
+}
+
+// setFailing makes the key set endpoint return errors
+func (issuer *standInIssuer) setFailing(failing bool) {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.failing = failing
+}
+
+// fakeClock is a manually advanced clock
+type fakeClock struct {
+	current time.Time
+}
+
+func (clock *fakeClock) now() time.Time {
+	return clock.current
+}
+
+func (clock *fakeClock) advance(d time.Duration) {
+	clock.current = clock.current.Add(d)
+}
+
+// newTestKeyManager creates a key manager for the stand-in issuer using a
+// fake clock
+func newTestKeyManager(issuer *standInIssuer) (*KeyManager, *fakeClock) {
+	clock := &fakeClock{current: time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)}
+	keyManager := newKeyManager(issuer.server.URL, "")
+	keyManager.now = clock.now
+	return keyManager, clock
+}
+
+// TestKeyManagerDiscoveryAndCaching tests that the key set is located via OIDC
+// discovery, then served from cache
+func TestKeyManagerDiscoveryAndCaching(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+	keyManager, clock := newTestKeyManager(issuer)
+
+	for i := 0; i < 3; i++ {
+		key, err := keyManager.GetKey("key-1")
+		assert.Nil(t, err)
+		assert.Equal(t, "key-1", key.KeyID)
+		clock.advance(time.Minute)
+	}
+
+	discoveryCount, jwksCount := issuer.counts()
+	assert.Equal(t, 1, discoveryCount)
+	assert.Equal(t, 1, jwksCount)
+}
+
+// TestKeyManagerUnknownKeyRefetch tests that an unknown key id triggers a
+// single refetch, picking up rotated keys
+func TestKeyManagerUnknownKeyRefetch(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+	keyManager, clock := newTestKeyManager(issuer)
+
+	_, err := keyManager.GetKey("key-1")
+	assert.Nil(t, err)
+
+	clock.advance(time.Minute)
+	issuer.rotate(t, "key-2")
+	key, err := keyManager.GetKey("key-2")
+	assert.Nil(t, err)
+	assert.Equal(t, "key-2", key.KeyID)
+	_, jwksCount := issuer.counts()
+	assert.Equal(t, 2, jwksCount)
+
+	// the rotated out key is no longer trusted, and asking for it again
+	// straight away does not refetch
+	_, err = keyManager.GetKey("key-1")
+	assert.NotNil(t, err)
+	_, err = keyManager.GetKey("key-1")
+	assert.NotNil(t, err)
+	_, jwksCount = issuer.counts()
+	assert.Equal(t, 2, jwksCount)
+}
+
+// TestKeyManagerRefreshAndExpiry tests that stale key sets are refreshed, and
+// that cached keys are only used while the issuer is unreachable up to expiry
+func TestKeyManagerRefreshAndExpiry(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+	keyManager, clock := newTestKeyManager(issuer)
+
+	_, err := keyManager.GetKey("key-1")
+	assert.Nil(t, err)
+
+	clock.advance(keyRefreshInterval)
+	_, err = keyManager.GetKey("key-1")
+	assert.Nil(t, err)
+	_, jwksCount := issuer.counts()
+	assert.Equal(t, 2, jwksCount)
+
+	issuer.setFailing(true)
+	clock.advance(keyRefreshInterval)
+	_, err = keyManager.GetKey("key-1")
+	assert.Nil(t, err)
+
+	clock.advance(keyExpiryInterval)
+	_, err = keyManager.GetKey("key-1")
+	assert.NotNil(t, err)
+}
+
+// TestGetKeyManager tests that key managers are shared per issuer
+func TestGetKeyManager(t *testing.T) {
+	a := GetKeyManager("https://dac.example.org", "")
+	b := GetKeyManager("https://dac.example.org", "")
+	c := GetKeyManager("https://other.example.org", "")
+	assert.True(t, a == b)
+	assert.False(t, a == c)
+}
+
+// TestGetDiscoveryUri tests GetDiscoveryUri function
+func TestGetDiscoveryUri(t *testing.T) {
+	assert.Equal(t, "https://dac.example.org/.well-known/openid-configuration", GetDiscoveryUri("https://dac.example.org/"))
+}
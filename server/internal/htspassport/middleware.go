@@ -0,0 +1,59 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module middleware protects http handlers, only passing on requests bearing a
+// passport from a trusted broker
+package htspassport
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htserror"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+)
+
+// contextKey type of the keys this package stores request context values under
+type contextKey string
+
+// passportContextKey request context key of the verified passport
+const passportContextKey = contextKey("passport")
+
+// passportClock gets the current time that passport validity is checked against
+var passportClock = time.Now
+
+// Handler wraps an http handler so that it is only called for requests bearing
+// a valid passport, wherever it was presented, making the verified passport
+// available through GetPassport
+//
+// Arguments
+//	next (http.Handler): handler for requests with a valid passport
+// Returns
+//	(http.Handler): handler verifying the passport before calling next
+func Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		passport, err := extractPassport(request, passportClock())
+		if err == errNoPassport {
+			msg := "A passport must be supplied in the " + PassportHeader + " header, the " + PassportBodyField + " field of the request body, or as a bearer token"
+			htserror.InvalidAuthentication(writer, &msg)
+			return
+		}
+		if err != nil {
+			log.Info("Rejected passport: %v", err)
+			msg := "The passport could not be verified"
+			htserror.InvalidAuthentication(writer, &msg)
+			return
+		}
+
+		log.Debug("Accepted passport of %s from %s via %s", passport.Subject, passport.Issuer, passport.Source)
+		ctx := context.WithValue(request.Context(), passportContextKey, passport)
+		next.ServeHTTP(writer, request.WithContext(ctx))
+	})
+}
+
+// GetPassport gets the verified passport of a request that has passed through
+// Handler, or nil if there is none
+func GetPassport(ctx context.Context) *Passport {
+	passport, _ := ctx.Value(passportContextKey).(*Passport)
+	return passport
+}
@@ -0,0 +1,99 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module middleware_test tests module middleware
+package htspassport
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport/passporttest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestHandler tests that Handler only passes on requests bearing a passport
+// from a configured broker, wherever the passport is presented
+func TestHandler(t *testing.T) {
+	issuer, err := passporttest.NewLocalIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer issuer.Close()
+	htsconfig.LoadConfig()
+	broker := issuer.Broker("htsget")
+	broker.IntrospectionEndpoint = issuer.IntrospectionEndpoint()
+	broker.UserinfoEndpoint = issuer.UserinfoEndpoint()
+	htsconfig.AddPassportBroker(broker)
+	htsconfig.AddTrustedIssuer(issuer.TrustedIssuer("10g"))
+
+	var passed *Passport
+	var passedBody string
+	handler := Handler(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		passed = GetPassport(request.Context())
+		body, _ := ioutil.ReadAll(request.Body)
+		passedBody = string(body)
+	}))
+
+	visa := issuer.CompactVisa(fmt.Sprintf("c:10g e:%d u:alice", time.Now().Add(time.Hour).Unix()))
+	valid, _ := issuer.Passport("alice", "htsget", time.Now().Add(time.Hour), visa)
+	wrongAudience, _ := issuer.Passport("alice", "elsewhere", time.Now().Add(time.Hour))
+	opaque := issuer.OpaqueToken("alice", "htsget", time.Now().Add(time.Hour), visa)
+	opaqueExpired := issuer.OpaqueToken("alice", "htsget", time.Now().Add(-time.Hour), visa)
+
+	tc := []struct {
+		method        string
+		authorization string
+		header        string
+		body          string
+		expCode       int
+		expSource     string
+	}{
+		{"GET", "Bearer " + valid, "", "", http.StatusOK, PassportSourceBearer},
+		{"GET", "bearer " + valid, "", "", http.StatusOK, PassportSourceBearer},
+		{"GET", "Bearer " + wrongAudience, "", "", http.StatusUnauthorized, ""},
+		{"GET", "Basic YWxpY2U6c2VjcmV0", "", "", http.StatusUnauthorized, ""},
+		{"GET", "", "", "", http.StatusUnauthorized, ""},
+		{"GET", "", valid, "", http.StatusOK, PassportSourceHeader},
+		{"GET", "Bearer " + wrongAudience, valid, "", http.StatusOK, PassportSourceHeader},
+		{"GET", "Bearer " + valid, wrongAudience, "", http.StatusUnauthorized, ""},
+		{"POST", "", "", `{"format": "BAM", "passport": "` + valid + `"}`, http.StatusOK, PassportSourceBody},
+		{"POST", "Bearer " + valid, "", `{"format": "BAM"}`, http.StatusOK, PassportSourceBearer},
+		{"POST", "", "", `{"format": "BAM", "passport": "` + wrongAudience + `"}`, http.StatusUnauthorized, ""},
+		{"POST", "", "", `not json`, http.StatusUnauthorized, ""},
+		{"GET", "Bearer " + opaque, "", "", http.StatusOK, PassportSourceIntrospection},
+		{"GET", "Bearer " + opaqueExpired, "", "", http.StatusUnauthorized, ""},
+		{"GET", "Bearer unknown-token", "", "", http.StatusUnauthorized, ""},
+	}
+
+	for i, c := range tc {
+		passed, passedBody = nil, ""
+		request := httptest.NewRequest(c.method, "/variants/10g/HG002", strings.NewReader(c.body))
+		if c.authorization != "" {
+			request.Header.Set("Authorization", c.authorization)
+		}
+		if c.header != "" {
+			request.Header.Set(PassportHeader, c.header)
+		}
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, c.expCode, recorder.Code, i)
+		if c.expCode == http.StatusOK {
+			assert.Equal(t, c.expSource, passed.Source, i)
+			assert.Equal(t, "alice", passed.Subject)
+			assert.Equal(t, issuer.URL(), passed.Issuer)
+			assert.Contains(t, passed.Claims, CompactVisaPassportClaim)
+			visas, _ := passed.DecodeVisas(time.Now(), 0)
+			assert.Equal(t, 1, len(visas))
+			// the body is still available to the handler after the passport is read from it
+			assert.Equal(t, c.body, passedBody)
+		} else {
+			assert.Nil(t, passed)
+		}
+	}
+}
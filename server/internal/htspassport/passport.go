@@ -0,0 +1,102 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module passport verifies passport tokens signed by the configured passport
+// brokers, checking their audience, algorithm and validity times
+package htspassport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// BrokerLookup gets the passport broker configuration for an issuer url, or nil
+// if the broker is not trusted
+type BrokerLookup func(issuer string) *htsconfig.PassportBroker
+
+// PassportVerifier verifies passports issued by trusted passport brokers
+//
+// Attributes
+//	Broker (BrokerLookup): gets the configuration of trusted brokers
+//	ClockSkew (time.Duration): tolerance applied when checking passport times
+type PassportVerifier struct {
+	Broker    BrokerLookup
+	ClockSkew time.Duration
+}
+
+// NewPassportVerifier instantiates a passport verifier trusting the configured
+// passport brokers
+func NewPassportVerifier() *PassportVerifier {
+	return &PassportVerifier{
+		Broker:    htsconfig.GetPassportBroker,
+		ClockSkew: htsconfig.GetClockSkew(),
+	}
+}
+
+// Verify checks a passport was signed by a trusted broker, is intended for
+// this server and is currently valid
+//
+//	Type: PassportVerifier
+// Arguments
+//	token (string): compact serialized passport JWT
+//	now (time.Time): current time
+// Returns
+//	(map[string]interface{}): verified passport claims
+//	(error): description of why the passport was not accepted
+func (verifier *PassportVerifier) Verify(token string, now time.Time) (map[string]interface{}, error) {
+	parsed, err := jwt.ParseSigned(token)
+	if err != nil {
+		return nil, fmt.Errorf("passport could not be parsed: %v", err)
+	}
+	if len(parsed.Headers) != 1 {
+		return nil, fmt.Errorf("passport must have exactly one signature")
+	}
+	header := parsed.Headers[0]
+
+	// the issuer is needed to find the key, so is read before the signature
+	// has been verified - it is checked again against the verified claims
+	unverified := new(jwt.Claims)
+	if err := parsed.UnsafeClaimsWithoutVerification(unverified); err != nil {
+		return nil, fmt.Errorf("passport claims could not be parsed: %v", err)
+	}
+
+	broker := verifier.Broker(unverified.Issuer)
+	if broker == nil {
+		return nil, fmt.Errorf("passport broker %s is not trusted", unverified.Issuer)
+	}
+	if !broker.AllowsAlgorithm(header.Algorithm) {
+		return nil, fmt.Errorf("passport broker %s is not permitted to sign with %s", broker.Issuer, header.Algorithm)
+	}
+
+	jwk, err := GetKeySource(broker.Issuer, broker.JwksUri, broker.Jwks, broker.JwksFile).GetKey(header.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckKeyAlgorithm(jwk, header.Algorithm); err != nil {
+		return nil, fmt.Errorf("passport cannot be verified: %v", err)
+	}
+
+	claims := new(jwt.Claims)
+	passportClaims := make(map[string]interface{})
+	if err := parsed.Claims(jwk.Key, claims, &passportClaims); err != nil {
+		return nil, fmt.Errorf("passport signature check failed with key %s: %v", header.KeyID, err)
+	}
+
+	if claims.Expiry == nil {
+		return nil, fmt.Errorf("passport has no expiry")
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("passport has no subject")
+	}
+	if !broker.AcceptsAudience(claims.Audience) {
+		return nil, fmt.Errorf("passport audience %v is not accepted from broker %s", []string(claims.Audience), broker.Issuer)
+	}
+	err = claims.ValidateWithLeeway(jwt.Expected{Issuer: broker.Issuer, Time: now}, verifier.ClockSkew)
+	if err != nil {
+		return nil, fmt.Errorf("passport is not valid: %v", err)
+	}
+
+	return passportClaims, nil
+}
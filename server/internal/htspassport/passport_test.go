@@ -0,0 +1,89 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module passport_test tests module passport
+package htspassport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport/passporttest"
+	"github.com/stretchr/testify/assert"
+)
+
+// passportClaimsFor creates passport claims from the local issuer
+func passportClaimsFor(issuer *passporttest.LocalIssuer, subject string, audience string, expiresAt time.Time) map[string]interface{} {
+	claims := map[string]interface{}{
+		"iss": issuer.URL(),
+		"aud": audience,
+		"iat": visaNow.Unix(),
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	if !expiresAt.IsZero() {
+		claims["exp"] = expiresAt.Unix()
+	}
+	return claims
+}
+
+// TestPassportVerifierVerify tests PassportVerifier Verify function
+func TestPassportVerifierVerify(t *testing.T) {
+	issuer, err := passporttest.NewLocalIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer issuer.Close()
+
+	other, err := passporttest.NewLocalIssuer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	inOneHour := visaNow.Add(time.Hour)
+
+	tc := []struct {
+		claims     map[string]interface{}
+		signer     *passporttest.LocalIssuer
+		broker     *htsconfig.PassportBroker
+		expSuccess bool
+	}{
+		{passportClaimsFor(issuer, "alice", "htsget", inOneHour), issuer, issuer.Broker("htsget"), true},
+		{passportClaimsFor(issuer, "alice", "other", inOneHour), issuer, issuer.Broker(), false},
+		{passportClaimsFor(issuer, "alice", "other", inOneHour), issuer, issuer.Broker("htsget", "htsget-staging"), false},
+		{passportClaimsFor(issuer, "alice", "htsget", visaNow.Add(-30*time.Second)), issuer, issuer.Broker("htsget"), true},
+		{passportClaimsFor(issuer, "alice", "htsget", visaNow.Add(-2*time.Minute)), issuer, issuer.Broker("htsget"), false},
+		{passportClaimsFor(issuer, "", "htsget", inOneHour), issuer, issuer.Broker("htsget"), false},
+		{passportClaimsFor(issuer, "alice", "htsget", time.Time{}), issuer, issuer.Broker("htsget"), false},
+		{passportClaimsFor(issuer, "alice", "htsget", inOneHour), issuer, nil, false},
+		{passportClaimsFor(issuer, "alice", "htsget", inOneHour), issuer, &htsconfig.PassportBroker{Issuer: issuer.URL(), Algorithms: []string{"RS256"}}, false},
+		{passportClaimsFor(issuer, "alice", "htsget", inOneHour), other, issuer.Broker("htsget"), false},
+	}
+
+	for i, c := range tc {
+		broker := c.broker
+		verifier := &PassportVerifier{
+			Broker: func(string) *htsconfig.PassportBroker {
+				return broker
+			},
+			ClockSkew: time.Minute,
+		}
+		token, err := c.signer.Sign(c.claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims, err := verifier.Verify(token, visaNow)
+		if c.expSuccess {
+			assert.Nil(t, err, i)
+			assert.Equal(t, "alice", claims["sub"], i)
+		} else {
+			assert.NotNil(t, err, i)
+			assert.Nil(t, claims, i)
+		}
+	}
+
+	_, err = (&PassportVerifier{Broker: htsconfig.GetPassportBroker}).Verify("not.a.passport", visaNow)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,294 @@
+// Package passporttest provides a local passport broker and visa issuer, so
+// that integration tests and test deployments can exercise controlled
+// endpoints without reaching out to a real broker
+//
+// Module localissuer runs an in-process issuer publishing an OIDC discovery
+// document and key set, and signs passports and visas with its key. it also
+// issues opaque access tokens, answering for them at its introspection and
+// userinfo endpoints
+package passporttest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"golang.org/x/crypto/ed25519"
+	jose "gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
+)
+
+// localIssuerKeyID key id the local issuer signs with
+const localIssuerKeyID = "local-issuer"
+
+// localIssuerAlgorithm JOSE algorithm the local issuer signs with
+const localIssuerAlgorithm = "EdDSA"
+
+// LocalIssuer is an in-process passport broker and visa issuer
+type LocalIssuer struct {
+	server     *httptest.Server
+	mux        *http.ServeMux
+	publicKey  ed25519.PublicKey
+	privateKey ed25519.PrivateKey
+	mutex      sync.Mutex
+	tokens     map[string]map[string]interface{}
+}
+
+// NewLocalIssuer starts a local issuer with a newly generated ed25519 key
+//
+// Returns
+//	(*LocalIssuer): running local issuer, which must be closed after use
+//	(error): the signing key could not be generated
+func NewLocalIssuer() (*LocalIssuer, error) {
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := newLocalIssuer(privateKey)
+	issuer.server = httptest.NewServer(issuer.mux)
+	return issuer, nil
+}
+
+// NewLocalIssuerAt starts a local issuer listening on the given address, e.g.
+// so that a test deployment of the server can be configured to trust it
+//
+// Arguments
+//	addr (string): host and port the issuer listens on, its url being http://{addr}
+//	privateKey (ed25519.PrivateKey): key the issuer signs with, kept across restarts
+//	so that the server need not refetch it
+// Returns
+//	(*LocalIssuer): running local issuer, which must be closed after use
+//	(error): the address could not be listened on
+func NewLocalIssuerAt(addr string, privateKey ed25519.PrivateKey) (*LocalIssuer, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	issuer := newLocalIssuer(privateKey)
+	issuer.server = httptest.NewUnstartedServer(issuer.mux)
+	issuer.server.Listener.Close()
+	issuer.server.Listener = listener
+	issuer.server.Start()
+	return issuer, nil
+}
+
+// newLocalIssuer instantiates a local issuer signing with the key, serving its
+// discovery document, key set and token endpoints
+func newLocalIssuer(privateKey ed25519.PrivateKey) *LocalIssuer {
+	issuer := &LocalIssuer{
+		mux:        http.NewServeMux(),
+		publicKey:  privateKey.Public().(ed25519.PublicKey),
+		privateKey: privateKey,
+		tokens:     make(map[string]map[string]interface{}),
+	}
+	issuer.mux.HandleFunc("/.well-known/openid-configuration", issuer.serveDiscovery)
+	issuer.mux.HandleFunc("/.well-known/jwks", issuer.serveJwks)
+	issuer.mux.HandleFunc("/introspect", issuer.serveIntrospection)
+	issuer.mux.HandleFunc("/userinfo", issuer.serveUserinfo)
+	return issuer
+}
+
+// URL gets the issuer url of the local issuer
+func (issuer *LocalIssuer) URL() string {
+	return issuer.server.URL
+}
+
+// IntrospectionEndpoint gets the url opaque tokens of the local issuer are
+// introspected at
+func (issuer *LocalIssuer) IntrospectionEndpoint() string {
+	return issuer.URL() + "/introspect"
+}
+
+// UserinfoEndpoint gets the url the claims of opaque tokens of the local issuer
+// are read from
+func (issuer *LocalIssuer) UserinfoEndpoint() string {
+	return issuer.URL() + "/userinfo"
+}
+
+// Handle serves additional content from the local issuer, e.g. the manifests
+// of its datasets
+func (issuer *LocalIssuer) Handle(pattern string, handler http.Handler) {
+	issuer.mux.Handle(pattern, handler)
+}
+
+// Close stops the local issuer
+func (issuer *LocalIssuer) Close() {
+	issuer.server.Close()
+}
+
+// Broker gets the passport broker configuration trusting the local issuer
+func (issuer *LocalIssuer) Broker(audiences ...string) *htsconfig.PassportBroker {
+	return &htsconfig.PassportBroker{
+		Issuer:     issuer.URL(),
+		Audiences:  audiences,
+		Algorithms: []string{localIssuerAlgorithm},
+	}
+}
+
+// TrustedIssuer gets the visa issuer configuration trusting the local issuer to
+// grant the given datasets
+func (issuer *LocalIssuer) TrustedIssuer(datasets ...string) *htsconfig.TrustedIssuer {
+	return &htsconfig.TrustedIssuer{
+		Issuer:     issuer.URL(),
+		Algorithms: []string{localIssuerAlgorithm},
+		Datasets:   datasets,
+	}
+}
+
+// Trust adds the local issuer to the loaded configuration, both as a passport
+// broker and as a visa issuer for the given datasets
+func (issuer *LocalIssuer) Trust(audience string, datasets ...string) {
+	htsconfig.AddPassportBroker(issuer.Broker(audience))
+	htsconfig.AddTrustedIssuer(issuer.TrustedIssuer(datasets...))
+}
+
+// KeySet gets the key set of the local issuer, e.g. to configure it statically
+// rather than have it fetched
+func (issuer *LocalIssuer) KeySet() jose.JSONWebKeySet {
+	return jose.JSONWebKeySet{
+		Keys: []jose.JSONWebKey{{
+			Key:       issuer.publicKey,
+			KeyID:     localIssuerKeyID,
+			Algorithm: localIssuerAlgorithm,
+			Use:       "sig",
+		}},
+	}
+}
+
+// CompactVisa signs the space separated claims of a compact visa
+func (issuer *LocalIssuer) CompactVisa(content string) map[string]interface{} {
+	return map[string]interface{}{
+		"v": content,
+		"i": issuer.URL(),
+		"k": localIssuerKeyID,
+		"s": base64.RawURLEncoding.EncodeToString(ed25519.Sign(issuer.privateKey, []byte(content))),
+	}
+}
+
+// Passport signs a passport for a subject carrying compact visas
+//
+// Arguments
+//	subject (string): subject of the passport
+//	audience (string): audience of the passport
+//	expiresAt (time.Time): expiry of the passport
+//	compactVisas (...map[string]interface{}): visas created by CompactVisa
+// Returns
+//	(string): compact serialized passport
+//	(error): the passport could not be signed
+func (issuer *LocalIssuer) Passport(subject string, audience string, expiresAt time.Time, compactVisas ...map[string]interface{}) (string, error) {
+	return issuer.Sign(issuer.passportClaims(subject, audience, expiresAt, compactVisas))
+}
+
+// OpaqueToken issues an opaque access token for a subject, which the local
+// issuer exchanges for passport claims carrying compact visas
+//
+// Arguments
+//	subject (string): subject of the token
+//	audience (string): audience of the token
+//	expiresAt (time.Time): expiry of the token
+//	compactVisas (...map[string]interface{}): visas created by CompactVisa
+// Returns
+//	(string): opaque access token
+func (issuer *LocalIssuer) OpaqueToken(subject string, audience string, expiresAt time.Time, compactVisas ...map[string]interface{}) string {
+	nonce := make([]byte, 24)
+	rand.Read(nonce)
+	token := base64.RawURLEncoding.EncodeToString(nonce)
+
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	issuer.tokens[token] = issuer.passportClaims(subject, audience, expiresAt, compactVisas)
+	return token
+}
+
+// passportClaims builds the claims of a passport carrying compact visas
+func (issuer *LocalIssuer) passportClaims(subject string, audience string, expiresAt time.Time, compactVisas []map[string]interface{}) map[string]interface{} {
+	visaList := make([]interface{}, 0)
+	for _, compactVisa := range compactVisas {
+		visaList = append(visaList, compactVisa)
+	}
+	return map[string]interface{}{
+		"iss": issuer.URL(),
+		"sub": subject,
+		"aud": audience,
+		"iat": time.Now().Unix(),
+		"exp": expiresAt.Unix(),
+		"ga4gh_passport_v2": map[string]interface{}{
+			"c": visaList,
+		},
+	}
+}
+
+// Sign signs arbitrary claims as a JWT, e.g. a GA4GH Passport v1.x visa or a
+// passport built by the test
+func (issuer *LocalIssuer) Sign(claims interface{}) (string, error) {
+	signer, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: jose.EdDSA,
+		Key:       jose.JSONWebKey{Key: issuer.privateKey, KeyID: localIssuerKeyID},
+	}, (&jose.SignerOptions{}).WithType("JWT"))
+	if err != nil {
+		return "", err
+	}
+	return jwt.Signed(signer).Claims(claims).CompactSerialize()
+}
+
+// serveDiscovery serves the OIDC discovery document of the local issuer
+func (issuer *LocalIssuer) serveDiscovery(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(map[string]string{
+		"issuer":   issuer.URL(),
+		"jwks_uri": issuer.URL() + "/.well-known/jwks",
+	})
+}
+
+// serveJwks serves the key set of the local issuer
+func (issuer *LocalIssuer) serveJwks(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(issuer.KeySet())
+}
+
+// tokenClaims gets the claims of an opaque token the local issuer issued, or
+// nil if it did not issue the token
+func (issuer *LocalIssuer) tokenClaims(token string) map[string]interface{} {
+	issuer.mutex.Lock()
+	defer issuer.mutex.Unlock()
+	return issuer.tokens[token]
+}
+
+// serveIntrospection answers RFC 7662 introspection requests for opaque tokens.
+// as with most brokers, the response does not carry the passport claims
+func (issuer *LocalIssuer) serveIntrospection(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "application/json")
+	claims := issuer.tokenClaims(request.PostFormValue("token"))
+	if claims == nil {
+		json.NewEncoder(writer).Encode(map[string]interface{}{"active": false})
+		return
+	}
+	json.NewEncoder(writer).Encode(map[string]interface{}{
+		"active": true,
+		"iss":    claims["iss"],
+		"sub":    claims["sub"],
+		"aud":    claims["aud"],
+		"exp":    claims["exp"],
+	})
+}
+
+// serveUserinfo serves the passport claims of the opaque token the request
+// bears
+func (issuer *LocalIssuer) serveUserinfo(writer http.ResponseWriter, request *http.Request) {
+	claims := issuer.tokenClaims(strings.TrimPrefix(request.Header.Get("Authorization"), "Bearer "))
+	if claims == nil {
+		writer.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	writer.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(writer).Encode(claims)
+}
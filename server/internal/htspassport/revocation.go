@@ -0,0 +1,248 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module revocation maintains a process-wide cache of the revocation list each
+// trusted issuer publishes, so that visas withdrawn by a Data Access Committee
+// are rejected before they expire
+package htspassport
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+)
+
+// revocation states of a visa
+const (
+	RevocationNotChecked = "not-checked"
+	RevocationNotRevoked = "not-revoked"
+	RevocationRevoked    = "revoked"
+)
+
+// revocationRetryInterval minimum time between attempts to reload a revocation
+// list that could not be loaded
+var revocationRetryInterval = 30 * time.Second
+
+// revocationFetchTimeout timeout for revocation list http requests
+var revocationFetchTimeout = 15 * time.Second
+
+// revocationDocument the revocation list published by an issuer
+//
+// Attributes
+//	Hashes ([]string): hex encoded SHA-256 hashes of revoked visas
+//	IDs ([]string): identifiers (jti) of revoked visas
+type revocationDocument struct {
+	Hashes []string `json:"hashes"`
+	IDs    []string `json:"ids"`
+}
+
+// RevocationList holds the current revocation list of a single issuer,
+// reloading it periodically. the list is fetched from the location the issuer
+// publishes it at, and read from a local file when it cannot be fetched
+type RevocationList struct {
+	issuer        string
+	uri           string
+	file          string
+	refresh       time.Duration
+	maxStaleness  time.Duration
+	client        *http.Client
+	now           func() time.Time
+	mutex         sync.Mutex
+	hashes        map[string]bool
+	ids           map[string]bool
+	loadedAt      time.Time
+	lastAttemptAt time.Time
+}
+
+// revocationLists process-wide revocation lists, keyed by issuer and list locations
+var revocationLists = map[string]*RevocationList{}
+
+// revocationListsMutex guards revocationLists
+var revocationListsMutex sync.Mutex
+
+// newRevocationList instantiates the revocation list of an issuer
+func newRevocationList(issuer string, revocation *htsconfig.IssuerRevocation) *RevocationList {
+	list := new(RevocationList)
+	list.issuer = issuer
+	list.uri = revocation.Uri
+	list.file = revocation.File
+	list.refresh = revocation.GetRefresh()
+	list.maxStaleness = revocation.GetMaxStaleness()
+	list.client = &http.Client{Timeout: revocationFetchTimeout}
+	list.now = time.Now
+	return list
+}
+
+// GetRevocationList gets the process-wide revocation list of a trusted issuer,
+// creating it on first use so that the list is cached across requests
+//
+// Arguments
+//	trustedIssuer (*htsconfig.TrustedIssuer): issuer configuration
+// Returns
+//	(*RevocationList): the issuer's revocation list, nil if the issuer has none configured
+func GetRevocationList(trustedIssuer *htsconfig.TrustedIssuer) *RevocationList {
+	revocation := trustedIssuer.Revocation
+	if revocation == nil || (revocation.Uri == "" && revocation.File == "") {
+		return nil
+	}
+
+	revocationListsMutex.Lock()
+	defer revocationListsMutex.Unlock()
+
+	cacheKey := trustedIssuer.Issuer + " " + revocation.Uri + " " + revocation.File
+	list, ok := revocationLists[cacheKey]
+	if !ok {
+		list = newRevocationList(trustedIssuer.Issuer, revocation)
+		revocationLists[cacheKey] = list
+	}
+	return list
+}
+
+// IsRevoked checks if a visa is on the revocation list, by its hash or its
+// identifier. the list is reloaded once it has been used for the refresh
+// interval. if it cannot be reloaded, the list last loaded continues to be
+// used, until it is older than the maximum staleness
+//
+//	Type: RevocationList
+// Arguments
+//	visa (*Visa): verified visa
+// Returns
+//	(bool): if true, the visa has been revoked
+//	(time.Time): time the list checked against was loaded
+//	(error): no revocation list could be loaded, or the list last loaded is too
+//	stale, so revocation cannot be ruled out
+func (list *RevocationList) IsRevoked(visa *Visa) (bool, time.Time, error) {
+	list.mutex.Lock()
+	defer list.mutex.Unlock()
+
+	now := list.now()
+	stale := list.hashes == nil || now.Sub(list.loadedAt) >= list.refresh
+	if stale && (list.lastAttemptAt.IsZero() || now.Sub(list.lastAttemptAt) >= revocationRetryInterval) {
+		err := list.load()
+		if err != nil {
+			if list.hashes == nil {
+				return false, time.Time{}, err
+			}
+			log.Warn("Continuing with revocation list of issuer %s loaded at %s: %v", list.issuer, list.loadedAt.Format(time.RFC3339), err)
+		}
+	}
+	if list.hashes == nil {
+		return false, time.Time{}, fmt.Errorf("revocation list of issuer %s could not be loaded", list.issuer)
+	}
+	if now.Sub(list.loadedAt) >= list.maxStaleness {
+		return false, time.Time{}, fmt.Errorf("revocation list of issuer %s was last loaded at %s, more than %s ago", list.issuer, list.loadedAt.Format(time.RFC3339), list.maxStaleness)
+	}
+
+	revoked := list.hashes[strings.ToLower(visa.Hash)] || (visa.ID != "" && list.ids[visa.ID])
+	return revoked, list.loadedAt, nil
+}
+
+// load fetches the revocation list, falling back to the local file
+func (list *RevocationList) load() error {
+	list.lastAttemptAt = list.now()
+
+	var document *revocationDocument
+	var err error
+	if list.uri != "" {
+		document, err = list.fetch()
+		if err != nil && list.file != "" {
+			log.Warn("Reading local revocation list of issuer %s: %v", list.issuer, err)
+		}
+	}
+	if document == nil && list.file != "" {
+		document, err = list.read()
+	}
+	if err != nil {
+		return err
+	}
+
+	list.hashes = make(map[string]bool)
+	for _, hash := range document.Hashes {
+		list.hashes[strings.ToLower(hash)] = true
+	}
+	list.ids = make(map[string]bool)
+	for _, id := range document.IDs {
+		list.ids[id] = true
+	}
+	list.loadedAt = list.lastAttemptAt
+	log.Debug("Loaded revocation list of issuer %s with %d hashes and %d ids", list.issuer, len(list.hashes), len(list.ids))
+	return nil
+}
+
+// fetch gets the revocation list from the location the issuer publishes it at
+func (list *RevocationList) fetch() (*revocationDocument, error) {
+	req, err := http.NewRequest(http.MethodGet, list.uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := list.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching revocation list of issuer %s: %v", list.issuer, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected response status " + res.Status + " from " + list.uri)
+	}
+	document := new(revocationDocument)
+	if err := json.NewDecoder(res.Body).Decode(document); err != nil {
+		return nil, fmt.Errorf("parsing revocation list of issuer %s: %v", list.issuer, err)
+	}
+	return document, nil
+}
+
+// read gets the revocation list from the local file
+func (list *RevocationList) read() (*revocationDocument, error) {
+	body, err := ioutil.ReadFile(list.file)
+	if err != nil {
+		return nil, fmt.Errorf("reading revocation list of issuer %s: %v", list.issuer, err)
+	}
+	document := new(revocationDocument)
+	if err := json.Unmarshal(body, document); err != nil {
+		return nil, fmt.Errorf("parsing revocation list of issuer %s: %v", list.issuer, err)
+	}
+	return document, nil
+}
+
+// checkRevocation records the revocation state of a verified visa, rejecting
+// it if the issuer has revoked it, or if the issuer's revocation list cannot
+// be loaded
+func checkRevocation(trustedIssuer *htsconfig.TrustedIssuer, visa *Visa) *VisaRejection {
+	list := GetRevocationList(trustedIssuer)
+	if list == nil {
+		visa.Revocation = RevocationNotChecked
+		return nil
+	}
+
+	revoked, loadedAt, err := list.IsRevoked(visa)
+	if err != nil {
+		return newIssuerRejection(visa.Issuer, RejectRevocationUnknown, "%v", err)
+	}
+	visa.RevocationListAt = loadedAt
+	if revoked {
+		visa.Revocation = RevocationRevoked
+		rejection := newIssuerRejection(visa.Issuer, RejectRevoked, "visa %s was revoked by its issuer", visa.Hash)
+		rejection.Visa = visa
+		return rejection
+	}
+	visa.Revocation = RevocationNotRevoked
+	return nil
+}
+
+// visaHash gets the hex encoded SHA-256 hash a visa is listed by on
+// revocation lists
+func visaHash(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,175 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module revocation_test tests module revocation
+package htspassport
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRevocationServer publishes a revocation list that tests can change or
+// take offline
+type testRevocationServer struct {
+	*httptest.Server
+	mutex    sync.Mutex
+	document *revocationDocument
+}
+
+// newTestRevocationServer starts a server publishing a revocation list
+func newTestRevocationServer(document *revocationDocument) *testRevocationServer {
+	server := &testRevocationServer{document: document}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+		if server.document == nil {
+			writer.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		json.NewEncoder(writer).Encode(server.document)
+	}))
+	return server
+}
+
+// publish changes the published revocation list, nil taking the list offline
+func (server *testRevocationServer) publish(document *revocationDocument) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.document = document
+}
+
+// TestRevocationListIsRevoked tests that visas are checked against the
+// published revocation list as it is refreshed, and that the list last loaded
+// is used while the issuer cannot be reached, until it is too stale
+func TestRevocationListIsRevoked(t *testing.T) {
+	server := newTestRevocationServer(&revocationDocument{Hashes: []string{"AAAA"}, IDs: []string{"visa-1"}})
+	defer server.Close()
+
+	now := time.Unix(1635811200, 0)
+	list := newRevocationList("https://dac.example.org", &htsconfig.IssuerRevocation{Uri: server.URL, Refresh: "5m", MaxStaleness: "30m"})
+	list.now = func() time.Time { return now }
+
+	check := func(visa *Visa, expRevoked bool) {
+		revoked, loadedAt, err := list.IsRevoked(visa)
+		assert.Nil(t, err)
+		assert.Equal(t, expRevoked, revoked, visa)
+		assert.False(t, loadedAt.IsZero())
+	}
+	check(&Visa{Hash: "aaaa"}, true)
+	check(&Visa{Hash: "bbbb", ID: "visa-1"}, true)
+	check(&Visa{Hash: "bbbb", ID: "visa-2"}, false)
+	check(&Visa{Hash: "bbbb"}, false)
+
+	// the list is only refetched once the refresh interval has passed
+	server.publish(&revocationDocument{Hashes: []string{"aaaa", "bbbb"}})
+	now = now.Add(time.Minute)
+	check(&Visa{Hash: "bbbb"}, false)
+	now = now.Add(5 * time.Minute)
+	check(&Visa{Hash: "bbbb"}, true)
+	check(&Visa{Hash: "cccc", ID: "visa-1"}, false)
+
+	// the list last loaded is used while the issuer cannot be reached
+	server.publish(nil)
+	now = now.Add(10 * time.Minute)
+	check(&Visa{Hash: "bbbb"}, true)
+
+	// until it is older than the maximum staleness, when revocation cannot be ruled out
+	now = now.Add(30 * time.Minute)
+	_, _, err := list.IsRevoked(&Visa{Hash: "cccc"})
+	assert.NotNil(t, err)
+
+	server.publish(&revocationDocument{Hashes: []string{"aaaa"}})
+	now = now.Add(time.Minute)
+	check(&Visa{Hash: "cccc"}, false)
+}
+
+// TestRevocationListFileFallback tests that the local revocation list is read
+// when the published list cannot be fetched, and that revocation cannot be
+// ruled out when neither can be loaded
+func TestRevocationListFileFallback(t *testing.T) {
+	dir, err := ioutil.TempDir("", "revocation")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "revoked.json")
+
+	server := newTestRevocationServer(nil)
+	defer server.Close()
+
+	now := time.Unix(1635811200, 0)
+	list := newRevocationList("https://dac.example.org", &htsconfig.IssuerRevocation{Uri: server.URL, File: path})
+	list.now = func() time.Time { return now }
+
+	_, _, err = list.IsRevoked(&Visa{Hash: "aaaa"})
+	assert.NotNil(t, err)
+
+	// failed loads are not retried on every check
+	ioutil.WriteFile(path, []byte(`{"hashes": ["aaaa"]}`), 0644)
+	_, _, err = list.IsRevoked(&Visa{Hash: "aaaa"})
+	assert.NotNil(t, err)
+
+	now = now.Add(time.Minute)
+	revoked, _, err := list.IsRevoked(&Visa{Hash: "aaaa"})
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+
+	// the published list is preferred once it can be fetched again
+	server.publish(&revocationDocument{Hashes: []string{}})
+	now = now.Add(time.Hour)
+	revoked, _, err = list.IsRevoked(&Visa{Hash: "aaaa"})
+	assert.Nil(t, err)
+	assert.False(t, revoked)
+}
+
+// TestCompactVisaDecoderRevocation tests that compact visas are rejected once
+// their issuer lists them as revoked, and that the revocation state of
+// accepted visas is recorded
+func TestCompactVisaDecoderRevocation(t *testing.T) {
+	jwks, privateKey := marshalKeySet(t, "key-1")
+	issuer := "https://revoking.example.org"
+	revokedContent := "c:10g e:1635811200 u:alice"
+	server := newTestRevocationServer(&revocationDocument{Hashes: []string{visaHash(revokedContent)}})
+	defer server.Close()
+
+	tc := []struct {
+		revocation    *htsconfig.IssuerRevocation
+		content       string
+		expRevocation string
+		expReason     RejectionReason
+	}{
+		{nil, revokedContent, RevocationNotChecked, ""},
+		{&htsconfig.IssuerRevocation{Uri: server.URL}, "c:10g e:1635811201 u:alice", RevocationNotRevoked, ""},
+		{&htsconfig.IssuerRevocation{Uri: server.URL}, revokedContent, "", RejectRevoked},
+		{&htsconfig.IssuerRevocation{File: "/nonexistent/revoked.json"}, revokedContent, "", RejectRevocationUnknown},
+	}
+
+	for _, c := range tc {
+		decoder := &CompactVisaDecoder{TrustedIssuer: func(url string) *htsconfig.TrustedIssuer {
+			return &htsconfig.TrustedIssuer{Issuer: issuer, Jwks: jwks, Algorithms: []string{EdDSAAlgorithm}, Datasets: []string{"10g"}, Revocation: c.revocation}
+		}}
+		claim := map[string]interface{}{"a": []interface{}{signCompactVisa(issuer, "key-1", privateKey, c.content)}}
+		visas, rejections := decoder.Decode(claim, "alice", visaNow, 0)
+		if c.expReason == "" {
+			if assert.Equal(t, 1, len(visas)) {
+				assert.Equal(t, c.expRevocation, visas[0].Revocation)
+				assert.Equal(t, visaHash(c.content), visas[0].Hash)
+			}
+		} else if assert.Equal(t, 1, len(rejections)) {
+			assert.Equal(t, c.expReason, rejections[0].Reason)
+			if c.expReason == RejectRevoked {
+				assert.Equal(t, []string{"10g"}, rejections[0].Visa.Datasets)
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module signature picks the signature algorithm of an issuer key from its
+// JWK, and verifies raw signatures made with EdDSA, RS256, PS256, ES256 or
+// ES384 keys
+package htspassport
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"math/big"
+
+	"golang.org/x/crypto/ed25519"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// JOSE names of the supported signature algorithms
+const (
+	RS256Algorithm = "RS256"
+	PS256Algorithm = "PS256"
+	ES256Algorithm = "ES256"
+	ES384Algorithm = "ES384"
+)
+
+// minRSAKeyBits the smallest RSA modulus accepted for signatures
+const minRSAKeyBits = 2048
+
+// KeyAlgorithm gets the algorithm an issuer key signs with. it is taken from
+// the key type and curve, and from the alg of the JWK where the key type
+// alone does not decide it. an RSA key without an alg signs with RS256
+//
+// Arguments
+//	jwk (*jose.JSONWebKey): public key of the issuer
+// Returns
+//	(string): JOSE algorithm name
+//	(error): the key is of an unsupported type, or its alg does not match it
+func KeyAlgorithm(jwk *jose.JSONWebKey) (string, error) {
+	var alg string
+	switch key := jwk.Key.(type) {
+	case ed25519.PublicKey:
+		alg = EdDSAAlgorithm
+	case *rsa.PublicKey:
+		if key.N.BitLen() < minRSAKeyBits {
+			return "", fmt.Errorf("key %s is a %d bit RSA key, shorter than %d bits", jwk.KeyID, key.N.BitLen(), minRSAKeyBits)
+		}
+		switch jwk.Algorithm {
+		case "", RS256Algorithm:
+			return RS256Algorithm, nil
+		case PS256Algorithm:
+			return PS256Algorithm, nil
+		}
+		return "", fmt.Errorf("key %s is an RSA key for unsupported algorithm %s", jwk.KeyID, jwk.Algorithm)
+	case *ecdsa.PublicKey:
+		switch key.Curve {
+		case elliptic.P256():
+			alg = ES256Algorithm
+		case elliptic.P384():
+			alg = ES384Algorithm
+		default:
+			return "", fmt.Errorf("key %s is an EC key on unsupported curve %s", jwk.KeyID, key.Curve.Params().Name)
+		}
+	default:
+		return "", fmt.Errorf("key %s is of unsupported type %T", jwk.KeyID, jwk.Key)
+	}
+
+	if jwk.Algorithm != "" && jwk.Algorithm != alg {
+		return "", fmt.Errorf("key %s signs with %s, but declares alg %s", jwk.KeyID, alg, jwk.Algorithm)
+	}
+	return alg, nil
+}
+
+// CheckKeyAlgorithm checks a token signed with an algorithm may be verified
+// with an issuer key. an RSA key without an alg may verify either RS256 or
+// PS256 signatures
+//
+// Arguments
+//	jwk (*jose.JSONWebKey): public key of the issuer
+//	alg (string): JOSE algorithm named in the token header
+// Returns
+//	(error): the key is of an unsupported type, or does not sign with the algorithm
+func CheckKeyAlgorithm(jwk *jose.JSONWebKey, alg string) error {
+	keyAlg, err := KeyAlgorithm(jwk)
+	if err != nil {
+		return err
+	}
+	if keyAlg == alg || (jwk.Algorithm == "" && keyAlg == RS256Algorithm && alg == PS256Algorithm) {
+		return nil
+	}
+	return fmt.Errorf("key %s signs with %s, not %s", jwk.KeyID, keyAlg, alg)
+}
+
+// VerifySignature verifies a raw signature over content, as made by the
+// algorithm of the issuer key. EC signatures are the JOSE concatenation of r
+// and s
+//
+// Arguments
+//	jwk (*jose.JSONWebKey): public key of the issuer
+//	alg (string): JOSE algorithm, as returned by KeyAlgorithm
+//	content ([]byte): signed content
+//	signature ([]byte): signature over the content
+// Returns
+//	(error): the signature does not verify
+func VerifySignature(jwk *jose.JSONWebKey, alg string, content []byte, signature []byte) error {
+	verified := false
+	switch alg {
+	case EdDSAAlgorithm:
+		key, _ := jwk.Key.(ed25519.PublicKey)
+		verified = key != nil && ed25519.Verify(key, content, signature)
+	case RS256Algorithm, PS256Algorithm:
+		key, _ := jwk.Key.(*rsa.PublicKey)
+		if key == nil {
+			break
+		}
+		digest := sha256.Sum256(content)
+		if alg == RS256Algorithm {
+			verified = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+		} else {
+			verified = rsa.VerifyPSS(key, crypto.SHA256, digest[:], signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash}) == nil
+		}
+	case ES256Algorithm:
+		digest := sha256.Sum256(content)
+		verified = verifyECDSA(jwk, digest[:], signature)
+	case ES384Algorithm:
+		digest := sha512.Sum384(content)
+		verified = verifyECDSA(jwk, digest[:], signature)
+	default:
+		return fmt.Errorf("algorithm %s is not supported", alg)
+	}
+	if !verified {
+		return fmt.Errorf("signature check failed with key %s", jwk.KeyID)
+	}
+	return nil
+}
+
+// verifyECDSA verifies a JOSE EC signature, the fixed width concatenation of
+// r and s, over a digest
+func verifyECDSA(jwk *jose.JSONWebKey, digest []byte, signature []byte) bool {
+	key, _ := jwk.Key.(*ecdsa.PublicKey)
+	if key == nil {
+		return false
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	if len(signature) != 2*size {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:size])
+	s := new(big.Int).SetBytes(signature[size:])
+	return ecdsa.Verify(key, digest, r, s)
+}
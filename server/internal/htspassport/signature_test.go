@@ -0,0 +1,177 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module signature_test tests module signature
+package htspassport
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// testSigningKeys private keys of each supported type, generated once as RSA
+// key generation is slow
+type testSigningKeys struct {
+	ed25519 ed25519.PrivateKey
+	rsa     *rsa.PrivateKey
+	p256    *ecdsa.PrivateKey
+	p384    *ecdsa.PrivateKey
+}
+
+// newTestSigningKeys generates a private key of each supported type
+func newTestSigningKeys(t *testing.T) *testSigningKeys {
+	keys := new(testSigningKeys)
+	var err error
+	if _, keys.ed25519, err = ed25519.GenerateKey(rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if keys.rsa, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+		t.Fatal(err)
+	}
+	if keys.p256, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if keys.p384, err = ecdsa.GenerateKey(elliptic.P384(), rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+// signRaw signs content with a private key using a JOSE algorithm, returning
+// the raw signature
+func signRaw(t *testing.T, key crypto.Signer, alg string, content []byte) []byte {
+	var signature []byte
+	var err error
+	switch alg {
+	case EdDSAAlgorithm:
+		signature = ed25519.Sign(key.(ed25519.PrivateKey), content)
+	case RS256Algorithm:
+		digest := sha256.Sum256(content)
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:])
+	case PS256Algorithm:
+		digest := sha256.Sum256(content)
+		signature, err = rsa.SignPSS(rand.Reader, key.(*rsa.PrivateKey), crypto.SHA256, digest[:], &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	case ES256Algorithm, ES384Algorithm:
+		var digest []byte
+		if alg == ES256Algorithm {
+			sum := sha256.Sum256(content)
+			digest = sum[:]
+		} else {
+			sum := sha512.Sum384(content)
+			digest = sum[:]
+		}
+		ecKey := key.(*ecdsa.PrivateKey)
+		r, s, signErr := ecdsa.Sign(rand.Reader, ecKey, digest)
+		err = signErr
+		size := (ecKey.Curve.Params().BitSize + 7) / 8
+		signature = make([]byte, 2*size)
+		if err == nil {
+			r.FillBytes(signature[:size])
+			s.FillBytes(signature[size:])
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signature
+}
+
+// TestKeyAlgorithm tests KeyAlgorithm and CheckKeyAlgorithm functions
+func TestKeyAlgorithm(t *testing.T) {
+	keys := newTestSigningKeys(t)
+	shortRSA, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p521, err := ecdsa.GenerateKey(elliptic.P521(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var tc = []struct {
+		key           interface{}
+		jwkAlg        string
+		expAlgorithm  string
+		expError      bool
+		tokenAlg      string
+		expCheckError bool
+	}{
+		{keys.ed25519.Public(), "", EdDSAAlgorithm, false, EdDSAAlgorithm, false},
+		{keys.ed25519.Public(), EdDSAAlgorithm, EdDSAAlgorithm, false, RS256Algorithm, true},
+		{keys.rsa.Public(), "", RS256Algorithm, false, RS256Algorithm, false},
+		{keys.rsa.Public(), "", RS256Algorithm, false, PS256Algorithm, false},
+		{keys.rsa.Public(), RS256Algorithm, RS256Algorithm, false, PS256Algorithm, true},
+		{keys.rsa.Public(), PS256Algorithm, PS256Algorithm, false, PS256Algorithm, false},
+		{keys.rsa.Public(), PS256Algorithm, PS256Algorithm, false, RS256Algorithm, true},
+		{keys.rsa.Public(), "RS512", "", true, "RS512", true},
+		{shortRSA.Public(), "", "", true, RS256Algorithm, true},
+		{keys.p256.Public(), "", ES256Algorithm, false, ES256Algorithm, false},
+		{keys.p256.Public(), ES256Algorithm, ES256Algorithm, false, ES384Algorithm, true},
+		{keys.p384.Public(), "", ES384Algorithm, false, ES384Algorithm, false},
+		{keys.p384.Public(), ES256Algorithm, "", true, ES256Algorithm, true},
+		{p521.Public(), "", "", true, "ES512", true},
+		{[]byte("secret"), "HS256", "", true, "HS256", true},
+	}
+
+	for _, c := range tc {
+		jwk := &jose.JSONWebKey{Key: c.key, KeyID: "key-1", Algorithm: c.jwkAlg}
+		alg, err := KeyAlgorithm(jwk)
+		if c.expError {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, c.expAlgorithm, alg)
+		}
+		err = CheckKeyAlgorithm(jwk, c.tokenAlg)
+		assert.Equal(t, c.expCheckError, err != nil)
+	}
+}
+
+// TestVerifySignature tests VerifySignature function
+func TestVerifySignature(t *testing.T) {
+	keys := newTestSigningKeys(t)
+	content := []byte("header.payload")
+
+	var tc = []struct {
+		key       crypto.Signer
+		alg       string
+		verifyAlg string
+		signed    []byte
+		verified  []byte
+		truncate  bool
+		expError  bool
+	}{
+		{keys.ed25519, EdDSAAlgorithm, EdDSAAlgorithm, content, content, false, false},
+		{keys.ed25519, EdDSAAlgorithm, EdDSAAlgorithm, content, []byte("header.tampered"), false, true},
+		{keys.rsa, RS256Algorithm, RS256Algorithm, content, content, false, false},
+		{keys.rsa, RS256Algorithm, RS256Algorithm, content, []byte("header.tampered"), false, true},
+		{keys.rsa, PS256Algorithm, PS256Algorithm, content, content, false, false},
+		{keys.rsa, PS256Algorithm, RS256Algorithm, content, content, false, true},
+		{keys.p256, ES256Algorithm, ES256Algorithm, content, content, false, false},
+		{keys.p256, ES256Algorithm, ES256Algorithm, content, []byte("header.tampered"), false, true},
+		{keys.p256, ES256Algorithm, ES256Algorithm, content, content, true, true},
+		{keys.p384, ES384Algorithm, ES384Algorithm, content, content, false, false},
+		{keys.p384, ES384Algorithm, ES256Algorithm, content, content, false, true},
+		{keys.p256, ES256Algorithm, RS256Algorithm, content, content, false, true},
+		{keys.p256, ES256Algorithm, "ES512", content, content, false, true},
+	}
+
+	for _, c := range tc {
+		signature := signRaw(t, c.key, c.alg, c.signed)
+		if c.truncate {
+			signature = signature[1:]
+		}
+		jwk := &jose.JSONWebKey{Key: c.key.Public(), KeyID: "key-1"}
+		err := VerifySignature(jwk, c.verifyAlg, c.verified, signature)
+		assert.Equal(t, c.expError, err != nil)
+	}
+}
@@ -0,0 +1,180 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module statickeys serves issuer keys from a key set configured inline or
+// read from a local file, so that passports and visas can be verified without
+// reaching the issuer, e.g. in air-gapped deployments
+package htspassport
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// KeySource gets the signing keys of a single issuer by key id
+type KeySource interface {
+	GetKey(kid string) (*jose.JSONWebKey, error)
+}
+
+// StaticKeySet holds the key set of a single issuer as configured, rather than
+// as fetched from the issuer. a key set read from a file is reloaded when the
+// file changes
+type StaticKeySet struct {
+	issuer  string
+	path    string
+	mutex   sync.Mutex
+	keys    *jose.JSONWebKeySet
+	err     error
+	modTime time.Time
+	size    int64
+}
+
+// staticKeySets process-wide static key sets, keyed by issuer and key set
+var staticKeySets = map[string]*StaticKeySet{}
+
+// staticKeySetsMutex guards staticKeySets
+var staticKeySetsMutex sync.Mutex
+
+// newInlineKeySet instantiates a static key set from a JSON web key set
+// configured inline. the key set is parsed once, and any error is returned on
+// each key lookup
+func newInlineKeySet(issuer string, jwks []byte) *StaticKeySet {
+	keySet := new(StaticKeySet)
+	keySet.issuer = issuer
+	keySet.keys, keySet.err = parseKeySet(issuer, jwks)
+	return keySet
+}
+
+// newFileKeySet instantiates a static key set read from a JSON web key set
+// file. the file is read on first use
+func newFileKeySet(issuer string, path string) *StaticKeySet {
+	keySet := new(StaticKeySet)
+	keySet.issuer = issuer
+	keySet.path = path
+	return keySet
+}
+
+// GetKeySource gets the process-wide source of an issuer's signing keys. a key
+// set file takes precedence over an inline key set, and both over fetching the
+// key set from jwksUri or via OIDC discovery
+//
+// Arguments
+//	issuer (string): issuer url
+//	jwksUri (string): location of the issuer's key set, empty to discover it
+//	jwks ([]byte): JSON web key set configured inline, empty if none was
+//	jwksFile (string): path of a JSON web key set file, empty if none was configured
+// Returns
+//	(KeySource): source of the issuer's keys
+func GetKeySource(issuer string, jwksUri string, jwks []byte, jwksFile string) KeySource {
+	if jwksFile == "" && len(jwks) == 0 {
+		return GetKeyManager(issuer, jwksUri)
+	}
+
+	staticKeySetsMutex.Lock()
+	defer staticKeySetsMutex.Unlock()
+
+	cacheKey := issuer + " file " + jwksFile
+	if jwksFile == "" {
+		cacheKey = issuer + " inline " + string(jwks)
+	}
+	keySet, ok := staticKeySets[cacheKey]
+	if !ok {
+		if jwksFile != "" {
+			keySet = newFileKeySet(issuer, jwksFile)
+		} else {
+			keySet = newInlineKeySet(issuer, jwks)
+		}
+		staticKeySets[cacheKey] = keySet
+	}
+	return keySet
+}
+
+// GetKey gets the issuer's signing key with the given key id. a key set file is
+// reloaded if it has changed since it was last read. once the file is removed
+// or no longer holds a valid key set, its keys are dropped, so no key is found
+// until it is fixed. only if the file cannot be read for another reason, which
+// may pass, do the keys last loaded from it continue to be used
+//
+//	Type: StaticKeySet
+// Arguments
+//	kid (string): key id
+// Returns
+//	(*jose.JSONWebKey): public key with the key id
+//	(error): the key set could not be loaded, or has no key with the key id
+func (keySet *StaticKeySet) GetKey(kid string) (*jose.JSONWebKey, error) {
+	keySet.mutex.Lock()
+	defer keySet.mutex.Unlock()
+
+	if keySet.path != "" {
+		err := keySet.reload()
+		if err != nil {
+			if keySet.keys == nil {
+				return nil, err
+			}
+			log.Warn("Continuing with previously loaded keys for issuer %s: %v", keySet.issuer, err)
+		}
+	} else if keySet.err != nil {
+		return nil, keySet.err
+	}
+
+	keys := keySet.keys.Key(kid)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("key %s was not found in the configured key set of issuer %s", kid, keySet.issuer)
+	}
+	return &keys[0], nil
+}
+
+// reload reads the key set file if it has changed since it was last loaded,
+// dropping the keys last loaded if the file has been removed or is not valid
+func (keySet *StaticKeySet) reload() error {
+	info, err := os.Stat(keySet.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			keySet.keys = nil
+		}
+		return fmt.Errorf("reading key set file of issuer %s: %v", keySet.issuer, err)
+	}
+	if keySet.keys != nil && info.ModTime().Equal(keySet.modTime) && info.Size() == keySet.size {
+		return nil
+	}
+
+	body, err := ioutil.ReadFile(keySet.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			keySet.keys = nil
+		}
+		return fmt.Errorf("reading key set file of issuer %s: %v", keySet.issuer, err)
+	}
+	keys, err := parseKeySet(keySet.issuer, body)
+	if err != nil {
+		keySet.keys = nil
+		return err
+	}
+
+	log.Debug("Loaded %d keys for issuer %s from %s", len(keys.Keys), keySet.issuer, keySet.path)
+	keySet.keys = keys
+	keySet.modTime = info.ModTime()
+	keySet.size = info.Size()
+	return nil
+}
+
+// parseKeySet parses a configured JSON web key set. private keys are refused,
+// as they have no place in the configuration of a verifier
+func parseKeySet(issuer string, jwks []byte) (*jose.JSONWebKeySet, error) {
+	keys := new(jose.JSONWebKeySet)
+	if err := json.Unmarshal(jwks, keys); err != nil {
+		return nil, fmt.Errorf("parsing key set of issuer %s: %v", issuer, err)
+	}
+	for _, key := range keys.Keys {
+		if !key.IsPublic() {
+			return nil, fmt.Errorf("key set of issuer %s holds private key %s", issuer, key.KeyID)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,186 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module statickeys_test tests module statickeys
+package htspassport
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ed25519"
+	jose "gopkg.in/square/go-jose.v2"
+)
+
+// marshalKeySet encodes a key set holding a single newly generated ed25519
+// public key, returning the private key for signing test visas
+func marshalKeySet(t *testing.T, kid string) ([]byte, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: publicKey, KeyID: kid, Algorithm: EdDSAAlgorithm, Use: "sig"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return jwks, privateKey
+}
+
+// TestInlineKeySet tests StaticKeySet GetKey function with inline key sets
+func TestInlineKeySet(t *testing.T) {
+	jwks, _ := marshalKeySet(t, "key-1")
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	privateJwks, _ := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{Key: privateKey, KeyID: "key-1"}}})
+
+	var tc = []struct {
+		jwks     []byte
+		kid      string
+		expError bool
+	}{
+		{jwks, "key-1", false},
+		{jwks, "key-2", true},
+		{[]byte(`{"keys": [{"kty": "OKP"}]}`), "key-1", true},
+		{[]byte(`not json`), "key-1", true},
+		{privateJwks, "key-1", true},
+	}
+
+	for _, c := range tc {
+		key, err := newInlineKeySet("https://dac.example.org", c.jwks).GetKey(c.kid)
+		if c.expError {
+			assert.NotNil(t, err)
+		} else {
+			assert.Nil(t, err)
+			assert.Equal(t, c.kid, key.KeyID)
+		}
+	}
+}
+
+// TestFileKeySetReload tests that a key set file is reloaded when it changes,
+// and that the keys last loaded are dropped once the changed file is not valid,
+// but kept while it cannot be read
+func TestFileKeySetReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+
+	keySet := newFileKeySet("https://dac.example.org", path)
+	_, err = keySet.GetKey("key-1")
+	assert.NotNil(t, err)
+
+	modTime := time.Now().Add(-time.Hour)
+	write := func(body []byte) {
+		if err := ioutil.WriteFile(path, body, 0644); err != nil {
+			t.Fatal(err)
+		}
+		// advance the modification time, as successive writes may fall
+		// within the resolution of the file system's timestamps
+		modTime = modTime.Add(time.Minute)
+		os.Chtimes(path, modTime, modTime)
+	}
+
+	jwks, _ := marshalKeySet(t, "key-1")
+	write(jwks)
+	key, err := keySet.GetKey("key-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "key-1", key.KeyID)
+
+	jwks, _ = marshalKeySet(t, "key-2")
+	write(jwks)
+	_, err = keySet.GetKey("key-1")
+	assert.NotNil(t, err)
+	key, err = keySet.GetKey("key-2")
+	assert.Nil(t, err)
+	assert.Equal(t, "key-2", key.KeyID)
+
+	write([]byte(`{"keys": [`))
+	_, err = keySet.GetKey("key-2")
+	assert.NotNil(t, err)
+
+	write(jwks)
+	key, err = keySet.GetKey("key-2")
+	assert.Nil(t, err)
+	assert.Equal(t, "key-2", key.KeyID)
+
+	// a path that cannot be read as a file, standing in for a read error that may pass
+	os.Remove(path)
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	key, err = keySet.GetKey("key-2")
+	assert.Nil(t, err)
+	assert.Equal(t, "key-2", key.KeyID)
+	os.Remove(path)
+}
+
+// TestFileKeySetRemoved tests that the keys of a key set file are dropped once
+// the file is removed, so that visas signed with them are no longer verified
+func TestFileKeySetRemoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jwks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "jwks.json")
+
+	jwks, _ := marshalKeySet(t, "key-1")
+	if err := ioutil.WriteFile(path, jwks, 0644); err != nil {
+		t.Fatal(err)
+	}
+	keySet := newFileKeySet("https://dac.example.org", path)
+	key, err := keySet.GetKey("key-1")
+	assert.Nil(t, err)
+	assert.Equal(t, "key-1", key.KeyID)
+
+	os.Remove(path)
+	_, err = keySet.GetKey("key-1")
+	assert.NotNil(t, err)
+	assert.Nil(t, keySet.keys)
+}
+
+// TestGetKeySource tests that the configured key set is preferred over
+// fetching keys, and that key sources are shared per issuer
+func TestGetKeySource(t *testing.T) {
+	jwks, _ := marshalKeySet(t, "key-1")
+
+	fetched := GetKeySource("https://dac.example.org", "", nil, "")
+	_, ok := fetched.(*KeyManager)
+	assert.True(t, ok)
+
+	inline := GetKeySource("https://dac.example.org", "", jwks, "")
+	_, ok = inline.(*StaticKeySet)
+	assert.True(t, ok)
+	assert.True(t, inline == GetKeySource("https://dac.example.org", "https://dac.example.org/keys", jwks, ""))
+
+	file := GetKeySource("https://dac.example.org", "", jwks, "/etc/htsget/jwks.json")
+	assert.Equal(t, "/etc/htsget/jwks.json", file.(*StaticKeySet).path)
+	assert.False(t, inline == file)
+}
+
+// TestCompactVisaDecoderStaticKeys tests that compact visas are verified with
+// a configured key set, without contacting the issuer
+func TestCompactVisaDecoderStaticKeys(t *testing.T) {
+	jwks, privateKey := marshalKeySet(t, "key-1")
+	issuer := "https://offline.example.org"
+	decoder := &CompactVisaDecoder{TrustedIssuer: func(url string) *htsconfig.TrustedIssuer {
+		return &htsconfig.TrustedIssuer{Issuer: issuer, Jwks: jwks, Algorithms: []string{EdDSAAlgorithm}, Datasets: []string{"10g"}}
+	}}
+
+	claim := map[string]interface{}{"a": []interface{}{
+		signCompactVisa(issuer, "key-1", privateKey, "c:10g e:1635811200 u:alice"),
+		signCompactVisa(issuer, "key-2", privateKey, "c:10g e:1635811200 u:alice"),
+	}}
+	visas, rejections := decoder.Decode(claim, "alice", visaNow, 0)
+	assert.Equal(t, 1, len(visas))
+	assert.Equal(t, issuer, visas[0].Issuer)
+	assert.Equal(t, 1, len(rejections))
+	assert.Equal(t, RejectUnknownKey, rejections[0].Reason)
+}
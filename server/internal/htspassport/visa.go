@@ -0,0 +1,188 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module visa decodes the visas carried in a passport, whichever format they
+// were issued in, into a common verified form
+package htspassport
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+)
+
+// RejectionReason identifies why a visa was not accepted
+type RejectionReason string
+
+// reasons a visa can be rejected
+const (
+	RejectMalformedVisa      RejectionReason = "malformed-visa"
+	RejectMalformedClaim     RejectionReason = "malformed-claim"
+	RejectUntrustedIssuer    RejectionReason = "untrusted-issuer"
+	RejectAlgorithmForbidden RejectionReason = "algorithm-forbidden"
+	RejectUntrustedKeySet    RejectionReason = "untrusted-key-set"
+	RejectUnknownKey         RejectionReason = "unknown-key"
+	RejectUnsupportedKey     RejectionReason = "unsupported-key"
+	RejectBadSignature       RejectionReason = "bad-signature"
+	RejectUnsupportedType    RejectionReason = "unsupported-visa-type"
+	RejectMissingExpiry      RejectionReason = "missing-expiry"
+	RejectExpired            RejectionReason = "expired"
+	RejectNotYetValid        RejectionReason = "not-yet-valid"
+	RejectIssuedInFuture     RejectionReason = "issued-in-future"
+	RejectMissingSubject     RejectionReason = "missing-subject"
+	RejectSubjectMismatch    RejectionReason = "subject-mismatch"
+	RejectRevoked            RejectionReason = "revoked"
+	RejectRevocationUnknown  RejectionReason = "revocation-unknown"
+)
+
+// VisaRejection is the error returned when a visa is not accepted, carrying
+// the reason so that each rejection can be logged distinctly
+//
+// Attributes
+//	Issuer (string): issuer of the rejected visa, if it could be determined
+//	Reason (RejectionReason): why the visa was rejected
+//	Detail (string): human readable description of the rejection
+//	Visa (*Visa): the rejected visa, if it was verified before being rejected, e.g. as revoked
+type VisaRejection struct {
+	Issuer string
+	Reason RejectionReason
+	Detail string
+	Visa   *Visa
+}
+
+func (rejection *VisaRejection) Error() string {
+	return fmt.Sprintf("visa rejected (%s): %s", rejection.Reason, rejection.Detail)
+}
+
+func newVisaRejection(reason RejectionReason, format string, a ...interface{}) *VisaRejection {
+	return &VisaRejection{Reason: reason, Detail: fmt.Sprintf(format, a...)}
+}
+
+func newIssuerRejection(issuer string, reason RejectionReason, format string, a ...interface{}) *VisaRejection {
+	rejection := newVisaRejection(reason, format, a...)
+	rejection.Issuer = issuer
+	return rejection
+}
+
+// Visa is a visa whose signature has been verified, independent of the format
+// it was carried in
+//
+// Attributes
+//	Issuer (string): issuer of the visa
+//	Subject (string): subject the visa was issued to
+//	Datasets ([]string): dataset ids the visa grants access to
+//	ExpiresAt (time.Time): time after which the visa is no longer valid
+//	IssuedAt (time.Time): time the visa was issued, zero if not known
+//	NotBefore (time.Time): time before which the visa is not valid, zero if not known
+//	Hash (string): hex encoded SHA-256 hash of the visa, as listed on revocation lists
+//	ID (string): identifier of the visa (jti), empty if not known
+//	Revocation (string): revocation state of the visa, one of the Revocation values
+//	RevocationListAt (time.Time): time the revocation list the visa was checked against was
+//	loaded, zero if it was not checked
+type Visa struct {
+	Issuer           string
+	Subject          string
+	Datasets         []string
+	ExpiresAt        time.Time
+	IssuedAt         time.Time
+	NotBefore        time.Time
+	Hash             string
+	ID               string
+	Revocation       string
+	RevocationListAt time.Time
+}
+
+// Validate checks the visa is currently valid, and that it was issued to the
+// subject of the passport carrying it
+//
+//	Type: Visa
+// Arguments
+//	passportSubject (string): sub claim of the passport carrying the visa
+//	now (time.Time): current time
+//	leeway (time.Duration): clock skew tolerated between this server and the issuer
+// Returns
+//	(error): a VisaRejection if the visa must not be used
+func (visa *Visa) Validate(passportSubject string, now time.Time, leeway time.Duration) error {
+	var rejection *VisaRejection
+	switch {
+	case visa.ExpiresAt.IsZero():
+		rejection = newVisaRejection(RejectMissingExpiry, "visa has no expiry")
+	case !now.Add(-leeway).Before(visa.ExpiresAt):
+		rejection = newVisaRejection(RejectExpired, "visa expired at %s", visa.ExpiresAt.Format(time.RFC3339))
+	case !visa.NotBefore.IsZero() && now.Add(leeway).Before(visa.NotBefore):
+		rejection = newVisaRejection(RejectNotYetValid, "visa is not valid before %s", visa.NotBefore.Format(time.RFC3339))
+	case !visa.IssuedAt.IsZero() && now.Add(leeway).Before(visa.IssuedAt):
+		rejection = newVisaRejection(RejectIssuedInFuture, "visa issued in the future at %s", visa.IssuedAt.Format(time.RFC3339))
+	case visa.Subject == "":
+		rejection = newVisaRejection(RejectMissingSubject, "visa has no subject")
+	case visa.Subject != passportSubject:
+		rejection = newVisaRejection(RejectSubjectMismatch, "visa subject %s does not match passport subject %s", visa.Subject, passportSubject)
+	default:
+		return nil
+	}
+	rejection.Issuer = visa.Issuer
+	return rejection
+}
+
+// GrantsDataset checks if the visa grants access to a dataset
+//
+//	Type: Visa
+// Arguments
+//	datasetID (string): requested dataset id
+// Returns
+//	(bool): if true, the visa carries a grant for the dataset
+func (visa *Visa) GrantsDataset(datasetID string) bool {
+	for _, dataset := range visa.Datasets {
+		if dataset == datasetID {
+			return true
+		}
+	}
+	return false
+}
+
+// TrustedIssuerLookup gets the trusted issuer configuration for an issuer url,
+// or nil if the issuer is not trusted
+type TrustedIssuerLookup func(issuer string) *htsconfig.TrustedIssuer
+
+// VisaDecoder verifies and decodes the visas of a single format
+type VisaDecoder interface {
+	// PassportClaim gets the name of the passport claim holding the visas
+	PassportClaim() string
+	// Decode verifies the visas held in the passport claim, returning the
+	// visas that are valid for the passport subject and a rejection for each
+	// visa that is not
+	Decode(claim interface{}, passportSubject string, now time.Time, leeway time.Duration) ([]*Visa, []*VisaRejection)
+}
+
+// visaDecoders the decoders for each visa format the server understands
+var visaDecoders = []VisaDecoder{
+	&CompactVisaDecoder{TrustedIssuer: htsconfig.GetTrustedIssuer},
+	&JWTVisaDecoder{TrustedIssuer: htsconfig.GetTrustedIssuer},
+}
+
+// DecodeVisas verifies and decodes the visas of every understood format
+// carried in a passport
+//
+// Arguments
+//	passportClaims (map[string]interface{}): claims of the verified passport
+//	now (time.Time): current time
+//	leeway (time.Duration): clock skew tolerated between this server and visa issuers
+// Returns
+//	([]*Visa): visas that are valid for the passport subject
+//	([]*VisaRejection): the reason each remaining visa was rejected
+func DecodeVisas(passportClaims map[string]interface{}, now time.Time, leeway time.Duration) ([]*Visa, []*VisaRejection) {
+	passportSubject, _ := passportClaims["sub"].(string)
+
+	visas := make([]*Visa, 0)
+	rejections := make([]*VisaRejection, 0)
+	for _, decoder := range visaDecoders {
+		claim, ok := passportClaims[decoder.PassportClaim()]
+		if !ok {
+			continue
+		}
+		decoded, rejected := decoder.Decode(claim, passportSubject, now, leeway)
+		visas = append(visas, decoded...)
+		rejections = append(rejections, rejected...)
+	}
+	return visas, rejections
+}
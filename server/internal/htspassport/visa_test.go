@@ -0,0 +1,124 @@
+// Package htspassport verifies GA4GH passports and the visas they carry
+//
+// Module visa_test tests module visa
+package htspassport
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/stretchr/testify/assert"
+)
+
+// visaNow fixed current time used to validate test visas (1635724800)
+var visaNow = time.Date(2021, 11, 1, 0, 0, 0, 0, time.UTC)
+
+// trustStandInIssuer gets a trusted issuer lookup trusting only the stand-in
+// issuer, signing with the given algorithms
+func trustStandInIssuer(issuer *standInIssuer, algorithms ...string) TrustedIssuerLookup {
+	return func(url string) *htsconfig.TrustedIssuer {
+		if url != issuer.server.URL {
+			return nil
+		}
+		return &htsconfig.TrustedIssuer{
+			Issuer:     issuer.server.URL,
+			Algorithms: algorithms,
+			Datasets:   []string{htsconfig.TrustedIssuerAnyDataset},
+		}
+	}
+}
+
+// unix gets the time at a number of seconds since the unix epoch
+func unix(seconds int64) time.Time {
+	return time.Unix(seconds, 0).UTC()
+}
+
+// visaValidateTC test cases for Visa Validate
+var visaValidateTC = []struct {
+	visa             Visa
+	passportSubject  string
+	expRejectionCode RejectionReason
+}{
+	{Visa{Subject: "alice", ExpiresAt: unix(1635811200), IssuedAt: unix(1635638400)}, "alice", ""},
+	{Visa{Subject: "alice", ExpiresAt: unix(1635811200), NotBefore: unix(1635724800)}, "alice", ""},
+	{Visa{Subject: "alice", IssuedAt: unix(1635638400)}, "alice", RejectMissingExpiry},
+	{Visa{Subject: "alice", ExpiresAt: unix(1635724800)}, "alice", RejectExpired},
+	{Visa{Subject: "alice", ExpiresAt: unix(1635638400)}, "alice", RejectExpired},
+	{Visa{Subject: "alice", ExpiresAt: unix(1635811200), NotBefore: unix(1635724801)}, "alice", RejectNotYetValid},
+	{Visa{Subject: "alice", ExpiresAt: unix(1635811200), IssuedAt: unix(1635724801)}, "alice", RejectIssuedInFuture},
+	{Visa{ExpiresAt: unix(1635811200)}, "alice", RejectMissingSubject},
+	{Visa{Subject: "bob", ExpiresAt: unix(1635811200)}, "alice", RejectSubjectMismatch},
+	{Visa{Subject: "alice", ExpiresAt: unix(1635811200)}, "", RejectSubjectMismatch},
+}
+
+// TestVisaValidate tests Visa Validate function
+func TestVisaValidate(t *testing.T) {
+	for _, tc := range visaValidateTC {
+		tc.visa.Issuer = "https://dac.example.org"
+		err := tc.visa.Validate(tc.passportSubject, visaNow, 0)
+		if tc.expRejectionCode == "" {
+			assert.Nil(t, err)
+		} else {
+			rejection := err.(*VisaRejection)
+			assert.Equal(t, tc.expRejectionCode, rejection.Reason)
+			assert.Equal(t, "https://dac.example.org", rejection.Issuer)
+		}
+	}
+}
+
+// TestVisaGrantsDataset tests Visa GrantsDataset function
+func TestVisaGrantsDataset(t *testing.T) {
+	visa := &Visa{Datasets: []string{"10g", "1kg"}}
+	assert.True(t, visa.GrantsDataset("1kg"))
+	assert.False(t, visa.GrantsDataset("10"))
+}
+
+// TestDecodeVisas tests that DecodeVisas decodes the visas of every format
+// carried in a passport
+func TestDecodeVisas(t *testing.T) {
+	issuer := newStandInIssuer(t, "key-1")
+	defer issuer.server.Close()
+
+	defaultDecoders := visaDecoders
+	defer func() { visaDecoders = defaultDecoders }()
+	trusted := trustStandInIssuer(issuer, EdDSAAlgorithm)
+	visaDecoders = []VisaDecoder{
+		&CompactVisaDecoder{TrustedIssuer: trusted},
+		&JWTVisaDecoder{TrustedIssuer: trusted},
+	}
+
+	passport := map[string]interface{}{
+		"sub": "alice",
+		CompactVisaPassportClaim: map[string]interface{}{
+			"a": []interface{}{
+				signCompactVisa(issuer.server.URL, "key-1", issuer.privateKey, "c:10g e:1635811200 u:alice"),
+				signCompactVisa(issuer.server.URL, "key-1", issuer.privateKey, "c:1kg e:1635638400 u:alice"),
+			},
+		},
+		JWTVisaPassportClaim: []interface{}{
+			signJWTVisa(t, issuer, "key-1", jwtVisaClaimsFor(issuer.server.URL, "alice", "https://dac.example.org/datasets/giab")),
+		},
+	}
+
+	visas, rejections := DecodeVisas(passport, visaNow, 0)
+	assert.Equal(t, 2, len(visas))
+	assert.Equal(t, 1, len(rejections))
+	assert.Equal(t, RejectExpired, rejections[0].Reason)
+
+	datasets := make([]string, 0)
+	for _, visa := range visas {
+		datasets = append(datasets, visa.Datasets...)
+	}
+	assert.ElementsMatch(t, []string{"10g", "giab"}, datasets)
+}
+
+// TestVisaValidateLeeway tests that Visa Validate tolerates clock skew
+func TestVisaValidateLeeway(t *testing.T) {
+	visa := &Visa{Subject: "alice", ExpiresAt: unix(1635724790), NotBefore: unix(1635724810)}
+	assert.Nil(t, visa.Validate("alice", visaNow, time.Minute))
+	assert.Equal(t, RejectExpired, visa.Validate("alice", visaNow, 5*time.Second).(*VisaRejection).Reason)
+
+	visa.ExpiresAt = unix(1635811200)
+	assert.Equal(t, RejectNotYetValid, visa.Validate("alice", visaNow, 5*time.Second).(*VisaRejection).Reason)
+}
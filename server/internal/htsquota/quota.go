@@ -0,0 +1,207 @@
+// Package htsquota limits the tickets and data each passport holder may be
+// granted for a controlled dataset within a window of time
+//
+// Module quota enforces the configured limits against the recorded usage, and
+// holds the process-wide quotas configured for the server
+package htsquota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+)
+
+// LimitRequests name of the limit on the number of tickets issued
+const LimitRequests = "requests"
+
+// LimitEgress name of the limit on the number of bytes tickets are issued for
+const LimitEgress = "egress"
+
+// Limits what a subject may be granted from a dataset within each window
+//
+// Attributes
+//	Window (time.Duration): length of the window usage is counted over. windows
+//	are aligned to fixed boundaries, e.g. midnight UTC for a 24h window
+//	MaxRequests (int): number of tickets that may be issued, 0 if unlimited
+//	MaxBytes (int64): number of bytes tickets may be issued for, 0 if unlimited
+type Limits struct {
+	Window      time.Duration
+	MaxRequests int
+	MaxBytes    int64
+}
+
+// ExceededError a ticket was refused because it would exceed a limit
+//
+// Attributes
+//	Subject (string): passport subject
+//	Dataset (string): dataset id
+//	Limit (string): limit that would be exceeded, one of requests or egress
+//	ResetAt (time.Time): time the window ends and usage is reset
+type ExceededError struct {
+	Subject string
+	Dataset string
+	Limit   string
+	ResetAt time.Time
+}
+
+// Error describes the limit that would be exceeded
+func (err *ExceededError) Error() string {
+	return fmt.Sprintf("The %s quota of %s for dataset %s has been used up until %s", err.Limit, err.Subject, err.Dataset, err.ResetAt.Format(time.RFC3339))
+}
+
+// Quotas enforces limits on what each subject is granted from each dataset
+type Quotas struct {
+	store  *Store
+	limits Limits
+	now    func() time.Time
+}
+
+// NewQuotas instantiates quotas enforcing limits against the usage in a store
+//
+// Arguments
+//	store (*Store): store usage is recorded in
+//	limits (Limits): limits enforced
+// Returns
+//	(*Quotas): quotas
+func NewQuotas(store *Store, limits Limits) *Quotas {
+	quotas := new(Quotas)
+	quotas.store = store
+	quotas.limits = limits
+	quotas.now = time.Now
+	return quotas
+}
+
+// current resets usage recorded in an earlier window, returning the end of the
+// current window
+func (quotas *Quotas) current(usage *Usage) time.Time {
+	windowStart := quotas.now().UTC().Truncate(quotas.limits.Window)
+	if !usage.WindowStart.Equal(windowStart) {
+		*usage = Usage{WindowStart: windowStart}
+	}
+	return windowStart.Add(quotas.limits.Window)
+}
+
+// Check checks a subject has not already used up a quota for a dataset, so
+// that a ticket may be considered. this is not a guarantee that the ticket
+// will be granted, as its size is not yet known
+//
+//	Type: Quotas
+// Arguments
+//	subject (string): passport subject
+//	dataset (string): dataset id
+// Returns
+//	(error): an *ExceededError if a quota is used up, or the store could not be read
+func (quotas *Quotas) Check(subject string, dataset string) error {
+	usage, err := quotas.store.Get(subject, dataset)
+	if err != nil {
+		return err
+	}
+	resetAt := quotas.current(usage)
+	if quotas.limits.MaxRequests > 0 && usage.Requests >= quotas.limits.MaxRequests {
+		return &ExceededError{Subject: subject, Dataset: dataset, Limit: LimitRequests, ResetAt: resetAt}
+	}
+	if quotas.limits.MaxBytes > 0 && usage.Bytes >= quotas.limits.MaxBytes {
+		return &ExceededError{Subject: subject, Dataset: dataset, Limit: LimitEgress, ResetAt: resetAt}
+	}
+	return nil
+}
+
+// LimitsEgress checks if the quotas limit the number of bytes tickets may be
+// issued for, so that the size of every ticket must be known
+//
+//	Type: Quotas
+// Returns
+//	(bool): true if there is a limit on the bytes of tickets
+func (quotas *Quotas) LimitsEgress() bool {
+	return quotas.limits.MaxBytes > 0
+}
+
+// Consume records a ticket issued to a subject for a dataset, unless it would
+// exceed a quota, in which case nothing is recorded
+//
+//	Type: Quotas
+// Arguments
+//	subject (string): passport subject
+//	dataset (string): dataset id
+//	bytes (int64): estimated number of bytes the ticket is issued for
+// Returns
+//	(*Usage): usage including the ticket
+//	(error): an *ExceededError if a quota would be exceeded, or the store could not be updated
+func (quotas *Quotas) Consume(subject string, dataset string, bytes int64) (*Usage, error) {
+	return quotas.store.Update(subject, dataset, func(usage *Usage) error {
+		resetAt := quotas.current(usage)
+		if quotas.limits.MaxRequests > 0 && usage.Requests+1 > quotas.limits.MaxRequests {
+			return &ExceededError{Subject: subject, Dataset: dataset, Limit: LimitRequests, ResetAt: resetAt}
+		}
+		if quotas.limits.MaxBytes > 0 && usage.Bytes+bytes > quotas.limits.MaxBytes {
+			return &ExceededError{Subject: subject, Dataset: dataset, Limit: LimitEgress, ResetAt: resetAt}
+		}
+		usage.Requests++
+		usage.Bytes += bytes
+		return nil
+	})
+}
+
+// quotas process-wide quotas, created from the configuration on first use. nil
+// if quotas are not configured
+var quotas *Quotas
+
+// quotasLoaded if true, quotas have been created from the configuration
+var quotasLoaded bool
+
+// quotasMutex guards quotas
+var quotasMutex sync.Mutex
+
+// newConfiguredQuotas creates quotas enforcing the configured limits against
+// the usage store named in the configuration
+func newConfiguredQuotas() (*Quotas, error) {
+	path := htsconfig.GetQuotaFile()
+	if path == "" {
+		return nil, nil
+	}
+	store, err := OpenStore(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open the quota store %s: %v", path, err)
+	}
+	return NewQuotas(store, Limits{
+		Window:      htsconfig.GetQuotaWindow(),
+		MaxRequests: htsconfig.GetQuotaMaxRequests(),
+		MaxBytes:    htsconfig.GetQuotaMaxEgress(),
+	}), nil
+}
+
+// GetQuotas gets the process-wide quotas, creating them from the
+// configuration on first use. if the configured store cannot be opened, it is
+// tried again on the next call
+//
+// Returns
+//	(*Quotas): process-wide quotas, nil if quotas are not configured
+//	(error): the configured store could not be opened, so quotas cannot be enforced
+func GetQuotas() (*Quotas, error) {
+	quotasMutex.Lock()
+	defer quotasMutex.Unlock()
+
+	if !quotasLoaded {
+		configured, err := newConfiguredQuotas()
+		if err != nil {
+			log.Error("%v", err)
+			return nil, err
+		}
+		quotas = configured
+		quotasLoaded = true
+	}
+	return quotas, nil
+}
+
+// SetQuotas replaces the process-wide quotas. if nil, the next call to
+// GetQuotas creates them again from the configuration
+func SetQuotas(newQuotas *Quotas) {
+	quotasMutex.Lock()
+	defer quotasMutex.Unlock()
+
+	quotas = newQuotas
+	quotasLoaded = newQuotas != nil
+}
@@ -0,0 +1,87 @@
+// Package htsquota limits the tickets and data each passport holder may be
+// granted for a controlled dataset within a window of time
+//
+// Module quota_test tests module quota
+package htsquota
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestQuotasConsume tests that tickets are refused once they would exceed a
+// limit, and granted again once the window is reset
+func TestQuotasConsume(t *testing.T) {
+	store, _, cleanup := openTestStore(t)
+	defer cleanup()
+	defer store.Close()
+
+	current := time.Date(2021, 11, 1, 10, 0, 0, 0, time.UTC)
+	quotas := NewQuotas(store, Limits{Window: 24 * time.Hour, MaxRequests: 2, MaxBytes: 1000})
+	quotas.now = func() time.Time { return current }
+	resetAt := time.Date(2021, 11, 2, 0, 0, 0, 0, time.UTC)
+
+	var tc = []struct {
+		advance     time.Duration
+		subject     string
+		bytes       int64
+		expLimit    string
+		expRequests int
+		expBytes    int64
+	}{
+		{0, "alice", 400, "", 1, 400},
+		{time.Hour, "alice", 700, LimitEgress, 1, 400},
+		{0, "alice", 600, "", 2, 1000},
+		{0, "bob", 0, "", 1, 0},
+		{0, "alice", 0, LimitRequests, 2, 1000},
+		{13 * time.Hour, "alice", 1000, "", 1, 1000},
+		{0, "bob", 0, "", 1, 0},
+	}
+
+	for _, c := range tc {
+		current = current.Add(c.advance)
+		_, err := quotas.Consume(c.subject, "10g", c.bytes)
+		if c.expLimit == "" {
+			assert.Nil(t, err)
+		} else {
+			exceeded, ok := err.(*ExceededError)
+			assert.True(t, ok)
+			assert.Equal(t, c.expLimit, exceeded.Limit)
+			assert.Equal(t, resetAt, exceeded.ResetAt)
+		}
+		usage, _ := store.Get(c.subject, "10g")
+		assert.Equal(t, c.expRequests, usage.Requests)
+		assert.Equal(t, c.expBytes, usage.Bytes)
+	}
+}
+
+// TestQuotasCheck tests that a used up quota is reported before a ticket is
+// considered
+func TestQuotasCheck(t *testing.T) {
+	store, _, cleanup := openTestStore(t)
+	defer cleanup()
+	defer store.Close()
+
+	current := time.Date(2021, 11, 1, 10, 0, 0, 0, time.UTC)
+	quotas := NewQuotas(store, Limits{Window: time.Hour, MaxRequests: 1, MaxBytes: 1000})
+	quotas.now = func() time.Time { return current }
+
+	assert.Nil(t, quotas.Check("alice", "10g"))
+	quotas.Consume("alice", "10g", 10)
+	err := quotas.Check("alice", "10g")
+	assert.Equal(t, LimitRequests, err.(*ExceededError).Limit)
+	assert.Equal(t, time.Date(2021, 11, 1, 11, 0, 0, 0, time.UTC), err.(*ExceededError).ResetAt)
+	assert.Nil(t, quotas.Check("alice", "giab"))
+
+	current = current.Add(time.Hour)
+	assert.Nil(t, quotas.Check("alice", "10g"))
+
+	unlimited := NewQuotas(store, Limits{Window: time.Hour})
+	for i := 0; i < 5; i++ {
+		_, err := unlimited.Consume("bob", "10g", 1000000)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, unlimited.Check("bob", "10g"))
+}
@@ -0,0 +1,131 @@
+// Package htsquota limits the tickets and data each passport holder may be
+// granted for a controlled dataset within a window of time
+//
+// Module store keeps the usage of each subject and dataset in an embedded
+// database, so that usage survives restarts of the server
+package htsquota
+
+import (
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// usageBucket bucket holding the usage of each subject and dataset
+var usageBucket = []byte("usage")
+
+// storeOpenTimeout how long to wait for another process to release the store
+var storeOpenTimeout = 5 * time.Second
+
+// Usage what a subject has been granted from a dataset within a window
+//
+// Attributes
+//	WindowStart (time.Time): start of the window the usage was counted in
+//	Requests (int): number of tickets issued
+//	Bytes (int64): estimated number of bytes the tickets were issued for
+type Usage struct {
+	WindowStart time.Time `json:"windowStart"`
+	Requests    int       `json:"requests"`
+	Bytes       int64     `json:"bytes"`
+}
+
+// Store persists the usage of each subject and dataset
+type Store struct {
+	db *bolt.DB
+}
+
+// OpenStore opens the usage store at a path, creating it if it does not
+// exist. the store is locked for as long as it is open
+//
+// Arguments
+//	path (string): path of the store file
+// Returns
+//	(*Store): open usage store
+//	(error): the store could not be opened or created
+func OpenStore(path string) (*Store, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: storeOpenTimeout})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(usageBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &Store{db: db}, nil
+}
+
+// Close closes the usage store, releasing its lock
+func (store *Store) Close() error {
+	return store.db.Close()
+}
+
+// usageKey the store key of the usage of a subject and dataset. subjects are
+// urls or opaque ids, so cannot contain a NUL
+func usageKey(subject string, dataset string) []byte {
+	return []byte(subject + "\x00" + dataset)
+}
+
+// Get gets the usage of a subject and dataset, as last updated
+//
+//	Type: Store
+// Arguments
+//	subject (string): passport subject
+//	dataset (string): dataset id
+// Returns
+//	(*Usage): recorded usage, empty if none has been recorded
+//	(error): the store could not be read
+func (store *Store) Get(subject string, dataset string) (*Usage, error) {
+	usage := new(Usage)
+	err := store.db.View(func(tx *bolt.Tx) error {
+		value := tx.Bucket(usageBucket).Get(usageKey(subject, dataset))
+		if value == nil {
+			return nil
+		}
+		return json.Unmarshal(value, usage)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// Update atomically changes the usage of a subject and dataset. the usage is
+// only written if update succeeds
+//
+//	Type: Store
+// Arguments
+//	subject (string): passport subject
+//	dataset (string): dataset id
+//	update (func(*Usage) error): changes the recorded usage in place
+// Returns
+//	(*Usage): usage as written
+//	(error): the error returned by update, or the store could not be updated
+func (store *Store) Update(subject string, dataset string, update func(usage *Usage) error) (*Usage, error) {
+	usage := new(Usage)
+	err := store.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(usageBucket)
+		key := usageKey(subject, dataset)
+		if value := bucket.Get(key); value != nil {
+			if err := json.Unmarshal(value, usage); err != nil {
+				return err
+			}
+		}
+		if err := update(usage); err != nil {
+			return err
+		}
+		value, err := json.Marshal(usage)
+		if err != nil {
+			return err
+		}
+		return bucket.Put(key, value)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
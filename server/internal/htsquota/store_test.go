@@ -0,0 +1,83 @@
+// Package htsquota limits the tickets and data each passport holder may be
+// granted for a controlled dataset within a window of time
+//
+// Module store_test tests module store
+package htsquota
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// openTestStore opens a usage store in a new temporary directory, returning
+// the path of the store and a function removing the directory
+func openTestStore(t *testing.T) (*Store, string, func()) {
+	dir, err := ioutil.TempDir("", "quotas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "quotas.db")
+	store, err := OpenStore(path)
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+	return store, path, func() { os.RemoveAll(dir) }
+}
+
+// TestStoreUpdate tests that usage is kept per subject and dataset, survives
+// the store being reopened, and is not written if the update fails
+func TestStoreUpdate(t *testing.T) {
+	store, path, cleanup := openTestStore(t)
+	defer cleanup()
+
+	increment := func(usage *Usage) error {
+		usage.Requests++
+		usage.Bytes += 100
+		return nil
+	}
+	store.Update("alice", "10g", increment)
+	usage, err := store.Update("alice", "10g", increment)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, usage.Requests)
+	assert.Equal(t, int64(200), usage.Bytes)
+	store.Update("alice", "giab", increment)
+	store.Update("bob", "10g", increment)
+
+	_, err = store.Update("alice", "10g", func(usage *Usage) error {
+		usage.Requests = 100
+		return errors.New("refused")
+	})
+	assert.NotNil(t, err)
+	store.Close()
+
+	store, err = OpenStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	var tc = []struct {
+		subject     string
+		dataset     string
+		expRequests int
+		expBytes    int64
+	}{
+		{"alice", "10g", 2, 200},
+		{"alice", "giab", 1, 100},
+		{"bob", "10g", 1, 100},
+		{"bob", "giab", 0, 0},
+	}
+
+	for _, c := range tc {
+		usage, err := store.Get(c.subject, c.dataset)
+		assert.Nil(t, err)
+		assert.Equal(t, c.expRequests, usage.Requests)
+		assert.Equal(t, c.expBytes, usage.Bytes)
+	}
+}
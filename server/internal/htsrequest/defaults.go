@@ -16,6 +16,7 @@ var defaultFields = []string{"ALL"}
 var defaultTags = []string{"ALL"}
 var defaultNoTags = []string{"NONE"}
 var defaultRegions = []*Region{}
+var defaultPurpose = ""
 var defaultHtsgetBlockClass = ""
 var defaultHtsgetCurrentBlock = "0"
 var defaultHtsgetTotalBlocks = "1"
@@ -31,6 +31,8 @@ type HtsgetRequest struct {
 	tags               []string
 	noTags             []string
 	regions            []*Region
+	purpose            string
+	purposeHeader      string
 	htsgetBlockClass   string
 	htsgetCurrentBlock string
 	htsgetTotalBlocks  string
@@ -75,6 +77,25 @@ func (r *HtsgetRequest) GetDataset() string {
 	return r.dataset
 }
 
+// SetPurpose sets the purpose declared in the query string
+func (r *HtsgetRequest) SetPurpose(purpose string) {
+	r.purpose = purpose
+}
+
+// SetPurposeHeader sets the purpose declared in the request header
+func (r *HtsgetRequest) SetPurposeHeader(purpose string) {
+	r.purposeHeader = purpose
+}
+
+// GetPurpose retrieves the purpose declared for accessing the dataset, from
+// the query string or else the request header
+func (r *HtsgetRequest) GetPurpose() string {
+	if r.purpose != "" {
+		return r.purpose
+	}
+	return r.purposeHeader
+}
+
 // SetFormat sets the requested file format
 func (r *HtsgetRequest) SetFormat(format string) {
 	r.format = format
@@ -366,6 +387,10 @@ func (r *HtsgetRequest) ConstructDataEndpointURL(useRegion bool, regionI int) (s
 		nt := strings.Join(r.GetNoTags(), ",")
 		query.Set("notags", nt)
 	}
+	// the data endpoint streams BAM unless told the object is CRAM
+	if r.GetFormat() == htsconstants.FormatCram {
+		query.Set("format", r.GetFormat())
+	}
 	dataEndpoint.RawQuery = query.Encode()
 	return dataEndpoint.String(), nil
 }
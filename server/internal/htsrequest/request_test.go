@@ -138,6 +138,16 @@ var requestNoTagsTC = []struct {
 	{[]string{"NM", "NZ", "MD", "QL"}},
 }
 
+// requestPurposeTC test cases for Set/Get Purpose
+var requestPurposeTC = []struct {
+	purpose, purposeHeader, exp string
+}{
+	{"", "", ""},
+	{"HMB", "", "HMB"},
+	{"", "POA", "POA"},
+	{"HMB", "POA", "HMB"},
+}
+
 // requestHeaderOnlyRequestedTC test cases for HeaderOnlyRequested
 var requestHeaderOnlyRequestedTC = []struct {
 	class string
@@ -487,6 +497,16 @@ func TestRequestNoTags(t *testing.T) {
 	}
 }
 
+// TestRequestPurpose tests Set/Get Purpose functions
+func TestRequestPurpose(t *testing.T) {
+	for _, tc := range requestPurposeTC {
+		r := NewHtsgetRequest()
+		r.SetPurpose(tc.purpose)
+		r.SetPurposeHeader(tc.purposeHeader)
+		assert.Equal(t, tc.exp, r.GetPurpose())
+	}
+}
+
 // TestRequestHeaderOnlyRequested tests HeaderOnlyRequested function
 func TestRequestHeaderOnlyRequested(t *testing.T) {
 	for _, tc := range requestHeaderOnlyRequestedTC {
@@ -639,3 +659,24 @@ func TestRequestGetServiceInfo(t *testing.T) {
 		assert.Equal(t, tc.expDatatype, si.HtsgetExtension.Datatype)
 	}
 }
+
+// TestRequestConstructDataEndpointURLFormat tests that the data endpoint is
+// only told the format of CRAM objects, as it streams BAM by default
+func TestRequestConstructDataEndpointURLFormat(t *testing.T) {
+	for format, exp := range map[string]string{
+		htsconstants.FormatBam:  "http://localhost:3000/reads/data/object0052",
+		htsconstants.FormatCram: "http://localhost:3000/reads/data/object0052?format=CRAM",
+	} {
+		request := NewHtsgetRequest()
+		request.SetEndpoint(htsconstants.APIEndpointReadsTicket)
+		request.SetID("object0052")
+		request.SetFormat(format)
+		request.SetFields(defaultFields)
+		request.SetTags(defaultTags)
+		request.SetNoTags(defaultNoTags)
+
+		url, err := request.ConstructDataEndpointURL(false, 0)
+		assert.Nil(t, err)
+		assert.Equal(t, exp, url)
+	}
+}
@@ -44,11 +44,11 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 		htsconstants.APIEndpointReadsTicket: []SetParameterTuple{
 			{
 				htsconstants.ParamLocPath,
-				"id",
+				"dataset",
 				"NoTransform",
-				"ValidateID",
-				"SetID",
-				defaultID,
+				"NoValidation",
+				"SetDataset",
+				"NONE",
 			},
 			{
 				htsconstants.ParamLocQuery,
@@ -115,6 +115,22 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 				"SetNoTags",
 				defaultNoTags,
 			},
+			{
+				htsconstants.ParamLocQuery,
+				"purpose",
+				"NoTransform",
+				"ValidatePurpose",
+				"SetPurpose",
+				defaultPurpose,
+			},
+			{
+				htsconstants.ParamLocHeader,
+				"Htsget-Purpose",
+				"NoTransform",
+				"ValidatePurposeHeader",
+				"SetPurposeHeader",
+				defaultPurpose,
+			},
 		},
 
 		/* **************************************************
@@ -122,14 +138,14 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 		 * ************************************************** */
 
 		htsconstants.APIEndpointReadsData: []SetParameterTuple{
-			{
-				htsconstants.ParamLocPath,
-				"id",
-				"NoTransform",
-				"ValidateID",
-				"SetID",
-				defaultID,
-			},
+	//		{
+	//			htsconstants.ParamLocPath,
+	//			"id",
+	//			"NoTransform",
+	//			"ValidateID",
+	//			"SetID",
+	//			defaultID,
+	//		},
 			{
 				htsconstants.ParamLocQuery,
 				"format",
@@ -218,6 +234,12 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 
 		htsconstants.APIEndpointReadsServiceInfo: []SetParameterTuple{},
 
+		/* **************************************************
+		 * HTTP GET READS DATASETS
+		 * ************************************************** */
+
+		htsconstants.APIEndpointReadsDatasets: []SetParameterTuple{},
+
 		/* **************************************************
 		 * HTTP GET VARIANTS TICKET
 		 * ************************************************** */
@@ -304,6 +326,22 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 				"SetNoTags",
 				defaultNoTags,
 			},
+			{
+				htsconstants.ParamLocQuery,
+				"purpose",
+				"NoTransform",
+				"ValidatePurpose",
+				"SetPurpose",
+				defaultPurpose,
+			},
+			{
+				htsconstants.ParamLocHeader,
+				"Htsget-Purpose",
+				"NoTransform",
+				"ValidatePurposeHeader",
+				"SetPurposeHeader",
+				defaultPurpose,
+			},
 		},
 
 		/* **************************************************
@@ -408,18 +446,31 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 		htsconstants.APIEndpointVariantsServiceInfo: []SetParameterTuple{},
 
 		/* **************************************************
-		 * HTTP GET FILE BYTES
+		 * HTTP GET VARIANTS DATASETS
+		 * ************************************************** */
+
+		htsconstants.APIEndpointVariantsDatasets: []SetParameterTuple{},
+
+		/* **************************************************
+		 * HTTP GET READS BYTES
 		 * ************************************************** */
 
-		htsconstants.APIEndpointFileBytes: []SetParameterTuple{
+		htsconstants.APIEndpointReadsBytes: []SetParameterTuple{
 			{
 				htsconstants.ParamLocHeader,
-				"HtsgetFilePath",
+				"Range",
 				"NoTransform",
 				"NoValidation",
-				"SetHtsgetFilePath",
-				defaultHtsgetFilePath,
+				"SetHtsgetRange",
+				defaultHtsgetRange,
 			},
+		},
+
+		/* **************************************************
+		 * HTTP GET VARIANTS BYTES
+		 * ************************************************** */
+
+		htsconstants.APIEndpointVariantsBytes: []SetParameterTuple{
 			{
 				htsconstants.ParamLocHeader,
 				"Range",
@@ -444,11 +495,11 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 		htsconstants.APIEndpointReadsTicket: []SetParameterTuple{
 			{
 				htsconstants.ParamLocPath,
-				"id",
+				"dataset",
 				"NoTransform",
-				"ValidateID",
-				"SetID",
-				defaultID,
+				"NoValidation",
+				"SetDataset",
+				"NONE",
 			},
 			{
 				htsconstants.ParamLocReqBody,
@@ -490,6 +541,22 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 				"SetRegions",
 				defaultRegions,
 			},
+			{
+				htsconstants.ParamLocQuery,
+				"purpose",
+				"NoTransform",
+				"ValidatePurpose",
+				"SetPurpose",
+				defaultPurpose,
+			},
+			{
+				htsconstants.ParamLocHeader,
+				"Htsget-Purpose",
+				"NoTransform",
+				"ValidatePurposeHeader",
+				"SetPurposeHeader",
+				defaultPurpose,
+			},
 		},
 
 		/* **************************************************
@@ -545,6 +612,22 @@ var orderedParamsMap = map[htsconstants.HTTPMethod]map[htsconstants.APIEndpoint]
 				"SetRegions",
 				defaultRegions,
 			},
+			{
+				htsconstants.ParamLocQuery,
+				"purpose",
+				"NoTransform",
+				"ValidatePurpose",
+				"SetPurpose",
+				defaultPurpose,
+			},
+			{
+				htsconstants.ParamLocHeader,
+				"Htsget-Purpose",
+				"NoTransform",
+				"ValidatePurposeHeader",
+				"SetPurposeHeader",
+				defaultPurpose,
+			},
 		},
 	},
 }
@@ -642,10 +725,11 @@ func SetAllParameters(method htsconstants.HTTPMethod, endpoint htsconstants.APIE
 	// chi seems to have changed to format of URLParam mapping from 4->5 - so this was hacked in
 	id := chi.URLParam(request, "*")
 	if id != "" {
-		valid, err := NewParamValidator().ValidateID(htsgetReq, id)
+		valid, msg := NewParamValidator().ValidateID(htsgetReq, id)
 
 		if !valid {
-			return nil, errors.New(err)
+			errorsByParam["id"](writer, &msg)
+			return nil, errors.New(msg)
 		}
 		htsgetReq.SetID(id)
 	}
@@ -18,6 +18,7 @@ import (
 	"github.com/ga4gh/htsget-refserver/internal/awsutils"
 	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htsduo"
 	"github.com/ga4gh/htsget-refserver/internal/htserror"
 	log "github.com/ga4gh/htsget-refserver/internal/htslog"
 	"github.com/ga4gh/htsget-refserver/internal/htsutils"
@@ -44,6 +45,8 @@ var errorsByParam = map[string]func(http.ResponseWriter, *string){
 	"tags":             htserror.InvalidInput,
 	"notags":           htserror.InvalidInput,
 	"regions":          htserror.InvalidRange,
+	"purpose":          htserror.InvalidInput,
+	"Htsget-Purpose":   htserror.InvalidInput,
 	"HtsgetBlockClass": htserror.InvalidInput,
 	"HtsgetBlockId":    htserror.InternalServerError,
 	"HtsgetNumBlocks":  htserror.InternalServerError,
@@ -108,13 +111,41 @@ func (v *ParamValidator) ValidateID(htsgetReq *HtsgetRequest, id string) (bool,
 	return true, ""
 }
 
+// ValidatePurpose validates the 'purpose' parameter. checks if the purpose is
+// a Data Use Ontology permission code
+func (v *ParamValidator) ValidatePurpose(htsgetReq *HtsgetRequest, purpose string) (bool, string) {
+	if _, err := htsduo.ParsePurpose(purpose); err != nil {
+		return false, err.Error()
+	}
+	return true, ""
+}
+
+// ValidatePurposeHeader validates the 'Htsget-Purpose' header. checks if the
+// purpose is a Data Use Ontology permission code, which does not contradict
+// a purpose declared in the query string
+func (v *ParamValidator) ValidatePurposeHeader(htsgetReq *HtsgetRequest, purpose string) (bool, string) {
+	if htsgetReq.purpose != "" && !strings.EqualFold(htsgetReq.purpose, purpose) {
+		return false, "purpose declared in both the query string and header, with different values"
+	}
+	return v.ValidatePurpose(htsgetReq, purpose)
+}
+
 // ValidateFormat validates the 'format' parameter. checks if the requested
-// format is one of the allowed options based on endpoint
+// format is one of the allowed options based on endpoint, and is enabled. as
+// a ticket serves the bytes of the object as they are, a ticket can only be
+// requested in the format of the object
 func (v *ParamValidator) ValidateFormat(htsgetReq *HtsgetRequest, format string) (bool, string) {
-	allowedFormats := htsgetReq.GetEndpoint().AllowedFormats()
+	allowedFormats := htsconfig.EnabledFormats(htsgetReq.GetEndpoint().AllowedFormats())
 	if !htsutils.IsItemInArray(format, allowedFormats) {
 		return false, "file format: '" + format + "' not supported"
 	}
+	switch htsgetReq.GetEndpoint() {
+	case htsconstants.APIEndpointReadsTicket, htsconstants.APIEndpointVariantsTicket:
+		objectFormat := htsconfig.GetObjectFormat(htsgetReq.GetEndpoint(), htsgetReq.GetID())
+		if objectFormat != "" && objectFormat != format {
+			return false, "file format: '" + format + "' not supported for the requested object, which is " + objectFormat
+		}
+	}
 	return true, ""
 }
 
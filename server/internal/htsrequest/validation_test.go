@@ -29,13 +29,19 @@ var validateIDTC = []struct {
 // validateFormatTC test cases for validateFormat
 var validateFormatTC = []struct {
 	endpoint htsconstants.APIEndpoint
+	id       string
 	format   string
 	exp      bool
 }{
-	{htsconstants.APIEndpointReadsTicket, "BAM", true},
-	{htsconstants.APIEndpointReadsTicket, "CRAM", false},
-	{htsconstants.APIEndpointVariantsTicket, "VCF", true},
-	{htsconstants.APIEndpointVariantsTicket, "BAM", false},
+	{htsconstants.APIEndpointReadsTicket, "", "BAM", true},
+	{htsconstants.APIEndpointReadsTicket, "", "CRAM", true},
+	{htsconstants.APIEndpointReadsTicket, "tabulamuris.A1-B000168-3_57_F-1-1_R2", "BAM", true},
+	// a ticket for a BAM object cannot be served as CRAM
+	{htsconstants.APIEndpointReadsTicket, "tabulamuris.A1-B000168-3_57_F-1-1_R2", "CRAM", false},
+	// the data endpoint transforms the object to the requested format
+	{htsconstants.APIEndpointReadsData, "tabulamuris.A1-B000168-3_57_F-1-1_R2", "CRAM", true},
+	{htsconstants.APIEndpointVariantsTicket, "", "VCF", true},
+	{htsconstants.APIEndpointVariantsTicket, "", "BAM", false},
 }
 
 // validateClassTC test cases for ValidateClass
@@ -265,8 +271,9 @@ func TestValidateFormat(t *testing.T) {
 	for _, tc := range validateFormatTC {
 		r := NewHtsgetRequest()
 		r.SetEndpoint(tc.endpoint)
+		r.SetID(tc.id)
 		result, _ := paramValidator.ValidateFormat(r, tc.format)
-		assert.Equal(t, tc.exp, result)
+		assert.Equal(t, tc.exp, result, tc.id+" "+tc.format)
 	}
 }
 
@@ -1,57 +1,61 @@
 package htsserver
 
 import (
-	"bufio"
-	"io"
-	"math"
 	"net/http"
 	"os"
 
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
-
+	"github.com/ga4gh/htsget-refserver/internal/htserror"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
 	"github.com/ga4gh/htsget-refserver/internal/htsutils"
 )
 
-func getFileBytes(writer http.ResponseWriter, request *http.Request) {
+func getReadsBytes(writer http.ResponseWriter, request *http.Request) {
+	newRequestHandler(
+		htsconstants.GetMethod,
+		htsconstants.APIEndpointReadsBytes,
+		noAfterSetup,
+		getFileBytesHandler,
+	).handleRequest(writer, request)
+}
+
+func getVariantsBytes(writer http.ResponseWriter, request *http.Request) {
 	newRequestHandler(
 		htsconstants.GetMethod,
-		htsconstants.APIEndpointFileBytes,
+		htsconstants.APIEndpointVariantsBytes,
 		noAfterSetup,
 		getFileBytesHandler,
 	).handleRequest(writer, request)
 }
 
+// getFileBytesHandler serves the byte range in the Range header of the local
+// file an object id resolves to through the data source registry. objects
+// served from urls are never fetched through the server
 func getFileBytesHandler(handler *requestHandler) {
-	start, end, err := htsutils.ParseRangeHeader(handler.HtsReq.GetHtsgetRange())
+	filePath, err := htsconfig.GetObjectPath(handler.HtsReq.GetEndpoint(), handler.HtsReq.GetID())
+	if err != nil || htsutils.IsValidURL(filePath) {
+		msg := "The requested resource is not a local file"
+		htserror.NotFound(handler.Writer, &msg)
+		return
+	}
+
+	file, err := os.Open(filePath)
 	if err != nil {
+		log.Error("Could not open %s: %v", filePath, err)
+		msg := "The requested resource was not found"
+		htserror.NotFound(handler.Writer, &msg)
 		return
 	}
+	defer file.Close()
 
-	file, err := os.Open(handler.HtsReq.GetHtsgetFilePath())
-	reader := bufio.NewReader(file)
-	reader.Discard(int(start))
-
-	chunkSize := 8192
-	nBytes := end - start + 1
-	nChunks := int(math.Ceil(float64(nBytes) / float64(chunkSize)))
-	nBytesRead := int64(0)
-	buffer := make([]byte, chunkSize)
-
-	for i := 0; i < nChunks; i++ {
-
-		n, err := io.ReadFull(reader, buffer)
-		if err != nil {
-
-		}
-		handler.Writer.Write(buffer)
-		// at the second last chunk, create a buffer that will only read bytes
-		// up to the exact remaining needed to fulfill the range request
-		nBytesRead += int64(n)
-		if i == nChunks-2 {
-			bytesRemaining := nBytes - nBytesRead
-			buffer = make([]byte, bytesRemaining)
-		} else {
-			buffer = make([]byte, chunkSize)
-		}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		log.Error("Could not stat %s: %v", filePath, err)
+		msg := "The requested resource could not be read"
+		htserror.InternalServerError(handler.Writer, &msg)
+		return
 	}
+
+	http.ServeContent(handler.Writer, handler.Request, "", fileInfo.ModTime(), file)
 }
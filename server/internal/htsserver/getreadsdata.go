@@ -2,13 +2,15 @@ package htsserver
 
 import (
 	"bufio"
+	"fmt"
 	"io"
 	"net/http"
-	"os/exec"
 
 	"github.com/ga4gh/htsget-refserver/internal/htscli"
 	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htserror"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
 	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
 	"github.com/google/uuid"
 )
@@ -28,17 +30,30 @@ func getReadsDataHandler(handler *requestHandler) {
 		return
 	}
 
+	// CRAM is encoded, and decoded, against the configured reference
+	cram := handler.HtsReq.GetFormat() == htsconstants.FormatCram
+	reference := htsconfig.GetCramReference()
+
 	commandChain := htscli.NewCommandChain()
 	removedHeadBytes := 0
 	removedTailBytes := htsconstants.BamEOFLen
+	if cram {
+		removedTailBytes = htsconstants.CramEOFLen
+	}
 
 	if handler.HtsReq.IsHeaderBlock() {
 		// only get the header for header blocks
-		commandChain.AddCommand(samtoolsViewHeaderOnlyBAM(fileURL))
+		commandChain.AddCommand(samtoolsViewHeaderOnly(fileURL, cram, reference))
 	} else {
 		// body-based requests will remove header bytes, as they are streamed
 		// in a different block
-		headerByteSize, _ := getHeaderByteSize(fileURL)
+		headerByteSize, err := getHeaderByteSize(fileURL, cram, reference)
+		if err != nil {
+			log.Error("Could not read the header of %s: %v", handler.HtsReq.GetID(), err)
+			msg := "The requested data could not be streamed"
+			htserror.InternalServerError(handler.Writer, &msg)
+			return
+		}
 		removedHeadBytes = headerByteSize
 		var region *htsrequest.Region = nil
 		if !handler.HtsReq.AllRegionsRequested() {
@@ -47,23 +62,32 @@ func getReadsDataHandler(handler *requestHandler) {
 
 		if handler.HtsReq.AllFieldsRequested() && handler.HtsReq.AllTagsRequested() {
 			// simple streaming of single block without field/tag modification
-			commandChain.AddCommand(samtoolsViewHeaderExcludedBAM(fileURL, region))
+			commandChain.AddCommand(samtoolsViewHeaderExcluded(fileURL, region, cram, reference))
 
 		} else {
 			// specific fields/tags requested, requires chaining of samtools
 			// with htsget-refserver-utils modify sam commands
-			commandChain.AddCommand(samtoolsViewHeaderIncludedSAM(fileURL, region))
+			commandChain.AddCommand(samtoolsViewHeaderIncludedSAM(fileURL, region, reference))
 			commandChain.AddCommand(modifySam(handler.HtsReq))
-			commandChain.AddCommand(samtoolsViewSamToBamStream())
+			commandChain.AddCommand(samtoolsViewSamToStream(cram, reference))
 		}
 	}
 
 	// execute command chain and stream output
-	commandWriteStream(commandChain, removedHeadBytes, removedTailBytes, handler.Writer)
+	if err := commandWriteStream(commandChain, removedHeadBytes, removedTailBytes, handler.Writer); err != nil {
+		log.Error("Could not stream %s: %v", handler.HtsReq.GetID(), err)
+		msg := "The requested data could not be streamed"
+		htserror.InternalServerError(handler.Writer, &msg)
+		return
+	}
 
 	// write EOF on the last block
 	if handler.HtsReq.IsFinalBlock() {
-		writeBamEOF(handler.Writer)
+		if cram {
+			writeCramEOF(handler.Writer)
+		} else {
+			writeBamEOF(handler.Writer)
+		}
 	}
 }
 
@@ -82,6 +106,12 @@ func commandWriteStream(commandChain *htscli.CommandChain, removeHeadBytes int,
 
 		// indicates this is the last loop
 		if nBytesRead != bufferSize {
+			// a stream shorter than the bytes to remove means the command failed,
+			// which can only be reported while nothing has been written
+			if firstLoop && nBytesRead < removeHeadBytes+removeTailBytes {
+				return fmt.Errorf("the command output %d bytes, fewer than the %d bytes removed from it", nBytesRead, removeHeadBytes+removeTailBytes)
+			}
+
 			// remove all unread bytes after EOF,
 			// then remove bytes specified by removeTailBytes
 			bufferBytes = bufferBytes[:nBytesRead]
@@ -104,14 +134,27 @@ func writeBamEOF(writer http.ResponseWriter) {
 	writer.Write(htsconstants.BamEOF)
 }
 
+func writeCramEOF(writer http.ResponseWriter) {
+	writer.Write(htsconstants.CramEOF)
+}
+
+// outputBinary sets samtools to output BAM, or CRAM encoded against the reference
+func outputBinary(samtoolsView *htscli.SamtoolsViewCommand, cram bool) *htscli.SamtoolsViewCommand {
+	if cram {
+		return samtoolsView.OutputCRAM()
+	}
+	return samtoolsView.OutputBAM()
+}
+
 // for header requests
-func samtoolsViewHeaderOnlyBAM(fileURL string) *htscli.Command {
-	return htscli.SamtoolsView().AddFilePath(fileURL).HeaderOnly().OutputBAM().GetCommand()
+func samtoolsViewHeaderOnly(fileURL string, cram bool, reference string) *htscli.Command {
+	samtoolsView := htscli.SamtoolsView().AddFilePath(fileURL).HeaderOnly().SetReference(reference)
+	return outputBinary(samtoolsView, cram).GetCommand()
 }
 
 // requests for all fields/tags
-func samtoolsViewHeaderExcludedBAM(fileURL string, region *htsrequest.Region) *htscli.Command {
-	samtoolsView := htscli.SamtoolsView().AddFilePath(fileURL).OutputBAM()
+func samtoolsViewHeaderExcluded(fileURL string, region *htsrequest.Region, cram bool, reference string) *htscli.Command {
+	samtoolsView := outputBinary(htscli.SamtoolsView().AddFilePath(fileURL).SetReference(reference), cram)
 	if region != nil {
 		samtoolsView.AddRegion(region)
 	}
@@ -119,8 +162,8 @@ func samtoolsViewHeaderExcludedBAM(fileURL string, region *htsrequest.Region) *h
 }
 
 // commands used when custom fields/tags are requested
-func samtoolsViewHeaderIncludedSAM(fileURL string, region *htsrequest.Region) *htscli.Command {
-	samtoolsView := htscli.SamtoolsView().AddFilePath(fileURL).HeaderIncluded()
+func samtoolsViewHeaderIncludedSAM(fileURL string, region *htsrequest.Region, reference string) *htscli.Command {
+	samtoolsView := htscli.SamtoolsView().AddFilePath(fileURL).HeaderIncluded().SetReference(reference)
 	if region != nil {
 		samtoolsView.AddRegion(region)
 	}
@@ -146,27 +189,39 @@ func modifySam(htsgetReq *htsrequest.HtsgetRequest) *htscli.Command {
 	return modifySam.GetCommand()
 }
 
-func samtoolsViewSamToBamStream() *htscli.Command {
-	return htscli.SamtoolsView().OutputBAM().StreamFromStdin().GetCommand()
+func samtoolsViewSamToStream(cram bool, reference string) *htscli.Command {
+	samtoolsView := outputBinary(htscli.SamtoolsView().SetReference(reference), cram)
+	return samtoolsView.StreamFromStdin().GetCommand()
 }
 
-func getHeaderByteSize(fileURL string) (int, error) {
-	cmd := exec.Command("samtools", "view", "-H", "-b", fileURL)
+func getHeaderByteSize(fileURL string, cram bool, reference string) (int, error) {
+	command := samtoolsViewHeaderOnly(fileURL, cram, reference)
+	command.SetupCmd()
+	cmd := command.GetCmd()
 	tmpHeader, err := htsconfig.CreateTempFile(uuid.New().String() + "_header")
 	if err != nil {
 		return 0, err
 	}
 
 	cmd.Stdout = tmpHeader
-	cmd.Run()
+	defer htsconfig.RemoveTempfile(tmpHeader)
+	defer tmpHeader.Close()
+	if err := cmd.Run(); err != nil {
+		return 0, err
+	}
 
 	fi, err := tmpHeader.Stat()
 	if err != nil {
 		return 0, err
 	}
 
-	size := fi.Size() - 28
-	tmpHeader.Close()
-	htsconfig.RemoveTempfile(tmpHeader)
+	eofLen := htsconstants.BamEOFLen
+	if cram {
+		eofLen = htsconstants.CramEOFLen
+	}
+	size := fi.Size() - int64(eofLen)
+	if size < 0 {
+		return 0, fmt.Errorf("the header of %s is shorter than its EOF", fileURL)
+	}
 	return int(size), nil
 }
@@ -0,0 +1,16 @@
+package htsserver
+
+import (
+	"net/http"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+)
+
+func getReadsDatasets(writer http.ResponseWriter, request *http.Request) {
+	newRequestHandler(
+		htsconstants.GetMethod,
+		htsconstants.APIEndpointReadsDatasets,
+		noAfterSetup,
+		datasetsRequestHandler,
+	).handleRequest(writer, request)
+}
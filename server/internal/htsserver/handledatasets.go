@@ -0,0 +1,145 @@
+package htsserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htserror"
+	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+	"github.com/ga4gh/htsget-refserver/internal/htsmanifest"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport"
+	"github.com/ga4gh/htsget-refserver/internal/htsticket"
+)
+
+// datasetsResponse the datasets the visas of a passport grant access to
+type datasetsResponse struct {
+	Datasets []*accessibleDataset `json:"datasets"`
+}
+
+// accessibleDataset a dataset granted by a visa, with the objects and regions
+// its manifest permits
+//
+// Attributes
+//	ID (string): dataset id, as used in ticket request paths
+//	Issuer (string): issuer of the visa granting the dataset
+//	Objects ([]*accessibleObject): objects of the dataset that may be requested
+//	Regions ([]*htsticket.Region): regions of the objects that may be requested, all if empty
+//	DataUse ([]string): Data Use Ontology codes the dataset is labelled with
+//	Error (string): if not empty, the manifest of the dataset could not be loaded
+type accessibleDataset struct {
+	ID      string              `json:"id"`
+	Issuer  string              `json:"issuer"`
+	Objects []*accessibleObject `json:"objects"`
+	Regions []*htsticket.Region `json:"regions"`
+	DataUse []string            `json:"dataUse,omitempty"`
+	Error   string              `json:"error,omitempty"`
+}
+
+// accessibleObject an object of a dataset, identified by the id it is
+// requested with
+type accessibleObject struct {
+	ID        string `json:"id"`
+	PatientID string `json:"patientId"`
+	SampleID  string `json:"sampleId"`
+}
+
+// datasetsRequestHandler lists the datasets the caller's passport grants access
+// to. visas are verified exactly as they are for tickets, and the objects and
+// regions of each dataset are taken from its manifest
+func datasetsRequestHandler(handler *requestHandler) {
+	passport := htspassport.GetPassport(handler.Request.Context())
+	if passport == nil {
+		msg := "A passport from a trusted broker is required to list datasets"
+		htserror.InvalidAuthentication(handler.Writer, &msg)
+		return
+	}
+
+	response := &datasetsResponse{Datasets: make([]*accessibleDataset, 0)}
+	listed := make(map[string]bool)
+
+	visas, rejections := passport.DecodeVisas(visaClock(), htsconfig.GetClockSkew())
+	for _, rejection := range rejections {
+		if rejection.Reason != htspassport.RejectUntrustedIssuer {
+			log.Info("Skipped visa from %s: %v", rejection.Issuer, rejection)
+		}
+	}
+
+	for _, visa := range visas {
+		trustedIssuer := htsconfig.GetTrustedIssuer(visa.Issuer)
+		for _, datasetID := range visa.Datasets {
+			// a dataset granted by more than one visa is listed as granted by the first
+			if listed[datasetID] {
+				continue
+			}
+			if trustedIssuer == nil || !trustedIssuer.CanGrant(datasetID) {
+				log.Info("Skipped visa claim for dataset %s because issuer %s is not trusted to grant it", datasetID, visa.Issuer)
+				continue
+			}
+			listed[datasetID] = true
+			response.Datasets = append(response.Datasets, describeDataset(handler.HtsReq.GetEndpoint(), visa.Issuer, datasetID))
+		}
+	}
+
+	handler.Writer.Header().Set(htsconstants.ContentTypeHeader.String(), htsconstants.ContentTypeHeaderHtsgetJSON.String())
+	json.NewEncoder(handler.Writer).Encode(response)
+}
+
+// describeDataset loads the manifest of a dataset granted by a visa, resolving
+// the artifacts of the endpoint's kind to the object ids they are requested by
+func describeDataset(ep htsconstants.APIEndpoint, issuer string, datasetID string) *accessibleDataset {
+	dataset := &accessibleDataset{
+		ID:      datasetID,
+		Issuer:  issuer,
+		Objects: make([]*accessibleObject, 0),
+		Regions: make([]*htsticket.Region, 0),
+		DataUse: htsconfig.GetDatasetDataUse(ep, datasetID),
+	}
+
+	manifest, err := htsmanifest.GetProvider().GetManifest(issuer, datasetID)
+	if err != nil {
+		log.Error("%v", err)
+		dataset.Error = fmt.Sprintf("The manifest of dataset %s could not be loaded", datasetID)
+		return dataset
+	}
+	dataset.DataUse = append(dataset.DataUse, manifest.DataUse...)
+
+	// only the artifacts and regions that may be accessed now are listed
+	manifest = manifest.At(manifestClock())
+
+	for _, sample := range manifest.Samples() {
+		path := sample.VariantsPath
+		if ep == htsconstants.APIEndpointReadsDatasets {
+			path = sample.ReadsPath
+		}
+		if path == "" {
+			continue
+		}
+		// artifacts that no data source resolves to cannot be requested, so are not listed
+		id, err := htsconfig.GetObjectID(ep, path)
+		if err != nil {
+			log.Debug("Not listing artifact of dataset %s: %v", datasetID, err)
+			continue
+		}
+		dataset.Objects = append(dataset.Objects, &accessibleObject{ID: id, PatientID: sample.PatientID, SampleID: sample.SampleID})
+	}
+
+	for _, manifestRange := range manifest.Regions {
+		// regions are reported with the reference names tickets are requested with
+		referenceName := manifestRange.Id
+		if !strings.HasPrefix(referenceName, "chr") {
+			referenceName = fmt.Sprintf("chr%s", referenceName)
+		}
+		region := htsticket.NewRegion(referenceName, 0)
+		if manifestRange.Start != nil {
+			region.Start = *manifestRange.Start
+		}
+		if manifestRange.End != nil {
+			region.SetEnd(*manifestRange.End)
+		}
+		dataset.Regions = append(dataset.Regions, region)
+	}
+	return dataset
+}
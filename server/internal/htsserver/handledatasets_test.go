@@ -0,0 +1,88 @@
+package htsserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsmanifest"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDatasetsListing tests that the datasets endpoints list the datasets the
+// visas of a passport grant, with the objects and regions of their manifests
+func TestDatasetsListing(t *testing.T) {
+	start, end := 100, 200
+	manifest := htsmanifest.Manifest{
+		Id: "tabulamuris",
+		Artifacts: map[string]htsmanifest.Artifact{
+			"P1": {Samples: map[string]htsmanifest.ArtifactConcrete{
+				"A1": {
+					ReadsPath:    tabulamurisA1Path,
+					VariantsPath: "../../data/test/sources/giab/NA12878_GIAB.filtered.vcf.gz",
+				},
+				"A2": {ReadsPath: "s3://elsewhere/A2.bam"},
+			}},
+		},
+		Regions: []htsmanifest.Region{{Id: "1", Start: &start, End: &end}, {Id: "chrX"}},
+		DataUse: []string{"POA"},
+	}
+	test, reset := newTicketTest(t, `{"htsgetConfig":{"reads":{"datasets":[{"id":"tabulamuris","dataUse":["HMB"]}]}}}`, manifest)
+	defer reset()
+	issuer := test.issuer
+	issuer.Trust("htsget", "tabulamuris", "giab")
+
+	expiresAt := time.Now().Add(time.Hour)
+	passport, err := issuer.Passport("alice", "htsget", expiresAt,
+		issuer.CompactVisa(fmt.Sprintf("c:tabulamuris c:giab e:%d u:alice", expiresAt.Unix())),
+		issuer.CompactVisa(fmt.Sprintf("c:tabulamuris e:%d u:alice", expiresAt.Unix())))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := func(endpoint string, passport string) (int, *datasetsResponse) {
+		request := httptest.NewRequest("GET", endpoint, nil)
+		if passport != "" {
+			request.Header.Set("Authorization", "Bearer "+passport)
+		}
+		writer := httptest.NewRecorder()
+		test.router.ServeHTTP(writer, request)
+		response := new(datasetsResponse)
+		json.Unmarshal(writer.Body.Bytes(), response)
+		return writer.Code, response
+	}
+
+	code, _ := list("/reads/datasets", "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	code, reads := list("/reads/datasets", passport)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Equal(t, 2, len(reads.Datasets)) {
+		tabulamuris := reads.Datasets[0]
+		assert.Equal(t, "tabulamuris", tabulamuris.ID)
+		assert.Equal(t, issuer.URL(), tabulamuris.Issuer)
+		assert.Equal(t, []*accessibleObject{{ID: "tabulamuris.A1-B000168-3_57_F-1-1_R2", PatientID: "P1", SampleID: "A1"}}, tabulamuris.Objects)
+		assert.Equal(t, 2, len(tabulamuris.Regions))
+		assert.Equal(t, "chr1", tabulamuris.Regions[0].ReferenceName)
+		assert.Equal(t, 100, tabulamuris.Regions[0].Start)
+		assert.Equal(t, 200, *tabulamuris.Regions[0].End)
+		assert.Nil(t, tabulamuris.Regions[1].End)
+		assert.Equal(t, []string{"HMB", "POA"}, tabulamuris.DataUse)
+		assert.Equal(t, "", tabulamuris.Error)
+
+		// no manifest is served for the second dataset
+		assert.Equal(t, "giab", reads.Datasets[1].ID)
+		assert.NotEqual(t, "", reads.Datasets[1].Error)
+		assert.Equal(t, 0, len(reads.Datasets[1].Objects))
+	}
+
+	code, variants := list("/variants/datasets", passport)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Equal(t, 2, len(variants.Datasets)) {
+		assert.Equal(t, []*accessibleObject{{ID: "NA12878_GIAB", PatientID: "P1", SampleID: "A1"}}, variants.Datasets[0].Objects)
+		assert.Equal(t, []string{"POA"}, variants.Datasets[0].DataUse)
+	}
+}
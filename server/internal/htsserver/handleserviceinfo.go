@@ -3,12 +3,28 @@ package htsserver
 import (
 	"encoding/json"
 
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
 )
 
 func serviceInfoRequestHandler(handler *requestHandler) {
-	serviceInfo := handler.HtsReq.GetServiceInfo()
+	serviceInfo := withDatasets(handler.HtsReq.GetServiceInfo(), handler.HtsReq.GetEndpoint())
 	writer := handler.Writer
 	writer.Header().Set(htsconstants.ContentTypeHeader.String(), htsconstants.ContentTypeHeaderHtsgetJSON.String())
 	json.NewEncoder(writer).Encode(serviceInfo)
 }
+
+// withDatasets copies the configured service info, reporting the access mode of
+// each dataset configured for the endpoint in the htsget extension, along with
+// only those of the configured formats that are enabled
+func withDatasets(serviceInfo *htsconfig.ServiceInfo, ep htsconstants.APIEndpoint) *htsconfig.ServiceInfo {
+	if serviceInfo == nil || serviceInfo.HtsgetExtension == nil {
+		return serviceInfo
+	}
+	withDatasets := *serviceInfo
+	extension := *serviceInfo.HtsgetExtension
+	extension.Formats = htsconfig.EnabledFormats(extension.Formats)
+	extension.Datasets = htsconfig.GetDatasets(ep)
+	withDatasets.HtsgetExtension = &extension
+	return &withDatasets
+}
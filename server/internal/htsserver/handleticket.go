@@ -1,113 +1,94 @@
 package htsserver
 
 import (
-	"encoding/base64"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/ga4gh/htsget-refserver/internal/htsaudit"
 	log "github.com/ga4gh/htsget-refserver/internal/htslog"
+	"github.com/ga4gh/htsget-refserver/internal/htsmanifest"
 	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
 	"github.com/jwangsadinata/go-multimap/slicemultimap"
-	"github.com/s12v/go-jwks"
-	"github.com/square/go-jose"
-	"github.com/xenitab/go-oidc-middleware/options"
-	"golang.org/x/crypto/ed25519"
-	"io/ioutil"
-	"net/http"
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
 	"github.com/ga4gh/htsget-refserver/internal/htsdao"
+	"github.com/ga4gh/htsget-refserver/internal/htsduo"
 	"github.com/ga4gh/htsget-refserver/internal/htserror"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport"
+	"github.com/ga4gh/htsget-refserver/internal/htsquota"
 	"github.com/ga4gh/htsget-refserver/internal/htsticket"
+	"github.com/ga4gh/htsget-refserver/internal/htsutils"
 )
 
-type HtsGetRegion struct {
-	Id    string `json:"chromosome"`
-	Start *int   `json:"start,omitempty"`
-	End   *int   `json:"end,omitempty"`
+// accessGrant what a manifest permits the client to access
+//
+// Attributes
+//	blockURLs ([]*htsticket.URL): urls of the permitted data blocks
+//	regions ([]*htsrequest.Region): permitted regions the blocks cover
+//	withheld ([]*htsticket.Region): requested regions left out, when regions are clipped
+type accessGrant struct {
+	blockURLs []*htsticket.URL
+	regions   []*htsrequest.Region
+	withheld  []*htsticket.Region
 }
 
-type HtsGetArtifactConcrete struct {
-	VariantsPath string `json:"variantsPath"`
-}
-
-type HtsGetArtifact struct {
-	Samples map[string]HtsGetArtifactConcrete `json:"samples"`
-}
-
-type Manifest struct {
-	Id         string                    `json:"id"`
-	PatientIds []string                  `json:"patientIds"`
-	Url        string                    `json:"htsgetUrl"`
-	Artifacts  map[string]HtsGetArtifact `json:"htsgetArtifacts"`
-	Regions    []HtsGetRegion            `json:"htsgetRegions"`
-}
-
-/**
-Fills in the blockURLs with the corresponding blocks allowed as per this controlled access dataset
-*/
-func controlledAccess(issuer string, datasetId string, handler *requestHandler, dao *htsdao.DataAccessObject) []*htsticket.URL {
-	// the first step for controlled access is to fetch the corresponding manifest
-	url := fmt.Sprintf("%s/api/manifest/%s", issuer, datasetId)
-
-	spaceClient := http.Client{
-		Timeout: time.Second * 15,
-	}
-
-	req, err := http.NewRequest(http.MethodGet, url, nil)
-	if err != nil {
-		log.Error("%v", err)
-		return nil
-	}
-
-	res, getErr := spaceClient.Do(req)
-	if getErr != nil {
-		log.Error("%v", getErr)
-		return nil
-	}
-
-	if res.Body != nil {
-		defer res.Body.Close()
-	}
-
-	body, readErr := ioutil.ReadAll(res.Body)
-	if readErr != nil {
-		log.Error("%v", readErr)
-		return nil
-	}
-
-	manifest := Manifest{}
-	jsonErr := json.Unmarshal(body, &manifest)
-	if jsonErr != nil {
-		log.Error("%v", jsonErr)
-		return nil
+// errBlocksNotLocated the blocks a ticket is granted could not be located in
+// the object, e.g. as its index could not be read. the ticket fails, rather
+// than granting the client an empty or partial ticket
+var errBlocksNotLocated = errors.New("the object or its index could not be read")
+
+// controlledAccess gets the blockURLs allowed as per the manifest of this
+// controlled access dataset. if a requested region is not covered by the
+// manifest, the error describes it - unless regions are configured to be
+// clipped, in which case only the covered parts are served and the rest are
+// returned as withheld. regions and artifacts outside their access window at
+// the time given are treated as if they were not in the manifest. if the blocks
+// cannot be located, the error wraps errBlocksNotLocated
+func controlledAccess(manifest *htsmanifest.Manifest, handler *requestHandler, dao *htsdao.DataAccessObject, now time.Time) (*accessGrant, error) {
+	active := manifest.At(now)
+
+	// the visa grants the dataset, but only the samples listed in its manifest may be accessed
+	objectPath, err := htsconfig.GetObjectPath(handler.HtsReq.GetEndpoint(), handler.HtsReq.GetID())
+	if err != nil || !active.AllowsObject(objectPath) {
+		if restriction := manifest.ObjectRestriction(objectPath, now); err == nil && restriction != "" {
+			return nil, fmt.Errorf("Object %s of dataset %s is %s", handler.HtsReq.GetID(), handler.HtsReq.GetDataset(), restriction)
+		}
+		return nil, fmt.Errorf("Object %s is not an artifact of dataset %s", handler.HtsReq.GetID(), handler.HtsReq.GetDataset())
 	}
 
-	// TODO: do a basic check of is the specimen allowed to be accessed
-
 	// log.Debug("%v", manifest)
 	if handler.HtsReq.HeaderOnlyRequested() {
 		// only header is requested, requires one URL range encompassing only the header data
 		log.Debug("Ticket handler choosing a header only response")
 
-		blockURLs := make([]*htsticket.URL, 0)
-
+		// the header cannot be located without the index of the object
 		headerBlockUrl := (*dao).GetHeaderByteRangeUrl()
+		if headerBlockUrl == nil {
+			return nil, fmt.Errorf("Could not locate the header of object %s: %w", handler.HtsReq.GetID(), errBlocksNotLocated)
+		}
 
-		blockURLs = append(blockURLs, headerBlockUrl)
-
-		return blockURLs
+		return &accessGrant{blockURLs: []*htsticket.URL{headerBlockUrl}}, nil
 	}
 
 	regions := make([]*htsrequest.Region, 0)
 
+	// requested parts outside the manifest, when regions are clipped
+	var withheld []*htsticket.Region
+
 	if handler.HtsReq.AllRegionsRequested() {
 		log.Debug("Ticket handler choosing a multi block all regions response")
 
 		// the user has requested all regions - the result we give back is only those regions listed
 		// in the manifest
 		// TODO: enforce sort ordering on the manifest regions (is probably true currently but not guaranteed)
-		for _, manifestRange := range manifest.Regions {
+		if len(active.Regions) == 0 && len(manifest.Regions) > 0 {
+			return nil, fmt.Errorf("No region of dataset %s may be accessed at this time", handler.HtsReq.GetDataset())
+		}
+		for _, manifestRange := range active.Regions {
 			// our manifest *only* ever uses chromosome ids in "1", "2", "X" format..
 
 			// TODO: need to detect the underlying format of the VCF and match it.. currently all are chrX etc
@@ -139,7 +120,8 @@ func controlledAccess(issuer string, datasetId string, handler *requestHandler,
 
 				log.Debug("Attempting to serve chromosome region %s", r.ReferenceName)
 
-				for _, manifestRange := range manifest.Regions {
+				matched := false
+				for _, manifestRange := range active.Regions {
 					compatibleReferenceName := manifestRange.Id
 
 					if !strings.HasPrefix(compatibleReferenceName, "chr") {
@@ -155,166 +137,468 @@ func controlledAccess(issuer string, datasetId string, handler *requestHandler,
 					// because the user has asked for the whole chromosome - we are going to just serve up every manifest
 					// region that matches
 					regions = append(regions, &htsrequest.Region{ReferenceName: compatibleReferenceName, Start: manifestRange.Start, End: manifestRange.End})
+					matched = true
 				}
-			} else {
-				// for every region - we need to find a manifest region that 'allows' us
-				// presume we aren't allowed
-				allowed := false
-
-				log.Debug("Attempting to get permission for region request %s %s-%s", r.ReferenceName, r.StartString(), r.EndString())
-
-				for _, manifestRange := range manifest.Regions {
 
-					// chromosome names must match between the request region and manifest region or else we just skip to
-					// next manifest rule
-					if r.ReferenceName != manifestRange.Id {
-						if r.ReferenceName != fmt.Sprintf("chr%s", manifestRange.Id) {
-							continue
-						}
-					}
-
-					var manifestStart int
-					if manifestRange.Start == nil {
-						manifestStart = 0
-					} else {
-						manifestStart = *manifestRange.Start
-					}
-
-					var manifestEnd int
-					if manifestRange.End == nil {
-						manifestEnd = 1000000000
-					} else {
-						manifestEnd = *manifestRange.End
-					}
-
-					log.Debug("Comparing to manifest region %s %d-%d", manifestRange.Id, manifestStart, manifestEnd)
-
-					var requestStart int
-					var requestEnd int
+				if restriction := manifest.RegionRestriction(r.ReferenceName, 0, htsmanifest.RegionOpenEnd, now); !matched && restriction != "" {
+					return nil, fmt.Errorf("Region %s of dataset %s is %s", r.ReferenceName, handler.HtsReq.GetDataset(), restriction)
+				}
+			} else {
+				// the requested region is intersected with the union of the manifest regions, so
+				// a region spanning adjacent manifest regions is allowed as a whole
+				requestStart, requestEnd := 0, htsmanifest.RegionOpenEnd
+				if r.StartRequested() {
+					requestStart = r.GetStart()
+				}
+				if r.EndRequested() {
+					requestEnd = r.GetEnd()
+				}
 
-					requestStart = *r.Start
-					requestEnd = *r.End
+				log.Debug("Attempting to get permission for region request %s %d-%d", r.ReferenceName, requestStart, requestEnd)
 
-					log.Debug("%d>=%d and %d<=%d", requestStart, manifestStart, requestEnd, manifestEnd)
+				permitted, withheldParts := active.Clip(r.GetReferenceName(), requestStart, requestEnd)
 
-					if requestStart >= manifestStart && requestEnd <= manifestEnd {
-						allowed = true
-						break
+				// unless clipping is enabled, any part of the region outside the manifest denies the request
+				if len(withheldParts) > 0 && !htsconfig.IsManifestClipRegions() {
+					if restriction := manifest.RegionRestriction(r.GetReferenceName(), requestStart, requestEnd, now); restriction != "" {
+						return nil, fmt.Errorf("Region %s %s-%s of dataset %s is %s", r.GetReferenceName(), r.StartString(), r.EndString(), handler.HtsReq.GetDataset(), restriction)
 					}
+					return nil, fmt.Errorf("Could not access region %s %s-%s", r.GetReferenceName(), r.StartString(), r.EndString())
 				}
 
-				if allowed {
-					regions = append(regions, &htsrequest.Region{ReferenceName: r.GetReferenceName(), Start: r.Start, End: r.End})
-				} else {
-					handler.Writer.WriteHeader(403)
-
-					json.NewEncoder(handler.Writer).Encode(fmt.Sprintf("Could not access region %s %s-%s", r.GetReferenceName(), r.StartString(), r.EndString()))
+				for _, part := range permitted {
+					partStart, partEnd := part.Start, part.End
+					regions = append(regions, &htsrequest.Region{ReferenceName: r.GetReferenceName(), Start: &partStart, End: &partEnd})
+				}
 
-					return nil
+				for _, part := range withheldParts {
+					log.Info("Withheld region %s %d-%d outside the manifest of dataset %s", part.ReferenceName, part.Start, part.End, handler.HtsReq.GetDataset())
+					withheldRegion := htsticket.NewRegion(part.ReferenceName, part.Start)
+					if part.End != htsmanifest.RegionOpenEnd {
+						withheldRegion.SetEnd(part.End)
+					}
+					withheld = append(withheld, withheldRegion)
 				}
 			}
 		}
 	}
 
-	blockURLs := make([]*htsticket.URL, 0)
-
-	urls := (*dao).GetChunkedInPlaceBlocks(regions)
-
-	if urls == nil {
-		log.Error("Chunked blocks call failed")
+	blockURLs := (*dao).GetChunkedInPlaceBlocks(regions)
+	if blockURLs == nil {
+		return nil, fmt.Errorf("Could not locate the blocks of object %s: %w", handler.HtsReq.GetID(), errBlocksNotLocated)
 	}
 
-	blockURLs = append(blockURLs, urls...)
-
-	return blockURLs
+	return &accessGrant{blockURLs: blockURLs, regions: regions, withheld: withheld}, nil
 }
 
-const ISSUER_DAC = "https://didact-patto.dev.umccr.org"
+// visaClock gets the current time that visa validity is checked against
+var visaClock = time.Now
+
+// manifestClock gets the current time that the access windows of manifest
+// regions and artifacts are checked against
+var manifestClock = time.Now
+
+// urlClock gets the current time that signed data urls expire from, and are
+// checked against
+var urlClock = time.Now
 
 func ticketRequestHandler(handler *requestHandler) {
 
+	// every decision made below is written to the audit log
+	record := newAuditRecord(handler)
+
 	dao, err := htsdao.GetDao(handler.HtsReq)
 	if err != nil {
 		msg := "Could not determine data source path/url from request id"
+		auditDecision(record, htsaudit.OutcomeFailed, msg)
 		htserror.InternalServerError(handler.Writer, &msg)
 		return
 	}
 
+	// the object is served in its own format, which may not be enabled - i.e. CRAM
+	if format := ticketFormat(handler); !htsutils.IsItemInArray(format, htsconfig.EnabledFormats(handler.HtsReq.GetEndpoint().AllowedFormats())) {
+		msg := "file format: '" + format + "' not supported"
+		auditDecision(record, htsaudit.OutcomeDenied, msg)
+		htserror.UnsupportedFormat(handler.Writer, &msg)
+		return
+	}
+
 	// part of our URL must be the dataset we are trying to access
 	datasetRequested := handler.HtsReq.GetDataset()
 
-	claims := handler.Request.Context().Value(options.DefaultClaimsContextKeyName).(map[string]interface{})
-
-	var blockURLs []*htsticket.URL
-
-	// this is just some wierdness about how Go JWT parses in the claims
-	for _, visaOuter := range claims["ga4gh_passport_v2"].(map[string]interface{}) {
-		visaInner := visaOuter.([]interface{})[0]
-		v := visaInner.(map[string]interface{})["v"].(string)
-		i := visaInner.(map[string]interface{})["i"].(string)
-		k := visaInner.(map[string]interface{})["k"].(string)
-		s := visaInner.(map[string]interface{})["s"].(string)
-
-		// we only proceed with known *trusted* issuers
-		if i == ISSUER_DAC {
-			log.Info("Processing interesting visa from issuer %s with content %s", i, v)
-
-			// set up a JWKS cache for visa TODO: actually cache this
-			// TODO: use OIDC discovery rather than assuming jwks location
-			visaJwksSource := jwks.NewWebSource(fmt.Sprintf("%s/.well-known/jwks", i))
-			visaJwksClient := jwks.NewDefaultClient(
-				visaJwksSource,
-				time.Hour,    // Refresh keys every 1 hour
-				12*time.Hour, // Expire keys after 12 hours
-			)
-
-			var jwk *jose.JSONWebKey
-			jwk, err := visaJwksClient.GetEncryptionKey(k)
+	// whoever is asking, the declared purpose must be compatible with the data use
+	// conditions the dataset is configured with
+	log.Info("Ticket requested for dataset %s with purpose %s", datasetRequested, handler.HtsReq.GetPurpose())
+	if err := htsduo.CheckPurpose(handler.HtsReq.GetPurpose(), htsconfig.GetDatasetDataUse(handler.HtsReq.GetEndpoint(), datasetRequested)); err != nil {
+		msg := err.Error()
+		auditDecision(record, htsaudit.OutcomeDenied, msg)
+		htserror.PermissionDenied(handler.Writer, &msg)
+		return
+	}
+
+	// public datasets are served to anyone, without consulting visas or manifests
+	if htsconfig.IsDatasetPublic(handler.HtsReq.GetEndpoint(), datasetRequested) {
+		log.Info("Serving public dataset %s", datasetRequested)
+		record.GrantedRegions = record.RequestedRegions
+		if streamingRequested(handler) {
+			// the fields and tags requested are only served by streaming the object
+			// through the data endpoint, which terminates the last block itself
+			blockURLs, err := streamingAccess(handler)
 			if err != nil {
-				log.Error(err.Error())
+				msg := "Could not construct data endpoint urls"
+				auditDecision(record, htsaudit.OutcomeFailed, msg)
+				htserror.InternalServerError(handler.Writer, &msg)
+				return
+			}
+			if err := auditDecision(record, htsaudit.OutcomeGranted, "public dataset"); err != nil {
+				writeAuditError(handler)
+				return
 			}
+			htsticket.FinalizeTicket(ticketFormat(handler), blockURLs, handler.Writer)
+			return
+		}
+		blockURLs, err := publicAccess(handler, &dao)
+		if err != nil {
+			log.Error("%v", err)
+			msg := err.Error()
+			auditDecision(record, htsaudit.OutcomeFailed, msg)
+			htserror.InternalServerError(handler.Writer, &msg)
+			return
+		}
+		if err := auditDecision(record, htsaudit.OutcomeGranted, "public dataset"); err != nil {
+			writeAuditError(handler)
+			return
+		}
+		finalizeTicket(handler, dao, blockURLs, nil)
+		return
+	}
 
-			x := jwk.Key.(ed25519.PublicKey)
+	// ticket routes are mounted behind the passport middleware, but refuse rather than grant
+	// if a route ever reaches here without a verified passport
+	passport := htspassport.GetPassport(handler.Request.Context())
+	if passport == nil {
+		msg := "A passport from a trusted broker is required to access dataset " + datasetRequested
+		auditDecision(record, htsaudit.OutcomeDenied, msg)
+		htserror.InvalidAuthentication(handler.Writer, &msg)
+		return
+	}
+	record.Subject = passport.Subject
 
-			vBytes := []byte(v)
-			sBytes, err := base64.RawURLEncoding.DecodeString(s)
+	// a subject who has used up a quota for the dataset is refused before any
+	// visas, manifests or indices are consulted
+	// while the configured quotas cannot be enforced, controlled tickets are refused
+	quotas, err := htsquota.GetQuotas()
+	if err != nil {
+		writeQuotaError(handler, record, err)
+		return
+	}
+	if quotas != nil {
+		if err := quotas.Check(record.Subject, datasetRequested); err != nil {
+			writeQuotaError(handler, record, err)
+			return
+		}
+	}
 
-			if ed25519.Verify(x, vBytes, sBytes) {
-				visaSplit := strings.Split(v, " ")
+	var grant *accessGrant
 
-				for _, visaClaim := range visaSplit {
-					// TODO: check expiry claims
-					// TODO: check identity claims match outer passport
-					// cover the situation that somehow the controlled access visa appears twice??
-					if blockURLs != nil {
-						continue
-					}
+	// the trusted issuers we actually evaluated visas from - reported back if permission is denied
+	issuersConsidered := make([]string, 0)
 
-					if strings.HasPrefix(visaClaim, "c:") {
-						datasetId := strings.TrimPrefix(visaClaim, "c:")
+	// visas of every format the passport carries are verified, and are only accepted if
+	// they were issued to the holder of the passport
+	visas, rejections := passport.DecodeVisas(visaClock(), htsconfig.GetClockSkew())
 
-						// the datset req in the URL has to match this visa - i.e. we need to cover the situation
-						// where this user has many datasets at this DAC/htsget endpoint
-						if datasetRequested == datasetId {
-							blockURLs = controlledAccess(i, datasetId, handler, &dao)
-						}
-					}
-				}
-			} else {
-				log.Error("Failed signature check for visa from %s", i)
-			}
-		} else {
-			log.Info("Skipped uninteresting visa from issuer %s", i)
+	for _, rejection := range rejections {
+		if rejection.Reason == htspassport.RejectUntrustedIssuer {
+			log.Info("Skipped uninteresting visa from issuer %s", rejection.Issuer)
+			continue
+		}
+		if rejection.Reason == htspassport.RejectRevoked {
+			auditRevokedVisa(record, rejection.Visa)
 		}
+		if rejection.Issuer != "" && !htsutils.IsItemInArray(rejection.Issuer, issuersConsidered) {
+			issuersConsidered = append(issuersConsidered, rejection.Issuer)
+		}
+		log.Info("Skipped visa from %s: %v", rejection.Issuer, rejection)
 	}
 
-	if blockURLs == nil {
-		msg := fmt.Sprintf("No valid controlled access visa from our trusted DACs (%v) was found matching dataset %s - so permission is denied", ISSUER_DAC, datasetRequested)
+	for _, visa := range visas {
+		if !htsutils.IsItemInArray(visa.Issuer, issuersConsidered) {
+			issuersConsidered = append(issuersConsidered, visa.Issuer)
+		}
+
+		log.Info("Processing interesting visa from issuer %s for datasets %s", visa.Issuer, strings.Join(visa.Datasets, ", "))
+
+		// cover the situation that somehow the controlled access visa appears twice??
+		if grant != nil {
+			continue
+		}
+
+		// the datset req in the URL has to match this visa - i.e. we need to cover the situation
+		// where this user has many datasets at this DAC/htsget endpoint
+		if !visa.GrantsDataset(datasetRequested) {
+			continue
+		}
+
+		// the issuer must also be one we trust to grant this particular dataset
+		trustedIssuer := htsconfig.GetTrustedIssuer(visa.Issuer)
+		if trustedIssuer == nil || !trustedIssuer.CanGrant(datasetRequested) {
+			log.Error("Skipped visa claim for dataset %s because issuer %s is not trusted to grant it", datasetRequested, visa.Issuer)
+			continue
+		}
+
+		auditVisa(record, visa)
+
+		manifest, err := htsmanifest.GetProvider().GetManifest(visa.Issuer, datasetRequested)
+		if err != nil {
+			log.Error("%v", err)
+			auditDecision(record, htsaudit.OutcomeFailed, err.Error())
+			writeManifestError(handler, err)
+			return
+		}
+
+		// the manifest may label the dataset with further data use conditions
+		if err := htsduo.CheckPurpose(handler.HtsReq.GetPurpose(), manifest.DataUse); err != nil {
+			msg := err.Error()
+			auditDecision(record, htsaudit.OutcomeDenied, msg)
+			htserror.PermissionDenied(handler.Writer, &msg)
+			return
+		}
+
+		grant, err = controlledAccess(manifest, handler, &dao, manifestClock())
+		if errors.Is(err, errBlocksNotLocated) {
+			// nothing has been granted, so no quota is consumed
+			log.Error("%v", err)
+			msg := err.Error()
+			auditDecision(record, htsaudit.OutcomeFailed, msg)
+			htserror.InternalServerError(handler.Writer, &msg)
+			return
+		}
+		if err != nil {
+			msg := err.Error()
+			auditDecision(record, htsaudit.OutcomeDenied, msg)
+			htserror.PermissionDenied(handler.Writer, &msg)
+			return
+		}
+	}
+
+	if grant == nil {
+		considered := "none"
+		if len(issuersConsidered) > 0 {
+			considered = strings.Join(issuersConsidered, ", ")
+		}
+		msg := fmt.Sprintf("No valid controlled access visa from our trusted DACs (considered: %s) was found matching dataset %s - so permission is denied", considered, datasetRequested)
+		auditDecision(record, htsaudit.OutcomeDenied, msg)
 		htserror.PermissionDenied(handler.Writer, &msg)
 		return
 	}
 
-	blockURLs = append(blockURLs, dao.GetBgzipEof())
+	record.GrantedRegions = auditRegions(grant.regions)
+	record.WithheldRegions = auditWithheldRegions(grant.withheld)
+
+	if quotas != nil {
+		bytes, known := grantedBytes(grant.blockURLs, dao)
+		if !known && quotas.LimitsEgress() {
+			writeQuotaError(handler, record, fmt.Errorf("the size of object %s is not known, so its ticket cannot be counted against the egress quota", handler.HtsReq.GetID()))
+			return
+		}
+		usage, err := quotas.Consume(record.Subject, datasetRequested, bytes)
+		if err != nil {
+			writeQuotaError(handler, record, err)
+			return
+		}
+		log.Info("Subject %s has been granted %d tickets and %d bytes of dataset %s since %s", record.Subject, usage.Requests, usage.Bytes, datasetRequested, usage.WindowStart.Format(time.RFC3339))
+	}
+
+	if err := auditDecision(record, htsaudit.OutcomeGranted, "visa for dataset "+datasetRequested); err != nil {
+		writeAuditError(handler)
+		return
+	}
+	finalizeTicket(handler, dao, grant.blockURLs, grant.withheld)
+}
+
+// publicAccess gets the blockURLs covering exactly what was requested, for
+// datasets that are served without controlled access. if the blocks cannot be
+// located, the error wraps errBlocksNotLocated
+func publicAccess(handler *requestHandler, dao *htsdao.DataAccessObject) ([]*htsticket.URL, error) {
+	if handler.HtsReq.HeaderOnlyRequested() {
+		log.Debug("Ticket handler choosing a header only response")
+		headerBlockUrl := (*dao).GetHeaderByteRangeUrl()
+		if headerBlockUrl == nil {
+			return nil, fmt.Errorf("Could not locate the header of object %s: %w", handler.HtsReq.GetID(), errBlocksNotLocated)
+		}
+		return []*htsticket.URL{headerBlockUrl}, nil
+	}
+
+	if handler.HtsReq.AllRegionsRequested() {
+		log.Debug("Ticket handler choosing a multi block all regions response")
+		return (*dao).GetByteRangeUrls(), nil
+	}
+
+	log.Debug("Ticket handler choosing a multi block selective regions response")
+	blockURLs := (*dao).GetChunkedInPlaceBlocks(handler.HtsReq.GetRegions())
+	if blockURLs == nil {
+		return nil, fmt.Errorf("Could not locate the blocks of object %s: %w", handler.HtsReq.GetID(), errBlocksNotLocated)
+	}
+	return blockURLs, nil
+}
+
+// streamingRequested checks if a reads ticket requests only some fields or
+// tags of each read, which the byte ranges of the object cannot serve. a header
+// only ticket is served from the byte ranges whatever fields or tags it names
+func streamingRequested(handler *requestHandler) bool {
+	req := handler.HtsReq
+	if req.GetEndpoint() != htsconstants.APIEndpointReadsTicket || req.HeaderOnlyRequested() {
+		return false
+	}
+	return !req.AllFieldsRequested() || !req.AllTagsRequested()
+}
+
+// streamingAccess gets the blockURLs of a ticket served through the reads data
+// endpoint, which streams the object through samtools so that only the
+// requested fields and tags are returned. the header is the first block,
+// followed by a block for each requested region, or for the whole body
+func streamingAccess(handler *requestHandler) ([]*htsticket.URL, error) {
+	req := handler.HtsReq
+
+	// the data endpoint streams the object in its own format
+	req.SetFormat(ticketFormat(handler))
+
+	nBodyBlocks := req.NRegions()
+	if req.AllRegionsRequested() {
+		nBodyBlocks = 1
+	}
+	totalBlocks := strconv.Itoa(nBodyBlocks + 1)
+
+	headerURL, err := req.ConstructDataEndpointURL(false, 0)
+	if err != nil {
+		return nil, err
+	}
+	headers := htsticket.NewHeaders().SetClassHeader().SetCurrentBlock("0").SetTotalBlocks(totalBlocks)
+	blockURLs := []*htsticket.URL{htsticket.NewURL().SetURL(headerURL).SetHeaders(headers).SetClassHeader()}
+
+	for i := 0; i < nBodyBlocks; i++ {
+		bodyURL, err := req.ConstructDataEndpointURL(!req.AllRegionsRequested(), i)
+		if err != nil {
+			return nil, err
+		}
+		headers := htsticket.NewHeaders().SetCurrentBlock(strconv.Itoa(i + 1)).SetTotalBlocks(totalBlocks)
+		blockURLs = append(blockURLs, htsticket.NewURL().SetURL(bodyURL).SetHeaders(headers).SetClassBody())
+	}
+	if err := signTicketURLs(blockURLs); err != nil {
+		return nil, err
+	}
+	return blockURLs, nil
+}
+
+// signTicketURLs signs the urls of a ticket that point back at this server, so
+// that the data endpoints only serve them to holders of the ticket, until they
+// expire. urls of other servers, e.g. presigned object store urls, are left as
+// they are
+func signTicketURLs(blockURLs []*htsticket.URL) error {
+	host := htsconfig.GetHost()
+	expires := urlClock().Add(htsconfig.GetURLLifetime())
+	for _, blockURL := range blockURLs {
+		if blockURL == nil || !strings.HasPrefix(blockURL.URL, host) {
+			continue
+		}
+		if err := blockURL.Sign(host, htsconfig.GetURLSigningKey(), expires); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeManifestError writes the htsget error for a manifest that could not be
+// loaded - the visa may well grant access, so this is not a permission denial
+func writeManifestError(handler *requestHandler, err error) {
+	if manifestErr, ok := err.(*htsmanifest.ManifestError); ok && manifestErr.Unavailable {
+		msg := fmt.Sprintf("The manifest of dataset %s is temporarily unavailable from %s", manifestErr.DatasetID, manifestErr.Issuer)
+		htserror.ServiceUnavailable(handler.Writer, &msg)
+		return
+	}
+	msg := "The manifest of the requested dataset could not be loaded"
+	if manifestErr, ok := err.(*htsmanifest.ManifestError); ok {
+		msg = fmt.Sprintf("The manifest of dataset %s could not be loaded from %s", manifestErr.DatasetID, manifestErr.Issuer)
+	}
+	htserror.BadGateway(handler.Writer, &msg)
+}
+
+// grantedBytes estimates the number of bytes a ticket is issued for, from the
+// byte ranges of its urls. a url without a byte range may download the whole
+// object, so is counted as its size. known is false if the size of the object
+// is needed but cannot be found
+func grantedBytes(blockURLs []*htsticket.URL, dao htsdao.DataAccessObject) (bytes int64, known bool) {
+	var objectSize int64 = -1
+	for _, blockURL := range blockURLs {
+		if blockURL == nil {
+			continue
+		}
+		if n, ok := blockURL.ByteCount(); ok {
+			bytes += n
+			continue
+		}
+		if objectSize < 0 {
+			objectSize = dao.GetContentLength()
+		}
+		if objectSize <= 0 {
+			return bytes, false
+		}
+		bytes += objectSize
+	}
+	return bytes, true
+}
+
+// writeQuotaError writes the htsget error for a ticket refused by a quota,
+// telling the client when to retry, and audits the decision
+func writeQuotaError(handler *requestHandler, record *htsaudit.Record, err error) {
+	exceeded, ok := err.(*htsquota.ExceededError)
+	if !ok {
+		log.Error("Could not check the quotas of %s: %v", record.Subject, err)
+		msg := "The request quota could not be checked"
+		auditDecision(record, htsaudit.OutcomeFailed, msg)
+		htserror.InternalServerError(handler.Writer, &msg)
+		return
+	}
+
+	msg := exceeded.Error()
+	log.Info("%s", msg)
+	auditDecision(record, htsaudit.OutcomeDenied, msg)
+	retryAfter := int(math.Ceil(time.Until(exceeded.ResetAt).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	handler.Writer.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	htserror.TooManyRequests(handler.Writer, &msg)
+}
+
+// ticketFormat gets the format a ticket is served in, i.e. the format of the
+// requested object, as its bytes are served as they are. a format that was not
+// requested defaults to BAM or VCF, so is only used if the object's path does
+// not tell its format
+func ticketFormat(handler *requestHandler) string {
+	if objectFormat := htsconfig.GetObjectFormat(handler.HtsReq.GetEndpoint(), handler.HtsReq.GetID()); objectFormat != "" {
+		return objectFormat
+	}
+	return handler.HtsReq.GetFormat()
+}
+
+// finalizeTicket terminates the blockURLs with the EOF block, signs those
+// pointing back at this server and writes the ticket, listing any requested
+// regions that were withheld
+func finalizeTicket(handler *requestHandler, dao htsdao.DataAccessObject, blockURLs []*htsticket.URL, withheld []*htsticket.Region) {
+	// BAM and VCF are both BGZF compressed, so either is terminated by the BGZF EOF block, and CRAM
+	// by its EOF container, unless the last url already reaches it, as it does when the whole file is served
+	if eof := dao.GetBgzipEof(); eof != nil && (len(blockURLs) == 0 || !blockURLs[len(blockURLs)-1].Covers(eof)) {
+		blockURLs = append(blockURLs, eof)
+	}
+
+	if err := signTicketURLs(blockURLs); err != nil {
+		log.Error("Could not sign the urls of the ticket for %s: %v", handler.HtsReq.GetID(), err)
+		msg := "Could not construct data endpoint urls"
+		htserror.InternalServerError(handler.Writer, &msg)
+		return
+	}
 
-	htsticket.FinalizeTicket(handler.HtsReq.GetFormat(), blockURLs, handler.Writer)
+	htsticket.FinalizeClippedTicket(ticketFormat(handler), blockURLs, withheld, handler.Writer)
 }
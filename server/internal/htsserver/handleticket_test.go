@@ -0,0 +1,1008 @@
+package htsserver
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ga4gh/htsget-refserver/internal/htsaudit"
+	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htsdao"
+	"github.com/ga4gh/htsget-refserver/internal/htsmanifest"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport/passporttest"
+	"github.com/ga4gh/htsget-refserver/internal/htsquota"
+	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
+	"github.com/ga4gh/htsget-refserver/internal/htsticket"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+// setIntegrationConfig sets the configuration for E2E tests, with properties
+// overridden by a further JSON config
+func setIntegrationConfig(override string) {
+	// configure dir in which test files are relative to
+	wd, _ := os.Getwd()
+	parentDir := filepath.Dir(filepath.Dir(wd))
+
+	configFilePath := filepath.Join(parentDir, "data", "config", "integration-tests.config.json")
+	configFile, _ := os.Open(configFilePath)
+	configJSONBytes, _ := ioutil.ReadAll(configFile)
+	newConfig := new(htsconfig.Configuration)
+	json.Unmarshal(configJSONBytes, newConfig)
+	json.Unmarshal([]byte(override), newConfig)
+	htsconfig.SetConfigFile(newConfig)
+	htsconfig.LoadConfig()
+}
+
+// tabulamurisA1Path path of the tabulamuris sample the test manifests list
+const tabulamurisA1Path = "../../data/test/sources/tabulamuris/A1-B000168-3_57_F-1-1_R2.mus.Aligned.out.sorted.bam"
+
+// sampleManifest creates the manifest of a dataset listing a single sample,
+// whose reads may be accessed in the given regions
+func sampleManifest(datasetID string, readsPath string, regions ...htsmanifest.Region) htsmanifest.Manifest {
+	return htsmanifest.Manifest{
+		Id: datasetID,
+		Artifacts: map[string]htsmanifest.Artifact{
+			"P1": {Samples: map[string]htsmanifest.ArtifactConcrete{"A1": {ReadsPath: readsPath}}},
+		},
+		Regions: regions,
+	}
+}
+
+// ticketTest the router and local passport issuer a ticket test is run against
+//
+// Attributes
+//	issuer (*passporttest.LocalIssuer): issuer of passports and visas, serving the manifests
+//	router (*chi.Mux): router serving the ticket endpoints
+type ticketTest struct {
+	issuer *passporttest.LocalIssuer
+	router *chi.Mux
+}
+
+// newTicketTest sets the integration configuration, overridden by a further
+// JSON config, and starts a local passport issuer serving the given manifests
+//
+// Arguments
+//	tb (testing.TB): the test or benchmark
+//	override (string): JSON config overriding the integration configuration
+//	manifests (...htsmanifest.Manifest): manifests served by the issuer
+// Returns
+//	(*ticketTest): the router and issuer
+//	(func()): closes the issuer and restores the default configuration and
+//		manifest provider. it must be deferred, so that nothing is left behind
+//		for later tests when a test fails
+func newTicketTest(tb testing.TB, override string, manifests ...htsmanifest.Manifest) (*ticketTest, func()) {
+	setIntegrationConfig(override)
+	issuer, err := passporttest.NewLocalIssuer()
+	if err != nil {
+		resetTicketTest()
+		tb.Fatal(err)
+	}
+	for _, manifest := range manifests {
+		manifest := manifest
+		issuer.Handle("/api/manifest/"+manifest.Id, http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			json.NewEncoder(writer).Encode(manifest)
+		}))
+	}
+	htsmanifest.SetProvider(nil)
+	router, _ := SetRouter()
+
+	return &ticketTest{issuer: issuer, router: router}, func() {
+		issuer.Close()
+		resetTicketTest()
+	}
+}
+
+// resetTicketTest sets the configuration back to default, dropping any
+// manifests cached under the test configuration
+func resetTicketTest() {
+	htsconfig.SetConfigFile(htsconfig.DefaultConfiguration)
+	htsconfig.SetConfig(htsconfig.DefaultConfiguration)
+	htsmanifest.SetProvider(nil)
+}
+
+// passport gets a passport for the subject, carrying a compact visa for the
+// dataset valid for an hour
+func (test *ticketTest) passport(tb testing.TB, subject string, dataset string) string {
+	expiresAt := time.Now().Add(time.Hour)
+	passport, err := test.issuer.Passport(subject, "htsget", expiresAt,
+		test.issuer.CompactVisa(fmt.Sprintf("c:%s e:%d u:%s", dataset, expiresAt.Unix(), subject)))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return passport
+}
+
+// get requests a reads ticket with the passport as a bearer token, unless it
+// is empty
+func (test *ticketTest) get(path string, passport string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest("GET", path, nil)
+	if passport != "" {
+		request.Header.Set("Authorization", "Bearer "+passport)
+	}
+	writer := httptest.NewRecorder()
+	test.router.ServeHTTP(writer, request)
+	return writer
+}
+
+// tabulamurisA1ID id the tabulamuris sample the test manifests list is
+// requested with
+const tabulamurisA1ID = "tabulamuris.A1-B000168-3_57_F-1-1_R2"
+
+// ticketRanges gets the Range header and class of each url of a written
+// ticket, checking that every url is a signed url of the reads bytes endpoint
+// for the given object
+func ticketRanges(tb testing.TB, writer *httptest.ResponseRecorder, id string) [][2]string {
+	ticket := new(htsticket.Ticket)
+	if err := json.Unmarshal(writer.Body.Bytes(), ticket); err != nil {
+		tb.Fatal(err)
+	}
+	ranges := make([][2]string, 0)
+	for _, url := range ticket.HTSget.URLS {
+		assert.True(tb, strings.HasPrefix(url.URL, htsconfig.GetHost()+"reads/bytes/"+id+"?"), url.URL)
+		assert.Contains(tb, url.URL, htsticket.SignatureParam+"=")
+		ranges = append(ranges, [2]string{url.Headers.Range, url.Class})
+	}
+	return ranges
+}
+
+// fetchTicket downloads each url of a written ticket from the router, with the
+// headers the ticket gives, and concatenates the data
+func (test *ticketTest) fetchTicket(tb testing.TB, writer *httptest.ResponseRecorder) []byte {
+	ticket := new(htsticket.Ticket)
+	if err := json.Unmarshal(writer.Body.Bytes(), ticket); err != nil {
+		tb.Fatal(err)
+	}
+	data := make([]byte, 0)
+	for _, url := range ticket.HTSget.URLS {
+		request := httptest.NewRequest("GET", strings.TrimPrefix(url.URL, strings.TrimSuffix(htsconfig.GetHost(), "/")), nil)
+		if url.Headers != nil && url.Headers.Range != "" {
+			request.Header.Set("Range", url.Headers.Range)
+		}
+		part := httptest.NewRecorder()
+		test.router.ServeHTTP(part, request)
+		if !assert.Contains(tb, []int{http.StatusOK, http.StatusPartialContent}, part.Code, part.Body.String()) {
+			return nil
+		}
+		data = append(data, part.Body.Bytes()...)
+	}
+	return data
+}
+
+// TestReadsTicketControlledAccess tests that reads tickets are only issued for
+// artifacts of the dataset in the path when the passport carries a visa for it,
+// or when the dataset is public
+func TestReadsTicketControlledAccess(t *testing.T) {
+	test, reset := newTicketTest(t, "{}",
+		sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}),
+		sampleManifest("tabulamuris-other", "../../data/test/sources/tabulamuris/A2-B000168-3_57_F-1-1_R2.mus.Aligned.out.sorted.bam", htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris", "tabulamuris-other", "giab")
+
+	// a controlled ticket holds the header and the blocks of the manifest regions, while a public
+	// ticket holds the whole file
+	controlled := [][2]string{{"bytes=0-2579", "header"}, {"bytes=2580-22174", "body"}, {"bytes=41130-41157", "body"}}
+	public := [][2]string{{"bytes=0-41157", ""}}
+
+	tc := []struct {
+		method    string
+		endpoint  string
+		passport  string
+		expCode   int
+		expRanges [][2]string
+	}{
+		{"GET", "/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2", test.passport(t, "alice", "tabulamuris"), http.StatusOK, controlled},
+		{"POST", "/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2", test.passport(t, "alice", "tabulamuris"), http.StatusOK, controlled},
+		{"GET", "/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2", "", http.StatusUnauthorized, nil},
+		{"POST", "/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2", "", http.StatusUnauthorized, nil},
+		{"GET", "/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2", test.passport(t, "alice", "giab"), http.StatusForbidden, nil},
+		{"GET", "/reads/giab/tabulamuris.A1-B000168-3_57_F-1-1_R2", test.passport(t, "alice", "tabulamuris"), http.StatusForbidden, nil},
+		{"GET", "/reads/giab/tabulamuris.A1-B000168-3_57_F-1-1_R2", test.passport(t, "alice", "giab"), http.StatusBadGateway, nil},
+		{"GET", "/reads/tabulamuris-other/tabulamuris.A1-B000168-3_57_F-1-1_R2", test.passport(t, "alice", "tabulamuris-other"), http.StatusForbidden, nil},
+		{"GET", "/reads/tabulamuris-other/tabulamuris.A1-B000168-3_57_F-1-1_R2?class=header", test.passport(t, "alice", "tabulamuris-other"), http.StatusForbidden, nil},
+		{"GET", "/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2", "", http.StatusOK, public},
+		{"POST", "/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2", "", http.StatusOK, public},
+		{"GET", "/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2", test.passport(t, "alice", "giab"), http.StatusOK, public},
+	}
+
+	for _, c := range tc {
+		request := httptest.NewRequest(c.method, c.endpoint, strings.NewReader("{}"))
+		if c.passport != "" {
+			request.Header.Set("Authorization", "Bearer "+c.passport)
+		}
+		writer := httptest.NewRecorder()
+		test.router.ServeHTTP(writer, request)
+		assert.Equal(t, c.expCode, writer.Code, c.method+" "+c.endpoint)
+		if c.expRanges != nil {
+			assert.Equal(t, c.expRanges, ticketRanges(t, writer, tabulamurisA1ID), c.method+" "+c.endpoint)
+		}
+	}
+}
+
+// TestReadsTicketLegacyPath tests that reads tickets requested without a
+// dataset in the path are served from the configured legacy dataset, with the
+// same access checks as its own path, and are refused if none is configured
+func TestReadsTicketLegacyPath(t *testing.T) {
+	manifest := sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"})
+	controlled := [][2]string{{"bytes=0-2579", "header"}, {"bytes=2580-22174", "body"}, {"bytes=41130-41157", "body"}}
+
+	tc := []struct {
+		legacyDataset string
+		method        string
+		passportOf    string
+		expCode       int
+		expRanges     [][2]string
+	}{
+		{"tabulamuris", "GET", "tabulamuris", http.StatusOK, controlled},
+		{"tabulamuris", "POST", "tabulamuris", http.StatusOK, controlled},
+		{"tabulamuris", "GET", "", http.StatusUnauthorized, nil},
+		{"tabulamuris", "GET", "giab", http.StatusForbidden, nil},
+		{"tabulamuris-public", "GET", "", http.StatusOK, [][2]string{{"bytes=0-41157", ""}}},
+		{"", "GET", "tabulamuris", http.StatusNotFound, nil},
+	}
+
+	for _, c := range tc {
+		func() {
+			test, reset := newTicketTest(t, `{"htsgetConfig":{"reads":{"legacyDataset":"`+c.legacyDataset+`"}}}`, manifest)
+			defer reset()
+			test.issuer.Trust("htsget", "tabulamuris", "giab")
+
+			request := httptest.NewRequest(c.method, "/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2", strings.NewReader("{}"))
+			if c.passportOf != "" {
+				request.Header.Set("Authorization", "Bearer "+test.passport(t, "alice", c.passportOf))
+			}
+			writer := httptest.NewRecorder()
+			test.router.ServeHTTP(writer, request)
+			assert.Equal(t, c.expCode, writer.Code, c.legacyDataset+" "+c.method+" "+c.passportOf)
+			if c.expRanges != nil {
+				assert.Equal(t, c.expRanges, ticketRanges(t, writer, tabulamurisA1ID), c.legacyDataset+" "+c.method)
+			}
+		}()
+	}
+}
+
+// TestReadsDataSignedURLs tests that the data endpoint only serves the
+// unexpired urls of a ticket, as signed when the ticket was issued
+func TestReadsDataSignedURLs(t *testing.T) {
+	test, reset := newTicketTest(t, "{}")
+	defer reset()
+	defer func() { urlClock = time.Now }()
+
+	writer := test.get("/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2?fields=SEQ,QUAL&referenceName=chr1", "")
+	assert.Equal(t, http.StatusOK, writer.Code)
+	ticket := new(htsticket.Ticket)
+	if err := json.Unmarshal(writer.Body.Bytes(), ticket); err != nil {
+		t.Fatal(err)
+	}
+	if !assert.Len(t, ticket.HTSget.URLS, 2) {
+		return
+	}
+	for _, ticketURL := range ticket.HTSget.URLS {
+		assert.Contains(t, ticketURL.URL, htsticket.SignatureParam+"=")
+	}
+	signed := strings.TrimPrefix(ticket.HTSget.URLS[1].URL, htsconfig.GetHost())
+
+	tc := []struct {
+		name    string
+		path    string
+		now     time.Time
+		expCode int
+	}{
+		{"unsigned", "/reads/data/tabulamuris.A1-B000168-3_57_F-1-1_R2?referenceName=chr1", time.Now(), http.StatusUnauthorized},
+		{"other object", "/reads/data/tabulamuris.A2-B000168-3_57_F-1-1_R2?" + strings.SplitN(signed, "?", 2)[1], time.Now(), http.StatusForbidden},
+		{"other region", "/" + strings.Replace(signed, "referenceName=chr1", "referenceName=chr2", 1), time.Now(), http.StatusForbidden},
+		{"expired", "/" + signed, time.Now().Add(htsconfig.GetURLLifetime() + time.Minute), http.StatusForbidden},
+	}
+
+	for _, c := range tc {
+		urlClock = func() time.Time { return c.now }
+		writer := test.get(c.path, "")
+		assert.Equal(t, c.expCode, writer.Code, c.name)
+	}
+}
+
+// TestDataEndpointIDs tests that the data and bytes endpoints resolve the id
+// of the object from the path of a ticket url
+func TestDataEndpointIDs(t *testing.T) {
+	_, reset := newTicketTest(t, "{}")
+	defer reset()
+
+	tc := []struct {
+		endpoint htsconstants.APIEndpoint
+		path     string
+	}{
+		{htsconstants.APIEndpointReadsData, "/reads/data/" + tabulamurisA1ID + "?referenceName=chr1"},
+		{htsconstants.APIEndpointReadsBytes, "/reads/bytes/" + tabulamurisA1ID},
+		{htsconstants.APIEndpointVariantsBytes, "/variants/bytes/HG002_GIAB"},
+	}
+
+	for _, c := range tc {
+		id := ""
+		router := chi.NewRouter()
+		router.Get(c.endpoint.String(), func(writer http.ResponseWriter, request *http.Request) {
+			if htsReq, err := htsrequest.SetAllParameters(htsconstants.GetMethod, c.endpoint, writer, request); err == nil {
+				id = htsReq.GetID()
+			}
+		})
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", c.path, nil))
+		assert.Equal(t, strings.SplitN(strings.SplitN(c.path, "/", 4)[3], "?", 2)[0], id, c.path)
+	}
+}
+
+// TestTicketBytesURLs tests that the urls of tickets for local files can be
+// fetched from the bytes endpoints, which only serve the signed byte ranges of
+// objects resolved through the data source registry
+func TestTicketBytesURLs(t *testing.T) {
+	test, reset := newTicketTest(t, "{}", sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+
+	bam, err := ioutil.ReadFile(tabulamurisA1Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vcf, err := ioutil.ReadFile("../../data/test/sources/giab/HG002_GIAB.filtered.vcf.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a controlled ticket holds the header, the chr1 block and the EOF block
+	controlled := append(append(append([]byte{}, bam[0:2580]...), bam[2580:22175]...), bam[41130:]...)
+
+	tc := []struct {
+		path     string
+		passport string
+		exp      []byte
+	}{
+		{"/reads/tabulamuris-public/" + tabulamurisA1ID, "", bam},
+		{"/reads/tabulamuris/" + tabulamurisA1ID, test.passport(t, "alice", "tabulamuris"), controlled},
+		{"/variants/giab-public/HG002_GIAB", "", vcf},
+	}
+
+	for _, c := range tc {
+		writer := test.get(c.path, c.passport)
+		if assert.Equal(t, http.StatusOK, writer.Code, c.path) {
+			assert.Equal(t, c.exp, test.fetchTicket(t, writer), c.path)
+		}
+	}
+
+	// the bytes endpoints refuse urls that were not signed by a ticket, or whose range was changed
+	writer := test.get("/reads/tabulamuris/"+tabulamurisA1ID, test.passport(t, "alice", "tabulamuris"))
+	ticket := new(htsticket.Ticket)
+	json.Unmarshal(writer.Body.Bytes(), ticket)
+	signed := strings.TrimPrefix(ticket.HTSget.URLS[0].URL, "http://localhost:3000")
+
+	refused := []struct {
+		path    string
+		rangeHd string
+		expCode int
+	}{
+		{"/reads/bytes/" + tabulamurisA1ID, "bytes=0-41157", http.StatusUnauthorized},
+		{"/variants/bytes/HG002_GIAB", "bytes=0-1000", http.StatusUnauthorized},
+		{signed, "bytes=0-41157", http.StatusForbidden},
+		{signed, "", http.StatusForbidden},
+	}
+
+	for _, c := range refused {
+		request := httptest.NewRequest("GET", c.path, nil)
+		if c.rangeHd != "" {
+			request.Header.Set("Range", c.rangeHd)
+		}
+		writer := httptest.NewRecorder()
+		test.router.ServeHTTP(writer, request)
+		assert.Equal(t, c.expCode, writer.Code, c.path+" "+c.rangeHd)
+	}
+}
+
+// TestReadsTicketHeaderWithoutIndex tests that a ticket whose blocks cannot be
+// located, as there is no index alongside the object, fails rather than being
+// granted empty. the failure is audited, and does not consume the quota
+func TestReadsTicketHeaderWithoutIndex(t *testing.T) {
+	dir, err := ioutil.TempDir("", "noindex")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bam, err := ioutil.ReadFile(tabulamurisA1Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	readsPath := filepath.Join(dir, "A1.bam")
+	ioutil.WriteFile(readsPath, bam, 0644)
+
+	override := `{"htsgetConfig":{"reads":{"dataSourceRegistry":{"sources":[{"pattern":"^unindexed\\.(?P<accession>.*)$","path":"` + dir + `/{accession}.bam"}]}}}}`
+	test, reset := newTicketTest(t, override, sampleManifest("tabulamuris", readsPath, htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+
+	sink := &recordingSink{}
+	htsaudit.SetAuditor(htsaudit.NewAuditor(sink, nil))
+	defer htsaudit.SetAuditor(nil)
+	store, err := htsquota.OpenStore(filepath.Join(dir, "quotas.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	htsquota.SetQuotas(htsquota.NewQuotas(store, htsquota.Limits{Window: time.Hour, MaxRequests: 10}))
+	defer htsquota.SetQuotas(nil)
+
+	for _, path := range []string{
+		"/reads/tabulamuris/unindexed.A1?class=header",
+		"/reads/tabulamuris/unindexed.A1?referenceName=chr1",
+	} {
+		writer := test.get(path, test.passport(t, "alice", "tabulamuris"))
+		assert.Equal(t, http.StatusInternalServerError, writer.Code, path)
+		assert.Contains(t, writer.Body.String(), "Could not locate", path)
+	}
+
+	if assert.Equal(t, 2, len(sink.records)) {
+		for _, record := range sink.records {
+			assert.Equal(t, htsaudit.OutcomeFailed, record.Outcome)
+		}
+	}
+	usage, _ := store.Get("alice", "tabulamuris")
+	assert.Equal(t, 0, usage.Requests)
+}
+
+// TestReadsTicketClippedRegions tests that requested regions reaching outside
+// the manifest regions are denied, unless regions are clipped, in which case
+// the ticket reports the withheld parts
+func TestReadsTicketClippedRegions(t *testing.T) {
+	bounded := func(start int, end int) htsmanifest.Region {
+		return htsmanifest.Region{Id: "1", Start: &start, End: &end}
+	}
+	test, reset := newTicketTest(t, "{}", sampleManifest("tabulamuris", tabulamurisA1Path, bounded(100, 200), bounded(200, 300), bounded(400, 500), bounded(4800000, 4900000)))
+	defer reset()
+	passport := test.passport(t, "alice", "tabulamuris")
+
+	// no reads are placed before 4849664 on chr1, so those regions are served without any blocks,
+	// while the reads after it are all in the block from 2580, and those of chr2 in the block from 22175
+	empty := [][2]string{{"bytes=0-2579", "header"}, {"bytes=41130-41157", "body"}}
+	chr1 := [][2]string{{"bytes=0-2579", "header"}, {"bytes=2580-22174", "body"}, {"bytes=41130-41157", "body"}}
+
+	tc := []struct {
+		clipRegions string
+		query       string
+		expCode     int
+		expWithheld string
+		expRanges   [][2]string
+	}{
+		// regions spanning adjacent manifest regions are allowed either way
+		{"false", "referenceName=chr1&start=150&end=300", http.StatusOK, "", empty},
+		{"true", "referenceName=chr1&start=150&end=300", http.StatusOK, "", empty},
+		{"false", "referenceName=chr1&start=150&end=450", http.StatusForbidden, "", nil},
+		{"true", "referenceName=chr1&start=150&end=450", http.StatusOK, `"withheldRegions":[{"referenceName":"chr1","start":300,"end":400}]`, empty},
+		{"true", "referenceName=chr1&start=450", http.StatusOK, `"withheldRegions":[{"referenceName":"chr1","start":500,"end":4800000},{"referenceName":"chr1","start":4900000}]`, chr1},
+		{"true", "referenceName=chr1&start=4800000&end=5000000", http.StatusOK, `"withheldRegions":[{"referenceName":"chr1","start":4900000,"end":5000000}]`, chr1},
+		// a region withheld as a whole serves none of its blocks
+		{"true", "referenceName=chr2&start=100&end=200", http.StatusOK, `"withheldRegions":[{"referenceName":"chr2","start":100,"end":200}]`, empty},
+		{"true", "referenceName=chr2&start=9961472&end=10092544", http.StatusOK, `"withheldRegions":[{"referenceName":"chr2","start":9961472,"end":10092544}]`, empty},
+	}
+
+	for _, c := range tc {
+		setIntegrationConfig(`{"htsgetConfig":{"manifests":{"clipRegions":` + c.clipRegions + `}}}`)
+		test.issuer.Trust("htsget", "tabulamuris")
+		htsmanifest.SetProvider(nil)
+
+		writer := test.get("/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2?"+c.query, passport)
+		assert.Equal(t, c.expCode, writer.Code, c.query)
+		if c.expWithheld != "" {
+			assert.Contains(t, writer.Body.String(), c.expWithheld, c.query)
+		} else {
+			assert.NotContains(t, writer.Body.String(), "withheldRegions", c.query)
+		}
+		if c.expRanges != nil {
+			assert.Equal(t, c.expRanges, ticketRanges(t, writer, tabulamurisA1ID), c.query)
+		}
+	}
+}
+
+// recordingSink keeps the audit records written by the ticket handler
+type recordingSink struct {
+	records []*htsaudit.Record
+}
+
+func (sink *recordingSink) Write(line []byte) error {
+	record := new(htsaudit.Record)
+	if err := json.Unmarshal(line, record); err != nil {
+		return err
+	}
+	sink.records = append(sink.records, record)
+	return nil
+}
+
+// TestReadsTicketAudit tests that every ticket decision is written to the
+// audit log, with who requested what and why it was decided
+func TestReadsTicketAudit(t *testing.T) {
+	start, end := 100, 200
+	test, reset := newTicketTest(t, `{"htsgetConfig":{"manifests":{"clipRegions":true}}}`,
+		sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "1", Start: &start, End: &end}))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+	sink := &recordingSink{}
+	htsaudit.SetAuditor(htsaudit.NewAuditor(sink, nil))
+	defer htsaudit.SetAuditor(nil)
+
+	passport := test.passport(t, "alice", "tabulamuris")
+	for _, endpoint := range []string{
+		"/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2?referenceName=chr1&start=150&end=250",
+		"/reads/giab/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2?class=header",
+	} {
+		test.get(endpoint, passport)
+	}
+
+	assert.Equal(t, 3, len(sink.records))
+	granted := sink.records[0]
+	assert.Equal(t, uint64(1), granted.Sequence)
+	assert.Equal(t, "alice", granted.Subject)
+	if assert.Equal(t, 1, len(granted.Visas)) {
+		assert.Equal(t, test.issuer.URL(), granted.Visas[0].Issuer)
+		assert.Equal(t, []string{"tabulamuris"}, granted.Visas[0].Datasets)
+		assert.Equal(t, htspassport.RevocationNotChecked, granted.Visas[0].Revocation)
+	}
+	assert.Equal(t, "reads", granted.Endpoint)
+	assert.Equal(t, "tabulamuris", granted.Dataset)
+	assert.Equal(t, "tabulamuris.A1-B000168-3_57_F-1-1_R2", granted.ObjectID)
+	assert.Equal(t, htsaudit.OutcomeGranted, granted.Outcome)
+	assert.Equal(t, 150, *granted.RequestedRegions[0].Start)
+	assert.Equal(t, 250, *granted.RequestedRegions[0].End)
+	assert.Equal(t, 150, *granted.GrantedRegions[0].Start)
+	assert.Equal(t, 200, *granted.GrantedRegions[0].End)
+	assert.Equal(t, 200, *granted.WithheldRegions[0].Start)
+	assert.Equal(t, 250, *granted.WithheldRegions[0].End)
+
+	denied := sink.records[1]
+	assert.Equal(t, htsaudit.OutcomeDenied, denied.Outcome)
+	assert.Equal(t, "giab", denied.Dataset)
+	assert.Contains(t, denied.Reason, "permission is denied")
+	assert.Equal(t, granted.Hash, denied.PrevHash)
+
+	public := sink.records[2]
+	assert.Equal(t, htsaudit.OutcomeGranted, public.Outcome)
+	assert.Equal(t, "header", public.Class)
+
+	// public datasets are served without verifying the passport, so its subject is not known
+	assert.Equal(t, "", public.Subject)
+}
+
+// brokenSink an audit sink that fails every write
+type brokenSink struct{}
+
+func (sink brokenSink) Write(line []byte) error {
+	return errors.New("audit log is unavailable")
+}
+
+// TestReadsTicketAuditUnavailable tests that tickets are refused, rather than
+// issued unaudited, when the configured audit log cannot be opened or written
+func TestReadsTicketAuditUnavailable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	override := `{"htsgetConfig":{"audit":{"file":"` + filepath.Join(dir, "missing", "audit.log") + `"}}}`
+	test, reset := newTicketTest(t, override, sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+	passport := test.passport(t, "alice", "tabulamuris")
+
+	// the audit log is created from the configuration, in a directory that does not exist
+	htsaudit.SetAuditor(nil)
+	defer htsaudit.SetAuditor(nil)
+	_, err = htsaudit.GetAuditor()
+	assert.NotNil(t, err)
+
+	tc := []struct {
+		path    string
+		expCode int
+	}{
+		{"/reads/tabulamuris/" + tabulamurisA1ID, http.StatusInternalServerError},
+		{"/reads/tabulamuris-public/" + tabulamurisA1ID, http.StatusInternalServerError},
+		{"/reads/tabulamuris-public/" + tabulamurisA1ID + "?fields=SEQ", http.StatusInternalServerError},
+	}
+	for _, c := range tc {
+		writer := test.get(c.path, passport)
+		assert.Equal(t, c.expCode, writer.Code, c.path)
+	}
+
+	// a write to the audit log fails, while the decision is being recorded
+	htsaudit.SetAuditor(htsaudit.NewAuditor(brokenSink{}, nil))
+	for _, c := range tc {
+		writer := test.get(c.path, passport)
+		assert.Equal(t, c.expCode, writer.Code, c.path)
+		assert.Contains(t, writer.Body.String(), "could not be recorded", c.path)
+	}
+
+	// a denied ticket is refused all the same
+	writer := test.get("/reads/giab/"+tabulamurisA1ID, passport)
+	assert.Equal(t, http.StatusForbidden, writer.Code)
+}
+
+// TestReadsTicketPurpose tests that tickets are refused when the declared
+// purpose is not compatible with the data use conditions of the dataset, in
+// either the configuration or the manifest
+func TestReadsTicketPurpose(t *testing.T) {
+	manifest := sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"})
+	manifest.DataUse = []string{"POA"}
+	test, reset := newTicketTest(t, `{"htsgetConfig":{"reads":{"datasets":[{"id":"tabulamuris-public","access":"public","dataUse":["HMB"]}]}}}`, manifest)
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+	passport := test.passport(t, "alice", "tabulamuris")
+
+	tc := []struct {
+		dataset       string
+		query         string
+		purposeHeader string
+		expCode       int
+	}{
+		{"tabulamuris-public", "", "", http.StatusForbidden},
+		{"tabulamuris-public", "?purpose=HMB", "", http.StatusOK},
+		{"tabulamuris-public", "", "DS-MONDO:0005015", http.StatusOK},
+		{"tabulamuris-public", "?purpose=POA", "", http.StatusForbidden},
+		{"tabulamuris-public", "?purpose=commercial", "", http.StatusBadRequest},
+		{"tabulamuris-public", "?purpose=HMB", "POA", http.StatusBadRequest},
+		{"tabulamuris", "?purpose=POA", "", http.StatusOK},
+		{"tabulamuris", "?purpose=HMB", "", http.StatusForbidden},
+		{"tabulamuris", "", "", http.StatusForbidden},
+	}
+
+	for _, c := range tc {
+		request := httptest.NewRequest("GET", "/reads/"+c.dataset+"/tabulamuris.A1-B000168-3_57_F-1-1_R2"+c.query, nil)
+		request.Header.Set("Authorization", "Bearer "+passport)
+		if c.purposeHeader != "" {
+			request.Header.Set("Htsget-Purpose", c.purposeHeader)
+		}
+		writer := httptest.NewRecorder()
+		test.router.ServeHTTP(writer, request)
+		assert.Equal(t, c.expCode, writer.Code, c.dataset+c.query+" "+c.purposeHeader)
+	}
+}
+
+// TestReadsTicketOfflineKeys tests that passports and visas are verified with
+// statically configured key sets once the issuer can no longer be reached
+func TestReadsTicketOfflineKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "offline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	manifest, _ := json.Marshal(sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}))
+	ioutil.WriteFile(filepath.Join(dir, "tabulamuris.json"), manifest, 0644)
+
+	test, reset := newTicketTest(t, `{"htsgetConfig":{"manifests":{"provider":"file","dir":"`+dir+`"}}}`)
+	defer reset()
+	test.issuer.Close()
+
+	jwks, _ := json.Marshal(test.issuer.KeySet())
+	jwksFile := filepath.Join(dir, "jwks.json")
+	ioutil.WriteFile(jwksFile, jwks, 0644)
+	broker := test.issuer.Broker("htsget")
+	broker.JwksFile = jwksFile
+	htsconfig.AddPassportBroker(broker)
+	trustedIssuer := test.issuer.TrustedIssuer("tabulamuris")
+	trustedIssuer.Jwks = jwks
+	htsconfig.AddTrustedIssuer(trustedIssuer)
+	passport := test.passport(t, "alice", "tabulamuris")
+
+	tc := []struct {
+		dataset string
+		expCode int
+	}{
+		{"tabulamuris", http.StatusOK},
+		{"giab", http.StatusForbidden},
+	}
+
+	for _, c := range tc {
+		writer := test.get("/reads/"+c.dataset+"/tabulamuris.A1-B000168-3_57_F-1-1_R2", passport)
+		assert.Equal(t, c.expCode, writer.Code, c.dataset)
+	}
+}
+
+// TestReadsTicketQuotas tests that tickets for a controlled dataset are
+// refused once the subject has used up their quota, while other subjects and
+// public datasets are unaffected
+func TestReadsTicketQuotas(t *testing.T) {
+	test, reset := newTicketTest(t, "{}", sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+
+	dir, err := ioutil.TempDir("", "quotas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := htsquota.OpenStore(filepath.Join(dir, "quotas.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	htsquota.SetQuotas(htsquota.NewQuotas(store, htsquota.Limits{Window: time.Hour, MaxRequests: 2}))
+	defer htsquota.SetQuotas(nil)
+
+	tc := []struct {
+		dataset string
+		subject string
+		expCode int
+	}{
+		{"tabulamuris", "alice", http.StatusOK},
+		{"tabulamuris", "alice", http.StatusOK},
+		{"tabulamuris", "alice", http.StatusTooManyRequests},
+		{"tabulamuris", "bob", http.StatusOK},
+		{"tabulamuris-public", "alice", http.StatusOK},
+	}
+
+	for _, c := range tc {
+		writer := test.get("/reads/"+c.dataset+"/tabulamuris.A1-B000168-3_57_F-1-1_R2", test.passport(t, c.subject, "tabulamuris"))
+		assert.Equal(t, c.expCode, writer.Code, c.dataset+" "+c.subject)
+		if c.expCode == http.StatusTooManyRequests {
+			assert.NotEqual(t, "", writer.Header().Get("Retry-After"))
+			assert.Contains(t, writer.Body.String(), "TooManyRequests")
+		}
+	}
+
+	usage, _ := store.Get("alice", "tabulamuris")
+	assert.Equal(t, 2, usage.Requests)
+}
+
+// TestReadsTicketQuotasUnavailable tests that tickets for a controlled dataset
+// are refused while the configured quota store cannot be opened, while public
+// datasets are unaffected
+func TestReadsTicketQuotasUnavailable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quotas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	override := `{"htsgetConfig":{"quotas":{"file":"` + filepath.Join(dir, "missing", "quotas.db") + `","maxRequests":2}}}`
+	test, reset := newTicketTest(t, override, sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+	htsquota.SetQuotas(nil)
+	defer htsquota.SetQuotas(nil)
+
+	_, err = htsquota.GetQuotas()
+	assert.NotNil(t, err)
+
+	writer := test.get("/reads/tabulamuris/"+tabulamurisA1ID, test.passport(t, "alice", "tabulamuris"))
+	assert.Equal(t, http.StatusInternalServerError, writer.Code)
+	assert.Contains(t, writer.Body.String(), "quota could not be checked")
+
+	writer = test.get("/reads/tabulamuris-public/"+tabulamurisA1ID, "")
+	assert.Equal(t, http.StatusOK, writer.Code)
+}
+
+// sizedDao a data access object that only knows the size of its object
+type sizedDao struct {
+	htsdao.DataAccessObject
+	size int64
+}
+
+func (dao sizedDao) GetContentLength() int64 { return dao.size }
+
+// TestGrantedBytes tests that the urls of a ticket are counted by their byte
+// ranges, and that a url without one is counted as the whole object, so that
+// it cannot download more than the egress quota allows
+func TestGrantedBytes(t *testing.T) {
+	ranged := func(start int64, end int64) *htsticket.URL {
+		return htsticket.NewURL().SetURL("http://localhost:3000/reads/data/A1").SetHeaders(htsticket.NewHeaders().SetRangeHeader(start, end))
+	}
+	unranged := htsticket.NewURL().SetURL("http://localhost:3000/reads/data/A1").SetHeaders(htsticket.NewHeaders())
+
+	tc := []struct {
+		urls     []*htsticket.URL
+		size     int64
+		expBytes int64
+		expKnown bool
+	}{
+		{[]*htsticket.URL{ranged(0, 99), ranged(200, 299)}, 0, 200, true},
+		{[]*htsticket.URL{ranged(0, 99), unranged}, 1000, 1100, true},
+		{[]*htsticket.URL{unranged, unranged}, 1000, 2000, true},
+		// the size of the object cannot be found
+		{[]*htsticket.URL{ranged(0, 99), unranged}, 0, 100, false},
+		{[]*htsticket.URL{}, 0, 0, true},
+	}
+
+	for _, c := range tc {
+		bytes, known := grantedBytes(c.urls, sizedDao{size: c.size})
+		assert.Equal(t, c.expBytes, bytes)
+		assert.Equal(t, c.expKnown, known)
+	}
+}
+
+// TestReadsTicketPassportSources tests that reads tickets are issued for a
+// passport presented in the dedicated header, the POST body, or exchanged for
+// an opaque access token, and that the rest of the POST body is still read
+func TestReadsTicketPassportSources(t *testing.T) {
+	test, reset := newTicketTest(t, "{}", sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+	broker := test.issuer.Broker("htsget")
+	broker.IntrospectionEndpoint = test.issuer.IntrospectionEndpoint()
+	broker.UserinfoEndpoint = test.issuer.UserinfoEndpoint()
+	htsconfig.AddPassportBroker(broker)
+	htsconfig.AddTrustedIssuer(test.issuer.TrustedIssuer("tabulamuris"))
+
+	expiresAt := time.Now().Add(time.Hour)
+	visa := test.issuer.CompactVisa(fmt.Sprintf("c:tabulamuris e:%d u:alice", expiresAt.Unix()))
+	passport, err := test.issuer.Passport("alice", "htsget", expiresAt, visa)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opaque := test.issuer.OpaqueToken("alice", "htsget", expiresAt, visa)
+
+	tc := []struct {
+		method        string
+		authorization string
+		header        string
+		body          string
+		expCode       int
+	}{
+		{"GET", "", passport, "", http.StatusOK},
+		{"GET", "Bearer " + opaque, "", "", http.StatusOK},
+		{"POST", "", "", `{"passport": "` + passport + `", "format": "BAM"}`, http.StatusOK},
+		// the format is still read from the body after the passport
+		{"POST", "", "", `{"passport": "` + passport + `", "format": "CRAM"}`, http.StatusBadRequest},
+		{"POST", "Bearer " + opaque, "", `{"format": "BAM"}`, http.StatusOK},
+		{"GET", "Bearer not-a-token", "", "", http.StatusUnauthorized},
+	}
+
+	for i, c := range tc {
+		request := httptest.NewRequest(c.method, "/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2", strings.NewReader(c.body))
+		if c.authorization != "" {
+			request.Header.Set("Authorization", c.authorization)
+		}
+		if c.header != "" {
+			request.Header.Set("X-GA4GH-Passport", c.header)
+		}
+		writer := httptest.NewRecorder()
+		test.router.ServeHTTP(writer, request)
+		assert.Equal(t, c.expCode, writer.Code, i)
+	}
+}
+
+// TestReadsTicketRevocation tests that tickets are refused for visas their
+// issuer has revoked, and that the revocation state is written to the audit log
+func TestReadsTicketRevocation(t *testing.T) {
+	test, reset := newTicketTest(t, "{}", sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+
+	expiresAt := time.Now().Add(time.Hour)
+	revokedContent := fmt.Sprintf("c:tabulamuris e:%d u:alice", expiresAt.Unix())
+	validContent := fmt.Sprintf("c:tabulamuris e:%d u:bob", expiresAt.Unix())
+	revokedHash := sha256.Sum256([]byte(revokedContent))
+	test.issuer.Handle("/api/revoked", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		fmt.Fprintf(writer, `{"hashes": ["%s"]}`, hex.EncodeToString(revokedHash[:]))
+	}))
+	htsconfig.AddPassportBroker(test.issuer.Broker("htsget"))
+	trustedIssuer := test.issuer.TrustedIssuer("tabulamuris")
+	trustedIssuer.Revocation = &htsconfig.IssuerRevocation{Uri: test.issuer.URL() + "/api/revoked"}
+	htsconfig.AddTrustedIssuer(trustedIssuer)
+	sink := &recordingSink{}
+	htsaudit.SetAuditor(htsaudit.NewAuditor(sink, nil))
+	defer htsaudit.SetAuditor(nil)
+
+	tc := []struct {
+		subject string
+		content string
+		expCode int
+	}{
+		{"alice", revokedContent, http.StatusForbidden},
+		{"bob", validContent, http.StatusOK},
+	}
+
+	for _, c := range tc {
+		passport, err := test.issuer.Passport(c.subject, "htsget", expiresAt, test.issuer.CompactVisa(c.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		writer := test.get("/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2", passport)
+		assert.Equal(t, c.expCode, writer.Code, c.subject)
+	}
+
+	if assert.Equal(t, 2, len(sink.records)) {
+		denied := sink.records[0]
+		assert.Equal(t, htsaudit.OutcomeDenied, denied.Outcome)
+		assert.Equal(t, 0, len(denied.Visas))
+		if assert.Equal(t, 1, len(denied.RevokedVisas)) {
+			assert.Equal(t, hex.EncodeToString(revokedHash[:]), denied.RevokedVisas[0].Hash)
+			assert.Equal(t, htspassport.RevocationRevoked, denied.RevokedVisas[0].Revocation)
+		}
+
+		granted := sink.records[1]
+		assert.Equal(t, htsaudit.OutcomeGranted, granted.Outcome)
+		if assert.Equal(t, 1, len(granted.Visas)) {
+			assert.Equal(t, htspassport.RevocationNotRevoked, granted.Visas[0].Revocation)
+			assert.NotNil(t, granted.Visas[0].RevocationListAt)
+		}
+	}
+}
+
+// TestReadsTicketAccessWindows tests that manifest regions and artifacts are
+// only served within their access windows, and that requests for them outside
+// their windows are denied with the reason
+func TestReadsTicketAccessWindows(t *testing.T) {
+	releasedAt := time.Date(2021, 11, 2, 0, 0, 0, 0, time.UTC)
+	bounded := func(start int, end int, window htsmanifest.Window) htsmanifest.Region {
+		return htsmanifest.Region{Id: "1", Start: &start, End: &end, Window: window}
+	}
+	test, reset := newTicketTest(t, "{}", sampleManifest("tabulamuris", tabulamurisA1Path,
+		bounded(100, 200, htsmanifest.Window{}),
+		bounded(200, 300, htsmanifest.Window{NotBefore: &releasedAt})))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+	defer func() { manifestClock = time.Now }()
+	passport := test.passport(t, "alice", "tabulamuris")
+
+	tc := []struct {
+		now     time.Time
+		query   string
+		expCode int
+		expBody string
+	}{
+		{releasedAt.Add(-time.Hour), "referenceName=chr1&start=120&end=180", http.StatusOK, ""},
+		{releasedAt.Add(-time.Hour), "referenceName=chr1&start=150&end=250", http.StatusForbidden, "embargoed until 2021-11-02T00:00:00Z"},
+		{releasedAt, "referenceName=chr1&start=150&end=250", http.StatusOK, ""},
+	}
+
+	for _, c := range tc {
+		now := c.now
+		manifestClock = func() time.Time { return now }
+		writer := test.get("/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2?"+c.query, passport)
+		assert.Equal(t, c.expCode, writer.Code, c.query)
+		assert.Contains(t, writer.Body.String(), c.expBody, c.query)
+	}
+}
+
+// BenchmarkTicketRequestHandler measures the latency of ticket requests made
+// in a row with the same passport, with and without the passport cache
+func BenchmarkTicketRequestHandler(b *testing.B) {
+	test, reset := newTicketTest(b, "{}", sampleManifest("tabulamuris", tabulamurisA1Path, htsmanifest.Region{Id: "chr1"}))
+	defer reset()
+	test.issuer.Trust("htsget", "tabulamuris")
+
+	// passports typically carry visas for several datasets, all verified on each request
+	expiresAt := time.Now().Add(time.Hour)
+	visas := []map[string]interface{}{test.issuer.CompactVisa(fmt.Sprintf("c:tabulamuris e:%d u:alice", expiresAt.Unix()))}
+	for i := 0; i < 10; i++ {
+		visas = append(visas, test.issuer.CompactVisa(fmt.Sprintf("c:dataset%d e:%d u:alice", i, expiresAt.Unix())))
+	}
+	passport, err := test.issuer.Passport("alice", "htsget", expiresAt, visas...)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	bc := []struct {
+		name  string
+		cache *htspassport.PassportCache
+	}{
+		{"uncached", htspassport.NewPassportCache(0, 0)},
+		{"cached", htspassport.NewPassportCache(time.Minute, 1000)},
+	}
+
+	defer htspassport.SetPassportCache(nil)
+	for _, c := range bc {
+		htspassport.SetPassportCache(c.cache)
+		b.Run(c.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				writer := test.get("/reads/tabulamuris/tabulamuris.A1-B000168-3_57_F-1-1_R2?referenceName=chr1", passport)
+				if writer.Code != http.StatusOK {
+					b.Fatalf("unexpected status %d: %s", writer.Code, writer.Body.String())
+				}
+			}
+		})
+	}
+}
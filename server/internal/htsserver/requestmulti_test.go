@@ -40,6 +40,16 @@ var httpRequestMultiTC = []E2ETestCase{
 
 	// GET READS, NOTHING SPECIFIED
 
+	{
+		"GET",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		nil,
+		"",
+		"reads-tc-00.bam",
+	},
+
+	// GET READS WITHOUT A DATASET, SERVED FROM THE LEGACY DATASET
+
 	{
 		"GET",
 		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
@@ -52,7 +62,7 @@ var httpRequestMultiTC = []E2ETestCase{
 
 	{
 		"GET",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		[][]string{
 			[]string{"referenceName", "chr1"},
 			[]string{"start", "20000000"},
@@ -66,7 +76,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// GET READS, SPECIFY REGION
 	{
 		"GET",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		[][]string{
 			[]string{"referenceName", "chr1"},
 			[]string{"start", "20000000"},
@@ -79,7 +89,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// GET READS, SPECIFY FIELDS, TAGS
 	{
 		"GET",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		[][]string{
 			[]string{"fields", "QNAME,FLAG,SEQ,QUAL"},
 			[]string{"tags", "HI,NM"},
@@ -91,7 +101,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// GET READS, SPECIFY TAGS=""
 	{
 		"GET",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		[][]string{
 			[]string{"tags", ""},
 		},
@@ -102,7 +112,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// GET READS, SPECIFY NOTAGS
 	{
 		"GET",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		[][]string{
 			[]string{"fields", "QNAME,FLAG,SEQ,QUAL"},
 			[]string{"notags", "HI,NM"},
@@ -115,7 +125,7 @@ var httpRequestMultiTC = []E2ETestCase{
 
 	{
 		"POST",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		nil,
 		"{\"regions\":[{\"referenceName\":\"chr10\"},{\"referenceName\":\"chr13\"},{\"referenceName\":\"chr16\"}]}",
 		"reads-tc-06.bam",
@@ -124,7 +134,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// POST READS, SPECIFY REGIONS, FIELDS
 	{
 		"POST",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		nil,
 		"{\"fields\":[\"QNAME\",\"FLAG\",\"RNAME\",\"POS\"],\"regions\":[{\"referenceName\":\"chr7\"},{\"referenceName\":\"chr11\"}]}",
 		"reads-tc-07.bam",
@@ -133,7 +143,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// POST READS, SPECIFY REGIONS, FIELDS, TAGS
 	{
 		"POST",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		nil,
 		"{\"fields\":[\"RNAME\",\"POS\"],\"tags\":[\"MD\"],\"regions\":[{\"referenceName\":\"chr8\"},{\"referenceName\":\"chr12\"}]}",
 		"reads-tc-08.bam",
@@ -142,7 +152,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// POST READS, SPECIFY REGIONS, FIELDS, NOTAGS
 	{
 		"POST",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		nil,
 		"{\"fields\":[\"QNAME\",\"RNAME\",\"POS\",\"SEQ\",\"QUAL\"],\"notags\":[\"MD\"],\"regions\":[{\"referenceName\":\"chr5\"}]}",
 		"reads-tc-09.bam",
@@ -156,7 +166,7 @@ var httpRequestMultiTC = []E2ETestCase{
 
 	{
 		"GET",
-		"/variants/HG002_GIAB",
+		"/variants/giab-public/HG002_GIAB",
 		nil,
 		"",
 		"variants-tc-00.vcf.gz",
@@ -166,7 +176,7 @@ var httpRequestMultiTC = []E2ETestCase{
 
 	{
 		"GET",
-		"/variants/HG002_GIAB",
+		"/variants/giab-public/HG002_GIAB",
 		[][]string{
 			[]string{"referenceName", "22"},
 		},
@@ -178,7 +188,7 @@ var httpRequestMultiTC = []E2ETestCase{
 
 	{
 		"POST",
-		"/variants/HG002_GIAB",
+		"/variants/giab-public/HG002_GIAB",
 		nil,
 		"{}",
 		"variants-tc-00.vcf.gz",
@@ -187,7 +197,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// POST VARIANTS, SINGLE REGION SPECIFIED
 	{
 		"POST",
-		"/variants/HG002_GIAB",
+		"/variants/giab-public/HG002_GIAB",
 		nil,
 		"{\"format\":\"VCF\",\"regions\":[{\"referenceName\":\"10\",\"start\":60000000,\"end\":90000000}]}",
 		"variants-tc-02.vcf",
@@ -196,7 +206,7 @@ var httpRequestMultiTC = []E2ETestCase{
 	// POST VARIANTS, MULTI REGION SPECIFIED
 	{
 		"POST",
-		"/variants/HG002_GIAB",
+		"/variants/giab-public/HG002_GIAB",
 		nil,
 		"{\"format\":\"VCF\",\"regions\":[{\"referenceName\":\"10\",\"start\":60000000,\"end\":90000000},{\"referenceName\":\"11\",\"start\":70000000,\"end\":100000000},{\"referenceName\":\"12\",\"start\":80000000,\"end\":110000000}]}",
 		"variants-tc-03.vcf",
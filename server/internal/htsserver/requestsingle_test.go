@@ -1,16 +1,19 @@
 package htsserver
 
 import (
+	"bytes"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
 	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
+	"github.com/ga4gh/htsget-refserver/internal/htsticket"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -31,7 +34,7 @@ var httpRequestSingleTC = []struct {
 		nil,
 		"",
 		200,
-		"{\"id\":\"htsgetref.reads\",\"name\":\"GA4GH htsget reference server reads endpoint\",\"type\":{\"group\":\"org.ga4gh\",\"artifact\":\"htsget\",\"version\":\"1.2.0\"},\"description\":\"Stream alignment files (BAM/CRAM) according to GA4GH htsget protocol\",\"organization\":{\"name\":\"Global Alliance for Genomics and Health\",\"url\":\"https://ga4gh.org\"},\"contactUrl\":\"mailto:jeremy.adams@ga4gh.org\",\"documentationUrl\":\"https://ga4gh.org\",\"createdAt\":\"2020-09-01T12:00:00Z\",\"updatedAt\":\"2020-09-01T12:00:00Z\",\"environment\":\"test\",\"version\":\"1.4.1\",\"htsget\":{\"datatype\":\"reads\",\"formats\":[\"BAM\"],\"fieldsParameterEffective\":true,\"tagsParametersEffective\":true}}\n",
+		"{\"id\":\"htsgetref.reads\",\"name\":\"GA4GH htsget reference server reads endpoint\",\"type\":{\"group\":\"org.ga4gh\",\"artifact\":\"htsget\",\"version\":\"1.2.0\"},\"description\":\"Stream alignment files (BAM/CRAM) according to GA4GH htsget protocol\",\"organization\":{\"name\":\"Global Alliance for Genomics and Health\",\"url\":\"https://ga4gh.org\"},\"contactUrl\":\"mailto:jeremy.adams@ga4gh.org\",\"documentationUrl\":\"https://ga4gh.org\",\"createdAt\":\"2020-09-01T12:00:00Z\",\"updatedAt\":\"2020-09-01T12:00:00Z\",\"environment\":\"test\",\"version\":\"1.4.1\",\"htsget\":{\"datatype\":\"reads\",\"formats\":[\"BAM\",\"CRAM\"],\"fieldsParameterEffective\":true,\"tagsParametersEffective\":true,\"datasets\":[{\"id\":\"tabulamuris-public\",\"access\":\"public\"}]}}\n",
 	},
 	{
 		"GET",
@@ -40,9 +43,51 @@ var httpRequestSingleTC = []struct {
 		nil,
 		"",
 		200,
-		"{\"id\":\"htsgetref.variants\",\"name\":\"GA4GH htsget reference server variants endpoint\",\"type\":{\"group\":\"org.ga4gh\",\"artifact\":\"htsget\",\"version\":\"1.2.0\"},\"description\":\"Stream variant files (VCF/BCF) according to GA4GH htsget protocol\",\"organization\":{\"name\":\"Global Alliance for Genomics and Health\",\"url\":\"https://ga4gh.org\"},\"contactUrl\":\"mailto:jeremy.adams@ga4gh.org\",\"documentationUrl\":\"https://ga4gh.org\",\"createdAt\":\"2020-09-01T12:00:00Z\",\"updatedAt\":\"2020-09-01T12:00:00Z\",\"environment\":\"test\",\"version\":\"1.4.1\",\"htsget\":{\"datatype\":\"variants\",\"formats\":[\"VCF\"],\"fieldsParameterEffective\":false,\"tagsParametersEffective\":false}}\n",
+		"{\"id\":\"htsgetref.variants\",\"name\":\"GA4GH htsget reference server variants endpoint\",\"type\":{\"group\":\"org.ga4gh\",\"artifact\":\"htsget\",\"version\":\"1.2.0\"},\"description\":\"Stream variant files (VCF/BCF) according to GA4GH htsget protocol\",\"organization\":{\"name\":\"Global Alliance for Genomics and Health\",\"url\":\"https://ga4gh.org\"},\"contactUrl\":\"mailto:jeremy.adams@ga4gh.org\",\"documentationUrl\":\"https://ga4gh.org\",\"createdAt\":\"2020-09-01T12:00:00Z\",\"updatedAt\":\"2020-09-01T12:00:00Z\",\"environment\":\"test\",\"version\":\"1.4.1\",\"htsget\":{\"datatype\":\"variants\",\"formats\":[\"VCF\"],\"fieldsParameterEffective\":false,\"tagsParametersEffective\":false,\"datasets\":[{\"id\":\"giab-public\",\"access\":\"public\"}]}}\n",
 	},
 	/* GET READS TICKET CASES */
+	{
+		"GET",
+		"/reads/tabulamuris-public/NonExistentId",
+		nil,
+		nil,
+		"",
+		404,
+		"{\"htsget\":{\"error\":\"NotFound\",\"message\":\"The requested resource could not be associated with a registered data source\"}}\n",
+	},
+	{
+		"GET",
+		"/reads/tabulamuris-public/tabulamuris.object00001",
+		nil,
+		nil,
+		"",
+		404,
+		"{\"htsget\":{\"error\":\"NotFound\",\"message\":\"The requested resource was not found\"}}\n",
+	},
+
+	{
+		"GET",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		nil,
+		nil,
+		"",
+		200,
+		"{\"htsget\":{\"format\":\"BAM\",\"urls\":[{\"url\":\"http://localhost:3000/reads/bytes/tabulamuris.A1-B000168-3_57_F-1-1_R2\",\"headers\":{\"Range\":\"bytes=0-41157\"}}]}}\n",
+	},
+
+	{
+		"GET",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		[][]string{
+			[]string{"class", "header"},
+		},
+		nil,
+		"",
+		200,
+		"{\"htsget\":{\"format\":\"BAM\",\"urls\":[{\"url\":\"http://localhost:3000/reads/bytes/tabulamuris.A1-B000168-3_57_F-1-1_R2\",\"headers\":{\"Range\":\"bytes=0-2579\"},\"class\":\"header\"},{\"url\":\"http://localhost:3000/reads/bytes/tabulamuris.A1-B000168-3_57_F-1-1_R2\",\"headers\":{\"Range\":\"bytes=41130-41157\"},\"class\":\"body\"}]}}\n",
+	},
+
+	/* GET READS TICKET CASES WITHOUT A DATASET, SERVED FROM THE LEGACY DATASET */
 	{
 		"GET",
 		"/reads/NonExistentId",
@@ -69,7 +114,7 @@ var httpRequestSingleTC = []struct {
 		nil,
 		"",
 		200,
-		"{\"htsget\":{\"format\":\"BAM\",\"urls\":[{\"url\":\"http://localhost:3000/file-bytes\",\"headers\":{\"HtsgetFilePath\":\"../../data/test/sources/tabulamuris/A1-B000168-3_57_F-1-1_R2.mus.Aligned.out.sorted.bam\",\"Range\":\"bytes=0-41157\"}}]}}\n",
+		"{\"htsget\":{\"format\":\"BAM\",\"urls\":[{\"url\":\"http://localhost:3000/reads/bytes/tabulamuris.A1-B000168-3_57_F-1-1_R2\",\"headers\":{\"Range\":\"bytes=0-41157\"}}]}}\n",
 	},
 
 	{
@@ -81,12 +126,12 @@ var httpRequestSingleTC = []struct {
 		nil,
 		"",
 		200,
-		"{\"htsget\":{\"format\":\"BAM\",\"urls\":[{\"url\":\"http://localhost:3000/reads/data/tabulamuris.A1-B000168-3_57_F-1-1_R2?class=header\",\"headers\":{\"HtsgetBlockClass\":\"header\",\"HtsgetCurrentBlock\":\"0\",\"HtsgetTotalBlocks\":\"1\"},\"class\":\"header\"}]}}\n",
+		"{\"htsget\":{\"format\":\"BAM\",\"urls\":[{\"url\":\"http://localhost:3000/reads/bytes/tabulamuris.A1-B000168-3_57_F-1-1_R2\",\"headers\":{\"Range\":\"bytes=0-2579\"},\"class\":\"header\"},{\"url\":\"http://localhost:3000/reads/bytes/tabulamuris.A1-B000168-3_57_F-1-1_R2\",\"headers\":{\"Range\":\"bytes=41130-41157\"},\"class\":\"body\"}]}}\n",
 	},
 
 	{
 		"GET",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		[][]string{
 			[]string{"format", "BAM"},
 			[]string{"referenceName", "chr1"},
@@ -103,7 +148,7 @@ var httpRequestSingleTC = []struct {
 
 	{
 		"GET",
-		"/reads/tabulamuris.A1-B000168-3_57_F-1-1_R2",
+		"/reads/tabulamuris-public/tabulamuris.A1-B000168-3_57_F-1-1_R2",
 		[][]string{
 			[]string{"format", "BAM"},
 			[]string{"fields", "QNAME,FLAG,RNAME"},
@@ -119,15 +164,39 @@ var httpRequestSingleTC = []struct {
 
 	{
 		"GET",
-		"/variants/HG002_GIAB",
+		"/variants/giab-public/HG002_GIAB",
 		nil,
 		nil,
 		"",
 		200,
-		"{\"htsget\":{\"format\":\"VCF\",\"urls\":[{\"url\":\"http://localhost:3000/file-bytes\",\"headers\":{\"HtsgetFilePath\":\"../../data/test/sources/giab/HG002_GIAB.filtered.vcf.gz\",\"Range\":\"bytes=0-185237\"}}]}}\n",
+		"{\"htsget\":{\"format\":\"VCF\",\"urls\":[{\"url\":\"http://localhost:3000/variants/bytes/HG002_GIAB\",\"headers\":{\"Range\":\"bytes=0-185237\"}}]}}\n",
 	},
 }
 
+// unsignedTicket removes the expiry and signature from the urls of a written
+// ticket, as they change with the time it is issued at. other responses are
+// returned as they are
+func unsignedTicket(body string) string {
+	ticket := new(htsticket.Ticket)
+	if err := json.Unmarshal([]byte(body), ticket); err != nil || ticket.HTSget == nil || len(ticket.HTSget.URLS) == 0 {
+		return body
+	}
+	for _, ticketURL := range ticket.HTSget.URLS {
+		parsed, err := url.Parse(ticketURL.URL)
+		if err != nil || parsed.Query().Get(htsticket.SignatureParam) == "" {
+			continue
+		}
+		query := parsed.Query()
+		query.Del(htsticket.SignatureParam)
+		query.Del(htsticket.ExpiresParam)
+		parsed.RawQuery = query.Encode()
+		ticketURL.URL = parsed.String()
+	}
+	unsigned := new(bytes.Buffer)
+	json.NewEncoder(unsigned).Encode(ticket)
+	return unsigned.String()
+}
+
 func TestHTTPRequestSingle(t *testing.T) {
 
 	// configure dir in which temp and test comparator files are relative to
@@ -177,7 +246,7 @@ func TestHTTPRequestSingle(t *testing.T) {
 		writer := httptest.NewRecorder()
 		router.ServeHTTP(writer, request)
 		responseBodyBytes, _ := ioutil.ReadAll(writer.Body)
-		responseBody := string(responseBodyBytes)
+		responseBody := unsignedTicket(string(responseBodyBytes))
 
 		// assert status code, response body
 		assert.Equal(t, tc.expCode, writer.Code)
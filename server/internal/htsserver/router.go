@@ -1,14 +1,15 @@
 package htsserver
 
 import (
-	"github.com/xenitab/go-oidc-middleware/oidchttp"
-	"github.com/xenitab/go-oidc-middleware/options"
 	"net/http"
 	"strings"
 
 	"github.com/ga4gh/htsget-refserver/internal/assumerole"
 	"github.com/ga4gh/htsget-refserver/internal/htsconfig"
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htserror"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport"
+	"github.com/ga4gh/htsget-refserver/internal/htsticket"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/cors"
 )
@@ -19,7 +20,7 @@ func SetRouter() (*chi.Mux, error) {
 
 	// Setup CORS
 	corsAllowedHeaders := strings.Split(htsconfig.GetCorsAllowedHeaders(), ",")
-	allowedHeaders := append(corsAllowedHeaders, "HtsgetBlockClass", "HtsgetCurrentBlock", "HtsgetTotalBlocks", "HtsgetFilePath")
+	allowedHeaders := append(corsAllowedHeaders, "HtsgetBlockClass", "HtsgetCurrentBlock", "HtsgetTotalBlocks", "Range", htspassport.PassportHeader)
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   strings.Split(htsconfig.GetCorsAllowedOrigins(), ","),
 		AllowedMethods:   strings.Split(htsconfig.GetCorsAllowedMethods(), ","),
@@ -39,26 +40,40 @@ func SetRouter() (*chi.Mux, error) {
 
 	// if reads enabled, add reads routes
 	if htsconfig.IsEndpointEnabled(htsconstants.APIEndpointReadsTicket) {
-		router.Get(htsconstants.APIEndpointReadsTicket.String(), getReadsTicket)
-		router.Post(htsconstants.APIEndpointReadsTicket.String(), postReadsTicket)
-		router.Get(htsconstants.APIEndpointReadsData.String(), getReadsData)
+		// reads tickets are controlled exactly as variants tickets are - unless the dataset in the
+		// path is public, a passport from one of the configured passport brokers must carry a visa for it
+		readsAccess := passportUnlessPublic(htsconstants.APIEndpointReadsTicket)
+		router.With(readsAccess).Get(htsconstants.APIEndpointReadsTicket.String(), getReadsTicket)
+		router.With(readsAccess).Post(htsconstants.APIEndpointReadsTicket.String(), postReadsTicket)
+		// clients of the reads path without a dataset are served from the configured legacy dataset,
+		// with exactly the same access checks as if they had named it
+		legacyReads := legacyDataset(htsconstants.APIEndpointReadsTicket)
+		router.With(legacyReads, readsAccess).Get(htsconstants.LegacyReadsTicketPath, getReadsTicket)
+		router.With(legacyReads, readsAccess).Post(htsconstants.LegacyReadsTicketPath, postReadsTicket)
+		// the data endpoint streams whatever object it is pointed at, so is only served from the
+		// signed urls of a ticket, which has already been checked against the passport and manifest
+		router.With(signedURL).Get(htsconstants.APIEndpointReadsData.String(), getReadsData)
+		router.With(signedURL).Get(htsconstants.APIEndpointReadsBytes.String(), getReadsBytes)
 		router.Get(htsconstants.APIEndpointReadsServiceInfo.String(), getReadsServiceInfo)
+		router.With(htspassport.Handler).Get(htsconstants.APIEndpointReadsDatasets.String(), getReadsDatasets)
 	}
 
 	// if variants enabled, add variants routes
 	if htsconfig.IsEndpointEnabled(htsconstants.APIEndpointVariantsTicket) {
-		router.Handle(htsconstants.APIEndpointVariantsTicket.String(), oidchttp.New(http.HandlerFunc(getVariantsTicket),
-			options.WithIssuer("https://broker.nagim.dev"),
-		))
+		// variants tickets require a passport from one of the configured passport brokers, unless
+		// the dataset in the path is public
+		variantsAccess := passportUnlessPublic(htsconstants.APIEndpointVariantsTicket)
+		router.With(variantsAccess).Handle(htsconstants.APIEndpointVariantsTicket.String(), http.HandlerFunc(getVariantsTicket))
 
 		//router.Post(htsconstants.APIEndpointVariantsTicket.String(), postVariantsTicket)
 		//router.Get(htsconstants.APIEndpointVariantsData.String(), getVariantsData)
+		// byte ranges of local objects are served from the signed urls of a ticket, just as reads data
+		router.With(signedURL).Get(htsconstants.APIEndpointVariantsBytes.String(), getVariantsBytes)
 		router.Get(htsconstants.APIEndpointVariantsServiceInfo.String(), getVariantsServiceInfo)
+		// the datasets a passport grants access to can be listed before any ticket is requested
+		router.With(htspassport.Handler).Get(htsconstants.APIEndpointVariantsDatasets.String(), getVariantsDatasets)
 	}
 
-	// add the file bytes endpoint for streaming byte indices of local files
-	// router.Get(htsconstants.APIEndpointFileBytes.String(), getFileBytes)
-
 	// add the static files route
 	//docsDir := htsconfig.GetDocsDir()
 	//if docsDir != "" {
@@ -71,3 +86,60 @@ func SetRouter() (*chi.Mux, error) {
 
 	return router, nil
 }
+
+// passportUnlessPublic creates middleware requiring a verified passport on a
+// ticket route, except for requests to datasets configured as public
+func passportUnlessPublic(ep htsconstants.APIEndpoint) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		controlled := htspassport.Handler(next)
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if htsconfig.IsDatasetPublic(ep, chi.URLParam(request, "dataset")) {
+				next.ServeHTTP(writer, request)
+				return
+			}
+			controlled.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// legacyDataset creates middleware routing a ticket request without a dataset
+// in its path to the legacy dataset configured for the endpoint, as though the
+// dataset had been named. if none is configured, the request is refused,
+// pointing the client at the dataset-scoped path
+func legacyDataset(ep htsconstants.APIEndpoint) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			dataset := htsconfig.GetLegacyDataset(ep)
+			if dataset == "" {
+				msg := "Tickets must be requested from the path of a dataset, i.e. " + ep.String()
+				htserror.NotFound(writer, &msg)
+				return
+			}
+			// the dataset, and the id as the ticket handlers read it, are added to the path
+			// parameters, taking precedence over those matched by the route
+			urlParams := &chi.RouteContext(request.Context()).URLParams
+			urlParams.Add("*", chi.URLParam(request, "id"))
+			urlParams.Add("dataset", dataset)
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
+
+// signedURL creates middleware refusing requests to a data endpoint unless
+// they are made to an unexpired url signed by a ticket
+func signedURL(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		err := htsticket.VerifySignature(request, htsconfig.GetURLSigningKey(), urlClock())
+		if err == htsticket.ErrUnsigned {
+			msg := "Data is only served from the urls of a ticket"
+			htserror.InvalidAuthentication(writer, &msg)
+			return
+		}
+		if err != nil {
+			msg := "The data url is not valid: " + err.Error()
+			htserror.PermissionDenied(writer, &msg)
+			return
+		}
+		next.ServeHTTP(writer, request)
+	})
+}
@@ -0,0 +1,91 @@
+package htsserver
+
+import (
+	"github.com/ga4gh/htsget-refserver/internal/htsaudit"
+	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
+	"github.com/ga4gh/htsget-refserver/internal/htserror"
+	"github.com/ga4gh/htsget-refserver/internal/htspassport"
+	"github.com/ga4gh/htsget-refserver/internal/htsrequest"
+	"github.com/ga4gh/htsget-refserver/internal/htsticket"
+)
+
+// newAuditRecord starts the audit record of a ticket request, describing what
+// was requested
+func newAuditRecord(handler *requestHandler) *htsaudit.Record {
+	record := htsaudit.NewRecord()
+	record.Endpoint = "variants"
+	if handler.HtsReq.GetEndpoint() == htsconstants.APIEndpointReadsTicket {
+		record.Endpoint = "reads"
+	}
+	record.Dataset = handler.HtsReq.GetDataset()
+	record.Purpose = handler.HtsReq.GetPurpose()
+	record.ObjectID = handler.HtsReq.GetID()
+	record.Class = handler.HtsReq.GetClass()
+	record.RequestedRegions = auditRegions(handler.HtsReq.GetRegions())
+	return record
+}
+
+// auditRegions converts requested regions for the audit record, leaving out
+// bounds that were not requested
+func auditRegions(regions []*htsrequest.Region) []htsaudit.Region {
+	converted := make([]htsaudit.Region, 0)
+	for _, region := range regions {
+		auditRegion := htsaudit.Region{ReferenceName: region.GetReferenceName()}
+		if region.StartRequested() {
+			start := region.GetStart()
+			auditRegion.Start = &start
+		}
+		if region.EndRequested() {
+			end := region.GetEnd()
+			auditRegion.End = &end
+		}
+		converted = append(converted, auditRegion)
+	}
+	return converted
+}
+
+// auditWithheldRegions converts withheld ticket regions for the audit record
+func auditWithheldRegions(regions []*htsticket.Region) []htsaudit.Region {
+	converted := make([]htsaudit.Region, 0)
+	for _, region := range regions {
+		start := region.Start
+		converted = append(converted, htsaudit.Region{ReferenceName: region.ReferenceName, Start: &start, End: region.End})
+	}
+	return converted
+}
+
+// auditVisa adds a visa the decision was based on to the audit record
+func auditVisa(record *htsaudit.Record, visa *htspassport.Visa) {
+	record.Visas = append(record.Visas, visaUse(visa))
+}
+
+// auditRevokedVisa adds a visa rejected as revoked to the audit record
+func auditRevokedVisa(record *htsaudit.Record, visa *htspassport.Visa) {
+	record.RevokedVisas = append(record.RevokedVisas, visaUse(visa))
+}
+
+// visaUse converts a visa for the audit record, with its revocation state
+func visaUse(visa *htspassport.Visa) htsaudit.VisaUse {
+	use := htsaudit.VisaUse{Issuer: visa.Issuer, Datasets: visa.Datasets, Hash: visa.Hash, Revocation: visa.Revocation}
+	if !visa.RevocationListAt.IsZero() {
+		revocationListAt := visa.RevocationListAt.UTC()
+		use.RevocationListAt = &revocationListAt
+	}
+	return use
+}
+
+// auditDecision completes the audit record with the outcome of the ticket
+// request, and writes it to the audit log. a ticket must not be issued unless
+// its grant was recorded
+func auditDecision(record *htsaudit.Record, outcome string, reason string) error {
+	record.Outcome = outcome
+	record.Reason = reason
+	return htsaudit.Log(record)
+}
+
+// writeAuditError writes the htsget error for a ticket refused as its grant
+// could not be recorded in the audit log
+func writeAuditError(handler *requestHandler) {
+	msg := "The access decision could not be recorded, so the ticket is refused"
+	htserror.InternalServerError(handler.Writer, &msg)
+}
@@ -4,11 +4,14 @@
 package htsticket
 
 // Container holds the file format, urls of files for the client, and optionally
-// an MD5 digest resulting from the concatenation of url data blocks
+// an MD5 digest resulting from the concatenation of url data blocks. as an
+// htsget extension, it also lists any requested regions that were withheld
+// from the client
 type Container struct {
-	Format string `json:"format"`
-	URLS   []*URL `json:"urls"`
-	MD5    string `json:"md5,omitempty"`
+	Format          string    `json:"format"`
+	URLS            []*URL    `json:"urls"`
+	MD5             string    `json:"md5,omitempty"`
+	WithheldRegions []*Region `json:"withheldRegions,omitempty"`
 }
 
 // NewContainer instantiates and returns an empty ticket container
@@ -51,3 +54,9 @@ func (container *Container) SetURLS(urls []*URL) *Container {
 	container.URLS = urls
 	return container
 }
+
+// SetWithheldRegions sets the requested regions withheld from the client
+func (container *Container) SetWithheldRegions(regions []*Region) *Container {
+	container.WithheldRegions = regions
+	return container
+}
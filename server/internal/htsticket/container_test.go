@@ -63,3 +63,15 @@ func TestContainerSetUrls(t *testing.T) {
 		}
 	}
 }
+
+// TestContainerSetWithheldRegions tests SetWithheldRegions function
+func TestContainerSetWithheldRegions(t *testing.T) {
+	container := NewContainer()
+	regions := []*Region{
+		NewRegion("chr1", 0).SetEnd(100),
+		NewRegion("chr1", 200),
+	}
+	container.SetWithheldRegions(regions)
+	assert.Equal(t, 100, *container.WithheldRegions[0].End)
+	assert.Nil(t, container.WithheldRegions[1].End)
+}
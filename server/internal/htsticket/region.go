@@ -0,0 +1,27 @@
+// Package htsticket produces the htsget JSON response ticket
+//
+// Module region describes a genomic region reported in the ticket, such as a
+// requested region that was withheld from the client
+package htsticket
+
+// Region a genomic region on a single reference, from Start (inclusive) to End
+// (exclusive). a nil End leaves the region open to the end of the reference
+type Region struct {
+	ReferenceName string `json:"referenceName"`
+	Start         int    `json:"start"`
+	End           *int   `json:"end,omitempty"`
+}
+
+// NewRegion instantiates a region open to the end of the reference
+func NewRegion(referenceName string, start int) *Region {
+	region := new(Region)
+	region.ReferenceName = referenceName
+	region.Start = start
+	return region
+}
+
+// SetEnd sets the end of the region
+func (region *Region) SetEnd(end int) *Region {
+	region.End = &end
+	return region
+}
@@ -0,0 +1,110 @@
+// Package htsticket produces the htsget JSON response ticket
+//
+// Module signature signs the urls a ticket points back at this server with, so
+// that the data they download is only served to holders of the ticket, and only
+// until the urls expire
+package htsticket
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureParam query parameter holding the signature of a url
+const SignatureParam = "signature"
+
+// ExpiresParam query parameter holding the unix time a signed url expires at
+const ExpiresParam = "expires"
+
+// ErrUnsigned the request was not made to a signed url
+var ErrUnsigned = errors.New("the url is not signed")
+
+// ErrBadSignature the signature of the url does not match it, or its headers
+var ErrBadSignature = errors.New("the signature of the url does not match")
+
+// ErrExpired the signed url has expired
+var ErrExpired = errors.New("the signed url has expired")
+
+// Sign adds an expiry time and signature to the url, covering its path, query
+// and Range header. the url must point at this server, as only its path
+// relative to host is signed, so the signature survives proxies that strip a
+// path prefix
+//
+//	Type: URL
+// Arguments
+//	host (string): base url of this server, with a trailing slash
+//	key ([]byte): key the signature is computed with
+//	expires (time.Time): time the url is accepted until
+// Returns
+//	(error): the url could not be parsed
+func (urlObj *URL) Sign(host string, key []byte, expires time.Time) error {
+	parsed, err := url.Parse(urlObj.URL)
+	if err != nil {
+		return err
+	}
+	query := parsed.Query()
+	query.Del(SignatureParam)
+	query.Set(ExpiresParam, strconv.FormatInt(expires.Unix(), 10))
+
+	rangeHeader := ""
+	if urlObj.Headers != nil {
+		rangeHeader = urlObj.Headers.Range
+	}
+	hostURL, err := url.Parse(host)
+	if err != nil {
+		return err
+	}
+	path := strings.TrimPrefix(parsed.EscapedPath(), strings.TrimSuffix(hostURL.EscapedPath(), "/"))
+	query.Set(SignatureParam, signature(key, path, query, rangeHeader))
+	parsed.RawQuery = query.Encode()
+	urlObj.URL = parsed.String()
+	return nil
+}
+
+// VerifySignature checks that a request was made to a url signed with the key,
+// that has not expired, and with the Range header it was signed with
+//
+// Arguments
+//	request (*http.Request): request to a signed url
+//	key ([]byte): key the url was signed with
+//	now (time.Time): time the expiry of the url is checked against
+// Returns
+//	(error): ErrUnsigned, ErrBadSignature or ErrExpired if the request is refused
+func VerifySignature(request *http.Request, key []byte, now time.Time) error {
+	query := request.URL.Query()
+	signed := query.Get(SignatureParam)
+	if signed == "" {
+		return ErrUnsigned
+	}
+	query.Del(SignatureParam)
+
+	expected := signature(key, request.URL.EscapedPath(), query, request.Header.Get("Range"))
+	if !hmac.Equal([]byte(signed), []byte(expected)) {
+		return ErrBadSignature
+	}
+	expires, err := strconv.ParseInt(query.Get(ExpiresParam), 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if !now.Before(time.Unix(expires, 0)) {
+		return ErrExpired
+	}
+	return nil
+}
+
+// signature computes the signature of a url path, its query and its Range
+// header. the path is compared without its leading slash
+func signature(key []byte, path string, query url.Values, rangeHeader string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.TrimPrefix(path, "/")))
+	mac.Write([]byte("\n" + query.Encode()))
+	mac.Write([]byte("\n" + rangeHeader))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,54 @@
+// Package htsticket produces the htsget JSON response ticket
+//
+// Module signature_test tests signature
+package htsticket
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// signatureVerifyTC test cases for VerifySignature
+var signatureVerifyTC = []struct {
+	name       string
+	tamper     func(url string) string
+	rangeHdr   string
+	key        string
+	afterIssue time.Duration
+	exp        error
+}{
+	{"signed", nil, "bytes=0-2579", "key", time.Minute, nil},
+	{"unsigned", func(url string) string { return strings.SplitN(url, "?", 2)[0] + "?referenceName=chr1" }, "bytes=0-2579", "key", time.Minute, ErrUnsigned},
+	{"other path", func(url string) string { return strings.Replace(url, "A1", "A2", 1) }, "bytes=0-2579", "key", time.Minute, ErrBadSignature},
+	{"other query", func(url string) string { return strings.Replace(url, "chr1", "chr2", 1) }, "bytes=0-2579", "key", time.Minute, ErrBadSignature},
+	{"extended", func(url string) string { return strings.Replace(url, "expires=", "expires=9", 1) }, "bytes=0-2579", "key", time.Minute, ErrBadSignature},
+	{"other range", nil, "bytes=0-41157", "key", time.Minute, ErrBadSignature},
+	{"no range", nil, "", "key", time.Minute, ErrBadSignature},
+	{"other key", nil, "bytes=0-2579", "other", time.Minute, ErrBadSignature},
+	{"expired", nil, "bytes=0-2579", "key", 2 * time.Hour, ErrExpired},
+}
+
+// TestSignature tests Sign and VerifySignature
+func TestSignature(t *testing.T) {
+	issuedAt := time.Unix(1700000000, 0)
+	for _, tc := range signatureVerifyTC {
+		url := NewURL().SetURL("https://example.org/htsget/reads/bytes/A1?referenceName=chr1").SetHeaders(NewHeaders().SetRangeHeader(0, 2579))
+		assert.Nil(t, url.Sign("https://example.org/htsget/", []byte("key"), issuedAt.Add(time.Hour)))
+		assert.Contains(t, url.URL, "referenceName=chr1")
+
+		// the path prefix of the host is stripped by a proxy before the request reaches the router
+		signed := strings.TrimPrefix(url.URL, "https://example.org/htsget")
+		if tc.tamper != nil {
+			signed = tc.tamper(signed)
+		}
+		request := httptest.NewRequest("GET", signed, nil)
+		if tc.rangeHdr != "" {
+			request.Header.Set("Range", tc.rangeHdr)
+		}
+		assert.Equal(t, tc.exp, VerifySignature(request, []byte(tc.key), issuedAt.Add(tc.afterIssue)), tc.name)
+	}
+}
@@ -29,7 +29,14 @@ func (ticket *Ticket) setContainer(container *Container) *Ticket {
 // FinalizeTicket for /ticket endpoints, write the htsget ticket to the HTTP
 // writer
 func FinalizeTicket(format string, urls []*URL, writer http.ResponseWriter) {
-	container := NewContainer().setFormat(format).SetURLS(urls)
+	FinalizeClippedTicket(format, urls, nil, writer)
+}
+
+// FinalizeClippedTicket for /ticket endpoints, write the htsget ticket to the
+// HTTP writer, listing the requested regions that were withheld from the
+// urls
+func FinalizeClippedTicket(format string, urls []*URL, withheld []*Region, writer http.ResponseWriter) {
+	container := NewContainer().setFormat(format).SetURLS(urls).SetWithheldRegions(withheld)
 	ticket := newTicket().setContainer(container)
 	writer.Header().Set(htsconstants.ContentTypeHeader.String(), htsconstants.ContentTypeHeaderHtsgetJSON.String())
 	json.NewEncoder(writer).Encode(ticket)
@@ -55,3 +55,13 @@ func TestTicketFinalizeTicket(t *testing.T) {
 		assert.Equal(t, tc.expContentTypeHeader, writer.HeaderMap[htsconstants.ContentTypeHeader.String()][0])
 	}
 }
+
+// TestTicketFinalizeClippedTicket tests FinalizeClippedTicket function
+func TestTicketFinalizeClippedTicket(t *testing.T) {
+	writer := httptest.NewRecorder()
+	url := NewURL().SetURL("http://htsget.ga4gh.org/reads/data/object1")
+	withheld := []*Region{NewRegion("chr1", 0).SetEnd(100), NewRegion("chr1", 200)}
+
+	FinalizeClippedTicket("BAM", []*URL{url}, withheld, writer)
+	assert.Equal(t, "{\"htsget\":{\"format\":\"BAM\",\"urls\":[{\"url\":\"http://htsget.ga4gh.org/reads/data/object1\"}],\"withheldRegions\":[{\"referenceName\":\"chr1\",\"start\":0,\"end\":100},{\"referenceName\":\"chr1\",\"start\":200}]}}\n", writer.Body.String())
+}
@@ -4,6 +4,9 @@
 package htsticket
 
 import (
+	"strconv"
+	"strings"
+
 	"github.com/ga4gh/htsget-refserver/internal/htsconstants"
 )
 
@@ -50,3 +53,51 @@ func (urlObj *URL) SetClassBody() *URL {
 	urlObj.setClass(htsconstants.ClassBody)
 	return urlObj
 }
+
+// byteRange gets the first and last byte downloaded from the url, as given by
+// its Range header. ok is false if there is no Range header, or it cannot be
+// parsed
+func (urlObj *URL) byteRange() (start int64, end int64, ok bool) {
+	if urlObj.Headers == nil || !strings.HasPrefix(urlObj.Headers.Range, "bytes=") {
+		return 0, 0, false
+	}
+	bounds := strings.SplitN(strings.TrimPrefix(urlObj.Headers.Range, "bytes="), "-", 2)
+	if len(bounds) != 2 {
+		return 0, 0, false
+	}
+	start, err := strconv.ParseInt(bounds[0], 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	end, err = strconv.ParseInt(bounds[1], 10, 64)
+	if err != nil || end < start {
+		return 0, 0, false
+	}
+	return start, end, true
+}
+
+// ByteCount gets the number of bytes downloaded from the url, as given by its
+// Range header. ok is false if there is no Range header, or it cannot be
+// parsed, as the url may then download the whole object
+func (urlObj *URL) ByteCount() (n int64, ok bool) {
+	start, end, ok := urlObj.byteRange()
+	if !ok {
+		return 0, false
+	}
+	return end - start + 1, true
+}
+
+// Covers checks if the url already downloads all of the bytes of another url,
+// i.e. both point at the same file and the other's range lies within its own.
+// a nil url covers nothing
+func (urlObj *URL) Covers(other *URL) bool {
+	if urlObj == nil || other == nil || urlObj.URL != other.URL || urlObj.Headers == nil || other.Headers == nil {
+		return false
+	}
+	if urlObj.Headers.FilePath != other.Headers.FilePath {
+		return false
+	}
+	start, end, ok := urlObj.byteRange()
+	otherStart, otherEnd, otherOk := other.byteRange()
+	return ok && otherOk && start <= otherStart && otherEnd <= end
+}
@@ -26,6 +26,41 @@ var urlSetHeadersTC = []struct {
 	{"1", "10", "./gatk/test1.bam"},
 }
 
+// urlByteCountTC test cases for ByteCount
+var urlByteCountTC = []struct {
+	headers *Headers
+	exp     int64
+	expOk   bool
+}{
+	{NewHeaders().SetRangeHeader(0, 65535), 65536, true},
+	{NewHeaders().SetRangeHeader(1000, 1000), 1, true},
+	{&Headers{Range: "bytes=1000-"}, 0, false},
+	{&Headers{Range: "bytes=2000-1000"}, 0, false},
+	{&Headers{Range: "items=0-10"}, 0, false},
+	{NewHeaders(), 0, false},
+	{nil, 0, false},
+}
+
+// urlCoversTC test cases for Covers
+var urlCoversTC = []struct {
+	url, other *URL
+	exp        bool
+}{
+	{fileBytesURL("a.bam", 0, 999), fileBytesURL("a.bam", 972, 999), true},
+	{fileBytesURL("a.bam", 0, 999), fileBytesURL("a.bam", 0, 999), true},
+	{fileBytesURL("a.bam", 0, 971), fileBytesURL("a.bam", 972, 999), false},
+	{fileBytesURL("a.bam", 0, 999), fileBytesURL("b.bam", 972, 999), false},
+	{fileBytesURL("a.bam", 0, 999), NewURL().SetURL("http://localhost:3000/file-bytes"), false},
+	{fileBytesURL("a.bam", 0, 999), nil, false},
+	{nil, fileBytesURL("a.bam", 972, 999), false},
+}
+
+// fileBytesURL gets a file-bytes url for a range of a file
+func fileBytesURL(filePath string, start int64, end int64) *URL {
+	headers := NewHeaders().SetFilePathHeader(filePath).SetRangeHeader(start, end)
+	return NewURL().SetURL("http://localhost:3000/file-bytes").SetHeaders(headers)
+}
+
 // TestUrlSetURL tests SetURL function
 func TestUrlSetURL(t *testing.T) {
 	for _, tc := range urlSetURLTC {
@@ -66,3 +101,20 @@ func TestUrlSetClass(t *testing.T) {
 		assert.Equal(t, exp[i], url.Class)
 	}
 }
+
+// TestUrlByteCount tests ByteCount function
+func TestUrlByteCount(t *testing.T) {
+	for _, tc := range urlByteCountTC {
+		url := NewURL().SetHeaders(tc.headers)
+		n, ok := url.ByteCount()
+		assert.Equal(t, tc.exp, n)
+		assert.Equal(t, tc.expOk, ok)
+	}
+}
+
+// TestUrlCovers tests Covers function
+func TestUrlCovers(t *testing.T) {
+	for _, tc := range urlCoversTC {
+		assert.Equal(t, tc.exp, tc.url.Covers(tc.other))
+	}
+}
@@ -97,6 +97,7 @@ func (i *Index) Add(r Record, c bgzf.Chunk, placed, mapped bool) error {
 	if !ok {
 		rid = len(i.refNames)
 		i.refNames = append(i.refNames, refName)
+		i.nameMap[refName] = rid
 	}
 	shim := tabixShim{id: rid, start: r.Start(), end: r.End()}
 	return i.idx.Add(shim, internal.BinFor(r.Start(), r.End()), c, placed, mapped)
@@ -115,33 +116,6 @@ func (i *Index) Chunks(ref string, beg, end int) ([]bgzf.Chunk, error) {
 	return adjacent(chunks), nil
 }
 
-//TODO: this is very shoddy - need to funadmentally fix
-
-// Chunks returns a []bgzf.Chunk that corresponds to the given genomic interval.
-func (i *Index) ChunksWithNext(ref string, beg, end int) ([]bgzf.Chunk, int64, error) {
-	id, ok := i.nameMap[ref]
-	if !ok {
-		return nil, 0, index.ErrNoReference
-	}
-	chunks, err := i.idx.Chunks(id, beg, end)
-	if err != nil {
-		return nil, 0, err
-	}
-	// locate the next chunks in the index and search through them until we get to
-	// the next file position (which defines our file block)
-	nextChunks, err := i.idx.Chunks(id, end+1, end+10000000)
-	if err != nil {
-		return nil, 0, err
-	}
-	for _, c := range nextChunks {
-		if c.Begin.File != chunks[0].End.File {
-			return adjacent(chunks), c.Begin.File, nil
-		}
-	}
-
-	return adjacent(chunks), 0, nil
-}
-
 var adjacent = index.Adjacent
 
 // MergeChunks applies the given MergeStrategy to all bins in the Index.